@@ -0,0 +1,124 @@
+package log
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// anonymized are the fields that Anonymize can replace, with the named words.
+var anonymized = []string{"process", "user", "group", "host", "ip", "message"}
+
+// Anonymize returns a transform replacing the values of fields by pseudonyms
+// computed with HMAC-SHA256 and key. The same value always gives the same
+// pseudonym, whatever its field, so that entries can still be joined on the
+// anonymized fields. IP addresses (ip, and the typed named words) are replaced
+// by addresses of the private ranges 10.0.0.0/8 and fd00::/8. host replaces
+// the whole address. The line of the entries is cleared since it has the
+// original values.
+func Anonymize(key []byte, fields ...string) (func(Entry) Entry, error) {
+	if len(key) == 0 {
+		return nil, errors.New("anonymize: empty key")
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("anonymize: no fields given")
+	}
+	for _, f := range fields {
+		if !strings.HasPrefix(f, "named.") && !isAnonymized(f) {
+			return nil, fmt.Errorf("anonymize: %s: field can not be anonymized", f)
+		}
+	}
+	a := anonymizer{key: key}
+	return func(e Entry) Entry {
+		for _, f := range fields {
+			a.replace(&e, f)
+		}
+		e.Line = ""
+		return e
+	}, nil
+}
+
+type anonymizer struct {
+	key []byte
+}
+
+func (a anonymizer) replace(e *Entry, field string) {
+	switch field {
+	case "process":
+		e.Process = a.pseudonym(e.Process)
+	case "user":
+		e.User = a.pseudonym(e.User)
+	case "group":
+		e.Group = a.pseudonym(e.Group)
+	case "message":
+		e.Message = a.pseudonym(e.Message)
+	case "host":
+		e.Host = a.pseudonym(e.Host)
+		e.Addr.Name = a.pseudonym(e.Addr.Name)
+		e.Addr.IP = a.address(e.Addr.IP)
+	case "ip":
+		if e.Addr.IP == nil {
+			break
+		}
+		ip := a.address(e.Addr.IP)
+		e.Host = strings.Replace(e.Host, e.Addr.IP.String(), ip.String(), -1)
+		e.Addr.IP = ip
+	default:
+		name := field[len("named."):]
+		if ip, ok := e.Values[name].(net.IP); ok {
+			ip = a.address(ip)
+			e.Values[name] = ip
+			e.setNamed(name, ip.String())
+			break
+		}
+		str := fieldString(getField(*e, field))
+		if str == "" {
+			break
+		}
+		delete(e.Values, name)
+		e.setNamed(name, a.pseudonym(str))
+	}
+}
+
+// pseudonym gives the first 12 hexadecimal digits of the HMAC of str. Empty
+// values are left empty.
+func (a anonymizer) pseudonym(str string) string {
+	if str == "" {
+		return ""
+	}
+	return hex.EncodeToString(a.sum(str)[:6])
+}
+
+// address gives an IP address of a private range of the family of ip.
+func (a anonymizer) address(ip net.IP) net.IP {
+	if ip == nil {
+		return nil
+	}
+	sum := a.sum(ip.String())
+	if v4 := ip.To4(); v4 != nil {
+		return net.IPv4(10, sum[0], sum[1], sum[2]).To4()
+	}
+	addr := make(net.IP, net.IPv6len)
+	addr[0] = 0xfd
+	copy(addr[1:], sum)
+	return addr
+}
+
+func (a anonymizer) sum(str string) []byte {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(str))
+	return mac.Sum(nil)
+}
+
+func isAnonymized(field string) bool {
+	for _, f := range anonymized {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,200 @@
+package log
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrClosed = errors.New("writer closed")
+
+type Policy int
+
+const (
+	PolicyBlock Policy = iota
+	PolicyDrop
+)
+
+type AsyncOption func(*AsyncWriter)
+
+func WithQueue(size int) AsyncOption {
+	return func(a *AsyncWriter) {
+		if size > 0 {
+			a.queue = size
+		}
+	}
+}
+
+func WithBatch(size int) AsyncOption {
+	return func(a *AsyncWriter) {
+		if size > 0 {
+			a.batch = size
+		}
+	}
+}
+
+func WithPolicy(p Policy) AsyncOption {
+	return func(a *AsyncWriter) {
+		a.policy = p
+	}
+}
+
+// BatchWriter can be implemented by writers that are able to send multiple
+// entries at once (eg, network sinks).
+type BatchWriter interface {
+	WriteBatch([]Entry) error
+}
+
+type item struct {
+	entry Entry
+	ack   chan error
+}
+
+type AsyncWriter struct {
+	inner  Writer
+	queue  int
+	batch  int
+	policy Policy
+
+	items  chan item
+	done   chan struct{}
+	once   sync.Once
+	state  sync.RWMutex
+	closed bool
+
+	mu      sync.Mutex
+	err     error
+	dropped int
+}
+
+func Async(w Writer, opts ...AsyncOption) *AsyncWriter {
+	a := AsyncWriter{
+		inner: w,
+		queue: 1024,
+		batch: 64,
+		done:  make(chan struct{}),
+	}
+	for _, o := range opts {
+		o(&a)
+	}
+	a.items = make(chan item, a.queue)
+	go a.run()
+	return &a
+}
+
+func (a *AsyncWriter) Write(e Entry) error {
+	a.state.RLock()
+	defer a.state.RUnlock()
+	if a.closed {
+		return ErrClosed
+	}
+	if err := a.error(); err != nil {
+		return err
+	}
+	if a.policy == PolicyBlock {
+		a.items <- item{entry: e}
+		return nil
+	}
+	select {
+	case a.items <- item{entry: e}:
+	default:
+		a.mu.Lock()
+		a.dropped++
+		a.mu.Unlock()
+	}
+	return nil
+}
+
+// Dropped returns the number of entries discarded because the queue was full.
+func (a *AsyncWriter) Dropped() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.dropped
+}
+
+func (a *AsyncWriter) Flush() error {
+	a.state.RLock()
+	if a.closed {
+		a.state.RUnlock()
+		return ErrClosed
+	}
+	ack := make(chan error, 1)
+	a.items <- item{ack: ack}
+	a.state.RUnlock()
+	return <-ack
+}
+
+func (a *AsyncWriter) Close() error {
+	a.once.Do(func() {
+		a.state.Lock()
+		a.closed = true
+		close(a.items)
+		a.state.Unlock()
+	})
+	<-a.done
+	err := a.error()
+	if e := CloseWriter(a.inner); err == nil {
+		err = e
+	}
+	return err
+}
+
+func (a *AsyncWriter) run() {
+	defer close(a.done)
+	batch := make([]Entry, 0, a.batch)
+	for it := range a.items {
+		if it.ack == nil {
+			batch = append(batch, it.entry)
+		}
+		if it.ack == nil && len(batch) < a.batch && len(a.items) > 0 {
+			continue
+		}
+		a.write(batch)
+		batch = batch[:0]
+		if it.ack != nil {
+			it.ack <- a.flush()
+		}
+	}
+	a.write(batch)
+	a.flush()
+}
+
+func (a *AsyncWriter) write(es []Entry) {
+	if len(es) == 0 || a.error() != nil {
+		return
+	}
+	var err error
+	if b, ok := a.inner.(BatchWriter); ok {
+		err = b.WriteBatch(es)
+	} else {
+		for _, e := range es {
+			if err = a.inner.Write(e); err != nil {
+				break
+			}
+		}
+	}
+	a.setError(err)
+}
+
+func (a *AsyncWriter) flush() error {
+	if f, ok := a.inner.(interface{ Flush() error }); ok {
+		a.setError(f.Flush())
+	}
+	return a.error()
+}
+
+func (a *AsyncWriter) error() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+func (a *AsyncWriter) setError(err error) {
+	if err == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err == nil {
+		a.err = err
+	}
+}
@@ -0,0 +1,61 @@
+//go:build !minimal
+// +build !minimal
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/midbel/log"
+	"github.com/midbel/log/sink/webhook"
+)
+
+// openAlert creates the writer posting alerts to url for the entries matching
+// filter. Options are given as format=slack|teams|generic, window=duration,
+// rate=n/duration and lines=n separated by commas.
+func openAlert(url, filter, options, pattern string) (log.Writer, error) {
+	var opts []webhook.Option
+	for _, opt := range strings.Split(options, ",") {
+		k, v := splitOption(opt)
+		switch k {
+		case "":
+		case "format":
+			f, err := webhook.ParseFormat(v)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, webhook.WithFormat(f))
+		case "window":
+			d, err := log.ParseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("alert: %s: invalid window", v)
+			}
+			opts = append(opts, webhook.WithWindow(d))
+		case "rate":
+			x := strings.IndexByte(v, '/')
+			if x < 0 {
+				return nil, fmt.Errorf("alert: %s: rate should be n/duration", v)
+			}
+			n, err := strconv.Atoi(v[:x])
+			if err != nil {
+				return nil, fmt.Errorf("alert: %s: invalid rate", v)
+			}
+			d, err := log.ParseDuration(v[x+1:])
+			if err != nil {
+				return nil, fmt.Errorf("alert: %s: invalid rate", v)
+			}
+			opts = append(opts, webhook.WithRateLimit(n, d))
+		case "lines":
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("alert: %s: invalid number", v)
+			}
+			opts = append(opts, webhook.WithLines(n))
+		default:
+			return nil, fmt.Errorf("alert: %s: unknown option", k)
+		}
+	}
+	return webhook.Alert(filter, url, pattern, opts...)
+}
@@ -0,0 +1,14 @@
+//go:build minimal
+// +build minimal
+
+package main
+
+import (
+	"errors"
+
+	"github.com/midbel/log"
+)
+
+func openAlert(_, _, _, _ string) (log.Writer, error) {
+	return nil, errors.New("alerts are not available in the minimal build")
+}
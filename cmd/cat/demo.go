@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/midbel/log"
+)
+
+//go:embed demo/*.log
+var samples embed.FS
+
+const syslog = "%t(%b %d %H:%M:%S) %h(%h) %n[%p]: %m"
+
+type step struct {
+	Title   string
+	File    string
+	Input   string
+	Output  string
+	Filter  string
+	Options []log.Option
+	Count   int
+	Stats   bool
+}
+
+var steps = []step{
+	{
+		Title:  "parsing: entries are extracted with the input pattern, lines not matching it are skipped",
+		File:   "demo/app.log",
+		Input:  input,
+		Output: output,
+		Count:  8,
+	},
+	{
+		Title:  "filtering: only warnings are kept",
+		File:   "demo/app.log",
+		Input:  input,
+		Output: output,
+		Filter: "eq(level, WARNING)",
+		Count:  3,
+	},
+	{
+		Title:  "filtering: functions can be combined",
+		File:   "demo/app.log",
+		Input:  input,
+		Output: output,
+		Filter: "and(eq(process, nginx), ge(time, 2021-03-01T08:01:00Z))",
+		Count:  2,
+	},
+	{
+		Title: "stats: number of entries per level",
+		File:  "demo/app.log",
+		Input: input,
+		Count: 8,
+		Stats: true,
+	},
+	{
+		Title:  "output: the output pattern controls which fields are written and how",
+		File:   "demo/app.log",
+		Input:  input,
+		Output: "%t(%H:%M:%S) %l %u@%h %n: %m",
+		Count:  8,
+	},
+	{
+		Title:   "time: syslog timestamps have no year, it is set with -year and follows the new year",
+		File:    "demo/syslog.log",
+		Input:   syslog,
+		Output:  "%t(%y-%m-%d %H:%M:%S) %h %n[%p]: %m",
+		Options: []log.Option{log.WithYear(2020)},
+		Count:   4,
+	},
+}
+
+func runDemo(w io.Writer) error {
+	var (
+		in     = bufio.NewReader(os.Stdin)
+		prompt = isTerminal(os.Stdin)
+	)
+	for i, s := range steps {
+		fmt.Fprintf(w, "# %d/%d %s\n", i+1, len(steps), s.Title)
+		fmt.Fprintf(w, "#   input:  %s\n", s.Input)
+		if s.Output != "" {
+			fmt.Fprintf(w, "#   output: %s\n", s.Output)
+		}
+		if s.Filter != "" {
+			fmt.Fprintf(w, "#   filter: %s\n", s.Filter)
+		}
+		if err := s.run(w); err != nil {
+			return fmt.Errorf("step %d (%s): %w", i+1, s.File, err)
+		}
+		if prompt && i < len(steps)-1 {
+			fmt.Fprint(w, "\npress enter to continue...")
+			in.ReadString('\n')
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+func (s step) run(w io.Writer) error {
+	data, err := samples.ReadFile(s.File)
+	if err != nil {
+		return err
+	}
+	rs, err := log.NewReader(bytes.NewReader(data), s.Input, s.Filter, s.Options...)
+	if err != nil {
+		return err
+	}
+	es, err := rs.ReadAll()
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if len(es) != s.Count {
+		return fmt.Errorf("%d entries found, %d expected", len(es), s.Count)
+	}
+	if s.Stats {
+		printLevels(w, es)
+		return nil
+	}
+	ws, err := log.NewWriter(w, s.Output)
+	if err != nil {
+		return err
+	}
+	for _, e := range es {
+		if err := ws.Write(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func printLevels(w io.Writer, es []log.Entry) {
+	top, _ := log.TopN("level", 0)
+	for _, e := range es {
+		top.Write(e)
+	}
+	printTop(w, top)
+}
+
+func isTerminal(f *os.File) bool {
+	i, err := f.Stat()
+	return err == nil && i.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/midbel/log"
+)
+
+const (
+	autoInput  = "auto"
+	eventInput = "winxml"
+)
+
+// detectInput guesses the input preset from the first lines of the file or,
+// when watching, of the first file matching the glob. The file is rewound
+// after.
+func detectInput(r *os.File, w *log.Watcher) (string, error) {
+	if r == nil {
+		files := w.Files()
+		if len(files) == 0 {
+			return "", fmt.Errorf("no file to detect input format")
+		}
+		f, err := os.Open(files[0])
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		r = f
+	}
+	name, _, err := log.DetectFormat(r)
+	if err != nil {
+		return "", err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("%s: input can not be rewound after detecting its format", r.Name())
+	}
+	return name, nil
+}
+
+// detectRotated detects the format of the rotation set of base from its
+// oldest file.
+func detectRotated(base string) (string, error) {
+	rot, err := log.OpenRotated(base)
+	if err != nil {
+		return "", err
+	}
+	defer rot.Close()
+	name, _, err := log.DetectFormat(rot)
+	return name, err
+}
+
+// convertInput translates the format of the Python logging module, the
+// pattern of log4j/logback or the grok expression given with their prefix into
+// an input pattern. The grok patterns are also looked up in the definitions of
+// the grok file when given.
+func convertInput(in, grok string) (string, error) {
+	switch {
+	case strings.HasPrefix(in, "grok:"):
+		var defs map[string]string
+		if grok != "" {
+			f, err := os.Open(grok)
+			if err != nil {
+				return "", err
+			}
+			defer f.Close()
+			if defs, err = log.ParseGrokDefinitions(f); err != nil {
+				return "", fmt.Errorf("%s: %w", grok, err)
+			}
+		}
+		return log.FromGrok(strings.TrimPrefix(in, "grok:"), defs)
+	case strings.HasPrefix(in, "python:"):
+		return log.FromPython(strings.TrimPrefix(in, "python:"))
+	case strings.HasPrefix(in, "log4j:"):
+		return log.FromLog4j(strings.TrimPrefix(in, "log4j:"))
+	case strings.HasPrefix(in, "logback:"):
+		return log.FromLog4j(strings.TrimPrefix(in, "logback:"))
+	default:
+		return in, nil
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/midbel/log"
+)
+
+// runDiff compares the entries of the old and the new file and prints the keys
+// only found in the old one prefixed by - and the ones only found in the new
+// one prefixed by +, with their number of entries.
+func runDiff(w io.Writer, old, new, keys string, open func(io.Reader) (*log.Reader, error)) error {
+	var fields []string
+	if keys != "" {
+		fields = strings.Split(keys, ",")
+	}
+	a, err := openDiff(old, open)
+	if err != nil {
+		return err
+	}
+	b, err := openDiff(new, open)
+	if err != nil {
+		return err
+	}
+	c, err := log.Diff(a, b, fields)
+	if err != nil {
+		return err
+	}
+	for _, d := range c.Removed {
+		fmt.Fprintf(w, "- %6d %s\n", d.Count, d.Key)
+	}
+	for _, d := range c.Added {
+		fmt.Fprintf(w, "+ %6d %s\n", d.Count, d.Key)
+	}
+	return nil
+}
+
+func openDiff(file string, open func(io.Reader) (*log.Reader, error)) (*log.Reader, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	// the file is read until the end of cat
+	return open(f)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/midbel/log"
+)
+
+// readFiles creates the reader giving the entries of all the files, parsed by
+// the readers created with open. Entries are ordered by time with merge or
+// given file after file otherwise. With rotated, each file is read after its
+// rotated files.
+func readFiles(files []string, jobs int, merge, rotated bool, open func(io.Reader) (*log.Reader, error)) (*log.Reader, func(), error) {
+	var (
+		rs []*log.Reader
+		fs []io.ReadCloser
+	)
+	closeAll := func() {
+		for _, f := range fs {
+			f.Close()
+		}
+	}
+	for _, file := range files {
+		var (
+			f   io.ReadCloser
+			err error
+		)
+		if rotated {
+			f, err = log.OpenRotated(file)
+		} else {
+			f, err = os.Open(file)
+		}
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		fs = append(fs, f)
+		r, err := open(f)
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		rs = append(rs, r)
+	}
+	var r *log.Reader
+	if merge {
+		r = log.Merge(rs...)
+	} else {
+		r = log.Concat(jobs, rs...)
+	}
+	return r, func() {
+		r.Close()
+		closeAll()
+	}, nil
+}
+
+// sectionWriter writes a header with the name of the file before the entries
+// of each file.
+type sectionWriter struct {
+	log.Writer
+	out  io.Writer
+	file string
+	seen bool
+}
+
+func withSections(w log.Writer, out io.Writer) log.Writer {
+	return &sectionWriter{Writer: w, out: out}
+}
+
+func (s *sectionWriter) Write(e log.Entry) error {
+	if !s.seen || e.Source.File != s.file {
+		// the entries kept by a buffered writer go before the header
+		if f, ok := s.Writer.(interface{ Flush() error }); ok {
+			if err := f.Flush(); err != nil {
+				return err
+			}
+		}
+		if s.seen {
+			fmt.Fprintln(s.out)
+		}
+		fmt.Fprintf(s.out, "==> %s <==\n", e.Source.File)
+		s.file, s.seen = e.Source.File, true
+	}
+	return s.Writer.Write(e)
+}
+
+func (s *sectionWriter) Flush() error {
+	if f, ok := s.Writer.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func (s *sectionWriter) Close() error {
+	return log.CloseWriter(s.Writer)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/midbel/log"
+)
+
+type filterList []string
+
+func (f *filterList) String() string {
+	return strings.Join(*f, " && ")
+}
+
+func (f *filterList) Set(str string) error {
+	*f = append(*f, str)
+	return nil
+}
+
+// deriveList holds the derived fields given as name=expression.
+type deriveList []string
+
+func (d *deriveList) String() string {
+	return strings.Join(*d, ", ")
+}
+
+func (d *deriveList) Set(str string) error {
+	*d = append(*d, str)
+	return nil
+}
+
+func (d deriveList) apply(r *log.Reader) error {
+	for _, str := range d {
+		x := strings.IndexByte(str, '=')
+		if x <= 0 {
+			return fmt.Errorf("%s: derived field should be name=expression", str)
+		}
+		fn, err := log.CompileDerive(str[x+1:])
+		if err != nil {
+			return err
+		}
+		r.Derive(strings.TrimSpace(str[:x]), fn)
+	}
+	return nil
+}
+
+// routeList holds the routes given as filter=>destination.
+type routeList []string
+
+func (r *routeList) String() string {
+	return strings.Join(*r, ", ")
+}
+
+func (r *routeList) Set(str string) error {
+	*r = append(*r, str)
+	return nil
+}
+
+// writer creates the Writer sending the entries to the destinations of the
+// routes, others getting the entries matching none of them. Destinations are
+// files written with pattern or sink URIs.
+func (r routeList) writer(others log.Writer, pattern string, opts ...log.WriterOption) (log.Writer, error) {
+	var rules []log.Rule
+	for _, str := range r {
+		x := strings.LastIndex(str, "=>")
+		if x < 0 {
+			return nil, fmt.Errorf("%s: route should be filter=>destination", str)
+		}
+		var (
+			w    log.Writer
+			err  error
+			dest = strings.TrimSpace(str[x+2:])
+		)
+		if strings.Contains(dest, "://") {
+			w, err = log.OpenSink(dest)
+		} else {
+			w, err = openRoute(dest, pattern, opts...)
+		}
+		if err == nil && w == nil {
+			err = fmt.Errorf("%s: route has no destination", str)
+		}
+		if err != nil {
+			for _, r := range rules {
+				log.CloseWriter(r.To)
+			}
+			return nil, err
+		}
+		rules = append(rules, log.Rule{Filter: str[:x], To: w})
+	}
+	rules = append(rules, log.Rule{To: others})
+	return log.Route(rules)
+}
+
+func openRoute(file, pattern string, opts ...log.WriterOption) (log.Writer, error) {
+	if file == "" {
+		return nil, nil
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	w, err := log.NewWriter(f, pattern, opts...)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return routeFile{Writer: w, file: f}, nil
+}
+
+type routeFile struct {
+	log.Writer
+	file *os.File
+}
+
+func (r routeFile) Close() error {
+	err := log.CloseWriter(r.Writer)
+	if e := r.file.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// loadFilter combines the filters given with -f and the one read from file.
+// Each filter is put in its own group ending with a newline so that a comment
+// on its last line does not hide the rest of the expression.
+func loadFilter(filters filterList, file string) (string, error) {
+	if file != "" {
+		buf, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		filters = append(filters, string(buf))
+	}
+	switch len(filters) {
+	case 0:
+		return "", nil
+	case 1:
+		return filters[0], nil
+	}
+	var parts []string
+	for _, f := range filters {
+		parts = append(parts, "("+f+"\n)")
+	}
+	return strings.Join(parts, " && "), nil
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/midbel/log"
+)
+
+const (
+	followInterval  = time.Millisecond * 250
+	checkpointEvery = time.Second
+)
+
+// segment records where a file starts in the stream of bytes given by the
+// follower to be able to translate the position of the reader into an offset
+// in the file being followed.
+type segment struct {
+	inode uint64
+	start int64
+}
+
+// follower is an io.Reader that never returns io.EOF: it waits for new data to
+// be appended to the file and reopens it when it is rotated or truncated.
+type follower struct {
+	path   string
+	file   *os.File
+	offset int64
+	total  int64
+
+	mu       sync.Mutex
+	segments []segment
+}
+
+func followFile(file *os.File) (*follower, error) {
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	f := follower{
+		path:     file.Name(),
+		file:     file,
+		segments: []segment{{inode: inode(fi)}},
+	}
+	return &f, nil
+}
+
+// Resume moves to the offset saved in the checkpoint file if it still refers
+// to the file being followed.
+func (f *follower) Resume(state string) error {
+	c, err := readCheckpoint(state)
+	if err != nil || c.Path != f.path {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return err
+	}
+	fi, err := f.file.Stat()
+	if err != nil {
+		return err
+	}
+	if c.Inode != inode(fi) || c.Offset > fi.Size() {
+		return nil
+	}
+	if _, err := f.file.Seek(c.Offset, io.SeekStart); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.offset = c.Offset
+	f.segments[0].start = -c.Offset
+	return nil
+}
+
+func (f *follower) Read(b []byte) (int, error) {
+	for {
+		n, err := f.file.Read(b)
+		if n > 0 {
+			f.offset += int64(n)
+			f.total += int64(n)
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+		if err := f.reopen(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (f *follower) reopen() error {
+	fi, err := os.Stat(f.path)
+	if err == nil {
+		f.mu.Lock()
+		curr := f.segments[len(f.segments)-1]
+		f.mu.Unlock()
+		if ino := inode(fi); ino != curr.inode || fi.Size() < f.offset {
+			file, err := os.Open(f.path)
+			if err != nil {
+				return err
+			}
+			f.file.Close()
+			f.file, f.offset = file, 0
+
+			f.mu.Lock()
+			f.segments = append(f.segments, segment{inode: ino, start: f.total})
+			f.mu.Unlock()
+			return nil
+		}
+	}
+	time.Sleep(followInterval)
+	return nil
+}
+
+// Position translates a position in the stream given by the follower into an
+// inode and an offset in the followed file.
+func (f *follower) Position(pos int64) (uint64, int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := len(f.segments) - 1; i >= 0; i-- {
+		if s := f.segments[i]; s.start <= pos {
+			if i > 0 {
+				f.segments = f.segments[i:]
+			}
+			return s.inode, pos - s.start
+		}
+	}
+	s := f.segments[0]
+	return s.inode, pos - s.start
+}
+
+type checkpoint struct {
+	Path   string `json:"path"`
+	Inode  uint64 `json:"inode"`
+	Offset int64  `json:"offset"`
+}
+
+func readCheckpoint(file string) (checkpoint, error) {
+	var c checkpoint
+	buf, err := ioutil.ReadFile(file)
+	if err == nil {
+		err = json.Unmarshal(buf, &c)
+	}
+	return c, err
+}
+
+// checkpointWriter saves the position of the last entry written in the state
+// file after at most one second and when cat is interrupted.
+type checkpointWriter struct {
+	log.Writer
+	state  string
+	follow *follower
+	reader *log.Reader
+	// out is the compressed output, ended before exiting on a signal
+	out io.Closer
+
+	mu   sync.Mutex
+	last time.Time
+	pos  int64
+}
+
+func withCheckpoint(w log.Writer, state string, f *follower, r *log.Reader, out io.Closer) log.Writer {
+	c := checkpointWriter{
+		Writer: w,
+		state:  state,
+		follow: f,
+		reader: r,
+		out:    out,
+		last:   time.Now(),
+	}
+	go c.saveOnSignal()
+	return &c
+}
+
+func (c *checkpointWriter) Write(e log.Entry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.Writer.Write(e); err != nil {
+		return err
+	}
+	c.pos = c.reader.Stats().Bytes
+	if time.Since(c.last) < checkpointEvery {
+		return nil
+	}
+	c.last = time.Now()
+	return c.flushAndSave()
+}
+
+func (c *checkpointWriter) Close() error {
+	c.mu.Lock()
+	err := c.flushAndSave()
+	c.mu.Unlock()
+	if e := log.CloseWriter(c.Writer); err == nil {
+		err = e
+	}
+	return err
+}
+
+func (c *checkpointWriter) saveOnSignal() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+	c.mu.Lock()
+	c.flushAndSave()
+	if c.out != nil {
+		c.out.Close()
+	}
+	os.Exit(0)
+}
+
+// flushAndSave writes the entries kept by a buffered writer before saving the
+// position, so that the entries before it are never lost.
+func (c *checkpointWriter) flushAndSave() error {
+	if f, ok := c.Writer.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+	return c.save()
+}
+
+func (c *checkpointWriter) save() error {
+	ino, offset := c.follow.Position(c.pos)
+	buf, err := json.Marshal(checkpoint{
+		Path:   c.follow.path,
+		Inode:  ino,
+		Offset: offset,
+	})
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(c.state), filepath.Base(c.state))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.state)
+}
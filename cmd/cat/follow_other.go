@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"os"
+)
+
+// inode is not available: rotations are only detected when the file is
+// truncated.
+func inode(_ os.FileInfo) uint64 {
+	return 0
+}
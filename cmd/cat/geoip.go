@@ -0,0 +1,21 @@
+//go:build !minimal
+// +build !minimal
+
+package main
+
+import (
+	"strings"
+
+	"github.com/midbel/log"
+	"github.com/midbel/log/geoip"
+)
+
+// deriveGeoIP adds the location of the addresses of field found in the
+// databases of files, separated by commas.
+func deriveGeoIP(r *log.Reader, files, field string) error {
+	db, err := geoip.Open(strings.Split(files, ",")...)
+	if err != nil {
+		return err
+	}
+	return db.Derive(r, field)
+}
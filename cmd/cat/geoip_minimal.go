@@ -0,0 +1,14 @@
+//go:build minimal
+// +build minimal
+
+package main
+
+import (
+	"errors"
+
+	"github.com/midbel/log"
+)
+
+func deriveGeoIP(_ *log.Reader, _, _ string) error {
+	return errors.New("geoip is not available in the minimal build")
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"github.com/midbel/log"
+)
+
+// openIndexed opens file to read the parts selected by q with its index. The
+// index is built first when it is missing, out of date or was built for
+// another input pattern or with other options.
+func openIndexed(file, pattern string, q log.IndexQuery, opts []log.Option) (*log.Indexed, error) {
+	if x, err := log.LoadIndex(file); err != nil || !x.Compatible(pattern, opts...) {
+		if _, err := log.BuildIndex(file, pattern, opts...); err != nil {
+			return nil, err
+		}
+	}
+	return log.OpenIndexed(file, q)
+}
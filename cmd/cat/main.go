@@ -1,13 +1,21 @@
 package main
 
 import (
+	"crypto/rand"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/midbel/log"
 )
 
+const outputBuffer = 64 << 10
+
 var (
 	input  = "[%t] [%h(%4:%p)]%b%u:%g:%n [%p:%l(INFO, WARNING)]:%b%m"
 	output = "%t %n[%p]: %m"
@@ -15,37 +23,768 @@ var (
 
 func main() {
 	var (
-		in     = flag.String("i", input, "input pattern")
-		out    = flag.String("o", output, "output pattern")
-		filter = flag.String("f", "", "filter log entry")
+		in       = flag.String("i", input, "input pattern, preset name, auto to detect it, format of python:/log4j:/grok: to convert or winxml for windows events")
+		out      = flag.String("o", output, "output pattern or preset name")
+		file     = flag.String("F", "", "read filter from file (# starts a comment)")
+		sink     = flag.String("s", "", "send log entry to sink")
+		tui      = flag.Bool("tui", false, "browse log entries in an interactive pager")
+		reject   = flag.String("r", "", "write lines not matching input pattern to file")
+		zone     = flag.String("tz", "", "time zone of timestamps without zone")
+		outZone  = flag.String("out-tz", "", "write times in the given time zone (eg, Local or Europe/Paris)")
+		year     = flag.String("year", "", "year of timestamps without year (auto to guess it)")
+		demo     = flag.Bool("demo", false, "walk through the features of cat with sample logs")
+		top      = flag.String("top", "", "print most frequent values of a field (field=name,n=10)")
+		group    = flag.String("group", "", "print count, first and last time and a sample message per value of field")
+		stats    = flag.String("stats", "", "print count, average, p50, p95, p99 and max of numeric fields (eg, latency=named.duration,size=named.bytes)")
+		split    = flag.String("split", "", "write log entries in one file per value of field")
+		dir      = flag.String("d", ".", "directory where files are written with -split")
+		schema   = flag.String("schema", "", "validate log entries against schema")
+		rewrite  = flag.String("t", "", "transform log entries before writing them")
+		onError  = flag.String("on-error", "", "what to do when the output fails: retry=n (with backoff=d, doubled up to max-backoff=d), skip to drop the entry (eg, retry=5,backoff=500ms,skip)")
+		resolve  = flag.Bool("resolve", false, "replace the addresses of the hosts by their names (and find the addresses of the host names) with DNS lookups")
+		resolveT = flag.Duration("resolve-ttl", log.DefaultResolveTTL, "how long the results of -resolve are kept")
+		geo      = flag.String("geoip", "", "MaxMind databases (eg, GeoLite2-City.mmdb,GeoLite2-ASN.mmdb) giving the country, city and asn of the addresses of -geoip-field")
+		geoField = flag.String("geoip-field", "ip", "field with the addresses located by -geoip (ip, host or named.<name>), the locations being stored in <name>_country, <name>_city,...")
+		enrich   = flag.String("enrich", "", "complete entries from the local system: accounts (names and uid/gid), processes (alive named word) or all")
+		anonym   = flag.String("anonymize", "", "replace the values of fields by pseudonyms, the same for equal values (eg, user,host,named.ip)")
+		anonKey  = flag.String("anonymize-key", os.Getenv("LOG_ANONYMIZE_KEY"), "key of the pseudonyms of -anonymize, random when not given")
+		profile  = flag.String("profile", "", "use options of profile defined in config file")
+		config   = flag.String("config", defaultConfig(), "config file with profiles")
+		color    = flag.Bool("color", false, "colorize log entries according to their level")
+		formats  = flag.Bool("list-formats", false, "list built-in input and output presets")
+		grok     = flag.String("grok-patterns", "", "read the grok patterns used by -i grok: from file (one name and pattern per line)")
+		regex    = flag.Bool("regexp", false, "print the regular expression equivalent to the input pattern and the fields of its groups")
+		progress = flag.Bool("progress", false, "print progress of reading input on stderr")
+		since    = flag.String("since", "", "keep entries at or after time (eg, 2h or \"2024-05-01 12:00\")")
+		until    = flag.String("until", "", "keep entries before time (eg, 30m or \"2024-05-01 13:00\")")
+		table    = flag.String("table", "", "print entries as a table with the given columns (eg, time,level,message)")
+		border   = flag.Bool("border", false, "draw borders around the table printed with -table")
+		follow   = flag.Bool("follow", false, "keep reading the file as it grows and when it is rotated")
+		state    = flag.String("state", "", "save position in followed file to state file and resume from it")
+		mark     = flag.String("highlight", "", "highlight values matched by like and match filters with color when output is a terminal (eg, red or 1;31)")
+		embedded = flag.Bool("embedded", false, "merge JSON object at end of message into named fields")
+		strict   = flag.Bool("strict", false, "reject lines with text left after the last specifier of the input pattern")
+		watch    = flag.Bool("watch", false, "read all files matching the glob pattern given as argument, including new and rotated ones")
+		index    = flag.Bool("index", false, "read the file with its index (file.idx, built when missing or out of date) to skip the parts without entries between -since and -until")
+		rotated  = flag.Bool("rotated", false, "read the rotated files of each file (eg, app.log.2.gz, app.log.1) before the file, oldest first")
+		escape   = flag.String("escape", "raw", "write control characters of fields as is (raw), escaped (escape) or removed (strip)")
+		wrap     = flag.Bool("wrap", false, "wrap long messages to the width of the terminal, indented under the fields written before them")
+		lazy     = flag.Bool("lazy", false, "only extract the fields used by the filter and the output pattern")
+		report   = flag.String("report", "", "print a report (counts by level, top errors, new messages) for each window of the given duration (eg, 1h)")
+		reportTo = flag.String("report-to", "", "write reports to file or post them as JSON to an http URL instead of the standard output")
+		alert    = flag.String("alert", "", "post alerts to webhook URL for the entries matching the filter given with -alert-if")
+		alertIf  = flag.String("alert-if", "", "filter of the entries triggering an alert")
+		alertOpt = flag.String("alert-with", "", "options of alerts (eg, format=slack,window=30s,rate=5/1h,lines=10)")
+		jobs     = flag.Int("jobs", runtime.NumCPU(), "number of files parsed at the same time when several files are given")
+		merge    = flag.Bool("merge", false, "merge entries of several files by time instead of printing them file after file")
+		diff     = flag.Bool("diff", false, "print the messages (or keys given with -diff-key) only found in the first or in the second file")
+		diffKey  = flag.String("diff-key", "", "fields compared by -diff instead of the message with its numbers masked (eg, process,level)")
+		patterns = flag.Bool("patterns", false, "print the templates of the messages (numbers, ids and addresses replaced by placeholders) with their counts")
+		records  = flag.Bool("records", false, "read entries made of the lines up to the next blank line (\\n matches the end of their lines in the input pattern)")
+		gaps     = flag.String("gaps", "", "print the periods longer than the given duration without entries (eg, 5m)")
+		query    = flag.String("sql", "", "print the result of a SQL query over the entries of the table log (eg, SELECT process, count(*) FROM log GROUP BY process)")
+		maxLine  = flag.Int("max-line", 0, "maximum size in bytes of the lines, the longer ones are handled according to -overflow (64KB lines stop cat by default)")
+		overflow = flag.String("overflow", "truncate", "keep the start of the lines longer than -max-line (truncate) or cut them in several lines (chunk)")
+		jsonOut  = flag.Bool("j", false, "print entries as JSON objects, one per line, colored when output is a terminal")
+		jsonArr  = flag.Bool("j-array", false, "print entries as the elements of a single JSON array instead of one JSON object per line (implies -j)")
+		jsonKeys = flag.String("j-keys", "", "fields written by -j in their order, or removed when prefixed by - (eg, time,level,message,named or -line)")
+		compress = flag.String("z", "", "compress output with gzip or zstd")
+		filters  filterList
+		derives  deriveList
+		routes   routeList
 	)
+	flag.Var(&filters, "f", "filter log entry (can be repeated to combine filters)")
+	flag.Var(&routes, "route", "write the entries matching a filter to a file or a sink URI given as filter=>destination, eg, level == 'error' => errors.log (can be repeated, others are printed)")
+	flag.Var(&derives, "derive", "add field computed from entry as name=expression, eg, ms=div(named.us, 1000) (can be repeated)")
 	flag.Parse()
 
-	r, err := os.Open(flag.Arg(0))
+	if *formats {
+		listFormats(os.Stdout)
+		return
+	}
+
+	if *profile != "" {
+		p, err := loadProfile(*config, *profile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		set := make(map[string]bool)
+		flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		if !set["i"] && p.Input != "" {
+			*in = p.Input
+		}
+		if !set["o"] && p.Output != "" {
+			*out = p.Output
+		}
+		if !set["f"] && p.Filter != "" {
+			filters = append(filters, p.Filter)
+		}
+		if !set["color"] {
+			*color = p.Color
+		}
+	}
+
+	if *regex {
+		if err := printRegexp(os.Stdout, *in, *grok, *strict); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	filter, err := loadFilter(filters, *file)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(2)
+		os.Exit(1)
+	}
+
+	if *demo {
+		if err := runDemo(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
 	}
-	defer r.Close()
 
-	rs, err := log.NewReader(r, *in, *filter)
+	var (
+		r   *os.File
+		wat *log.Watcher
+		rot *log.Rotated
+		src io.Reader
+	)
+	if flag.NArg() > 1 && (*tui || *follow || *watch || *progress || *state != "") {
+		fmt.Fprintln(os.Stderr, "-tui, -follow, -watch, -progress and -state can only be used with one file")
+		os.Exit(1)
+	}
+	if *rotated && (*tui || *follow || *watch || *progress || *state != "") {
+		fmt.Fprintln(os.Stderr, "-rotated can not be used with -tui, -follow, -watch, -progress or -state")
+		os.Exit(1)
+	}
+	if *index && (flag.NArg() != 1 || *tui || *follow || *watch || *rotated || *progress || *state != "" || *in == eventInput) {
+		fmt.Fprintln(os.Stderr, "-index can only be used with one file and not with -tui, -follow, -watch, -rotated, -progress, -state or winxml input")
+		os.Exit(1)
+	}
+	if *rotated {
+		if rot, err = log.OpenRotated(flag.Arg(0)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		defer rot.Close()
+		src = rot
+	} else if *watch {
+		if *tui || *follow {
+			fmt.Fprintln(os.Stderr, "-watch can not be used with -tui or -follow")
+			os.Exit(1)
+		}
+		if wat, err = log.Watch(flag.Arg(0), followInterval); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		defer wat.Close()
+		src = wat
+	} else {
+		if r, err = os.Open(flag.Arg(0)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		defer r.Close()
+		src = r
+	}
+	if *in, err = convertInput(*in, *grok); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *in == autoInput {
+		if rot != nil {
+			*in, err = detectRotated(flag.Arg(0))
+		} else {
+			*in, err = detectInput(r, wat)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	opts, err := readerOptions(*zone, *year)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
-	ws, err := log.NewWriter(os.Stdout, *out)
+	from, to, err := timeBounds(*since, *until, *zone)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
-	for i := 1; ; i++ {
-		e, err := rs.Read()
+	filter = timeFilter(filter, from, to)
+	if *index {
+		iopts := opts[:len(opts):len(opts)]
+		if *records {
+			iopts = append(iopts, log.WithRecords())
+		}
+		ix, err := openIndexed(flag.Arg(0), *in, log.IndexQuery{Since: from, Until: to}, iopts)
 		if err != nil {
-			break
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
 		}
-		if err := ws.Write(e); err != nil {
+		defer ix.Close()
+		src = ix
+	}
+	if *tui {
+		if err := runPager(r, *in, *out, filter, opts); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *schema != "" {
+		s, err := parseSchema(*schema)
+		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
-			break
+			os.Exit(1)
+		}
+		opts = append(opts, log.WithSchema(s))
+	}
+	if *reject != "" {
+		w, err := os.Create(*reject)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		defer w.Close()
+		opts = append(opts, log.OnSkip(func(_ int, line string) {
+			fmt.Fprintln(w, line)
+		}))
+	}
+
+	if *embedded {
+		opts = append(opts, log.WithEmbeddedJSON())
+	}
+	if *strict {
+		opts = append(opts, log.WithStrict())
+	}
+	if *records {
+		opts = append(opts, log.WithRecords())
+	}
+	if *maxLine > 0 {
+		mode, err := log.ParseOverflow(*overflow)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		opts = append(opts, log.WithMaxLine(*maxLine, mode))
+	}
+	if *progress && r != nil {
+		opts = append(opts, log.OnProgress(progressBar(r, os.Stderr)))
+	}
+	if *lazy {
+		if *sink != "" || *rewrite != "" || *enrich != "" || *anonym != "" || len(derives) > 0 || *geo != "" || *resolve || *top != "" || *group != "" || *stats != "" || *table != "" || *report != "" || *patterns || *gaps != "" || *query != "" || *jsonOut || *jsonArr || len(routes) > 0 {
+			fmt.Fprintln(os.Stderr, "-lazy can only be used when entries are printed with an output pattern")
+			os.Exit(1)
+		}
+		fields, err := log.PrintFields(*out)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if *split != "" {
+			fields = append(fields, *split)
+		}
+		if *color {
+			fields = append(fields, "level")
+		}
+		if *merge {
+			// the entries of the files are merged by their time
+			fields = append(fields, "time")
+		}
+		opts = append(opts, log.WithFields(fields...))
+	}
+
+	var fol *follower
+	if *follow {
+		if fol, err = followFile(r); err == nil && *state != "" {
+			err = fol.Resume(*state)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		src = fol
+	}
+
+	open := func(src io.Reader) (*log.Reader, error) {
+		if *in == eventInput {
+			return log.NewEventReader(src, filter, opts...)
+		}
+		return log.NewReader(src, *in, filter, opts...)
+	}
+	if *diff {
+		if flag.NArg() != 2 {
+			fmt.Fprintln(os.Stderr, "-diff needs two files")
+			os.Exit(1)
+		}
+		derived := func(src io.Reader) (*log.Reader, error) {
+			r, err := open(src)
+			if err == nil {
+				err = derives.apply(r)
+			}
+			return r, err
+		}
+		if err := runDiff(os.Stdout, flag.Arg(0), flag.Arg(1), *diffKey, derived); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	var rs *log.Reader
+	if flag.NArg() > 1 {
+		var (
+			shared *log.Filter
+			done   func()
+		)
+		// the filter is compiled once: its stateful functions (first,
+		// every,...) see the entries of all the files
+		if shared, err = log.CompileFilter(filter); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fopts := append(opts[:len(opts):len(opts)], log.WithFilter(shared))
+		open := func(src io.Reader) (*log.Reader, error) {
+			if *in == eventInput {
+				return log.NewEventReader(src, "", fopts...)
+			}
+			return log.NewReader(src, *in, "", fopts...)
+		}
+		if rs, done, err = readFiles(flag.Args(), *jobs, *merge, *rotated, open); err == nil {
+			defer done()
+		}
+	} else {
+		rs, err = open(src)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *resolve {
+		rs = log.Resolve(rs, log.WithTTL(*resolveT))
+	}
+	if *geo != "" {
+		if err := deriveGeoIP(rs, *geo, *geoField); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if err := derives.apply(rs); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *top != "" {
+		t, err := parseTop(*top)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err := log.NewPipeline(rs).To(t).Reuse().Run(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		printTop(os.Stdout, t)
+		return
+	}
+	if *report != "" {
+		if err := runReport(rs, *report, *reportTo); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *stats != "" {
+		list, err := parseStats(*stats)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		ws := make([]log.Writer, len(list))
+		for i := range list {
+			ws[i] = list[i].Summary
+		}
+		if err := log.NewPipeline(rs).To(ws...).Reuse().Run(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		printStats(os.Stdout, list)
+		return
+	}
+	if *group != "" {
+		g, err := log.GroupBy(*group)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err := log.NewPipeline(rs).To(g).Reuse().Run(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		printGroups(os.Stdout, g)
+		return
+	}
+	if *patterns {
+		t := log.NewTemplates(0)
+		if err := log.NewPipeline(rs).To(t).Reuse().Run(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		printTemplates(os.Stdout, t)
+		return
+	}
+	if *gaps != "" {
+		d, err := log.ParseDuration(*gaps)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		g := log.FindGaps(d)
+		if err := log.NewPipeline(rs).To(g).Reuse().Run(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		printGaps(os.Stdout, g)
+		return
+	}
+	if *query != "" {
+		q, err := log.CompileQuery(*query)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err := log.NewPipeline(rs).To(q).Reuse().Run(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		printQuery(os.Stdout, q)
+		return
+	}
+	mode, err := log.ParseEscape(*escape)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	wopts := []log.WriterOption{log.WithEscape(mode)}
+	// output to files and pipes is written by blocks, at least every second
+	// for the followed inputs
+	bopts := append([]log.WriterOption{log.WithBuffer(outputBuffer, time.Second)}, wopts...)
+	if *wrap && *compress == "" && isTerminal(os.Stdout) {
+		cols, _ := termSize(os.Stdout)
+		wopts = append(wopts, log.WithWrap(cols))
+	}
+
+	var (
+		stdout io.Writer = os.Stdout
+		zout   io.Closer
+	)
+	if *compress != "" {
+		if *sink != "" || *split != "" {
+			fmt.Fprintln(os.Stderr, "-z can not be used with -s or -split")
+			os.Exit(1)
+		}
+		z, err := log.Compress(os.Stdout, *compress)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		stdout, zout = z, z
+	}
+
+	var ws log.Writer
+	if *sink != "" {
+		ws, err = log.OpenSink(*sink)
+	} else if *split != "" {
+		ws, err = splitWriter(*dir, *split, *out, bopts...)
+	} else if *jsonOut || *jsonArr {
+		ws, err = jsonOutput(stdout, *jsonKeys, *compress == "" && isTerminal(os.Stdout), *jsonArr)
+	} else if *table != "" {
+		var opts []log.TableOption
+		if *border {
+			opts = append(opts, log.WithBorder())
+		}
+		ws, err = log.Table(stdout, strings.Split(*table, ","), opts...)
+	} else if *color || (*mark != "" && *compress == "" && isTerminal(os.Stdout)) {
+		ws, err = colorOutput(stdout, *color, *mark, filter, *out, wopts...)
+	} else if isTerminal(os.Stdout) && *compress == "" {
+		ws, err = log.NewWriter(stdout, *out, wopts...)
+	} else {
+		ws, err = log.NewWriter(stdout, *out, bopts...)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if flag.NArg() > 1 && !*merge && *sink == "" && *split == "" && *table == "" && !*jsonOut && !*jsonArr {
+		ws = withSections(ws, stdout)
+	}
+	if *alert != "" {
+		a, err := openAlert(*alert, *alertIf, *alertOpt, *out)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		ws = log.MultiWriter(ws, a)
+	}
+	if len(routes) > 0 {
+		if ws, err = routes.writer(ws, *out, bopts...); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if fol != nil && *state != "" {
+		ws = withCheckpoint(ws, *state, fol, rs, zout)
+	}
+	pipe := log.NewPipeline(rs)
+	if *sink == "" {
+		// sinks can queue the entries before sending them
+		pipe.Reuse()
+	}
+	if *rewrite != "" {
+		pipe.Rewrite(*rewrite)
+	}
+	if *onError != "" {
+		policy, err := errorPolicy(*onError)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		pipe.OnError(policy)
+	}
+	if *enrich != "" {
+		opts, err := systemOptions(*enrich)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		pipe.Transform(log.EnrichSystem(opts...))
+	}
+	if *outZone != "" {
+		loc, err := time.LoadLocation(*outZone)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		pipe.Transform(func(e log.Entry) log.Entry {
+			if !e.When.IsZero() {
+				e.When = e.When.In(loc)
+			}
+			return e
+		})
+	}
+	if *anonym != "" {
+		key, err := anonymizeKey(*anonKey)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		pipe.Anonymize(key, strings.Split(*anonym, ",")...)
+	}
+	err = pipe.To(ws).Run()
+	if e := pipe.Close(); err == nil {
+		err = e
+	}
+	// the compressed stream is ended even when the entries are not all written
+	if zout != nil {
+		if e := zout.Close(); err == nil {
+			err = e
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// errorPolicy gives the ErrorPolicy of -on-error. The skipped entries are
+// reported on stderr.
+func errorPolicy(str string) (log.ErrorPolicy, error) {
+	var policy log.ErrorPolicy
+	for _, opt := range strings.Split(str, ",") {
+		k, v := splitOption(opt)
+		switch k {
+		case "":
+		case "abort":
+			policy.Skip = false
+		case "skip":
+			policy.Skip = true
+		case "retry":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return policy, fmt.Errorf("on-error: %s: invalid number of retries", v)
+			}
+			policy.Retries = n
+		case "backoff", "max-backoff":
+			d, err := log.ParseDuration(v)
+			if err != nil {
+				return policy, fmt.Errorf("on-error: %s: invalid %s", v, k)
+			}
+			if k == "backoff" {
+				policy.Backoff = d
+			} else {
+				policy.MaxBackoff = d
+			}
+		default:
+			return policy, fmt.Errorf("on-error: %s: unknown option", k)
+		}
+	}
+	if policy.Retries > 0 && policy.Backoff == 0 {
+		policy.Backoff = 100 * time.Millisecond
+	}
+	if policy.Skip {
+		policy.OnSkip = func(e log.Entry, err error) {
+			fmt.Fprintf(os.Stderr, "line %d skipped: %s\n", e.Source.Line, err)
+		}
+	}
+	return policy, nil
+}
+
+// systemOptions gives the enrichments of -enrich.
+func systemOptions(str string) ([]log.SystemOption, error) {
+	var opts []log.SystemOption
+	for _, s := range strings.Split(str, ",") {
+		switch strings.TrimSpace(s) {
+		case "all":
+			return nil, nil
+		case "accounts":
+			opts = append(opts, log.ResolveAccounts())
+		case "processes":
+			opts = append(opts, log.CheckProcesses())
+		default:
+			return nil, fmt.Errorf("%s: unknown enrichment", s)
+		}
+	}
+	return opts, nil
+}
+
+// anonymizeKey gives the key of -anonymize: a random one, and so pseudonyms
+// only valid for this run, when none is given.
+func anonymizeKey(key string) ([]byte, error) {
+	if key != "" {
+		return []byte(key), nil
+	}
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	return buf, err
+}
+
+func readerOptions(zone, year string) ([]log.Option, error) {
+	var opts []log.Option
+	if zone != "" {
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, log.WithLocation(loc))
+	}
+	switch year {
+	case "":
+	case "auto":
+		opts = append(opts, log.WithYear(log.YearAuto))
+	default:
+		y, err := strconv.Atoi(year)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid year", year)
+		}
+		opts = append(opts, log.WithYear(y))
+	}
+	return opts, nil
+}
+
+// colorOutput creates the writer colorizing entries according to their level
+// and/or highlighting the values matched by the filter.
+func colorOutput(w io.Writer, levels bool, mark, filter, pattern string, opts ...log.WriterOption) (log.Writer, error) {
+	c, err := colorize(w, pattern, opts...)
+	if err != nil {
+		return nil, err
+	}
+	c.levels = levels
+	if mark != "" {
+		if c.color, err = highlightColor(mark); err != nil {
+			return nil, err
+		}
+		if c.mark, err = log.NewHighlighter(filter); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// jsonOutput creates the writer of -j and -j-array with the fields to write,
+// or to remove when they start with -, given in keys.
+func jsonOutput(w io.Writer, keys string, color, array bool) (log.Writer, error) {
+	var (
+		opts []log.JSONOption
+		with []string
+	)
+	if color {
+		opts = append(opts, log.WithColors())
+	}
+	if array {
+		opts = append(opts, log.WithArray())
+	}
+	for _, k := range strings.Split(keys, ",") {
+		switch {
+		case k == "":
+		case strings.HasPrefix(k, "-"):
+			opts = append(opts, log.WithoutKeys(k[1:]))
+		default:
+			with = append(with, k)
+		}
+	}
+	opts = append(opts, log.WithKeys(with...))
+	return log.JSON(w, opts...)
+}
+
+func splitWriter(dir, field, pattern string, opts ...log.WriterOption) (log.Writer, error) {
+	if _, err := log.NewWriter(io.Discard, pattern); err != nil {
+		return nil, err
+	}
+	return log.Split(dir, field, func(w io.Writer) log.Writer {
+		ws, _ := log.NewWriter(w, pattern, opts...)
+		return ws
+	})
+}
+
+func printRegexp(w io.Writer, pattern, grok string, strict bool) error {
+	pattern, err := convertInput(pattern, grok)
+	if err != nil {
+		return err
+	}
+	if pattern == autoInput || pattern == eventInput {
+		return fmt.Errorf("%s: no regular expression for this input", pattern)
+	}
+	var opts []log.Option
+	if strict {
+		opts = append(opts, log.WithStrict())
+	}
+	p, err := log.CompilePattern(pattern, opts...)
+	if err != nil {
+		return err
+	}
+	re, fields := p.Regexp()
+	if re == nil {
+		return fmt.Errorf("%s: no regular expression for this pattern", pattern)
+	}
+	fmt.Fprintln(w, re)
+	names := re.SubexpNames()[1:]
+	for i := range names {
+		fmt.Fprintf(w, "  %s: %s\n", names[i], fields[i])
+	}
+	return nil
+}
+
+func listFormats(w io.Writer) {
+	for _, p := range log.Presets() {
+		fmt.Fprintf(w, "%s (%s)\n", p.Name, p.Kind)
+		fmt.Fprintf(w, "  pattern: %s\n", p.Pattern)
+		if p.Example != "" {
+			fmt.Fprintf(w, "  example: %s\n", p.Example)
 		}
 	}
 }
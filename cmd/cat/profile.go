@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/midbel/log"
+	"github.com/midbel/toml"
+)
+
+// a profile groups the options of cat under a name. Profiles are defined in
+// the configuration file ($XDG_CONFIG_HOME/logcat/config.toml), eg:
+//
+// [[profile]]
+// name   = "nginx"
+// input  = "%h(%4) - %u [%t(%d/%b/%y:%H:%M:%S %Z)] %m"
+// output = "%t %h %m"
+// filter = "message ~= \"(GET|POST)\""
+// color  = true
+type Profile struct {
+	Name   string
+	Input  string
+	Output string
+	Filter string
+	Color  bool
+}
+
+func defaultConfig() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "logcat", "config.toml")
+}
+
+func loadProfile(file, name string) (Profile, error) {
+	config := struct {
+		Profiles []Profile `toml:"profile"`
+	}{}
+	if err := toml.DecodeFile(file, &config); err != nil {
+		return Profile{}, err
+	}
+	for _, p := range config.Profiles {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return Profile{}, fmt.Errorf("%s: profile not found in %s", name, file)
+}
+
+type colorWriter struct {
+	inner  io.Writer
+	buffer bytes.Buffer
+	print  log.Writer
+
+	levels bool
+	mark   *log.Highlighter
+	color  string
+}
+
+func colorize(w io.Writer, pattern string, opts ...log.WriterOption) (*colorWriter, error) {
+	c := colorWriter{inner: w}
+	print, err := log.NewWriter(&c.buffer, pattern, opts...)
+	if err != nil {
+		return nil, err
+	}
+	c.print = print
+	return &c, nil
+}
+
+func (c *colorWriter) Write(e log.Entry) error {
+	c.buffer.Reset()
+	if err := c.print.Write(e); err != nil {
+		return err
+	}
+	var (
+		line  = strings.TrimRight(c.buffer.String(), "\n")
+		color string
+	)
+	if c.levels {
+		color = levelColor(e.Level)
+	}
+	if c.mark != nil {
+		line = c.mark.Mark(e, line, c.color, colorReset+color)
+	}
+	if color != "" {
+		_, err := fmt.Fprintf(c.inner, "%s%s%s\n", color, line, colorReset)
+		return err
+	}
+	_, err := fmt.Fprintf(c.inner, "%s\n", line)
+	return err
+}
+
+var highlightColors = map[string]string{
+	"red":     colorRed,
+	"green":   colorGreen,
+	"yellow":  colorYellow,
+	"blue":    colorBlue,
+	"magenta": "\x1b[35m",
+	"cyan":    "\x1b[36m",
+	"bold":    "\x1b[1m",
+	"invert":  colorInvert,
+}
+
+// highlightColor gives the escape sequence of a color name or of SGR
+// parameters (eg, 1;31 for bold red).
+func highlightColor(name string) (string, error) {
+	if c, ok := highlightColors[name]; ok {
+		return c, nil
+	}
+	if name == "" || strings.Trim(name, "0123456789;") != "" {
+		return "", fmt.Errorf("%s: unknown color", name)
+	}
+	return "\x1b[" + name + "m", nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/midbel/log"
+)
+
+const barWidth = 40
+
+func progressBar(file *os.File, w io.Writer) func(log.Stats) {
+	var size int64
+	if fi, err := file.Stat(); err == nil && fi.Mode().IsRegular() {
+		size = fi.Size()
+	}
+	return func(s log.Stats) {
+		if size <= 0 {
+			fmt.Fprintf(w, "\r%d lines, %d matched, %d filtered, %d failed", s.Lines, s.Matched, s.Filtered, s.Failed)
+			return
+		}
+		ratio := float64(s.Bytes) / float64(size)
+		if ratio > 1 {
+			ratio = 1
+		}
+		done := int(ratio * barWidth)
+		fmt.Fprintf(w, "\r[%-*s] %3.0f%% %d lines, %d matched", barWidth, strings.Repeat("=", done), ratio*100, s.Lines, s.Matched)
+		if s.Bytes >= size {
+			fmt.Fprintln(w)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/midbel/log"
+)
+
+// runReport reads the entries of rs and gives a report every window of the
+// given duration. When the input is followed, the report of a window is given
+// once an entry of the next window is read.
+func runReport(rs *log.Reader, every, target string) error {
+	window, err := log.ParseDuration(every)
+	if err != nil {
+		return err
+	}
+	if window <= 0 {
+		return fmt.Errorf("%s: invalid report window", every)
+	}
+	emit, closer, err := reportTo(target)
+	if err != nil {
+		return err
+	}
+	if closer != nil {
+		defer closer.Close()
+	}
+	rep := log.NewReporter(window, emit)
+	if err := log.NewPipeline(rs).To(rep).Reuse().Run(); err != nil {
+		return err
+	}
+	return rep.Close()
+}
+
+// reportTo gives the function emitting the reports to target: the standard
+// output if target is empty or -, a webhook receiving the reports as JSON if
+// it is an http URL, or a file where the reports are appended.
+func reportTo(target string) (func(log.Report) error, io.Closer, error) {
+	switch {
+	case target == "" || target == "-":
+		return printReport(os.Stdout), nil, nil
+	case strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://"):
+		return postReport(target), nil, nil
+	default:
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, nil, err
+		}
+		return printReport(f), f, nil
+	}
+}
+
+func printReport(w io.Writer) func(log.Report) error {
+	return func(r log.Report) error {
+		var buf bytes.Buffer
+		if r.Start.IsZero() {
+			fmt.Fprintf(&buf, "report: %d entries\n", r.Total)
+		} else {
+			fmt.Fprintf(&buf, "report %s - %s: %d entries\n", r.Start.Format(time.RFC3339), r.End.Format(time.RFC3339), r.Total)
+		}
+		fmt.Fprintln(&buf, "levels:")
+		for _, c := range r.Levels {
+			level := c.Value
+			if level == "" {
+				level = "-"
+			}
+			fmt.Fprintf(&buf, "  %-30s %8d %6.2f%%\n", level, c.Count, c.Percent)
+		}
+		if len(r.Errors) > 0 {
+			fmt.Fprintln(&buf, "top errors:")
+			for _, c := range r.Errors {
+				fmt.Fprintf(&buf, "  %8d %s %s\n", c.Count, formatTime(c.First), c.Value)
+			}
+		}
+		if len(r.New) > 0 {
+			fmt.Fprintln(&buf, "new messages:")
+			for _, m := range r.New {
+				fmt.Fprintf(&buf, "  %s\n", m)
+			}
+		}
+		fmt.Fprintln(&buf)
+		_, err := w.Write(buf.Bytes())
+		return err
+	}
+}
+
+func postReport(url string) func(log.Report) error {
+	client := http.Client{Timeout: 10 * time.Second}
+	return func(r log.Report) error {
+		buf, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		res, err := client.Post(url, "application/json", bytes.NewReader(buf))
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		io.Copy(io.Discard, res.Body)
+		if res.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("%s: %s", url, res.Status)
+		}
+		return nil
+	}
+}
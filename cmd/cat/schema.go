@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/midbel/log"
+)
+
+// parseSchema reads a schema given as a list of options separated by
+// semicolons, eg: required=level,process;types=named.status:int;levels=INFO,WARNING;action=fail
+func parseSchema(str string) (log.Schema, error) {
+	s := log.Schema{
+		Types:  make(map[string]string),
+		Action: log.SchemaFail,
+	}
+	for _, opt := range strings.Split(str, ";") {
+		k, v := splitOption(opt)
+		switch k {
+		case "required":
+			s.Required = splitList(v)
+		case "levels":
+			s.Levels = splitList(v)
+		case "types":
+			for _, t := range splitList(v) {
+				x := strings.Index(t, ":")
+				if x < 0 {
+					return s, fmt.Errorf("schema: %s: missing type", t)
+				}
+				s.Types[t[:x]] = t[x+1:]
+			}
+		case "action":
+			switch v {
+			case "drop":
+				s.Action = log.SchemaDrop
+			case "annotate":
+				s.Action = log.SchemaAnnotate
+			case "fail":
+				s.Action = log.SchemaFail
+			default:
+				return s, fmt.Errorf("schema: %s: unknown action", v)
+			}
+		case "":
+		default:
+			return s, fmt.Errorf("schema: %s: unknown option", k)
+		}
+	}
+	return s, s.Check()
+}
+
+func splitList(str string) []string {
+	var list []string
+	for _, s := range strings.Split(str, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/midbel/log"
+)
+
+var sinceLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"15:04:05",
+	"15:04",
+}
+
+// timeBounds gives the times of since and until, zero when they are not set.
+// Both accept a duration relative to now (eg, 2h, 1d) or a time.
+func timeBounds(since, until, zone string) (time.Time, time.Time, error) {
+	loc := time.Local
+	if zone != "" {
+		z, err := time.LoadLocation(zone)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		loc = z
+	}
+	var (
+		now   = time.Now().In(loc)
+		times [2]time.Time
+	)
+	for i, value := range []string{since, until} {
+		if value == "" {
+			continue
+		}
+		when, err := parseWhen(value, now)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		times[i] = when
+	}
+	return times[0], times[1], nil
+}
+
+// timeFilter adds to filter the conditions matching entries between since and
+// until, when they are not zero.
+func timeFilter(filter string, since, until time.Time) string {
+	for _, c := range []struct {
+		when time.Time
+		op   string
+	}{
+		{when: since, op: ">="},
+		{when: until, op: "<"},
+	} {
+		if c.when.IsZero() {
+			continue
+		}
+		expr := fmt.Sprintf("time %s \"%s\"", c.op, c.when.Format(time.RFC3339Nano))
+		if filter == "" {
+			filter = expr
+		} else {
+			filter = fmt.Sprintf("(%s\n) && %s", filter, expr)
+		}
+	}
+	return filter
+}
+
+func parseWhen(str string, now time.Time) (time.Time, error) {
+	if d, err := log.ParseDuration(str); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range sinceLayouts {
+		w, err := time.ParseInLocation(layout, str, now.Location())
+		if err != nil {
+			continue
+		}
+		if w.Year() == 0 {
+			y, m, d := now.Date()
+			w = w.AddDate(y, int(m)-1, d-1)
+		}
+		return w, nil
+	}
+	return time.Time{}, fmt.Errorf("%s: invalid time", str)
+}
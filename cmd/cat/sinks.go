@@ -0,0 +1,12 @@
+//go:build !minimal
+// +build !minimal
+
+package main
+
+// sinks available in the full build of cat. Build with -tags minimal to get a
+// binary that only depends on the core package.
+
+import (
+	_ "github.com/midbel/log/sink/fluent"
+	_ "github.com/midbel/log/sink/socket"
+)
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/midbel/log"
+)
+
+func parseTop(str string) (*log.Top, error) {
+	var (
+		field = "message"
+		limit = 10
+	)
+	for _, opt := range strings.Split(str, ",") {
+		k, v := splitOption(opt)
+		switch k {
+		case "field":
+			field = v
+		case "n":
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("top: %s: invalid number", v)
+			}
+			limit = n
+		default:
+			return nil, fmt.Errorf("top: %s: unknown option", k)
+		}
+	}
+	return log.TopN(field, limit)
+}
+
+type namedSummary struct {
+	Name string
+	*log.Summary
+}
+
+// parseStats parses a list of fields to summarize given as name=field or
+// field separated by commas.
+func parseStats(str string) ([]namedSummary, error) {
+	var list []namedSummary
+	for _, opt := range strings.Split(str, ",") {
+		name, field := splitOption(opt)
+		if field == "" {
+			field = name
+		}
+		s, err := log.Summarize(field)
+		if err != nil {
+			return nil, fmt.Errorf("stats: %w", err)
+		}
+		list = append(list, namedSummary{Name: name, Summary: s})
+	}
+	return list, nil
+}
+
+func printStats(w io.Writer, list []namedSummary) {
+	fmt.Fprintf(w, "%-20s %8s %12s %12s %12s %12s %12s\n", "field", "count", "avg", "p50", "p95", "p99", "max")
+	for _, s := range list {
+		fmt.Fprintf(w, "%-20s %8d %12.6g %12.6g %12.6g %12.6g %12.6g\n", s.Name, s.Count(), s.Mean(), s.Quantile(0.5), s.Quantile(0.95), s.Quantile(0.99), s.Max())
+	}
+}
+
+func printTop(w io.Writer, top *log.Top) {
+	for _, c := range top.Counts() {
+		fmt.Fprintf(w, "%-32s %8d %6.2f%% %s %s\n", c.Value, c.Count, c.Percent, formatTime(c.First), formatTime(c.Last))
+	}
+}
+
+func printTemplates(w io.Writer, t *log.Templates) {
+	for _, c := range t.Counts() {
+		fmt.Fprintf(w, "%8d %6.2f%% %s %s %s\n", c.Count, c.Percent, formatTime(c.First), formatTime(c.Last), c.Value)
+	}
+}
+
+func printGaps(w io.Writer, gaps *log.Gaps) {
+	for _, g := range gaps.Gaps() {
+		fmt.Fprintf(w, "%s %s %12s", formatTime(g.Start), formatTime(g.End), g.Duration)
+		if g.Source.File != "" {
+			fmt.Fprintf(w, " %s:%d", g.Source.File, g.Source.Line)
+		} else if g.Source.Line > 0 {
+			fmt.Fprintf(w, " line %d", g.Source.Line)
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "%d gaps, %d entries, average interval %s, longest %s\n", len(gaps.Gaps()), gaps.Total(), gaps.Mean(), gaps.Max())
+}
+
+func printQuery(w io.Writer, q *log.Query) {
+	var (
+		cols   = q.Columns()
+		rows   = q.Rows()
+		widths = make([]int, len(cols))
+	)
+	for _, row := range append([][]string{cols}, rows...) {
+		for i, v := range row {
+			if n := utf8.RuneCountInString(v); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	for _, row := range append([][]string{cols}, rows...) {
+		for i, v := range row {
+			if i == len(row)-1 {
+				fmt.Fprintln(w, v)
+				break
+			}
+			fmt.Fprint(w, v, strings.Repeat(" ", widths[i]-utf8.RuneCountInString(v)+2))
+		}
+	}
+	fmt.Fprintf(w, "(%d rows)\n", len(rows))
+}
+
+func printGroups(w io.Writer, groups *log.Groups) {
+	for _, g := range groups.Groups() {
+		fmt.Fprintf(w, "%-32s %8d %s %s %s\n", g.Value, g.Count, formatTime(g.First), formatTime(g.Last), g.Sample)
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+func splitOption(str string) (string, string) {
+	x := strings.Index(str, "=")
+	if x < 0 {
+		return strings.TrimSpace(str), ""
+	}
+	return strings.TrimSpace(str[:x]), strings.TrimSpace(str[x+1:])
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/midbel/log"
+)
+
+const (
+	keyUp = iota + 256
+	keyDown
+	keyPageUp
+	keyPageDown
+	keyEsc
+)
+
+const (
+	colorReset  = "\x1b[0m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorBlue   = "\x1b[34m"
+	colorGray   = "\x1b[90m"
+	colorInvert = "\x1b[7m"
+)
+
+type pager struct {
+	data    []byte
+	pattern string
+	options []log.Option
+	print   log.Writer
+	buffer  bytes.Buffer
+
+	entries []log.Entry
+	err     error
+	filter  string
+	edit    []rune
+	editing bool
+	detail  bool
+	// scroll is the first line of the detail pane shown
+	scroll int
+
+	cursor int
+	offset int
+	width  int
+	height int
+}
+
+func runPager(r io.Reader, pattern, output, filter string, opts []log.Option) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	p := pager{
+		data:    data,
+		pattern: pattern,
+		options: opts,
+	}
+	if p.print, err = log.NewWriter(&p.buffer, output); err != nil {
+		return err
+	}
+	p.apply(filter)
+	if p.err != nil {
+		return p.err
+	}
+
+	restore, err := makeRaw(os.Stdin)
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	var (
+		in  = bufio.NewReader(os.Stdin)
+		out = bufio.NewWriter(os.Stdout)
+	)
+	defer func() {
+		out.WriteString("\x1b[2J\x1b[H\x1b[?25h")
+		out.Flush()
+	}()
+	out.WriteString("\x1b[?25l")
+	for {
+		p.width, p.height = termSize(os.Stdout)
+		p.render(out)
+		if err := out.Flush(); err != nil {
+			return err
+		}
+		k, err := readKey(in)
+		if err != nil {
+			return err
+		}
+		if !p.handle(k) {
+			return nil
+		}
+	}
+}
+
+func (p *pager) apply(filter string) {
+	rs, err := log.NewReader(bytes.NewReader(p.data), p.pattern, filter, p.options...)
+	if err != nil {
+		p.err = err
+		return
+	}
+	es, err := rs.ReadAll()
+	if err != nil && err != io.EOF {
+		p.err = err
+		return
+	}
+	p.entries, p.filter, p.err = es, filter, nil
+	p.cursor, p.offset = 0, 0
+}
+
+func (p *pager) handle(k int) bool {
+	if p.editing {
+		switch k {
+		case keyEsc:
+			p.editing = false
+		case '\r', '\n':
+			p.editing = false
+			p.apply(string(p.edit))
+		case 127, 8:
+			if n := len(p.edit); n > 0 {
+				p.edit = p.edit[:n-1]
+			}
+		default:
+			if k >= ' ' && k < keyUp {
+				p.edit = append(p.edit, rune(k))
+			}
+		}
+		return true
+	}
+	switch k {
+	case 'q', 3:
+		return false
+	case 'j', keyDown:
+		p.move(1)
+	case 'k', keyUp:
+		p.move(-1)
+	case ' ', keyPageDown:
+		p.move(p.rows())
+	case 'b', keyPageUp:
+		p.move(-p.rows())
+	case 'g':
+		p.move(-len(p.entries))
+	case 'G':
+		p.move(len(p.entries))
+	case '/':
+		p.editing = true
+		p.edit = []rune(p.filter)
+	case '\r', '\n':
+		p.detail, p.scroll = !p.detail, 0
+	case 'J':
+		p.scroll++
+	case 'K':
+		if p.scroll > 0 {
+			p.scroll--
+		}
+	}
+	return true
+}
+
+func (p *pager) move(n int) {
+	if n != 0 {
+		p.scroll = 0
+	}
+	p.cursor += n
+	if p.cursor >= len(p.entries) {
+		p.cursor = len(p.entries) - 1
+	}
+	if p.cursor < 0 {
+		p.cursor = 0
+	}
+	rows := p.rows()
+	if p.cursor < p.offset {
+		p.offset = p.cursor
+	}
+	if p.cursor >= p.offset+rows {
+		p.offset = p.cursor - rows + 1
+	}
+}
+
+func (p *pager) rows() int {
+	n := p.height - 2
+	if p.detail {
+		n -= detailHeight
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+const detailHeight = 12
+
+func (p *pager) render(w *bufio.Writer) {
+	w.WriteString("\x1b[2J\x1b[H")
+	p.move(0)
+
+	header := fmt.Sprintf(" %s - %d entries", p.pattern, len(p.entries))
+	w.WriteString(colorInvert + p.clip(header, true) + colorReset + "\r\n")
+
+	rows := p.rows()
+	for i := p.offset; i < p.offset+rows; i++ {
+		if i >= len(p.entries) {
+			w.WriteString("~\r\n")
+			continue
+		}
+		p.buffer.Reset()
+		p.print.Write(p.entries[i])
+		line := p.clip(strings.TrimRight(p.buffer.String(), "\n"), false)
+		if i == p.cursor {
+			w.WriteString(colorInvert)
+		}
+		w.WriteString(levelColor(p.entries[i].Level))
+		w.WriteString(line)
+		w.WriteString(colorReset + "\r\n")
+	}
+	if p.detail && p.cursor < len(p.entries) {
+		p.renderDetail(w, p.entries[p.cursor])
+	}
+
+	var status string
+	switch {
+	case p.editing:
+		status = "filter: " + string(p.edit)
+	case p.err != nil:
+		status = colorRed + p.err.Error()
+	case p.detail:
+		status = fmt.Sprintf("filter: %s | j/k move, J/K scroll detail, / filter, enter close, q quit", p.filter)
+	default:
+		status = fmt.Sprintf("filter: %s | j/k move, / filter, enter detail, q quit", p.filter)
+	}
+	w.WriteString(p.clip(status, false) + colorReset)
+}
+
+func (p *pager) renderDetail(w *bufio.Writer, e log.Entry) {
+	type field struct {
+		Label string
+		Value string
+	}
+	fields := []field{
+		{Label: "time", Value: e.When.String()},
+		{Label: "host", Value: e.Host},
+		{Label: "process", Value: e.Process},
+		{Label: "pid", Value: strconv.Itoa(e.Pid)},
+		{Label: "user", Value: e.User},
+		{Label: "group", Value: e.Group},
+		{Label: "level", Value: e.Level},
+		{Label: "words", Value: strings.Join(e.Words, ", ")},
+		{Label: "message", Value: e.Message},
+		{Label: "line", Value: e.Line},
+	}
+	names := make([]string, 0, len(e.Named)+len(e.Values))
+	for k := range e.Named {
+		names = append(names, k)
+	}
+	for k := range e.Values {
+		if _, ok := e.Named[k]; !ok {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		v, ok := e.Named[k]
+		if !ok {
+			v = fmt.Sprint(e.Values[k])
+		}
+		fields = append(fields, field{Label: "named." + k, Value: v})
+	}
+
+	rows := detailHeight - 1
+	if last := len(fields) - rows; p.scroll > last {
+		p.scroll = last
+	}
+	if p.scroll < 0 {
+		p.scroll = 0
+	}
+	header := " detail"
+	if len(fields) > rows {
+		header += fmt.Sprintf(" (%d-%d/%d)", p.scroll+1, p.scroll+rows, len(fields))
+	}
+	w.WriteString(colorInvert + p.clip(header, true) + colorReset + "\r\n")
+	for i := p.scroll; i < p.scroll+rows; i++ {
+		if i < len(fields) {
+			f := fields[i]
+			w.WriteString(p.clip(fmt.Sprintf("%s%-8s%s %s", colorGray, f.Label, colorReset, f.Value), false))
+		}
+		w.WriteString("\r\n")
+	}
+}
+
+// clip cuts str to the width of the terminal, and pads it with blanks when pad
+// is set. The escape sequences take no column and are all kept, so that the
+// colors are reset after the text cut.
+func (p *pager) clip(str string, pad bool) string {
+	var (
+		buf  strings.Builder
+		cols int
+	)
+	for i := 0; i < len(str); {
+		if str[i] == 0x1b {
+			n := escapeLen(str[i:])
+			buf.WriteString(str[i : i+n])
+			i += n
+			continue
+		}
+		_, n := utf8.DecodeRuneInString(str[i:])
+		if p.width <= 0 || cols < p.width {
+			buf.WriteString(str[i : i+n])
+			cols++
+		}
+		i += n
+	}
+	if pad && p.width > cols {
+		buf.WriteString(strings.Repeat(" ", p.width-cols))
+	}
+	return buf.String()
+}
+
+// escapeLen gives the length of the escape sequence at the start of str.
+func escapeLen(str string) int {
+	if len(str) < 2 {
+		return len(str)
+	}
+	if str[1] != '[' {
+		return 2
+	}
+	for i := 2; i < len(str); i++ {
+		if c := str[i]; c >= 0x40 && c <= 0x7e {
+			return i + 1
+		}
+	}
+	return len(str)
+}
+
+func levelColor(level string) string {
+	switch level = strings.ToLower(level); {
+	case strings.HasPrefix(level, "err"), strings.HasPrefix(level, "crit"), strings.HasPrefix(level, "fatal"), strings.HasPrefix(level, "emerg"), strings.HasPrefix(level, "alert"):
+		return colorRed
+	case strings.HasPrefix(level, "warn"):
+		return colorYellow
+	case strings.HasPrefix(level, "info"), strings.HasPrefix(level, "notice"):
+		return colorGreen
+	case strings.HasPrefix(level, "debug"), strings.HasPrefix(level, "trace"):
+		return colorBlue
+	default:
+		return ""
+	}
+}
+
+func readKey(r *bufio.Reader) (int, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b != 0x1b {
+		return int(b), nil
+	}
+	if r.Buffered() == 0 {
+		return keyEsc, nil
+	}
+	if b, _ = r.ReadByte(); b != '[' {
+		return keyEsc, nil
+	}
+	switch b, _ = r.ReadByte(); b {
+	case 'A':
+		return keyUp, nil
+	case 'B':
+		return keyDown, nil
+	case '5', '6':
+		r.ReadByte()
+		if b == '5' {
+			return keyPageUp, nil
+		}
+		return keyPageDown, nil
+	default:
+		return keyEsc, nil
+	}
+}
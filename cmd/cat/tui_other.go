@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+func makeRaw(_ *os.File) (func(), error) {
+	return nil, errors.New("tui: terminal not supported on this platform")
+}
+
+func termSize(_ *os.File) (int, int) {
+	return 80, 24
+}
@@ -0,0 +1,70 @@
+package log
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+var ErrCompression = errors.New("unknown compression")
+
+// CompressFunc creates a writer compressing what is written to it into w.
+// Closing it flushes the compressed data but does not close w.
+type CompressFunc func(w io.Writer) (io.WriteCloser, error)
+
+var compressors = struct {
+	sync.RWMutex
+	algos map[string]CompressFunc
+}{
+	algos: make(map[string]CompressFunc),
+}
+
+func init() {
+	RegisterCompression("gzip", func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriter(w), nil
+	})
+	RegisterCompression("zstd", func(w io.Writer) (io.WriteCloser, error) {
+		return newZstdWriter(w), nil
+	})
+}
+
+// RegisterCompression makes an algorithm available to Compress. gzip and zstd
+// are built in.
+func RegisterCompression(algo string, fn CompressFunc) {
+	compressors.Lock()
+	defer compressors.Unlock()
+	if fn == nil {
+		panic("log: RegisterCompression function is nil")
+	}
+	if _, dup := compressors.algos[algo]; dup {
+		panic("log: RegisterCompression called twice for " + algo)
+	}
+	compressors.algos[algo] = fn
+}
+
+func Compressions() []string {
+	compressors.RLock()
+	defer compressors.RUnlock()
+	var list []string
+	for a := range compressors.algos {
+		list = append(list, a)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Compress wraps w to compress the data written to it with the given
+// algorithm. The returned writer has to be closed to write the end of the
+// compressed stream.
+func Compress(w io.Writer, algo string) (io.WriteCloser, error) {
+	compressors.RLock()
+	fn, ok := compressors.algos[algo]
+	compressors.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrCompression, algo)
+	}
+	return fn(w)
+}
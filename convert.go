@@ -0,0 +1,365 @@
+package log
+
+import (
+	"strings"
+)
+
+// converters translate the format of the log lines configured in other logging
+// libraries into an input pattern of this package. Padding and alignment are
+// handled by accepting any number of blanks where the other library adds
+// spaces. As %m reads until the end of the line, the text following the
+// message in the format can not be matched.
+
+var pythonAttrs = map[string]string{
+	"asctime":         "%t(%y-%m-%d %H:%M:%S,%L)",
+	"created":         "%t(%s.%f)",
+	"levelname":       "%l",
+	"message":         "%m",
+	"process":         "%p",
+	"processName":     "%n",
+	"name":            "%w(logger)",
+	"levelno":         "%w(levelno)",
+	"pathname":        "%w(pathname)",
+	"filename":        "%w(filename)",
+	"module":          "%w(module)",
+	"funcName":        "%w(func)",
+	"lineno":          "%w(lineno)",
+	"msecs":           "%w(msecs)",
+	"relativeCreated": "%w(relative)",
+	"thread":          "%w(thread)",
+	"threadName":      "%w(thread_name)",
+	"taskName":        "%w(task)",
+}
+
+// FromPython translates a format string of the Python logging module in the
+// % style (eg, "%(asctime)s %(levelname)-8s %(name)s: %(message)s") into an
+// input pattern. The default format of asctime is expected.
+func FromPython(format string) (string, error) {
+	var (
+		str strings.Builder
+		rs  = []rune(format)
+	)
+	for i := 0; i < len(rs); i++ {
+		if rs[i] != '%' {
+			writeConvertLiteral(&str, rs[i])
+			continue
+		}
+		i++
+		if i < len(rs) && rs[i] == '%' {
+			str.WriteString("%%")
+			continue
+		}
+		if i >= len(rs) || rs[i] != '(' {
+			return "", syntaxErrorAt("python", i, "%%( expected")
+		}
+		end := i + 1
+		for end < len(rs) && rs[end] != ')' {
+			end++
+		}
+		if end >= len(rs) {
+			return "", syntaxErrorAt("python", i, "missing )")
+		}
+		name := string(rs[i+1 : end])
+		i = end + 1
+		flags := i
+		for i < len(rs) && strings.ContainsRune("-+ #0123456789.", rs[i]) {
+			i++
+		}
+		if i >= len(rs) || !strings.ContainsRune("sdifrxXeEgGc", rs[i]) {
+			return "", syntaxError("python", "missing conversion type for %s", name)
+		}
+		pattern, ok := pythonAttrs[name]
+		if !ok {
+			return "", syntaxError("python", "unknown attribute %s", name)
+		}
+		writeConvertField(&str, pattern, string(rs[flags:i]))
+	}
+	return str.String(), nil
+}
+
+var log4jConversions = map[string]string{
+	"c":         "%w(logger)",
+	"lo":        "%w(logger)",
+	"logger":    "%w(logger)",
+	"C":         "%w(class)",
+	"class":     "%w(class)",
+	"t":         "%w(thread)",
+	"thread":    "%w(thread)",
+	"p":         "%l",
+	"le":        "%l",
+	"level":     "%l",
+	"m":         "%m",
+	"msg":       "%m",
+	"message":   "%m",
+	"L":         "%w(line)",
+	"line":      "%w(line)",
+	"F":         "%w(file)",
+	"file":      "%w(file)",
+	"M":         "%w(method)",
+	"method":    "%w(method)",
+	"l":         "%w(location)",
+	"r":         "%w(relative)",
+	"relative":  "%w(relative)",
+	"pid":       "%p",
+	"processId": "%p",
+	"h":         "%h",
+	"host":      "%h",
+}
+
+// log4jIgnored are the conversions that do not produce anything on the line
+// itself: end of line and stack traces.
+var log4jIgnored = map[string]bool{
+	"n":         true,
+	"ex":        true,
+	"xEx":       true,
+	"throwable": true,
+	"exception": true,
+	"rEx":       true,
+	"nopex":     true,
+}
+
+// log4jDates are the named date formats of log4j and logback.
+var log4jDates = map[string]string{
+	"":               "yyyy-MM-dd HH:mm:ss,SSS",
+	"DEFAULT":        "yyyy-MM-dd HH:mm:ss,SSS",
+	"ISO8601":        "yyyy-MM-dd'T'HH:mm:ss,SSS",
+	"ISO8601_BASIC":  "yyyyMMdd'T'HHmmss,SSS",
+	"ISO8601_OFFSET": "yyyy-MM-dd'T'HH:mm:ss,SSSXXX",
+	"ABSOLUTE":       "HH:mm:ss,SSS",
+	"DATE":           "dd MMM yyyy HH:mm:ss,SSS",
+	"COMPACT":        "yyyyMMddHHmmssSSS",
+}
+
+// FromLog4j translates a conversion pattern of log4j or logback (eg,
+// "%d{ISO8601} [%t] %-5p %c - %m%n") into an input pattern. Dates in the
+// %d conversion are given in the syntax of Java's SimpleDateFormat or with one
+// of the names known by log4j. The MDC values (%X{key}) are set in Named.
+func FromLog4j(pattern string) (string, error) {
+	var str strings.Builder
+	if err := convertLog4j(&str, []rune(pattern)); err != nil {
+		return "", err
+	}
+	return str.String(), nil
+}
+
+func convertLog4j(str *strings.Builder, rs []rune) error {
+	for i := 0; i < len(rs); i++ {
+		if rs[i] != '%' {
+			writeConvertLiteral(str, rs[i])
+			continue
+		}
+		i++
+		if i < len(rs) && rs[i] == '%' {
+			str.WriteString("%%")
+			continue
+		}
+		flags := i
+		for i < len(rs) && strings.ContainsRune("-.0123456789", rs[i]) {
+			i++
+		}
+		modifier := string(rs[flags:i])
+		name := i
+		for i < len(rs) && isLetter(rs[i]) {
+			i++
+		}
+		conv := string(rs[name:i])
+		if conv == "" {
+			return syntaxErrorAt("log4j", name, "conversion expected")
+		}
+		var inner []rune
+		if i < len(rs) && rs[i] == '(' {
+			end, err := matchingParen(rs, i)
+			if err != nil {
+				return err
+			}
+			inner, i = rs[i+1:end], end+1
+		}
+		var options []string
+		for i < len(rs) && rs[i] == '{' {
+			end := i + 1
+			for end < len(rs) && rs[end] != '}' {
+				end++
+			}
+			if end >= len(rs) {
+				return syntaxErrorAt("log4j", i, "missing }")
+			}
+			options, i = append(options, string(rs[i+1:end])), end+1
+		}
+		i--
+
+		if inner != nil {
+			// composite conversions (eg, %highlight(%-5level)) only decorate
+			// their content
+			if err := convertLog4j(str, inner); err != nil {
+				return err
+			}
+			continue
+		}
+		if log4jIgnored[conv] {
+			continue
+		}
+		var pattern string
+		switch conv {
+		case "d", "date":
+			var format string
+			if len(options) > 0 {
+				format = options[0]
+			}
+			if f, ok := log4jDates[format]; ok {
+				format = f
+			}
+			when := "%s"
+			if format != "UNIX" {
+				w, err := convertJavaDate(format)
+				if err != nil {
+					return err
+				}
+				when = w
+			}
+			pattern = "%t(" + when + ")"
+		case "X", "mdc", "MDC":
+			if len(options) == 0 || options[0] == "" {
+				pattern = "%*"
+				break
+			}
+			pattern = "%w(" + options[0] + ")"
+		default:
+			p, ok := log4jConversions[conv]
+			if !ok {
+				return syntaxError("log4j", "unknown conversion %%%s", conv)
+			}
+			pattern = p
+		}
+		writeConvertField(str, pattern, modifier)
+	}
+	return nil
+}
+
+func matchingParen(rs []rune, i int) (int, error) {
+	var depth int
+	for j := i; j < len(rs); j++ {
+		switch rs[j] {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return j, nil
+			}
+		}
+	}
+	return 0, syntaxErrorAt("log4j", i, "missing )")
+}
+
+var javaDates = []struct {
+	letters string
+	code    string
+}{
+	{letters: "yyyy", code: "%y"},
+	{letters: "MMMM", code: "%b"},
+	{letters: "MMM", code: "%b"},
+	{letters: "MM", code: "%m"},
+	{letters: "M", code: "%m"},
+	{letters: "dd", code: "%d"},
+	{letters: "d", code: "%d"},
+	{letters: "DDD", code: "%j"},
+	{letters: "HH", code: "%H"},
+	{letters: "H", code: "%H"},
+	{letters: "hh", code: "%h"},
+	{letters: "h", code: "%h"},
+	{letters: "mm", code: "%M"},
+	{letters: "m", code: "%M"},
+	{letters: "ss", code: "%S"},
+	{letters: "s", code: "%S"},
+	{letters: "SSSSSSSSS", code: "%N"},
+	{letters: "SSSSSS", code: "%E"},
+	{letters: "SSS", code: "%L"},
+	{letters: "EEEE", code: "%a"},
+	{letters: "EEE", code: "%a"},
+	{letters: "a", code: "%p"},
+	{letters: "XXX", code: "%Z"},
+	{letters: "XX", code: "%Z"},
+	{letters: "X", code: "%Z"},
+	{letters: "ZZ", code: "%Z"},
+	{letters: "Z", code: "%Z"},
+	{letters: "ww", code: "%V"},
+	{letters: "u", code: "%u"},
+}
+
+// convertJavaDate translates a date format of Java's SimpleDateFormat into a
+// time pattern.
+func convertJavaDate(format string) (string, error) {
+	var str strings.Builder
+	for i := 0; i < len(format); {
+		c := format[i]
+		if c == '\'' {
+			end := strings.IndexByte(format[i+1:], '\'')
+			if end < 0 {
+				return "", syntaxError("log4j", "unterminated quote in date %s", format)
+			}
+			if end == 0 {
+				str.WriteByte('\'')
+			}
+			str.WriteString(strings.ReplaceAll(format[i+1:i+1+end], "%", "%%"))
+			i += end + 2
+			continue
+		}
+		if !isLetter(rune(c)) {
+			if c == '%' {
+				str.WriteByte('%')
+			}
+			str.WriteByte(c)
+			i++
+			continue
+		}
+		n := i
+		for n < len(format) && format[n] == c {
+			n++
+		}
+		var code string
+		for _, d := range javaDates {
+			if format[i:n] == d.letters {
+				code = d.code
+				break
+			}
+		}
+		if code == "" {
+			return "", syntaxError("log4j", "unsupported date field %s", format[i:n])
+		}
+		str.WriteString(code)
+		i = n
+	}
+	return str.String(), nil
+}
+
+func writeConvertLiteral(str *strings.Builder, r rune) {
+	switch {
+	case isBlank(r):
+		if !strings.HasSuffix(str.String(), "%b") {
+			str.WriteString("%b")
+		}
+	case r == '%':
+		str.WriteString("%%")
+	case isEscape(r):
+		str.WriteRune('\\')
+		str.WriteRune(r)
+	default:
+		str.WriteRune(r)
+	}
+}
+
+// writeConvertField writes the pattern of a field. Blanks are accepted around
+// a field having a minimum width.
+func writeConvertField(str *strings.Builder, pattern, modifier string) {
+	modifier = strings.TrimLeft(modifier, "+ #0")
+	if modifier == "" || modifier[0] == '.' {
+		str.WriteString(pattern)
+		return
+	}
+	if modifier[0] != '-' && !strings.HasSuffix(str.String(), "%b") {
+		str.WriteString("%b")
+	}
+	str.WriteString(pattern)
+	if modifier[0] == '-' {
+		str.WriteString("%b")
+	}
+}
@@ -0,0 +1,227 @@
+package log
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// derived values
+// a value of transform (see transform.go) or a numeric function:
+// add(number...), sub(number...), mul(number...), div(number...),
+// mod(number, number), round(number[, digits])
+// numbers are fields, literals or numeric functions. Durations are counted in
+// seconds and times in seconds since the epoch.
+
+type derived struct {
+	name string
+	fn   func(Entry) interface{}
+}
+
+type numberfunc func(Entry) (float64, bool)
+
+var numericFuncs = map[string]func([]float64) (float64, bool){
+	"add": func(vs []float64) (float64, bool) {
+		var sum float64
+		for _, v := range vs {
+			sum += v
+		}
+		return sum, true
+	},
+	"sub": func(vs []float64) (float64, bool) {
+		if len(vs) == 0 {
+			return 0, false
+		}
+		res := vs[0]
+		for _, v := range vs[1:] {
+			res -= v
+		}
+		return res, true
+	},
+	"mul": func(vs []float64) (float64, bool) {
+		if len(vs) == 0 {
+			return 0, false
+		}
+		res := vs[0]
+		for _, v := range vs[1:] {
+			res *= v
+		}
+		return res, true
+	},
+	"div": func(vs []float64) (float64, bool) {
+		if len(vs) == 0 {
+			return 0, false
+		}
+		res := vs[0]
+		for _, v := range vs[1:] {
+			if v == 0 {
+				return 0, false
+			}
+			res /= v
+		}
+		return res, true
+	},
+	"mod": func(vs []float64) (float64, bool) {
+		if len(vs) != 2 || vs[1] == 0 {
+			return 0, false
+		}
+		return math.Mod(vs[0], vs[1]), true
+	},
+	"round": func(vs []float64) (float64, bool) {
+		switch len(vs) {
+		case 1:
+			return math.Round(vs[0]), true
+		case 2:
+			p := math.Pow(10, math.Trunc(vs[1]))
+			return math.Round(vs[0]*p) / p, true
+		default:
+			return 0, false
+		}
+	},
+}
+
+// Derive adds a field computed from the entries once they are parsed and
+// before they are filtered. The value is stored in Values and its text in
+// Named so that it can be used by filters (named.<name>), printed and
+// aggregated. Nothing is stored when fn returns nil.
+func (r *Reader) Derive(name string, fn func(Entry) interface{}) {
+	r.derived = append(r.derived, derived{name: name, fn: fn})
+}
+
+// CompileDerive compiles an expression giving the value of a derived field, eg,
+// div(named.latency_us, 1000) or concat(host, ":", named.port).
+func CompileDerive(expr string) (func(Entry) interface{}, error) {
+	f := filter{input: expr, what: "derive"}
+	fn, err := f.parseDerived()
+	if err != nil {
+		return nil, err
+	}
+	if f.skip(); f.pos < len(f.input) {
+		return nil, f.errorf("unexpected %q", f.input[f.pos:])
+	}
+	return fn, nil
+}
+
+func (f *filter) parseDerived() (func(Entry) interface{}, error) {
+	offset := f.pos
+	name := f.ident()
+	if _, ok := numericFuncs[name]; ok && f.accept('(') {
+		num, err := f.parseNumberCall(name)
+		if err != nil {
+			return nil, err
+		}
+		fn := func(e Entry) interface{} {
+			if v, ok := num(e); ok {
+				return v
+			}
+			return nil
+		}
+		return fn, nil
+	}
+	if isField(name) && !f.accept('(') {
+		return func(e Entry) interface{} { return getField(e, name) }, nil
+	}
+	f.pos = offset
+	value, err := f.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	fn := func(e Entry) interface{} {
+		if str := value(e); str != "" {
+			return str
+		}
+		return nil
+	}
+	return fn, nil
+}
+
+func (f *filter) parseNumber() (numberfunc, error) {
+	offset := f.pos
+	name := f.ident()
+	if _, ok := numericFuncs[name]; ok && f.accept('(') {
+		return f.parseNumberCall(name)
+	}
+	if isField(name) && !f.accept('(') {
+		return func(e Entry) (float64, bool) { return toFloat(getField(e, name)) }, nil
+	}
+	f.pos = offset
+	value, err := f.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	return func(e Entry) (float64, bool) { return toFloat(value(e)) }, nil
+}
+
+func (f *filter) parseNumberCall(name string) (numberfunc, error) {
+	var args []numberfunc
+	for !f.accept(')') {
+		if len(args) > 0 {
+			if err := f.expect(','); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := f.parseNumber()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return numberCall(name, args), nil
+}
+
+func numberCall(name string, args []numberfunc) numberfunc {
+	apply := numericFuncs[name]
+	return func(e Entry) (float64, bool) {
+		vs := make([]float64, len(args))
+		for i, a := range args {
+			v, ok := a(e)
+			if !ok {
+				return 0, false
+			}
+			vs[i] = v
+		}
+		return apply(vs)
+	}
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	case time.Duration:
+		return v.Seconds(), true
+	case time.Time:
+		if v.IsZero() {
+			return 0, false
+		}
+		return float64(v.UnixNano()) / float64(time.Second), true
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return n, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func (r *Reader) derive(e *Entry) {
+	for _, d := range r.derived {
+		setDerived(e, d.name, d.fn(*e))
+	}
+}
+
+func setDerived(e *Entry, name string, value interface{}) {
+	if value == nil {
+		delete(e.Named, name)
+		delete(e.Values, name)
+		return
+	}
+	if _, ok := value.(string); ok {
+		delete(e.Values, name)
+	} else {
+		e.setValue(name, value)
+	}
+	e.setNamed(name, fieldString(value))
+}
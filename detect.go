@@ -0,0 +1,95 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+)
+
+const detectLines = 64
+
+// DetectFormat samples the first lines of r and returns the name of the input
+// preset that matches them best. The confidence is the average part of the
+// lines consumed by the preset, between 0 and 1. When several presets have
+// the same confidence, the one extracting the most fields wins.
+func DetectFormat(r io.Reader) (string, float64, error) {
+	var (
+		scan  = bufio.NewScanner(r)
+		lines [][]byte
+	)
+	for len(lines) < detectLines && scan.Scan() {
+		line := bytes.TrimRight(scan.Bytes(), "\r")
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		lines = append(lines, append([]byte(nil), line...))
+	}
+	if err := scan.Err(); err != nil {
+		return "", 0, err
+	}
+	if len(lines) == 0 {
+		return "", 0, fmt.Errorf("%w: no line to detect format", ErrPattern)
+	}
+	type candidate struct {
+		name   string
+		score  float64
+		fields int
+	}
+	var list []candidate
+	for _, p := range Presets() {
+		if p.Kind != KindInput {
+			continue
+		}
+		parse, err := parsePattern(p.Pattern, config{})
+		if err != nil {
+			continue
+		}
+		c := candidate{name: p.Name}
+		for _, line := range lines {
+			var (
+				e   Entry
+				str = newScanner(line)
+			)
+			if parse(&e, str) != nil {
+				continue
+			}
+			c.score += float64(len(line)-str.Len()) / float64(len(line))
+			c.fields += countFields(e)
+		}
+		if c.score > 0 {
+			c.score /= float64(len(lines))
+			list = append(list, c)
+		}
+	}
+	if len(list) == 0 {
+		return "", 0, fmt.Errorf("%w: no preset matches input", ErrPattern)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].score == list[j].score {
+			return list[i].fields > list[j].fields
+		}
+		return list[i].score > list[j].score
+	})
+	return list[0].name, list[0].score, nil
+}
+
+func countFields(e Entry) int {
+	n := len(e.Named) + len(e.Words)
+	for _, ok := range []bool{
+		e.Pid != 0,
+		e.Process != "",
+		e.User != "",
+		e.Group != "",
+		e.Level != "",
+		e.Message != "",
+		e.Host != "",
+		!e.When.IsZero(),
+	} {
+		if ok {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,105 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Difference groups the entries having the same key that are only found in
+// one of the streams compared by Diff. Sample is the first of them.
+type Difference struct {
+	Key    string `json:"key"`
+	Count  int    `json:"count"`
+	Sample Entry  `json:"sample"`
+}
+
+// Changes are the entries only found in the first stream (Removed) and the
+// ones only found in the second (Added), in the order they were first seen.
+type Changes struct {
+	Removed []Difference `json:"removed"`
+	Added   []Difference `json:"added"`
+}
+
+// Diff compares the entries of a and b by key. Without key fields, the key of
+// an entry is its message with the numbers masked, like the messages of a
+// Report, so that the same template with other ids or durations is the same
+// entry. Otherwise, it is made of the values of the given fields. Both
+// readers are read at the same time.
+func Diff(a, b *Reader, keyFields []string) (Changes, error) {
+	var c Changes
+	for _, f := range keyFields {
+		if !isField(f) {
+			return c, fmt.Errorf("%s: unknown field", f)
+		}
+	}
+	type result struct {
+		keys *keyCount
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		keys, err := countKeys(a, keyFields)
+		ch <- result{keys: keys, err: err}
+	}()
+	right, err := countKeys(b, keyFields)
+	res := <-ch
+	if res.err != nil {
+		return c, res.err
+	}
+	if err != nil {
+		return c, err
+	}
+	c.Removed = res.keys.missing(right)
+	c.Added = right.missing(res.keys)
+	return c, nil
+}
+
+type keyCount struct {
+	order []string
+	diffs map[string]*Difference
+}
+
+func countKeys(r *Reader, fields []string) (*keyCount, error) {
+	k := keyCount{diffs: make(map[string]*Difference)}
+	for {
+		e, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		key := entryKey(e, fields)
+		if d, ok := k.diffs[key]; ok {
+			d.Count++
+			r.Release(e)
+			continue
+		}
+		k.order = append(k.order, key)
+		k.diffs[key] = &Difference{Key: key, Count: 1, Sample: e}
+	}
+	return &k, nil
+}
+
+// missing gives the keys of k not found in other.
+func (k *keyCount) missing(other *keyCount) []Difference {
+	var list []Difference
+	for _, key := range k.order {
+		if _, ok := other.diffs[key]; !ok {
+			list = append(list, *k.diffs[key])
+		}
+	}
+	return list
+}
+
+func entryKey(e Entry, fields []string) string {
+	if len(fields) == 0 {
+		return messageKey(e.Message)
+	}
+	parts := make([]string, len(fields))
+	for i, f := range fields {
+		parts[i] = f + "=" + fieldString(getField(e, f))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,118 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SyntaxError is the error of an invalid pattern, filter, transform or query.
+// It wraps ErrSyntax.
+type SyntaxError struct {
+	// What is the kind of expression, eg, filter, sql, print or the name of a
+	// specifier. It is empty for the patterns themselves.
+	What string
+	// Pos is the byte offset of the error in the expression or -1 when it is
+	// not known.
+	Pos int
+	// Expected is what was expected at Pos and Got what was found there, when
+	// they are known.
+	Expected string
+	Got      string
+	Msg      string
+}
+
+func syntaxError(what, format string, args ...interface{}) error {
+	return syntaxErrorAt(what, -1, format, args...)
+}
+
+func syntaxErrorAt(what string, pos int, format string, args ...interface{}) *SyntaxError {
+	return &SyntaxError{
+		What: what,
+		Pos:  pos,
+		Msg:  fmt.Sprintf(format, args...),
+	}
+}
+
+func (e *SyntaxError) Error() string {
+	var str strings.Builder
+	str.WriteString(ErrSyntax.Error())
+	if e.What != "" {
+		str.WriteString("(" + e.What + ")")
+	}
+	str.WriteString(": ")
+	switch {
+	case e.Msg != "":
+		str.WriteString(e.Msg)
+	case e.Expected != "":
+		str.WriteString(e.Expected + " expected")
+	default:
+		fmt.Fprintf(&str, "unexpected %q", e.Got)
+	}
+	if e.Pos >= 0 {
+		fmt.Fprintf(&str, " at position %d", e.Pos)
+	}
+	return str.String()
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return ErrSyntax
+}
+
+// MatchError is the error of a line not matching the input pattern. It is
+// matched by ErrPattern with errors.Is and wraps the cause of the mismatch,
+// like a ValueError.
+type MatchError struct {
+	// Specifier is the specifier (eg, %t) or the text of the pattern that does
+	// not match.
+	Specifier string
+	// Offset is the byte offset in the line where Specifier starts to be
+	// matched.
+	Offset int
+	Err    error
+}
+
+func (e *MatchError) Error() string {
+	msg := fmt.Sprintf("%s: %s does not match at offset %d", ErrPattern, e.Specifier, e.Offset)
+	if e.Err != nil && e.Err != ErrPattern {
+		msg += " (" + strings.TrimPrefix(e.Err.Error(), ErrPattern.Error()+": ") + ")"
+	}
+	return msg
+}
+
+func (e *MatchError) Unwrap() error {
+	return e.Err
+}
+
+func (e *MatchError) Is(target error) bool {
+	return target == ErrPattern
+}
+
+// ValueError is the error of a value of a line that can not be converted to
+// the type of its field (eg, %w(status:int)). Like MatchError, it is matched by
+// ErrPattern since the line is rejected.
+type ValueError struct {
+	Field string
+	Value string
+	Err   error
+}
+
+func (e *ValueError) Error() string {
+	return fmt.Sprintf("%s: %s: %q is not a valid value", ErrPattern, e.Field, e.Value)
+}
+
+func (e *ValueError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ValueError) Is(target error) bool {
+	return target == ErrPattern
+}
+
+// matchError gives err as the MatchError of spec starting at offset, unless it
+// is already one of a nested specifier.
+func matchError(spec string, offset int, err error) error {
+	if _, ok := err.(*MatchError); ok {
+		return err
+	}
+	return &MatchError{Specifier: spec, Offset: offset, Err: err}
+}
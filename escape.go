@@ -0,0 +1,159 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Escape controls how a Writer writes the control characters and the ANSI
+// escape sequences of the fields. The literal text of the pattern is always
+// written as is.
+type Escape int
+
+const (
+	// EscapeNone writes the fields as is.
+	EscapeNone Escape = iota
+	// EscapeControl writes the control characters as escape sequences (\n,
+	// \t, \x1b,...) so that an entry is always written on one line.
+	EscapeControl
+	// EscapeStrip replaces the newlines and tabs by a blank and removes the
+	// other control characters and the ANSI escape sequences.
+	EscapeStrip
+)
+
+// ParseEscape gives the Escape mode from its name: raw (or none), escape or
+// strip.
+func ParseEscape(name string) (Escape, error) {
+	switch name {
+	case "", "raw", "none":
+		return EscapeNone, nil
+	case "escape":
+		return EscapeControl, nil
+	case "strip":
+		return EscapeStrip, nil
+	default:
+		return EscapeNone, fmt.Errorf("%s: unknown escape mode", name)
+	}
+}
+
+func (e Escape) String() string {
+	switch e {
+	case EscapeControl:
+		return "escape"
+	case EscapeStrip:
+		return "strip"
+	default:
+		return "raw"
+	}
+}
+
+type escapeWriter struct {
+	inner *bytes.Buffer
+	mode  Escape
+}
+
+func (w escapeWriter) WriteString(str string) (int, error) {
+	if w.mode == EscapeStrip {
+		str = stripString(str)
+	} else {
+		str = escapeString(str)
+	}
+	return w.inner.WriteString(str)
+}
+
+func escapeString(str string) string {
+	if !hasControl(str) {
+		return str
+	}
+	var buf strings.Builder
+	for i := 0; i < len(str); {
+		r, n := utf8.DecodeRuneInString(str[i:])
+		switch {
+		case r == utf8.RuneError && n == 1:
+			buf.WriteByte(str[i])
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r < utf8.RuneSelf && unicode.IsControl(r):
+			fmt.Fprintf(&buf, `\x%02x`, r)
+		case unicode.IsControl(r):
+			fmt.Fprintf(&buf, `\u%04x`, r)
+		default:
+			buf.WriteString(str[i : i+n])
+		}
+		i += n
+	}
+	return buf.String()
+}
+
+func stripString(str string) string {
+	if !hasControl(str) {
+		return str
+	}
+	var (
+		buf   strings.Builder
+		blank bool
+	)
+	for i := 0; i < len(str); {
+		r, n := utf8.DecodeRuneInString(str[i:])
+		switch {
+		case r == '\x1b':
+			n = ansiLength(str[i:])
+		case r == '\n' || r == '\r' || r == '\t':
+			blank = buf.Len() > 0
+		case unicode.IsControl(r):
+		default:
+			if blank {
+				buf.WriteByte(' ')
+				blank = false
+			}
+			buf.WriteString(str[i : i+n])
+		}
+		i += n
+	}
+	return buf.String()
+}
+
+// ansiLength gives the length of the escape sequence at the start of str: CSI
+// (ESC [ ... final byte), OSC (ESC ] ... BEL or ESC \) or ESC followed by one
+// character.
+func ansiLength(str string) int {
+	if len(str) < 2 {
+		return len(str)
+	}
+	switch str[1] {
+	case '[':
+		for i := 2; i < len(str); i++ {
+			if str[i] >= 0x40 && str[i] <= 0x7e {
+				return i + 1
+			}
+		}
+	case ']':
+		for i := 2; i < len(str); i++ {
+			if str[i] == '\a' {
+				return i + 1
+			}
+			if str[i] == '\x1b' && i+1 < len(str) && str[i+1] == '\\' {
+				return i + 2
+			}
+		}
+	default:
+		return 2
+	}
+	return len(str)
+}
+
+func hasControl(str string) bool {
+	for _, r := range str {
+		if unicode.IsControl(r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,246 @@
+package log
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// inline expressions of the output patterns (%{expr})
+// expr: term, expr + term, expr - term
+// term: factor, term * factor, term / factor, term % factor
+// factor: number, "string", field, function(expr...), (expr), -factor
+// functions are the values of transform (lower, upper, trim, concat) and the
+// numeric functions of derive (add, sub, mul, div, mod, round). Arithmetic is
+// done on the numeric values of the fields (see toFloat) and gives nothing
+// when a value is not a number or on a division by zero. The names of the
+// fields end at a -, taken as a minus: named.bytes-96 is named.bytes minus 96.
+
+type exprfunc func(Entry) interface{}
+
+// compileExpr compiles an inline expression and gives the fields it uses.
+func compileExpr(expr string) (exprfunc, []string, error) {
+	f := filter{input: expr, what: "expr"}
+	fn, err := f.parseExpr()
+	if err != nil {
+		return nil, nil, err
+	}
+	if f.skip(); f.pos < len(f.input) {
+		return nil, nil, f.errorf("unexpected %q", f.input[f.pos:])
+	}
+	return fn, uniqueFields(f.fields), nil
+}
+
+func (f *filter) parseExpr() (exprfunc, error) {
+	return f.parseBinary("+-", f.parseTerm)
+}
+
+func (f *filter) parseTerm() (exprfunc, error) {
+	return f.parseBinary("*/%", f.parseFactor)
+}
+
+// parseBinary parses the operands given by next separated by one of ops, from
+// left to right.
+func (f *filter) parseBinary(ops string, next func() (exprfunc, error)) (exprfunc, error) {
+	left, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		f.skip()
+		if f.pos >= len(f.input) || strings.IndexByte(ops, f.input[f.pos]) < 0 {
+			return left, nil
+		}
+		op := f.input[f.pos]
+		f.pos++
+		right, err := next()
+		if err != nil {
+			return nil, err
+		}
+		left = arithmetic(op, left, right)
+	}
+}
+
+func (f *filter) parseFactor() (exprfunc, error) {
+	f.skip()
+	if f.pos >= len(f.input) {
+		return nil, f.errorf("value expected")
+	}
+	switch c := f.input[f.pos]; {
+	case c == '(':
+		f.pos++
+		fn, err := f.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		return fn, f.expect(')')
+	case c == '-':
+		f.pos++
+		fn, err := f.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		zero := func(_ Entry) interface{} { return 0.0 }
+		return arithmetic('-', zero, fn), nil
+	case isQuote(rune(c)):
+		lit, err := f.parseLiteral(isArgument)
+		if err != nil {
+			return nil, err
+		}
+		return func(_ Entry) interface{} { return lit.raw }, nil
+	case isDigit(rune(c)) || c == '.':
+		start := f.pos
+		for f.pos < len(f.input) && (isDigit(rune(f.input[f.pos])) || f.input[f.pos] == '.') {
+			f.pos++
+		}
+		lit := f.input[start:f.pos]
+		n, err := strconv.ParseFloat(lit, 64)
+		if err != nil {
+			f.pos = start
+			return nil, f.errorf("invalid number %s", lit)
+		}
+		return func(_ Entry) interface{} { return n }, nil
+	}
+	offset := f.pos
+	name := f.exprIdent()
+	if name != "" && f.accept('(') {
+		return f.parseExprCall(name)
+	}
+	if !isField(name) {
+		f.pos = offset
+		if name == "" {
+			return nil, f.errorf("unexpected %q", f.input[f.pos:f.pos+1])
+		}
+		return nil, f.errorf("%s: unknown field", name)
+	}
+	f.addField(name)
+	return func(e Entry) interface{} { return getField(e, name) }, nil
+}
+
+// exprIdent is like ident but a - ends the name.
+func (f *filter) exprIdent() string {
+	f.skip()
+	start := f.pos
+	for f.pos < len(f.input) {
+		r, n := utf8.DecodeRuneInString(f.input[f.pos:])
+		if r == '-' || (!isAlpha(r) && r != '.') {
+			break
+		}
+		f.pos += n
+	}
+	return f.input[start:f.pos]
+}
+
+func (f *filter) parseExprCall(name string) (exprfunc, error) {
+	var args []exprfunc
+	for !f.accept(')') {
+		if len(args) > 0 {
+			if err := f.expect(','); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := f.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	if _, ok := numericFuncs[name]; ok {
+		nums := make([]numberfunc, len(args))
+		for i := range args {
+			arg := args[i]
+			nums[i] = func(e Entry) (float64, bool) { return toFloat(arg(e)) }
+		}
+		num := numberCall(name, nums)
+		fn := func(e Entry) interface{} {
+			if v, ok := num(e); ok {
+				return v
+			}
+			return nil
+		}
+		return fn, nil
+	}
+	values := make([]valuefunc, len(args))
+	for i := range args {
+		arg := args[i]
+		values[i] = func(e Entry) string { return fieldString(arg(e)) }
+	}
+	value, err := f.valueCall(name, values)
+	if err != nil {
+		return nil, err
+	}
+	return func(e Entry) interface{} { return value(e) }, nil
+}
+
+func arithmetic(op byte, left, right exprfunc) exprfunc {
+	return func(e Entry) interface{} {
+		x, ok := toFloat(left(e))
+		if !ok {
+			return nil
+		}
+		y, ok := toFloat(right(e))
+		if !ok {
+			return nil
+		}
+		switch op {
+		case '+':
+			return x + y
+		case '-':
+			return x - y
+		case '*':
+			return x * y
+		case '/':
+			if y == 0 {
+				return nil
+			}
+			return x / y
+		default:
+			if y == 0 {
+				return nil
+			}
+			return math.Mod(x, y)
+		}
+	}
+}
+
+// parseExprArgument gives the expression of %{expr}, up to the closing brace
+// not in a quoted string.
+func parseExprArgument(str *bytes.Reader) (string, error) {
+	var (
+		buf   bytes.Buffer
+		quote rune
+	)
+	for str.Len() > 0 {
+		r, _, _ := str.ReadRune()
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case isQuote(r):
+			quote = r
+		case r == '}':
+			return buf.String(), nil
+		}
+		buf.WriteRune(r)
+	}
+	return "", syntaxError("expr", "missing }")
+}
+
+func printExpr(str *bytes.Reader) (printfunc, error) {
+	expr, err := parseExprArgument(str)
+	if err != nil {
+		return nil, err
+	}
+	fn, _, err := compileExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	print := func(e Entry, w io.StringWriter) {
+		printString(fieldString(fn(e)), w)
+	}
+	return print, nil
+}
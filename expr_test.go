@@ -0,0 +1,48 @@
+package log
+
+import (
+	"testing"
+)
+
+func TestExpr(t *testing.T) {
+	e := Entry{
+		Level:   "warn",
+		Process: "nginx",
+		Named:   map[string]string{"bytes": "2048", "ms": "250", "name": "a-b"},
+	}
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"%{named.bytes/1024}KB", "2KB"},
+		{"%{upper(level)}", "WARN"},
+		{"%{named.bytes-96}", "1952"},
+		{"%{named.bytes - 96}", "1952"},
+		{"%{(named.bytes-48)/1000}", "2"},
+		{"%{named.bytes-named.ms*2}", "1548"},
+		{"%{-named.ms+1}", "-249"},
+		{"%{named.ms%7}", "5"},
+		{"%{named.ms/0}", "N/A"},
+		{"%{named.missing-1}", "N/A"},
+		{"%{concat(process, \"-\", named.name)}", "nginx-a-b"},
+		{"%{round(named.ms/3)}", "83"},
+	}
+	for _, tt := range tests {
+		o, err := CompileOutput(tt.pattern)
+		if err != nil {
+			t.Errorf("%s: %s", tt.pattern, err)
+			continue
+		}
+		if got := o.Format(e); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestExprErrors(t *testing.T) {
+	for _, pattern := range []string{"%{named.bytes-}", "%{nope}", "%{(1+2}", "%{1 2}", "%{unknown(level)}", "%{}"} {
+		if _, err := CompileOutput(pattern); err == nil {
+			t.Errorf("%s: compiled", pattern)
+		}
+	}
+}
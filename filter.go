@@ -0,0 +1,1187 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// filters can span multiple lines and contain comments starting with #
+
+// filter functions
+// and(filter, filter...): all filters should match
+// or(filter, filter...): at least one filter should match
+// not(filter): filter should not match
+// eq(field, value), ne(field, value)
+// lt(field, value), le(field, value), gt(field, value), ge(field, value)
+// the value of a comparison can be @field to compare with another field of
+// the entry (eg, gt(named.end, @named.start))
+// between(field, lower, upper): lower <= field <= upper
+// like(field, value): field contains value
+// prefix(field, value): field starts with value
+// suffix(field, value): field ends with value
+// match(field, regexp): field matches regexp
+// glob(field, pattern): field matches glob pattern (*, ?, [...])
+// cidr(field, network): field is an address in network (eg, 10.0.0.0/8)
+// ieq, ine, ilike, iprefix, isuffix, imatch, iglob: same as above ignoring case
+// olderthan(field, duration[, reference]): field is before reference minus duration
+// youngerthan(field, duration[, reference]): field is after reference minus duration
+// sample(ratio[, seed]): keep randomly the given ratio of entries
+// every(n): keep one entry every n entries
+// first(field...): keep the first entry of each distinct value of the fields
+// seen(field...): keep the entries whose values of the fields were already seen
+// rate(op, n/unit): keep the entries when the number of entries of the last
+// unit (eg, 100/min or 5/10s) compares to n with op (lt, le, gt or ge)
+// stateful functions (sample, every, first, seen, rate) only count the entries
+// they are evaluated on
+
+// infix operators
+// field == value, field != value
+// field < value, field <= value, field > value, field >= value
+// field ~= regexp, field !~ regexp
+// filter && filter, filter || filter, !filter, (filter)
+// function calls can be mixed with infix expressions
+
+// fields
+// time, process, pid, user, group, host, ip, port, level, message, named.<name>
+// file, offset, origin, pattern (name of the alternative that matched)
+// lino (line number in the input), line (raw line)
+// seq (number of the entry in the output of Merge and Concat)
+
+// Filter is a compiled filter. It can be given to several Readers with
+// WithFilter and used by several goroutines at the same time. The state of its
+// stateful functions is then shared by all of them.
+type Filter struct {
+	source string
+	keep   filterfunc
+	fields []string
+	// set when the filter has stateful functions
+	mu *sync.Mutex
+}
+
+// CompileFilter compiles a filter. An empty filter matches all the entries.
+func CompileFilter(expr string) (*Filter, error) {
+	f := filter{input: expr}
+	keep, err := f.compile()
+	if err != nil {
+		return nil, err
+	}
+	c := Filter{
+		source: expr,
+		keep:   keep,
+		fields: uniqueFields(f.fields),
+	}
+	if f.stateful {
+		c.mu = new(sync.Mutex)
+	}
+	return &c, nil
+}
+
+// Match tells whether e matches the filter.
+func (f *Filter) Match(e Entry) bool {
+	if f.mu != nil {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+	}
+	return f.keep(e)
+}
+
+// Fields gives the fields used by the filter.
+func (f *Filter) Fields() []string {
+	return f.fields
+}
+
+func (f *Filter) String() string {
+	return f.source
+}
+
+func parseFilter(str string) (filterfunc, error) {
+	f := filter{input: str}
+	return f.compile()
+}
+
+func (f *filter) compile() (filterfunc, error) {
+	if f.skip(); f.pos >= len(f.input) {
+		return keepAll, nil
+	}
+	fn, err := f.parse()
+	if err != nil {
+		return nil, err
+	}
+	if f.skip(); f.pos < len(f.input) {
+		return nil, f.errorf("unexpected %q", f.input[f.pos:])
+	}
+	return fn, nil
+}
+
+func keepAll(_ Entry) bool {
+	return true
+}
+
+type filter struct {
+	input string
+	pos   int
+	what  string
+
+	// terms are the values searched by like and match, not under a negation,
+	// that can be highlighted in the output
+	terms  []term
+	negate int
+
+	// fields are the fields used by the expression
+	fields []string
+	// stateful is set when sample, every, first, seen or rate is used
+	stateful bool
+}
+
+type term struct {
+	field string
+	re    *regexp.Regexp
+}
+
+func (f *filter) addTerm(field string, re *regexp.Regexp) {
+	if f.negate%2 == 0 {
+		f.terms = append(f.terms, term{field: field, re: re})
+	}
+}
+
+func (f *filter) addField(field string) {
+	f.fields = append(f.fields, field)
+}
+
+func (f *filter) parse() (filterfunc, error) {
+	return f.parseOr()
+}
+
+func (f *filter) parseOr() (filterfunc, error) {
+	fs, err := f.parseInfix("||", f.parseAnd)
+	if err != nil {
+		return nil, err
+	}
+	if len(fs) == 1 {
+		return fs[0], nil
+	}
+	return mergeFilter(fs, false), nil
+}
+
+func (f *filter) parseAnd() (filterfunc, error) {
+	fs, err := f.parseInfix("&&", f.parseUnary)
+	if err != nil {
+		return nil, err
+	}
+	if len(fs) == 1 {
+		return fs[0], nil
+	}
+	return mergeFilter(fs, true), nil
+}
+
+func (f *filter) parseInfix(op string, next func() (filterfunc, error)) ([]filterfunc, error) {
+	var fs []filterfunc
+	for {
+		fn, err := next()
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, fn)
+		if !f.acceptOp(op) {
+			break
+		}
+	}
+	return fs, nil
+}
+
+func (f *filter) parseUnary() (filterfunc, error) {
+	if f.acceptOp("!") {
+		f.negate++
+		fn, err := f.parseUnary()
+		f.negate--
+		if err != nil {
+			return nil, err
+		}
+		return func(e Entry) bool { return !fn(e) }, nil
+	}
+	if f.accept('(') {
+		fn, err := f.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return fn, f.expect(')')
+	}
+	name := f.ident()
+	if name == "" {
+		return nil, f.errorf("filter expected")
+	}
+	if f.accept('(') {
+		return f.parseCall(name)
+	}
+	return f.parseOperator(name)
+}
+
+var operators = []string{"==", "!=", "<=", ">=", "<", ">", "~=", "!~"}
+
+func (f *filter) parseOperator(field string) (filterfunc, error) {
+	if !isField(field) {
+		return nil, f.errorf("unknown field %s", field)
+	}
+	f.addField(field)
+	var op string
+	for _, o := range operators {
+		if f.acceptOp(o) {
+			op = o
+			break
+		}
+	}
+	if op == "" {
+		return nil, f.errorf("operator expected after %s", field)
+	}
+	lit, err := f.parseOperand(isOperand)
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "~=", "!~":
+		if lit.ref != "" {
+			return nil, f.errorf("regexp expected after %s", op)
+		}
+		re, err := regexp.Compile(lit.raw)
+		if err != nil {
+			return nil, f.errorf("%s", err)
+		}
+		fn := makeMatch(field, re)
+		if op == "!~" {
+			return func(e Entry) bool { return !fn(e) }, nil
+		}
+		f.addTerm(field, re)
+		return fn, nil
+	case "==":
+		return makeCompare(field, "eq", lit), nil
+	case "!=":
+		return makeCompare(field, "ne", lit), nil
+	case "<":
+		return makeCompare(field, "lt", lit), nil
+	case "<=":
+		return makeCompare(field, "le", lit), nil
+	case ">":
+		return makeCompare(field, "gt", lit), nil
+	default:
+		return makeCompare(field, "ge", lit), nil
+	}
+}
+
+func (f *filter) parseCall(name string) (filterfunc, error) {
+	var (
+		fn  filterfunc
+		err error
+	)
+	switch name {
+	case "and", "or":
+		fn, err = f.parseLogical(name == "and")
+	case "not":
+		f.negate++
+		fn, err = f.parse()
+		f.negate--
+		if err == nil {
+			keep := fn
+			fn = func(e Entry) bool { return !keep(e) }
+		}
+	case "eq", "ne", "lt", "le", "gt", "ge":
+		fn, err = f.parseCompare(name, false)
+	case "ieq", "ine":
+		fn, err = f.parseCompare(name[1:], true)
+	case "between":
+		fn, err = f.parseBetween()
+	case "like", "ilike":
+		fn, err = f.parseText(strings.Contains, name == "ilike", true)
+	case "prefix", "iprefix":
+		fn, err = f.parseText(strings.HasPrefix, name == "iprefix", false)
+	case "suffix", "isuffix":
+		fn, err = f.parseText(strings.HasSuffix, name == "isuffix", false)
+	case "match", "imatch":
+		fn, err = f.parseMatch(regexp.Compile, name == "imatch", true)
+	case "glob", "iglob":
+		fn, err = f.parseMatch(compileGlob, name == "iglob", false)
+	case "cidr":
+		fn, err = f.parseCIDR()
+	case "olderthan", "youngerthan":
+		fn, err = f.parseAge(name == "olderthan")
+	case "sample":
+		fn, err = f.parseSample()
+	case "every":
+		fn, err = f.parseEvery()
+	case "first", "seen":
+		fn, err = f.parseSeen(name == "first")
+	case "rate":
+		fn, err = f.parseRate()
+	default:
+		return nil, f.errorf("unknown function %s", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fn, f.expect(')')
+}
+
+func (f *filter) parseLogical(all bool) (filterfunc, error) {
+	var fs []filterfunc
+	for {
+		fn, err := f.parse()
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, fn)
+		if !f.accept(',') {
+			break
+		}
+	}
+	return mergeFilter(fs, all), nil
+}
+
+func mergeFilter(fs []filterfunc, all bool) filterfunc {
+	return func(e Entry) bool {
+		for _, keep := range fs {
+			if keep(e) != all {
+				return !all
+			}
+		}
+		return all
+	}
+}
+
+func (f *filter) parseCompare(op string, fold bool) (filterfunc, error) {
+	field, err := f.parseField()
+	if err != nil {
+		return nil, err
+	}
+	if err := f.expect(','); err != nil {
+		return nil, err
+	}
+	lit, err := f.parseOperand(isArgument)
+	if err != nil {
+		return nil, err
+	}
+	lit.fold = fold
+	return makeCompare(field, op, lit), nil
+}
+
+func makeCompare(field, op string, lit literal) filterfunc {
+	var test func(int) bool
+	switch op {
+	case "eq":
+		test = func(c int) bool { return c == 0 }
+	case "ne":
+		test = func(c int) bool { return c != 0 }
+	case "lt":
+		test = func(c int) bool { return c < 0 }
+	case "le":
+		test = func(c int) bool { return c <= 0 }
+	case "gt":
+		test = func(c int) bool { return c > 0 }
+	case "ge":
+		test = func(c int) bool { return c >= 0 }
+	}
+	return func(e Entry) bool {
+		cmp := lit
+		if lit.ref != "" {
+			v := getField(e, lit.ref)
+			if v == nil {
+				return op == "ne"
+			}
+			cmp = valueLiteral(v)
+			cmp.fold = lit.fold
+		}
+		c, ok := cmp.compare(getField(e, field))
+		if !ok {
+			return op == "ne"
+		}
+		return test(c)
+	}
+}
+
+func (f *filter) parseBetween() (filterfunc, error) {
+	field, err := f.parseField()
+	if err != nil {
+		return nil, err
+	}
+	var lits [2]literal
+	for i := range lits {
+		if err := f.expect(','); err != nil {
+			return nil, err
+		}
+		if lits[i], err = f.parseLiteral(isArgument); err != nil {
+			return nil, err
+		}
+	}
+	fn := func(e Entry) bool {
+		v := getField(e, field)
+		lo, ok1 := lits[0].compare(v)
+		hi, ok2 := lits[1].compare(v)
+		return ok1 && ok2 && lo >= 0 && hi <= 0
+	}
+	return fn, nil
+}
+
+func (f *filter) parseText(cmp func(string, string) bool, fold, mark bool) (filterfunc, error) {
+	field, lit, err := f.parseArguments()
+	if err != nil {
+		return nil, err
+	}
+	if mark {
+		expr := regexp.QuoteMeta(lit.raw)
+		if fold {
+			expr = "(?i)" + expr
+		}
+		f.addTerm(field, regexp.MustCompile(expr))
+	}
+	if fold {
+		lit.raw = strings.ToLower(lit.raw)
+	}
+	fn := func(e Entry) bool {
+		str := fieldString(getField(e, field))
+		if fold {
+			str = strings.ToLower(str)
+		}
+		return cmp(str, lit.raw)
+	}
+	return fn, nil
+}
+
+func (f *filter) parseMatch(compile func(string) (*regexp.Regexp, error), fold, mark bool) (filterfunc, error) {
+	field, lit, err := f.parseArguments()
+	if err != nil {
+		return nil, err
+	}
+	re, err := compile(lit.raw)
+	if err == nil && fold {
+		re, err = regexp.Compile("(?i)" + re.String())
+	}
+	if err != nil {
+		return nil, f.errorf("%s", err)
+	}
+	if mark {
+		f.addTerm(field, re)
+	}
+	return makeMatch(field, re), nil
+}
+
+func (f *filter) parseArguments() (string, literal, error) {
+	field, err := f.parseField()
+	if err != nil {
+		return "", literal{}, err
+	}
+	if err := f.expect(','); err != nil {
+		return "", literal{}, err
+	}
+	lit, err := f.parseLiteral(isArgument)
+	return field, lit, err
+}
+
+// compileGlob translates a glob pattern into an anchored regexp. Unlike
+// path.Match, * also matches the / character.
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	var str strings.Builder
+	str.WriteByte('^')
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			str.WriteString(".*")
+		case '?':
+			str.WriteByte('.')
+		case '[':
+			j := strings.IndexByte(pattern[i:], ']')
+			if j < 0 {
+				return nil, fmt.Errorf("%s: missing ]", pattern)
+			}
+			class := pattern[i+1 : i+j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			str.WriteString("[" + class + "]")
+			i += j
+		case '\\':
+			if i++; i < len(pattern) {
+				str.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			}
+		default:
+			str.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	str.WriteByte('$')
+	return regexp.Compile(str.String())
+}
+
+func (f *filter) parseCIDR() (filterfunc, error) {
+	field, err := f.parseField()
+	if err != nil {
+		return nil, err
+	}
+	if err := f.expect(','); err != nil {
+		return nil, err
+	}
+	lit, err := f.parseLiteral(isArgument)
+	if err != nil {
+		return nil, err
+	}
+	_, network, err := net.ParseCIDR(lit.raw)
+	if err != nil {
+		return nil, f.errorf("%s", err)
+	}
+	fn := func(e Entry) bool {
+		switch v := getField(e, field).(type) {
+		case net.IP:
+			return network.Contains(v)
+		case string:
+			return network.Contains(net.ParseIP(v))
+		default:
+			return false
+		}
+	}
+	return fn, nil
+}
+
+func makeMatch(field string, re *regexp.Regexp) filterfunc {
+	return func(e Entry) bool {
+		return re.MatchString(fieldString(getField(e, field)))
+	}
+}
+
+func (f *filter) parseAge(older bool) (filterfunc, error) {
+	field, err := f.parseField()
+	if err != nil {
+		return nil, err
+	}
+	if err := f.expect(','); err != nil {
+		return nil, err
+	}
+	lit, err := f.parseLiteral(isArgument)
+	if err != nil {
+		return nil, err
+	}
+	age, err := ParseDuration(lit.raw)
+	if err != nil {
+		return nil, f.errorf("%s: invalid duration", lit.raw)
+	}
+	ref := time.Now
+	if f.accept(',') {
+		lit, err := f.parseLiteral(isArgument)
+		if err != nil {
+			return nil, err
+		}
+		if lit.raw != "now" {
+			if !lit.istime {
+				return nil, f.errorf("%s: invalid time", lit.raw)
+			}
+			ref = func() time.Time { return lit.when }
+		}
+	}
+	fn := func(e Entry) bool {
+		when, ok := getField(e, field).(time.Time)
+		if !ok || when.IsZero() {
+			return false
+		}
+		limit := ref().Add(-age)
+		when = sameYear(when, limit)
+		if older {
+			return when.Before(limit)
+		}
+		return !when.Before(limit)
+	}
+	return fn, nil
+}
+
+func (f *filter) parseSample() (filterfunc, error) {
+	lit, err := f.parseLiteral(isArgument)
+	if err != nil {
+		return nil, err
+	}
+	if !lit.isnum || lit.num <= 0 || lit.num > 1 {
+		return nil, f.errorf("%s: ratio should be between 0 and 1", lit.raw)
+	}
+	seed := time.Now().UnixNano()
+	if f.accept(',') {
+		arg, err := f.parseLiteral(isArgument)
+		if err != nil {
+			return nil, err
+		}
+		if !arg.isnum {
+			return nil, f.errorf("%s: invalid seed", arg.raw)
+		}
+		seed = int64(arg.num)
+	}
+	f.stateful = true
+	rnd := rand.New(rand.NewSource(seed))
+	fn := func(_ Entry) bool {
+		return rnd.Float64() < lit.num
+	}
+	return fn, nil
+}
+
+func (f *filter) parseEvery() (filterfunc, error) {
+	lit, err := f.parseLiteral(isArgument)
+	if err != nil {
+		return nil, err
+	}
+	if !lit.isnum || lit.num < 1 {
+		return nil, f.errorf("%s: invalid count", lit.raw)
+	}
+	f.stateful = true
+	var (
+		every = int(lit.num)
+		count int
+	)
+	fn := func(_ Entry) bool {
+		count++
+		return (count-1)%every == 0
+	}
+	return fn, nil
+}
+
+func (f *filter) parseSeen(first bool) (filterfunc, error) {
+	var fields []string
+	for {
+		field, err := f.parseField()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+		if !f.accept(',') {
+			break
+		}
+	}
+	f.stateful = true
+	seen := make(map[string]struct{})
+	fn := func(e Entry) bool {
+		key := entryKey(e, fields)
+		_, ok := seen[key]
+		if !ok {
+			seen[key] = struct{}{}
+		}
+		return ok != first
+	}
+	return fn, nil
+}
+
+// rateBuckets is the number of parts of the window of rate in which the
+// entries are counted.
+const rateBuckets = 60
+
+func (f *filter) parseRate() (filterfunc, error) {
+	op := f.ident()
+	switch op {
+	case "lt", "le", "gt", "ge":
+	default:
+		return nil, f.errorf("%s: rate operator should be lt, le, gt or ge", op)
+	}
+	if err := f.expect(','); err != nil {
+		return nil, err
+	}
+	lit, err := f.parseLiteral(isArgument)
+	if err != nil {
+		return nil, err
+	}
+	limit, per, err := parseRate(lit.raw)
+	if err != nil {
+		return nil, f.errorf("%s", err)
+	}
+	f.stateful = true
+	var (
+		width   = int64(per / rateBuckets)
+		indices [rateBuckets]int64
+		counts  [rateBuckets]int
+	)
+	if width <= 0 {
+		width = 1
+	}
+	fn := func(e Entry) bool {
+		when := e.When
+		if when.IsZero() {
+			when = time.Now()
+		}
+		curr := when.UnixNano() / width
+		if x := curr % rateBuckets; indices[x] != curr {
+			indices[x], counts[x] = curr, 0
+		}
+		counts[curr%rateBuckets]++
+
+		var total int
+		for i := range counts {
+			if indices[i] > curr-rateBuckets && indices[i] <= curr {
+				total += counts[i]
+			}
+		}
+		switch n := float64(total); op {
+		case "lt":
+			return n < limit
+		case "le":
+			return n <= limit
+		case "gt":
+			return n > limit
+		default:
+			return n >= limit
+		}
+	}
+	return fn, nil
+}
+
+// parseRate parses a rate given as n/duration or n/unit (eg, 100/min).
+func parseRate(str string) (float64, time.Duration, error) {
+	x := strings.IndexByte(str, '/')
+	if x < 0 {
+		return 0, 0, fmt.Errorf("%s: rate should be n/duration", str)
+	}
+	n, err := strconv.ParseFloat(str[:x], 64)
+	if err != nil || n < 0 {
+		return 0, 0, fmt.Errorf("%s: invalid rate", str)
+	}
+	unit := str[x+1:]
+	switch unit {
+	case "sec", "second":
+		unit = "s"
+	case "min", "minute":
+		unit = "m"
+	case "hour":
+		unit = "h"
+	case "day":
+		unit = "d"
+	}
+	per, err := ParseDuration(unit)
+	if err != nil {
+		per, err = ParseDuration("1" + unit)
+	}
+	if err != nil || per <= 0 {
+		return 0, 0, fmt.Errorf("%s: invalid rate", str)
+	}
+	return n, per, nil
+}
+
+func (f *filter) parseField() (string, error) {
+	name := f.ident()
+	if name == "" {
+		return "", f.errorf("field expected")
+	}
+	if !isField(name) {
+		return "", f.errorf("unknown field %s", name)
+	}
+	f.addField(name)
+	return name, nil
+}
+
+func (f *filter) parseLiteral(stop func(byte) bool) (literal, error) {
+	f.skip()
+	if f.pos >= len(f.input) {
+		return literal{}, f.errorf("value expected")
+	}
+	var str string
+	if q := f.input[f.pos]; q == '"' || q == '\'' {
+		end := strings.IndexByte(f.input[f.pos+1:], q)
+		if end < 0 {
+			return literal{}, f.errorf("unterminated string")
+		}
+		str = f.input[f.pos+1 : f.pos+1+end]
+		f.pos += end + 2
+	} else {
+		start := f.pos
+		for f.pos < len(f.input) && !stop(f.input[f.pos]) {
+			f.pos++
+		}
+		str = strings.TrimSpace(f.input[start:f.pos])
+	}
+	if str == "" {
+		return literal{}, f.errorf("value expected")
+	}
+	return makeLiteral(str), nil
+}
+
+// parseOperand parses a literal or a reference to a field starting with @.
+func (f *filter) parseOperand(stop func(byte) bool) (literal, error) {
+	if !f.accept('@') {
+		return f.parseLiteral(stop)
+	}
+	name := f.ident()
+	if !isField(name) {
+		return literal{}, f.errorf("unknown field %s", name)
+	}
+	f.addField(name)
+	return literal{ref: name}, nil
+}
+
+func (f *filter) ident() string {
+	f.skip()
+	start := f.pos
+	for f.pos < len(f.input) {
+		r, n := utf8.DecodeRuneInString(f.input[f.pos:])
+		if !isAlpha(r) && r != '.' {
+			break
+		}
+		f.pos += n
+	}
+	return f.input[start:f.pos]
+}
+
+func (f *filter) acceptOp(op string) bool {
+	f.skip()
+	if !strings.HasPrefix(f.input[f.pos:], op) {
+		return false
+	}
+	if op == "!" && strings.HasPrefix(f.input[f.pos:], "!=") {
+		return false
+	}
+	f.pos += len(op)
+	return true
+}
+
+func isArgument(c byte) bool {
+	return c == ',' || c == ')'
+}
+
+func isOperand(c byte) bool {
+	return c == ')' || c == '&' || c == '|' || c == ' ' || c == '\t' || c == '\n' || c == '#'
+}
+
+func (f *filter) accept(c byte) bool {
+	f.skip()
+	if f.pos < len(f.input) && f.input[f.pos] == c {
+		f.pos++
+		return true
+	}
+	return false
+}
+
+func (f *filter) expect(c byte) error {
+	if !f.accept(c) {
+		err := f.errorf("missing %c", c)
+		err.Expected = string(c)
+		if f.pos < len(f.input) {
+			err.Got = string(f.input[f.pos])
+		}
+		return err
+	}
+	return nil
+}
+
+// skip skips blanks, newlines and comments (from # to the end of the line).
+func (f *filter) skip() {
+	for f.pos < len(f.input) {
+		switch c := f.input[f.pos]; {
+		case isBlank(rune(c)) || c == '\n' || c == '\r':
+			f.pos++
+		case c == '#':
+			for f.pos < len(f.input) && f.input[f.pos] != '\n' {
+				f.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (f *filter) errorf(format string, args ...interface{}) *SyntaxError {
+	what := f.what
+	if what == "" {
+		what = "filter"
+	}
+	return syntaxErrorAt(what, f.pos, format, args...)
+}
+
+var fields = []string{
+	"time",
+	"process",
+	"pid",
+	"user",
+	"group",
+	"host",
+	"ip",
+	"port",
+	"level",
+	"message",
+	"file",
+	"offset",
+	"origin",
+	"pattern",
+	"lino",
+	"line",
+	"seq",
+}
+
+func isField(name string) bool {
+	if strings.HasPrefix(name, "named.") {
+		return len(name) > len("named.")
+	}
+	for _, f := range fields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+func getField(e Entry, name string) interface{} {
+	switch name {
+	case "time":
+		return e.When
+	case "process":
+		return e.Process
+	case "pid":
+		return e.Pid
+	case "user":
+		return e.User
+	case "group":
+		return e.Group
+	case "host":
+		return e.Host
+	case "ip":
+		return e.Addr.IP
+	case "port":
+		return e.Addr.Port
+	case "level":
+		return e.Level
+	case "message":
+		return e.Message
+	case "file":
+		return e.Source.File
+	case "offset":
+		return int(e.Source.Offset)
+	case "origin":
+		return e.Source.Origin
+	case "pattern":
+		return e.Pattern
+	case "lino":
+		return e.Source.Line
+	case "seq":
+		return e.Seq
+	case "line":
+		return e.Line
+	default:
+		if strings.HasPrefix(name, "named.") {
+			name = name[len("named."):]
+			if v, ok := e.Values[name]; ok {
+				return v
+			}
+			if v, ok := e.Named[name]; ok {
+				return v
+			}
+		}
+		return nil
+	}
+}
+
+func fieldString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case net.IP:
+		if v == nil {
+			return ""
+		}
+		return v.String()
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+type literal struct {
+	raw  string
+	fold bool
+	// field whose value is compared, set by @field
+	ref string
+
+	num   float64
+	isnum bool
+
+	when   time.Time
+	istime bool
+
+	dur   time.Duration
+	isdur bool
+
+	bool   bool
+	isbool bool
+}
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"Jan _2 15:04:05",
+	"Jan _2 15:04",
+}
+
+// sameYear gives the time t in the year of ref when t has no year (year 0 or
+// 1, eg, timestamps of syslog read without WithYear) so that times with and
+// without year can be compared.
+func sameYear(t, ref time.Time) time.Time {
+	if t.Year() > 1 || t.Year() == ref.Year() || t.IsZero() {
+		return t
+	}
+	return time.Date(ref.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+func makeLiteral(str string) literal {
+	lit := literal{raw: str}
+	if n, err := strconv.ParseFloat(str, 64); err == nil {
+		lit.num, lit.isnum = n, true
+	}
+	for _, layout := range timeLayouts {
+		if w, err := time.Parse(layout, str); err == nil {
+			lit.when, lit.istime = w, true
+			break
+		}
+	}
+	if d, err := ParseDuration(str); err == nil {
+		lit.dur, lit.isdur = d, true
+	}
+	if b, err := strconv.ParseBool(str); err == nil {
+		lit.bool, lit.isbool = b, true
+	}
+	return lit
+}
+
+// valueLiteral gives the literal of the value of a field.
+func valueLiteral(v interface{}) literal {
+	switch v := v.(type) {
+	case string:
+		return makeLiteral(v)
+	case int:
+		return literal{raw: strconv.Itoa(v), num: float64(v), isnum: true}
+	case float64:
+		return literal{raw: fieldString(v), num: v, isnum: true}
+	case time.Duration:
+		return literal{raw: v.String(), dur: v, isdur: true}
+	case bool:
+		return literal{raw: strconv.FormatBool(v), bool: v, isbool: true}
+	case time.Time:
+		return literal{raw: fieldString(v), when: v, istime: !v.IsZero()}
+	default:
+		return literal{raw: fieldString(v)}
+	}
+}
+
+func (i literal) compare(v interface{}) (int, bool) {
+	switch v := v.(type) {
+	case int:
+		if !i.isnum {
+			return 0, false
+		}
+		return compareFloat(float64(v), i.num), true
+	case float64:
+		if !i.isnum {
+			return 0, false
+		}
+		return compareFloat(v, i.num), true
+	case time.Duration:
+		if !i.isdur {
+			return 0, false
+		}
+		return compareFloat(float64(v), float64(i.dur)), true
+	case bool:
+		if !i.isbool {
+			return 0, false
+		}
+		if v == i.bool {
+			return 0, true
+		}
+		if v {
+			return 1, true
+		}
+		return -1, true
+	case time.Time:
+		if !i.istime || v.IsZero() {
+			return 0, false
+		}
+		v = sameYear(v, i.when)
+		when := sameYear(i.when, v)
+		switch {
+		case v.Before(when):
+			return -1, true
+		case v.After(when):
+			return 1, true
+		default:
+			return 0, true
+		}
+	case net.IP:
+		ip := net.ParseIP(i.raw)
+		if v == nil || ip == nil {
+			return 0, false
+		}
+		return bytes.Compare(v.To16(), ip.To16()), true
+	case string:
+		// the values of the named words have no type: they are compared as
+		// numbers, durations or times when they are like the literal, and as
+		// strings otherwise
+		if i.isnum {
+			if n, err := strconv.ParseFloat(v, 64); err == nil {
+				return compareFloat(n, i.num), true
+			}
+		}
+		if i.isdur {
+			if d, err := ParseDuration(v); err == nil {
+				return compareFloat(float64(d), float64(i.dur)), true
+			}
+		}
+		if i.istime {
+			for _, layout := range timeLayouts {
+				if w, err := time.Parse(layout, v); err == nil {
+					return i.compare(w)
+				}
+			}
+		}
+		if i.fold {
+			return strings.Compare(strings.ToLower(v), strings.ToLower(i.raw)), true
+		}
+		return strings.Compare(v, i.raw), true
+	default:
+		return 0, false
+	}
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// ParseDuration accepts the same input as time.ParseDuration and also the d
+// (day) and w (week) units.
+func ParseDuration(str string) (time.Duration, error) {
+	var total time.Duration
+	for str != "" {
+		i := strings.IndexAny(str, "dw")
+		if i < 0 {
+			d, err := time.ParseDuration(str)
+			return total + d, err
+		}
+		n, err := strconv.Atoi(str[:i])
+		if err != nil {
+			d, err := time.ParseDuration(str)
+			return total + d, err
+		}
+		unit := time.Hour * 24
+		if str[i] == 'w' {
+			unit *= 7
+		}
+		total += time.Duration(n) * unit
+		str = str[i+1:]
+	}
+	return total, nil
+}
@@ -0,0 +1,45 @@
+package log
+
+import (
+	"testing"
+)
+
+func TestFilterUntypedValues(t *testing.T) {
+	p, err := CompilePattern("%k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := p.Parse("start=9 end=10 bytes=999 took=1500ms when=2024-03-01T10:00:00Z user=bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"gt(named.end, @named.start)", true},
+		{"lt(named.end, @named.start)", false},
+		{"gt(named.bytes, 1000)", false},
+		{"named.bytes > 1000", false},
+		{"named.bytes < 1000", true},
+		{"lt(named.start, 10)", true},
+		{"named.start == 9.0", true},
+		{"between(named.end, 5, 50)", true},
+		{"named.took > 1s", true},
+		{"named.took < 2s", true},
+		{"named.when > 2024-02-01T00:00:00Z", true},
+		{"named.when < 2024-02-01T00:00:00Z", false},
+		{"named.user > alice", true},
+		{"named.user < 10", false},
+	}
+	for _, tt := range tests {
+		f, err := CompileFilter(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %s", tt.expr, err)
+			continue
+		}
+		if got := f.Match(e); got != tt.want {
+			t.Errorf("%s: got %t, want %t", tt.expr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package log
+
+// fixedField is a part of a time pattern always taking the same number of
+// bytes: a literal or a number of width digits (%y, %m, %d, %H, %M, %S, %j,
+// %L, %E and %N). The consecutive fixed fields of a pattern are checked by
+// indexing the line instead of being scanned rune by rune.
+type fixedField struct {
+	literal string
+	width   int
+	// the first digit can be a blank, like the day of syslog timestamps
+	blank bool
+	set   func(*when, int)
+}
+
+func (f fixedField) size() int {
+	if f.set == nil {
+		return len(f.literal)
+	}
+	return f.width
+}
+
+func fixedNumber(width int, set func(*when, int)) *fixedField {
+	return &fixedField{width: width, set: set}
+}
+
+func fixedFraction(width int) *fixedField {
+	scale := 1
+	for i := width; i < 9; i++ {
+		scale *= 10
+	}
+	return fixedNumber(width, func(w *when, n int) { w.Frac = n * scale })
+}
+
+// optimizeWhen merges the runs of fixed fields of wfs into a single function.
+// fixed has the fixed field of each function of wfs, or nil when its width
+// depends on the input.
+func optimizeWhen(wfs []whenfunc, fixed []*fixedField) whenfunc {
+	var list []whenfunc
+	for i := 0; i < len(wfs); {
+		j := i
+		for j < len(wfs) && fixed[j] != nil {
+			j++
+		}
+		if j-i < 2 {
+			list = append(list, wfs[i])
+			i++
+			continue
+		}
+		fields := make([]fixedField, 0, j-i)
+		for _, f := range fixed[i:j] {
+			fields = append(fields, *f)
+		}
+		list = append(list, parseFixed(fields, mergeWhen(wfs[i:j])))
+		i = j
+	}
+	if len(list) == 1 {
+		return list[0]
+	}
+	return mergeWhen(list)
+}
+
+// parseFixed parses the fields from the bytes of the line. slow parses them
+// again rune by rune when they do not match, to fail at the same position.
+func parseFixed(fields []fixedField, slow whenfunc) whenfunc {
+	var size int
+	for _, f := range fields {
+		size += f.size()
+	}
+	return func(w *when, r *scanner) error {
+		if r.Len() < size {
+			return slow(w, r)
+		}
+		b := r.buf[r.pos : r.pos+size]
+		for _, f := range fields {
+			n := f.size()
+			if f.set == nil {
+				if string(b[:n]) != f.literal {
+					return slow(w, r)
+				}
+				b = b[n:]
+				continue
+			}
+			var v int
+			for j, c := range b[:n] {
+				if c == ' ' && j == 0 && f.blank {
+					continue
+				}
+				if c < '0' || c > '9' {
+					return slow(w, r)
+				}
+				v = v*10 + int(c-'0')
+			}
+			f.set(w, v)
+			b = b[n:]
+		}
+		r.pos, r.prev = r.pos+size, -1
+		return nil
+	}
+}
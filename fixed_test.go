@@ -0,0 +1,139 @@
+package log
+
+import (
+	"testing"
+)
+
+var fixedTests = []struct {
+	pattern string
+	inputs  []string
+}{
+	{
+		pattern: "%y-%m-%dT%H:%M:%S.%L%Z",
+		inputs: []string{
+			"2024-03-01T10:20:30.123Z",
+			"2024-03-01T10:20:30.123+01:00 rest",
+			"2024-3-01T10:20:30.123Z",
+			"2024-03-01 10:20:30.123Z",
+			"2024-03-0aT10:20:30.123Z",
+			"2024-03-01T10:20",
+			"",
+		},
+	},
+	{
+		pattern: "%b %d %H:%M:%S",
+		inputs: []string{
+			"Mar  1 10:20:30 host",
+			"Mar 11 10:20:30",
+			"Mar 1 10:20:30",
+			"Mar 11 10-20-30",
+		},
+	},
+	{
+		pattern: "%d/%b/%y:%H:%M:%S %Z",
+		inputs: []string{
+			"10/Oct/2000:13:55:36 -0700",
+			"10/Oct/2000:13:55 -0700",
+		},
+	},
+	{
+		pattern: "%y%m%d %H%M%S.%N",
+		inputs: []string{
+			"20240301 102030.123456789",
+			"20240301 102030.12345678",
+			"2024031 102030.123456789",
+		},
+	},
+	{
+		pattern: "%G-W%V-%u %H:%M:%S.%E",
+		inputs: []string{
+			"2024-W09-5 10:20:30.123456",
+			"2024-W9-5 10:20:30.123456",
+		},
+	},
+	{
+		pattern: "[%I]",
+		inputs: []string{
+			"[2024-03-01T10:20:30Z]",
+			"[2024-03-01T10:20:30.5Z]",
+			"2024-03-01T10:20:30Z]",
+		},
+	},
+}
+
+// TestFixedWhen checks that the fixed fields are parsed like the functions
+// parsing the time rune by rune.
+func TestFixedWhen(t *testing.T) {
+	for _, tt := range fixedTests {
+		wfs, fxs, err := compileTimePattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.pattern, err)
+		}
+		var (
+			fast = optimizeWhen(wfs, fxs)
+			slow = mergeWhen(wfs)
+		)
+		for _, in := range tt.inputs {
+			var (
+				fw, sw when
+				fr     = newScanner([]byte(in))
+				sr     = newScanner([]byte(in))
+				ferr   = fast(&fw, fr)
+				serr   = slow(&sw, sr)
+			)
+			if (ferr == nil) != (serr == nil) || (ferr != nil && ferr.Error() != serr.Error()) {
+				t.Errorf("%s: %q: errors differ: %v / %v", tt.pattern, in, ferr, serr)
+				continue
+			}
+			if ferr != nil {
+				continue
+			}
+			if fw != sw {
+				t.Errorf("%s: %q: times differ: %+v / %+v", tt.pattern, in, fw, sw)
+			}
+			if fr.pos != sr.pos {
+				t.Errorf("%s: %q: positions differ: %d / %d", tt.pattern, in, fr.pos, sr.pos)
+			}
+		}
+	}
+}
+
+func BenchmarkFixedWhen(b *testing.B) {
+	benchmarks := []struct {
+		name    string
+		pattern string
+		input   string
+	}{
+		{"iso", "%y-%m-%dT%H:%M:%S.%L%Z", "2024-03-01T10:20:30.123Z"},
+		{"syslog", "%b %d %H:%M:%S", "Mar  1 10:20:30"},
+		{"compact", "%y%m%d %H%M%S.%N", "20240301 102030.123456789"},
+	}
+	for _, bb := range benchmarks {
+		wfs, fxs, err := compileTimePattern(bb.pattern)
+		if err != nil {
+			b.Fatal(err)
+		}
+		funcs := []struct {
+			name string
+			fn   whenfunc
+		}{
+			{"scan", mergeWhen(wfs)},
+			{"fixed", optimizeWhen(wfs, fxs)},
+		}
+		for _, f := range funcs {
+			b.Run(bb.name+"/"+f.name, func(b *testing.B) {
+				var (
+					w when
+					r = newScanner([]byte(bb.input))
+				)
+				for i := 0; i < b.N; i++ {
+					w = when{}
+					r.Reset([]byte(bb.input))
+					if err := f.fn(&w, r); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
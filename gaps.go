@@ -0,0 +1,87 @@
+package log
+
+import (
+	"time"
+)
+
+// Gap is a period without entries between the time of an entry (Start) and
+// the time of the next one (End).
+type Gap struct {
+	Start    time.Time
+	End      time.Time
+	Duration time.Duration
+	// Source of the first entry after the gap
+	Source Source
+}
+
+// Gaps computes the time between consecutive entries and keeps the gaps longer
+// than its threshold. Entries without time are ignored as well as the ones
+// older than the latest entry seen.
+type Gaps struct {
+	threshold time.Duration
+	total     int
+	count     int
+	sum       time.Duration
+	max       time.Duration
+	last      time.Time
+	gaps      []Gap
+}
+
+func FindGaps(threshold time.Duration) *Gaps {
+	return &Gaps{threshold: threshold}
+}
+
+func (g *Gaps) Write(e Entry) error {
+	g.total++
+	if e.When.IsZero() {
+		return nil
+	}
+	if g.last.IsZero() {
+		g.last = e.When
+		return nil
+	}
+	if !e.When.After(g.last) {
+		if e.When.Equal(g.last) {
+			g.count++
+		}
+		return nil
+	}
+	diff := e.When.Sub(g.last)
+	g.count++
+	g.sum += diff
+	if diff > g.max {
+		g.max = diff
+	}
+	if diff > g.threshold {
+		g.gaps = append(g.gaps, Gap{
+			Start:    g.last,
+			End:      e.When,
+			Duration: diff,
+			Source:   e.Source,
+		})
+	}
+	g.last = e.When
+	return nil
+}
+
+func (g *Gaps) Total() int {
+	return g.total
+}
+
+// Gaps gives the gaps longer than the threshold in the order of the entries.
+func (g *Gaps) Gaps() []Gap {
+	return g.gaps
+}
+
+// Mean gives the average time between consecutive entries.
+func (g *Gaps) Mean() time.Duration {
+	if g.count == 0 {
+		return 0
+	}
+	return g.sum / time.Duration(g.count)
+}
+
+// Max gives the longest time between consecutive entries.
+func (g *Gaps) Max() time.Duration {
+	return g.max
+}
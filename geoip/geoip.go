@@ -0,0 +1,191 @@
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/midbel/log"
+)
+
+// geoip finds the location and the network of the addresses of the entries in
+// the MaxMind DB files of GeoIP2/GeoLite2 (City, Country and ASN databases)
+// and stores them as named words usable by the filters and the statistics.
+
+// cacheSize is the number of addresses whose location is kept by a DB.
+const cacheSize = 4096
+
+// Location is what the databases know of an address.
+type Location struct {
+	Country     string
+	CountryName string
+	City        string
+	ASN         int
+	Org         string
+}
+
+// DB looks up addresses in one or several databases, like a City and an ASN
+// database, the first one knowing a value giving it.
+type DB struct {
+	dbs []*mmdb
+
+	mu    sync.Mutex
+	cache map[string]Location
+}
+
+// Open loads the databases of files in memory.
+func Open(files ...string) (*DB, error) {
+	db := DB{
+		cache: make(map[string]Location),
+	}
+	for _, f := range files {
+		buf, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		m, err := parseMMDB(buf)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+		db.dbs = append(db.dbs, m)
+	}
+	if len(db.dbs) == 0 {
+		return nil, fmt.Errorf("geoip: no database given")
+	}
+	return &db, nil
+}
+
+// Lookup gives the location of ip. The Location is empty when the databases
+// do not have the address.
+func (db *DB) Lookup(ip net.IP) (Location, error) {
+	var loc Location
+	if ip == nil {
+		return loc, nil
+	}
+	key := string(ip)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if loc, ok := db.cache[key]; ok {
+		return loc, nil
+	}
+	for _, m := range db.dbs {
+		v, err := m.lookup(ip)
+		if err != nil {
+			return loc, err
+		}
+		rec, _ := v.(map[string]interface{})
+		if loc.Country == "" {
+			loc.Country = lookupString(rec, "country", "iso_code")
+		}
+		if loc.CountryName == "" {
+			loc.CountryName = lookupString(rec, "country", "names", "en")
+		}
+		if loc.City == "" {
+			loc.City = lookupString(rec, "city", "names", "en")
+		}
+		if loc.ASN == 0 {
+			loc.ASN = int(toUint(rec["autonomous_system_number"]))
+		}
+		if loc.Org == "" {
+			loc.Org = lookupString(rec, "autonomous_system_organization")
+		}
+	}
+	if len(db.cache) >= cacheSize {
+		db.cache = make(map[string]Location)
+	}
+	db.cache[key] = loc
+	return loc, nil
+}
+
+// Derive adds to r the fields of the location of the address of field (ip,
+// host or named.<name>): <name>_country (iso code), <name>_country_name,
+// <name>_city, <name>_asn and <name>_org, name being field without its named.
+// prefix. Nothing is stored for the unknown values.
+func (db *DB) Derive(r *log.Reader, field string) error {
+	get, err := addressOf(field)
+	if err != nil {
+		return err
+	}
+	var (
+		name   = strings.TrimPrefix(field, "named.")
+		locate = func(e log.Entry) Location {
+			loc, _ := db.Lookup(get(e))
+			return loc
+		}
+		text = func(s string) interface{} {
+			if s == "" {
+				return nil
+			}
+			return s
+		}
+	)
+	r.Derive(name+"_country", func(e log.Entry) interface{} {
+		return text(locate(e).Country)
+	})
+	r.Derive(name+"_country_name", func(e log.Entry) interface{} {
+		return text(locate(e).CountryName)
+	})
+	r.Derive(name+"_city", func(e log.Entry) interface{} {
+		return text(locate(e).City)
+	})
+	r.Derive(name+"_asn", func(e log.Entry) interface{} {
+		if n := locate(e).ASN; n > 0 {
+			return n
+		}
+		return nil
+	})
+	r.Derive(name+"_org", func(e log.Entry) interface{} {
+		return text(locate(e).Org)
+	})
+	return nil
+}
+
+// addressOf gives the function giving the address of field in an entry.
+func addressOf(field string) (func(log.Entry) net.IP, error) {
+	switch {
+	case field == "ip":
+		return func(e log.Entry) net.IP {
+			return e.Addr.IP
+		}, nil
+	case field == "host":
+		return func(e log.Entry) net.IP {
+			if e.Addr.IP != nil {
+				return e.Addr.IP
+			}
+			return parseIP(e.Host)
+		}, nil
+	case strings.HasPrefix(field, "named.") && len(field) > len("named."):
+		name := field[len("named."):]
+		return func(e log.Entry) net.IP {
+			if ip, ok := e.Values[name].(net.IP); ok {
+				return ip
+			}
+			return parseIP(e.Named[name])
+		}, nil
+	default:
+		return nil, fmt.Errorf("geoip: %s: field has no address", field)
+	}
+}
+
+// parseIP parses an address with an optional port.
+func parseIP(str string) net.IP {
+	if host, _, err := net.SplitHostPort(str); err == nil {
+		str = host
+	}
+	return net.ParseIP(strings.Trim(str, "[]"))
+}
+
+func lookupString(rec map[string]interface{}, keys ...string) string {
+	var v interface{} = rec
+	for _, k := range keys {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		v = m[k]
+	}
+	str, _ := v.(string)
+	return str
+}
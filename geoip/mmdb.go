@@ -0,0 +1,288 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+)
+
+// minimal reader of the MaxMind DB format: the search tree and the types of
+// the data section used by the GeoIP2/GeoLite2 databases.
+
+var errFormat = errors.New("invalid mmdb format")
+
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// data types of the data section
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEnd
+	typeBool
+	typeFloat
+)
+
+type mmdb struct {
+	buf       []byte
+	data      []byte
+	nodes     uint
+	size      uint
+	ipv4Start uint
+	ipVersion uint
+}
+
+func parseMMDB(buf []byte) (*mmdb, error) {
+	x := bytes.LastIndex(buf, metadataMarker)
+	if x < 0 {
+		return nil, fmt.Errorf("%w: metadata not found", errFormat)
+	}
+	meta, _, err := decode(buf[x+len(metadataMarker):], 0)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := meta.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata is not a map", errFormat)
+	}
+	db := mmdb{
+		nodes:     uint(toUint(m["node_count"])),
+		size:      uint(toUint(m["record_size"])),
+		ipVersion: uint(toUint(m["ip_version"])),
+	}
+	switch db.size {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("%w: unsupported record size %d", errFormat, db.size)
+	}
+	tree := db.nodes * db.size / 4
+	if tree+16 > uint(x) {
+		return nil, fmt.Errorf("%w: search tree larger than the file", errFormat)
+	}
+	db.buf, db.data = buf[:tree], buf[tree+16:x]
+	if db.ipVersion == 6 {
+		// IPv4 addresses are stored under ::/96
+		for i := 0; i < 96 && db.ipv4Start < db.nodes; i++ {
+			db.ipv4Start = db.record(db.ipv4Start, 0)
+		}
+	}
+	return &db, nil
+}
+
+// lookup gives the record of ip, or nil when the database has none.
+func (db *mmdb) lookup(ip net.IP) (interface{}, error) {
+	var (
+		node uint
+		bits = ip.To4()
+	)
+	if bits != nil {
+		node = db.ipv4Start
+	} else if db.ipVersion == 6 {
+		bits = ip.To16()
+	} else {
+		return nil, nil
+	}
+	for i := 0; i < len(bits)*8 && node < db.nodes; i++ {
+		bit := (bits[i/8] >> (7 - uint(i%8))) & 1
+		node = db.record(node, uint(bit))
+	}
+	if node <= db.nodes {
+		return nil, nil
+	}
+	offset := node - db.nodes - 16
+	if offset >= uint(len(db.data)) {
+		return nil, fmt.Errorf("%w: invalid data pointer", errFormat)
+	}
+	v, _, err := decode(db.data, offset)
+	return v, err
+}
+
+// record gives the left (bit 0) or right (bit 1) record of node.
+func (db *mmdb) record(node, bit uint) uint {
+	b := db.buf[node*db.size/4:]
+	switch db.size {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// maxDepth limits the nesting of the maps and arrays, and so the recursion
+// of decode on invalid databases.
+const maxDepth = 32
+
+// decode decodes the value at offset of data and gives the offset following
+// it.
+func decode(data []byte, offset uint) (interface{}, uint, error) {
+	return decodeValue(data, offset, 0)
+}
+
+func decodeValue(data []byte, offset uint, depth int) (interface{}, uint, error) {
+	if depth > maxDepth {
+		return nil, 0, fmt.Errorf("%w: values nested too deeply", errFormat)
+	}
+	if offset >= uint(len(data)) {
+		return nil, 0, fmt.Errorf("%w: unexpected end of data", errFormat)
+	}
+	ctrl := data[offset]
+	offset++
+	kind := uint(ctrl >> 5)
+	if kind == typePointer {
+		ptr, next, err := decodePointer(data, ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		if ptr < uint(len(data)) && data[ptr]>>5 == typePointer {
+			return nil, 0, fmt.Errorf("%w: pointer to a pointer", errFormat)
+		}
+		v, _, err := decodeValue(data, ptr, depth+1)
+		return v, next, err
+	}
+	if kind == typeExtended {
+		if offset >= uint(len(data)) {
+			return nil, 0, fmt.Errorf("%w: unexpected end of data", errFormat)
+		}
+		kind = 7 + uint(data[offset])
+		offset++
+	}
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(data)) {
+			return nil, 0, fmt.Errorf("%w: unexpected end of data", errFormat)
+		}
+		var extra uint
+		for _, b := range data[offset : offset+n] {
+			extra = extra<<8 | uint(b)
+		}
+		offset += n
+		switch n {
+		case 1:
+			size = 29 + extra
+		case 2:
+			size = 285 + extra
+		default:
+			size = 65821 + extra
+		}
+	}
+	switch kind {
+	case typeMap:
+		m := make(map[string]interface{})
+		for i := uint(0); i < size; i++ {
+			k, next, err := decodeValue(data, offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("%w: map key is not a string", errFormat)
+			}
+			v, next, err := decodeValue(data, next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key], offset = v, next
+		}
+		return m, offset, nil
+	case typeArray:
+		var list []interface{}
+		for i := uint(0); i < size; i++ {
+			v, next, err := decodeValue(data, offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			list, offset = append(list, v), next
+		}
+		return list, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	case typeContainer, typeEnd:
+		return nil, offset, nil
+	}
+	if offset+size > uint(len(data)) {
+		return nil, 0, fmt.Errorf("%w: unexpected end of data", errFormat)
+	}
+	b, next := data[offset:offset+size], offset+size
+	switch kind {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes:
+		return append([]byte{}, b...), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("%w: invalid double size %d", errFormat, size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("%w: invalid float size %d", errFormat, size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), next, nil
+	case typeUint16, typeUint32, typeUint64, typeUint128:
+		if size > 8 {
+			// only the lowest 64 bits of the 128 bits integers are kept
+			b = b[size-8:]
+		}
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, next, nil
+	case typeInt32:
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return int64(int32(v)), next, nil
+	default:
+		return nil, 0, fmt.Errorf("%w: unknown type %d", errFormat, kind)
+	}
+}
+
+// decodePointer gives the offset a pointer refers to and the offset following
+// the pointer.
+func decodePointer(data []byte, ctrl byte, offset uint) (uint, uint, error) {
+	n := uint(ctrl>>3)&0x3 + 1
+	if offset+n > uint(len(data)) {
+		return 0, 0, fmt.Errorf("%w: unexpected end of data", errFormat)
+	}
+	var ptr uint
+	if n < 4 {
+		ptr = uint(ctrl & 0x7)
+	}
+	for _, b := range data[offset : offset+n] {
+		ptr = ptr<<8 | uint(b)
+	}
+	switch n {
+	case 2:
+		ptr += 2048
+	case 3:
+		ptr += 526336
+	}
+	return ptr, offset + n, nil
+}
+
+func toUint(v interface{}) uint64 {
+	n, _ := v.(uint64)
+	return n
+}
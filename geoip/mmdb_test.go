@@ -0,0 +1,534 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// mmdbWriter builds the databases of the tests.
+type mmdbWriter struct {
+	data  bytes.Buffer
+	nodes [][2]mmdbRecord
+}
+
+// mmdbRecord is a record of the search tree: a node, data or nothing.
+type mmdbRecord struct {
+	node int
+	data int
+}
+
+var emptyRecord = mmdbRecord{node: -1, data: -1}
+
+func newWriter() *mmdbWriter {
+	var w mmdbWriter
+	w.nodes = append(w.nodes, [2]mmdbRecord{emptyRecord, emptyRecord})
+	return &w
+}
+
+// insert stores the data at offset for the first bits of addr.
+func (w *mmdbWriter) insert(addr []byte, bits, offset int) {
+	node := 0
+	for i := 0; i < bits; i++ {
+		bit := (addr[i/8] >> (7 - uint(i%8))) & 1
+		if i == bits-1 {
+			w.nodes[node][bit] = mmdbRecord{node: -1, data: offset}
+			return
+		}
+		next := w.nodes[node][bit].node
+		if next < 0 {
+			w.nodes = append(w.nodes, [2]mmdbRecord{emptyRecord, emptyRecord})
+			next = len(w.nodes) - 1
+			w.nodes[node][bit] = mmdbRecord{node: next, data: -1}
+		}
+		node = next
+	}
+}
+
+func (w *mmdbWriter) insertNetwork(network string, v6 bool, offset int) {
+	_, ipnet, err := net.ParseCIDR(network)
+	if err != nil {
+		panic(err)
+	}
+	ones, _ := ipnet.Mask.Size()
+	addr := []byte(ipnet.IP)
+	if ip := ipnet.IP.To4(); ip != nil && v6 {
+		addr, ones = append(make([]byte, 12), ip...), ones+96
+	}
+	w.insert(addr, ones, offset)
+}
+
+// add encodes v in the data section and gives its offset.
+func (w *mmdbWriter) add(v interface{}) int {
+	offset := w.data.Len()
+	encodeValue(&w.data, v)
+	return offset
+}
+
+func (w *mmdbWriter) bytes(size, version int) []byte {
+	var (
+		buf   bytes.Buffer
+		count = len(w.nodes)
+	)
+	value := func(r mmdbRecord) uint32 {
+		switch {
+		case r.node >= 0:
+			return uint32(r.node)
+		case r.data >= 0:
+			return uint32(count + 16 + r.data)
+		default:
+			return uint32(count)
+		}
+	}
+	for _, n := range w.nodes {
+		left, right := value(n[0]), value(n[1])
+		switch size {
+		case 24:
+			buf.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left)})
+			buf.Write([]byte{byte(right >> 16), byte(right >> 8), byte(right)})
+		case 28:
+			buf.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left)})
+			buf.WriteByte(byte(left>>24)<<4 | byte(right>>24)&0x0f)
+			buf.Write([]byte{byte(right >> 16), byte(right >> 8), byte(right)})
+		case 32:
+			binary.Write(&buf, binary.BigEndian, left)
+			binary.Write(&buf, binary.BigEndian, right)
+		}
+	}
+	buf.Write(make([]byte, 16))
+	buf.Write(w.data.Bytes())
+	buf.Write(metadataMarker)
+	encodeValue(&buf, map[string]interface{}{
+		"node_count":    uint32(count),
+		"record_size":   uint16(size),
+		"ip_version":    uint16(version),
+		"database_type": "Test",
+	})
+	return buf.Bytes()
+}
+
+// pointer is a value encoded as a pointer to the data at its offset.
+type pointer int
+
+func encodeControl(buf *bytes.Buffer, kind, size int) {
+	var extra []byte
+	switch {
+	case size < 29:
+	case size < 285:
+		extra, size = []byte{byte(size - 29)}, 29
+	case size < 65821:
+		n := size - 285
+		extra, size = []byte{byte(n >> 8), byte(n)}, 30
+	default:
+		n := size - 65821
+		extra, size = []byte{byte(n >> 16), byte(n >> 8), byte(n)}, 31
+	}
+	if kind > 7 {
+		buf.WriteByte(byte(size))
+		buf.WriteByte(byte(kind - 7))
+	} else {
+		buf.WriteByte(byte(kind<<5 | size))
+	}
+	buf.Write(extra)
+}
+
+func encodeUint(buf *bytes.Buffer, kind int, v uint64, max int) {
+	var b []byte
+	for ; v > 0; v >>= 8 {
+		b = append([]byte{byte(v)}, b...)
+	}
+	if len(b) > max {
+		panic("integer too large")
+	}
+	encodeControl(buf, kind, len(b))
+	buf.Write(b)
+}
+
+func encodeValue(buf *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case pointer:
+		p := int(v)
+		switch {
+		case p < 2048:
+			buf.Write([]byte{byte(typePointer<<5 | p>>8), byte(p)})
+		case p < 526336:
+			p -= 2048
+			buf.Write([]byte{byte(typePointer<<5 | 1<<3 | p>>16), byte(p >> 8), byte(p)})
+		case p < 134744064:
+			p -= 526336
+			buf.Write([]byte{byte(typePointer<<5 | 2<<3 | p>>24), byte(p >> 16), byte(p >> 8), byte(p)})
+		default:
+			buf.WriteByte(byte(typePointer<<5 | 3<<3))
+			binary.Write(buf, binary.BigEndian, uint32(p))
+		}
+	case string:
+		encodeControl(buf, typeString, len(v))
+		buf.WriteString(v)
+	case []byte:
+		encodeControl(buf, typeBytes, len(v))
+		buf.Write(v)
+	case float64:
+		encodeControl(buf, typeDouble, 8)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+	case float32:
+		encodeControl(buf, typeFloat, 4)
+		binary.Write(buf, binary.BigEndian, math.Float32bits(v))
+	case uint16:
+		encodeUint(buf, typeUint16, uint64(v), 2)
+	case uint32:
+		encodeUint(buf, typeUint32, uint64(v), 4)
+	case uint64:
+		encodeUint(buf, typeUint64, v, 8)
+	case int32:
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, uint32(v))
+		encodeControl(buf, typeInt32, 4)
+		buf.Write(b)
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		encodeControl(buf, typeBool, size)
+	case []interface{}:
+		encodeControl(buf, typeArray, len(v))
+		for _, x := range v {
+			encodeValue(buf, x)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		encodeControl(buf, typeMap, len(v))
+		for _, k := range keys {
+			encodeValue(buf, k)
+			encodeValue(buf, v[k])
+		}
+	default:
+		panic("unsupported value")
+	}
+}
+
+func names(name string) map[string]interface{} {
+	return map[string]interface{}{
+		"names": map[string]interface{}{"en": name},
+	}
+}
+
+// testDB builds a database knowing 1.2.3.0/24 (Paris), 8.8.0.0/16 (an ASN)
+// and, for IPv6, 2001:db8::/32 (Germany).
+func testDB(size, version int, padding int) []byte {
+	w := newWriter()
+	if padding > 0 {
+		w.add(strings.Repeat("x", padding))
+	}
+	france := w.add(map[string]interface{}{"iso_code": "FR", "names": map[string]interface{}{"en": "France"}})
+	paris := w.add(map[string]interface{}{
+		"country": pointer(france),
+		"city":    names("Paris"),
+	})
+	asn := w.add(map[string]interface{}{
+		"autonomous_system_number":       uint32(15169),
+		"autonomous_system_organization": "GOOGLE",
+	})
+	w.insertNetwork("1.2.3.0/24", version == 6, paris)
+	w.insertNetwork("8.8.0.0/16", version == 6, asn)
+	if version == 6 {
+		germany := w.add(map[string]interface{}{
+			"country": map[string]interface{}{"iso_code": "DE", "names": map[string]interface{}{"en": "Germany"}},
+		})
+		w.insertNetwork("2001:db8::/32", true, germany)
+	}
+	return w.bytes(size, version)
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		ip      string
+		v4, v6  Location
+		unknown bool
+	}{
+		{ip: "1.2.3.4", v4: Location{Country: "FR", CountryName: "France", City: "Paris"}},
+		{ip: "1.2.3.255", v4: Location{Country: "FR", CountryName: "France", City: "Paris"}},
+		{ip: "8.8.8.8", v4: Location{ASN: 15169, Org: "GOOGLE"}},
+		{ip: "1.2.4.1"},
+		{ip: "::ffff:1.2.3.4", v4: Location{Country: "FR", CountryName: "France", City: "Paris"}},
+		{ip: "2001:db8::1", v6: Location{Country: "DE", CountryName: "Germany"}},
+		{ip: "2001:db9::1"},
+	}
+	for _, size := range []int{24, 28, 32} {
+		for _, version := range []int{4, 6} {
+			for _, padding := range []int{0, 3000} {
+				m, err := parseMMDB(testDB(size, version, padding))
+				if err != nil {
+					t.Fatalf("%d bits, ipv%d: %s", size, version, err)
+				}
+				db := DB{dbs: []*mmdb{m}, cache: make(map[string]Location)}
+				for _, tt := range tests {
+					want := tt.v4
+					if version == 6 && tt.v6 != (Location{}) {
+						want = tt.v6
+					}
+					got, err := db.Lookup(net.ParseIP(tt.ip))
+					if err != nil {
+						t.Errorf("%d bits, ipv%d: %s: %s", size, version, tt.ip, err)
+						continue
+					}
+					if got != want {
+						t.Errorf("%d bits, ipv%d, padding %d: %s: got %+v, want %+v", size, version, padding, tt.ip, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestRecord(t *testing.T) {
+	tests := []struct {
+		size        uint
+		node        []byte
+		left, right uint
+	}{
+		{24, []byte{0x01, 0x02, 0x03, 0xfe, 0xdc, 0xba}, 0x010203, 0xfedcba},
+		{28, []byte{0x01, 0x02, 0x03, 0xa5, 0xfe, 0xdc, 0xba}, 0xa010203, 0x5fedcba},
+		{32, []byte{0x81, 0x02, 0x03, 0x04, 0xff, 0xfe, 0xfd, 0xfc}, 0x81020304, 0xfffefdfc},
+	}
+	for _, tt := range tests {
+		// the node is the second one of the tree
+		buf := append(make([]byte, len(tt.node)), tt.node...)
+		db := mmdb{buf: buf, size: tt.size, nodes: 2}
+		if got := db.record(1, 0); got != tt.left {
+			t.Errorf("%d bits: got left record %x, want %x", tt.size, got, tt.left)
+		}
+		if got := db.record(1, 1); got != tt.right {
+			t.Errorf("%d bits: got right record %x, want %x", tt.size, got, tt.right)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	values := []interface{}{
+		"",
+		"text",
+		strings.Repeat("a", 28),
+		strings.Repeat("b", 29),
+		strings.Repeat("c", 284),
+		strings.Repeat("d", 285),
+		strings.Repeat("e", 70000),
+		[]byte{1, 2, 3},
+		1.5,
+		float32(0.25),
+		uint16(0),
+		uint16(65535),
+		uint32(1 << 31),
+		uint64(1 << 60),
+		int32(-42),
+		true,
+		false,
+		[]interface{}{"a", uint16(1), []interface{}{true}},
+		map[string]interface{}{"a": map[string]interface{}{"b": "c"}},
+	}
+	for _, v := range values {
+		var buf bytes.Buffer
+		encodeValue(&buf, v)
+		got, next, err := decode(buf.Bytes(), 0)
+		if err != nil {
+			t.Errorf("%.20v: %s", v, err)
+			continue
+		}
+		if next != uint(buf.Len()) {
+			t.Errorf("%.20v: got next offset %d, want %d", v, next, buf.Len())
+		}
+		if !reflect.DeepEqual(got, normalize(v)) {
+			t.Errorf("%.20v: got %.20v", v, got)
+		}
+	}
+}
+
+// normalize gives the value decoded for v.
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case float32:
+		return float64(v)
+	case uint16:
+		return uint64(v)
+	case uint32:
+		return uint64(v)
+	case int32:
+		return int64(v)
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i := range v {
+			list[i] = normalize(v[i])
+		}
+		return list
+	case map[string]interface{}:
+		m := make(map[string]interface{})
+		for k, x := range v {
+			m[k] = normalize(x)
+		}
+		return m
+	default:
+		return v
+	}
+}
+
+func TestDecodePointer(t *testing.T) {
+	for _, ptr := range []int{0, 2047, 2048, 526335, 526336, 134744063, 134744064, 1<<32 - 1} {
+		var buf bytes.Buffer
+		encodeValue(&buf, pointer(ptr))
+		got, next, err := decodePointer(buf.Bytes(), buf.Bytes()[0], 1)
+		if err != nil {
+			t.Errorf("%d: %s", ptr, err)
+			continue
+		}
+		if got != uint(ptr) || next != uint(buf.Len()) {
+			t.Errorf("%d: got pointer %d, next offset %d", ptr, got, next)
+		}
+	}
+	// values shared by pointers with each size, the last one in front of the
+	// others
+	for _, padding := range []int{10, 3000, 530000} {
+		var buf bytes.Buffer
+		encodeValue(&buf, strings.Repeat("x", padding))
+		shared := buf.Len()
+		encodeValue(&buf, "shared")
+		start := buf.Len()
+		encodeValue(&buf, []interface{}{pointer(shared), pointer(shared), "end"})
+		got, _, err := decode(buf.Bytes(), uint(start))
+		if err != nil {
+			t.Fatalf("padding %d: %s", padding, err)
+		}
+		if want := []interface{}{"shared", "shared", "end"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("padding %d: got %v", padding, got)
+		}
+	}
+}
+
+func TestCorrupt(t *testing.T) {
+	valid := testDB(24, 6, 0)
+	tests := map[string]func() []byte{
+		"empty": func() []byte {
+			return nil
+		},
+		"no metadata": func() []byte {
+			return bytes.Replace(valid, metadataMarker, []byte("\xab\xcd\xefMaxMind.org"), 1)
+		},
+		"truncated metadata": func() []byte {
+			x := bytes.LastIndex(valid, metadataMarker) + len(metadataMarker)
+			return valid[:x+3]
+		},
+		"metadata not a map": func() []byte {
+			var buf bytes.Buffer
+			buf.Write(metadataMarker)
+			encodeValue(&buf, "metadata")
+			return buf.Bytes()
+		},
+		"record size": func() []byte {
+			var buf bytes.Buffer
+			buf.Write(metadataMarker)
+			encodeValue(&buf, map[string]interface{}{"node_count": uint32(1), "record_size": uint16(20), "ip_version": uint16(4)})
+			return buf.Bytes()
+		},
+		"tree too large": func() []byte {
+			var buf bytes.Buffer
+			buf.Write(make([]byte, 64))
+			buf.Write(metadataMarker)
+			encodeValue(&buf, map[string]interface{}{"node_count": uint32(100), "record_size": uint16(24), "ip_version": uint16(4)})
+			return buf.Bytes()
+		},
+	}
+	for name, fn := range tests {
+		if _, err := parseMMDB(fn()); !errors.Is(err, errFormat) {
+			t.Errorf("%s: got %v, want %v", name, err, errFormat)
+		}
+	}
+
+	// the data section is cut: the records point after its end
+	w := newWriter()
+	w.insertNetwork("1.2.3.0/24", false, w.add(names("Paris")))
+	buf := w.bytes(24, 4)
+	x := bytes.LastIndex(buf, metadataMarker)
+	buf = append(buf[:len(w.nodes)*6+16:len(w.nodes)*6+16], buf[x:]...)
+	m, err := parseMMDB(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.lookup(net.ParseIP("1.2.3.4")); !errors.Is(err, errFormat) {
+		t.Errorf("data after the end: got %v, want %v", err, errFormat)
+	}
+}
+
+func TestDecodeCorrupt(t *testing.T) {
+	deep := []byte{}
+	for i := 0; i < maxDepth+2; i++ {
+		deep = append(deep, 1, byte(typeArray-7))
+	}
+	deep = append(deep, byte(typeString<<5))
+	tests := map[string][]byte{
+		"empty":              {},
+		"truncated string":   {byte(typeString<<5 | 5), 'a', 'b'},
+		"truncated size":     {byte(typeString<<5 | 30), 1},
+		"truncated extended": {byte(typeExtended << 5)},
+		"unknown type":       {0x01, 0x20},
+		"map key":            {byte(typeMap<<5 | 1), byte(typeUint16<<5 | 1), 1, byte(typeString << 5)},
+		"truncated map":      {byte(typeMap<<5 | 2), byte(typeString<<5 | 1), 'a', byte(typeString << 5)},
+		"double size":        {byte(typeDouble<<5 | 4), 0, 0, 0, 0},
+		"float size":         {0x08, byte(typeFloat - 7), 0, 0, 0, 0, 0, 0, 0, 0},
+		"pointer to pointer": {byte(typePointer << 5), 2, byte(typePointer << 5), 0},
+		"truncated pointer":  {byte(typePointer<<5 | 1<<3), 0},
+		"pointer after end":  {byte(typePointer << 5), 100},
+		"nested too deeply":  deep,
+	}
+	for name, data := range tests {
+		if _, _, err := decode(data, 0); !errors.Is(err, errFormat) {
+			t.Errorf("%s: got %v, want %v", name, err, errFormat)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	city, asn := filepath.Join(dir, "city.mmdb"), filepath.Join(dir, "asn.mmdb")
+	if err := os.WriteFile(city, testDB(28, 6, 0), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w := newWriter()
+	w.insertNetwork("1.2.0.0/16", false, w.add(map[string]interface{}{
+		"autonomous_system_number":       uint32(64500),
+		"autonomous_system_organization": "EXAMPLE",
+	}))
+	if err := os.WriteFile(asn, w.bytes(32, 4), 0644); err != nil {
+		t.Fatal(err)
+	}
+	db, err := Open(city, asn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Location{Country: "FR", CountryName: "France", City: "Paris", ASN: 64500, Org: "EXAMPLE"}
+	for i := 0; i < 2; i++ {
+		got, err := db.Lookup(net.ParseIP("1.2.3.4"))
+		if err != nil || got != want {
+			t.Errorf("got %+v, %v, want %+v", got, err, want)
+		}
+	}
+	if err := os.WriteFile(asn, []byte("not a database"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(city, asn); !errors.Is(err, errFormat) {
+		t.Errorf("got %v, want %v", err, errFormat)
+	}
+	if _, err := Open(); err == nil {
+		t.Errorf("opened without database")
+	}
+}
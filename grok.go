@@ -0,0 +1,415 @@
+package log
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// grok expressions are translated like the formats of the other libraries
+// (see convert.go): the patterns of the grok library become the specifiers
+// matching the same values and the named fields of %{NAME:field} the names of
+// the words. The patterns of the definitions are expanded and only the part of
+// the regular expressions used around them is supported: escaped characters,
+// blanks with a quantifier, .* and the (optional) groups with alternatives.
+
+// grokPatterns are the patterns of the grok library matched by a specifier.
+var grokPatterns = map[string]string{
+	"WORD":              "%w",
+	"NOTSPACE":          "%w",
+	"DATA":              "%w",
+	"USERNAME":          "%w",
+	"USER":              "%w",
+	"HTTPDUSER":         "%w",
+	"EMAILADDRESS":      "%w",
+	"EMAILLOCALPART":    "%w",
+	"IPORHOST":          "%w",
+	"HOSTNAME":          "%w",
+	"HOST":              "%w",
+	"IP":                "%w",
+	"IPV4":              "%w",
+	"IPV6":              "%w",
+	"HOSTPORT":          "%w",
+	"IPORHOSTPORT":      "%w",
+	"URI":               "%w",
+	"URIPATH":           "%w",
+	"URIPATHPARAM":      "%w",
+	"URIPARAM":          "%w",
+	"PATH":              "%w",
+	"UNIXPATH":          "%w",
+	"WINPATH":           "%w",
+	"UUID":              "%w",
+	"MAC":               "%w",
+	"NUMBER":            "%w",
+	"INT":               "%w",
+	"POSINT":            "%w",
+	"NONNEGINT":         "%w",
+	"BASE10NUM":         "%w",
+	"BASE16NUM":         "%w",
+	"BASE16FLOAT":       "%w",
+	"PROG":              "%w",
+	"SYSLOGHOST":        "%w",
+	"QUOTEDSTRING":      "%q",
+	"QS":                "%q",
+	"GREEDYDATA":        "%m",
+	"LOGLEVEL":          "%l",
+	"TIMESTAMP_ISO8601": "%t",
+	"HTTPDATE":          "%t(%d/%b/%y:%H:%M:%S %Z)",
+	"SYSLOGTIMESTAMP":   "%t(%b %d %H:%M:%S)",
+}
+
+// grokDefinitions are the patterns of the grok library made of other patterns.
+var grokDefinitions = map[string]string{
+	"SYSLOGPROG":        `%{PROG:program}(?:\[%{POSINT:pid}\])?`,
+	"SYSLOGFACILITY":    `<%{NONNEGINT:facility}\.%{NONNEGINT:priority}>`,
+	"SYSLOGBASE":        `%{SYSLOGTIMESTAMP:timestamp} (?:%{SYSLOGFACILITY} )?%{SYSLOGHOST:logsource} %{SYSLOGPROG}:`,
+	"COMMONAPACHELOG":   `%{IPORHOST:clientip} %{HTTPDUSER:ident} %{USER:auth} \[%{HTTPDATE:timestamp}\] "(?:%{WORD:verb} %{NOTSPACE:request}(?: HTTP/%{NUMBER:httpversion})?|%{DATA:rawrequest})" %{NUMBER:response} (?:%{NUMBER:bytes}|-)`,
+	"COMBINEDAPACHELOG": `%{COMMONAPACHELOG} %{QS:referrer} %{QS:agent}`,
+}
+
+// grokFields are the names of the fields of the grok libraries having a
+// specifier of their own.
+var grokFields = map[string]string{
+	"host":      "%h",
+	"hostname":  "%h",
+	"logsource": "%h",
+	"clientip":  "%h",
+	"program":   "%n",
+	"process":   "%n",
+	"pid":       "%p",
+	"level":     "%l",
+	"loglevel":  "%l",
+	"log.level": "%l",
+	"user":      "%u",
+	"username":  "%u",
+}
+
+// FromGrok translates a grok expression (eg, "%{IPORHOST:client}
+// %{WORD:method} %{GREEDYDATA:message}") into an input pattern. The patterns
+// used are looked up first in definitions, then in the common patterns of the
+// grok library. The definitions that are regular expressions that can not be
+// translated (eg, "[A-F0-9]{10}") match a word like %w.
+//
+// The timestamps are set in the time of the entries, GREEDYDATA in the
+// message and the fields known by this package (eg, host, program, pid or
+// level) in theirs. The others are set in Named, converted when their type is
+// given (eg, %{NUMBER:bytes:int}). DATA matches a word, not any text.
+func FromGrok(pattern string, definitions map[string]string) (string, error) {
+	g := grokConverter{
+		definitions: definitions,
+		expanding:   make(map[string]bool),
+	}
+	pattern = strings.TrimSuffix(strings.TrimPrefix(pattern, "^"), "$")
+	var str strings.Builder
+	if err := g.convert(&str, []rune(pattern)); err != nil {
+		return "", err
+	}
+	return str.String(), nil
+}
+
+// ParseGrokDefinitions reads the definitions of a pattern file of grok (eg,
+// the patterns directory of logstash): a name followed by its pattern on each
+// line, the empty lines and the ones starting with # being ignored.
+func ParseGrokDefinitions(r io.Reader) (map[string]string, error) {
+	var (
+		defs = make(map[string]string)
+		scan = bufio.NewScanner(r)
+	)
+	for n := 1; scan.Scan(); n++ {
+		line := strings.TrimSpace(scan.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		x := strings.IndexAny(line, " \t")
+		if x < 0 {
+			return nil, syntaxError("grok", "line %d: pattern expected after %s", n, line)
+		}
+		defs[line[:x]] = strings.TrimSpace(line[x:])
+	}
+	return defs, scan.Err()
+}
+
+type grokConverter struct {
+	definitions map[string]string
+	expanding   map[string]bool
+	// regexp is set when a part of a regular expression that can not be
+	// translated is found
+	regexp bool
+}
+
+// convert translates the alternatives separated by | in rs.
+func (g *grokConverter) convert(str *strings.Builder, rs []rune) error {
+	branches, err := splitGrokBranches(rs)
+	if err != nil {
+		return err
+	}
+	return g.branches(str, branches)
+}
+
+func (g *grokConverter) branches(str *strings.Builder, branches [][]rune) error {
+	if len(branches) == 1 {
+		return g.sequence(str, branches[0])
+	}
+	str.WriteString("@(")
+	for i, b := range branches {
+		if i > 0 {
+			str.WriteString("|")
+		}
+		if err := g.sequence(str, b); err != nil {
+			return err
+		}
+	}
+	str.WriteString(")")
+	return nil
+}
+
+func (g *grokConverter) sequence(str *strings.Builder, rs []rune) error {
+	for i := 0; i < len(rs); i++ {
+		switch r := rs[i]; {
+		case r == '%' && i+1 < len(rs) && rs[i+1] == '{':
+			end := i + 2
+			for end < len(rs) && rs[end] != '}' {
+				end++
+			}
+			if end >= len(rs) {
+				return syntaxErrorAt("grok", i, "missing }")
+			}
+			if err := g.reference(str, string(rs[i+2:end])); err != nil {
+				return err
+			}
+			i = end
+		case r == '(':
+			end, err := matchingGrokParen(rs, i)
+			if err != nil {
+				return err
+			}
+			inner := rs[i+1 : end]
+			if len(inner) > 1 && inner[0] == '?' {
+				if inner[1] != ':' {
+					return g.unsupported(rs, i)
+				}
+				inner = inner[2:]
+			}
+			branches, err := splitGrokBranches(inner)
+			if err != nil {
+				return err
+			}
+			if i = end; i+1 < len(rs) && rs[i+1] == '?' {
+				branches = append(branches, nil)
+				i++
+			}
+			if i+1 < len(rs) && isGrokQuantifier(rs[i+1]) {
+				return g.unsupported(rs, i+1)
+			}
+			// the text following the group ends each branch so that the words
+			// ending them stop where it starts
+			if n := grokLiteralLen(rs[i+1:]); n > 0 {
+				for j := range branches {
+					branches[j] = append(append([]rune(nil), branches[j]...), rs[i+1:i+1+n]...)
+				}
+				i += n
+			}
+			if err := g.branches(str, branches); err != nil {
+				return err
+			}
+		case r == '.':
+			if i+1 >= len(rs) || (rs[i+1] != '*' && rs[i+1] != '+') {
+				return g.unsupported(rs, i)
+			}
+			if i++; i+1 < len(rs) && rs[i+1] == '?' {
+				i++
+			}
+			str.WriteString("%*")
+		case r == '\\':
+			if i++; i >= len(rs) {
+				return syntaxErrorAt("grok", i-1, "character expected after \\")
+			}
+			r = rs[i]
+			if r == 's' {
+				r = ' '
+			} else if isLetter(r) || isDigit(r) {
+				return g.unsupported(rs, i-1)
+			}
+			if err := g.literal(str, rs, i, r); err != nil {
+				return err
+			}
+			if i+1 < len(rs) && isGrokQuantifier(rs[i+1]) {
+				i++
+			}
+		case r == '[' || r == '{' || r == '^' || r == '$' || isGrokQuantifier(r):
+			return g.unsupported(rs, i)
+		default:
+			if err := g.literal(str, rs, i, r); err != nil {
+				return err
+			}
+			if i+1 < len(rs) && isGrokQuantifier(rs[i+1]) {
+				i++
+			}
+		}
+	}
+	return nil
+}
+
+// literal writes the character r at i. Only the blanks can be repeated.
+func (g *grokConverter) literal(str *strings.Builder, rs []rune, i int, r rune) error {
+	if i+1 < len(rs) && isGrokQuantifier(rs[i+1]) && !isBlank(r) {
+		return g.unsupported(rs, i)
+	}
+	writeConvertLiteral(str, r)
+	return nil
+}
+
+func (g *grokConverter) reference(str *strings.Builder, ref string) error {
+	parts := strings.SplitN(ref, ":", 3)
+	name, field, kind := parts[0], "", ""
+	if len(parts) > 1 {
+		field = grokField(parts[1])
+	}
+	if len(parts) > 2 {
+		kind = parts[2]
+	}
+	if kind != "" && kind != "int" && kind != "float" {
+		return syntaxError("grok", "%s: unknown type %s", ref, kind)
+	}
+	def, user := g.definitions[name]
+	if !user {
+		var ok bool
+		if def, ok = grokDefinitions[name]; !ok {
+			pattern, ok := grokPatterns[name]
+			if !ok {
+				return syntaxError("grok", "%s: unknown pattern", name)
+			}
+			writeGrokField(str, pattern, field, kind)
+			return nil
+		}
+	}
+	if g.expanding[name] {
+		return syntaxError("grok", "%s: recursive pattern", name)
+	}
+	g.expanding[name] = true
+	defer delete(g.expanding, name)
+
+	var sub strings.Builder
+	if err := g.convert(&sub, []rune(def)); err != nil {
+		if !user || !g.regexp {
+			return err
+		}
+		g.regexp = false
+		sub.Reset()
+		sub.WriteString("%w")
+	}
+	pattern := sub.String()
+	writeGrokField(str, pattern, field, kind)
+	return nil
+}
+
+func (g *grokConverter) unsupported(rs []rune, i int) error {
+	g.regexp = true
+	return syntaxErrorAt("grok", i, "unsupported regular expression %s", string(rs[i:]))
+}
+
+// writeGrokField writes the pattern of a field. Only the words and the quoted
+// strings are captured in Named and a definition made of several patterns
+// keeps the names of their fields.
+func writeGrokField(str *strings.Builder, pattern, field, kind string) {
+	if spec, ok := grokFields[field]; ok && pattern == "%w" {
+		pattern, field = spec, ""
+	}
+	if field == "" || (pattern != "%w" && pattern != "%q") {
+		str.WriteString(pattern)
+		return
+	}
+	if kind != "" {
+		field += ":" + kind
+	}
+	str.WriteString(pattern + "(" + field + ")")
+}
+
+// grokField gives the name of a field given in the syntax of the nested
+// fields of logstash (eg, [client][ip]) with dots (eg, client.ip).
+func grokField(field string) string {
+	if !strings.HasPrefix(field, "[") || !strings.HasSuffix(field, "]") {
+		return field
+	}
+	field = strings.TrimSuffix(strings.TrimPrefix(field, "["), "]")
+	return strings.ReplaceAll(field, "][", ".")
+}
+
+// splitGrokBranches splits rs on the | not in a group nor in a reference.
+func splitGrokBranches(rs []rune) ([][]rune, error) {
+	var (
+		list  [][]rune
+		depth int
+		last  int
+	)
+	for i := 0; i < len(rs); i++ {
+		switch rs[i] {
+		case '\\':
+			i++
+		case '{':
+			if i > 0 && rs[i-1] == '%' {
+				for i < len(rs) && rs[i] != '}' {
+					i++
+				}
+			}
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth < 0 {
+				return nil, syntaxErrorAt("grok", i, "unexpected )")
+			}
+		case '|':
+			if depth == 0 {
+				list = append(list, rs[last:i])
+				last = i + 1
+			}
+		}
+	}
+	return append(list, rs[last:]), nil
+}
+
+func matchingGrokParen(rs []rune, i int) (int, error) {
+	var depth int
+	for j := i; j < len(rs); j++ {
+		switch rs[j] {
+		case '\\':
+			j++
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return j, nil
+			}
+		}
+	}
+	return 0, syntaxErrorAt("grok", i, "missing )")
+}
+
+// grokLiteralLen gives the length of the text at the start of rs, up to the
+// first reference, group or character followed by a quantifier.
+func grokLiteralLen(rs []rune) int {
+	var n int
+	for n < len(rs) {
+		size := 1
+		switch r := rs[n]; {
+		case r == '\\':
+			if n+1 >= len(rs) || isLetter(rs[n+1]) || isDigit(rs[n+1]) {
+				return n
+			}
+			size++
+		case r == '%' && n+1 < len(rs) && rs[n+1] == '{':
+			return n
+		case strings.ContainsRune("()|.[{^$", r) || isGrokQuantifier(r):
+			return n
+		}
+		if n+size < len(rs) && isGrokQuantifier(rs[n+size]) {
+			return n
+		}
+		n += size
+	}
+	return n
+}
+
+func isGrokQuantifier(r rune) bool {
+	return r == '?' || r == '*' || r == '+'
+}
@@ -0,0 +1,157 @@
+package log
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFromGrok(t *testing.T) {
+	tests := []struct {
+		grok    string
+		pattern string
+		line    string
+		fields  map[string]string
+		values  map[string]interface{}
+	}{
+		{
+			grok:    `%{COMMONAPACHELOG}`,
+			pattern: `%h%b%w(ident)%b%w(auth)%b[%t(%d/%b/%y:%H:%M:%S %Z)]%b"@(%w(verb)%b%w(request)@(%bHTTP/%w(httpversion)"%b|"%b)|%w(rawrequest)"%b)%w(response)%b@(%w(bytes)|-)`,
+			line:    `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`,
+			fields: map[string]string{
+				"host":              "127.0.0.1",
+				"named.auth":        "frank",
+				"named.verb":        "GET",
+				"named.request":     "/apache_pb.gif",
+				"named.httpversion": "1.0",
+				"named.response":    "200",
+				"named.bytes":       "2326",
+			},
+		},
+		{
+			grok:    `%{SYSLOGBASE} %{GREEDYDATA:message}`,
+			pattern: `%t(%b %d %H:%M:%S)%b@(<%w(facility).%w(priority)>%b|)%h%b%n@([%p]|):%b%m`,
+			line:    `Oct  3 13:20:02 web01 sshd[2346]: Accepted publickey for bob`,
+			fields: map[string]string{
+				"host":    "web01",
+				"process": "sshd",
+				"pid":     "2346",
+				"message": "Accepted publickey for bob",
+			},
+		},
+		{
+			grok:    `%{SYSLOGBASE} %{GREEDYDATA:message}`,
+			pattern: `%t(%b %d %H:%M:%S)%b@(<%w(facility).%w(priority)>%b|)%h%b%n@([%p]|):%b%m`,
+			line:    `Oct  3 13:20:02 web01 kernel: eth0 link up`,
+			fields: map[string]string{
+				"host":    "web01",
+				"process": "kernel",
+				"pid":     "0",
+				"message": "eth0 link up",
+			},
+		},
+		{
+			grok:    `%{WORD:a}\s+%{WORD:b}`,
+			pattern: `%w(a)%b%w(b)`,
+			line:    "one  \t two",
+			fields:  map[string]string{"named.a": "one", "named.b": "two"},
+		},
+		{
+			grok:    `%{QS:agent} %{NUMBER:size:int} %{NUMBER:ratio:float}`,
+			pattern: `%q(agent)%b%w(size:int)%b%w(ratio:float)`,
+			line:    `"Mozilla/4.08 (Linux)" 42 0.5`,
+			fields:  map[string]string{"named.agent": "Mozilla/4.08 (Linux)", "named.size": "42"},
+			values:  map[string]interface{}{"size": 42, "ratio": 0.5},
+		},
+		{
+			grok:    `^%{IPORHOST:clientip} %{LOGLEVEL:level} .*$`,
+			pattern: `%h%b%l%b%*`,
+			line:    "10.0.0.1 ERROR anything",
+			fields:  map[string]string{"host": "10.0.0.1", "level": "ERROR"},
+		},
+	}
+	for _, tt := range tests {
+		pattern, err := FromGrok(tt.grok, nil)
+		if err != nil {
+			t.Errorf("%s: %s", tt.grok, err)
+			continue
+		}
+		if pattern != tt.pattern {
+			t.Errorf("%s: got pattern %s, want %s", tt.grok, pattern, tt.pattern)
+			continue
+		}
+		p, err := CompilePattern(pattern)
+		if err != nil {
+			t.Errorf("%s: %s", pattern, err)
+			continue
+		}
+		e, err := p.Parse(tt.line)
+		if err != nil {
+			t.Errorf("%s: %q: %s", tt.grok, tt.line, err)
+			continue
+		}
+		for field, want := range tt.fields {
+			if got, _ := entryField(e, field); got != want {
+				t.Errorf("%s: %s: got %q, want %q", tt.grok, field, got, want)
+			}
+		}
+		for name, want := range tt.values {
+			if got := e.Values[name]; !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: value %s: got %v, want %v", tt.grok, name, got, want)
+			}
+		}
+	}
+}
+
+func TestFromGrokDefinitions(t *testing.T) {
+	defs, err := ParseGrokDefinitions(strings.NewReader("# ids\nQUEUEID [A-F0-9]{10}\n\nPOSTFIX %{SYSLOGBASE} %{QUEUEID:queue}: %{GREEDYDATA:message}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pattern, err := FromGrok(`%{POSTFIX}`, defs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `%t(%b %d %H:%M:%S)%b@(<%w(facility).%w(priority)>%b|)%h%b%n@([%p]|):%b%w(queue):%b%m`
+	if pattern != want {
+		t.Errorf("got pattern %s, want %s", pattern, want)
+	}
+	if _, err := ParseGrokDefinitions(strings.NewReader("NOPATTERN\n")); err == nil {
+		t.Errorf("definition without pattern accepted")
+	}
+}
+
+func TestFromGrokErrors(t *testing.T) {
+	tests := []string{
+		`%{WORD:a}[0-9]`,
+		`%{WORD:a}\d+`,
+		`(?<name>a)`,
+		`a{2}`,
+		`%{WORD:a}+`,
+		`a^b`,
+		`a.b`,
+		`ab+`,
+		`(a|b)*`,
+		`%{FOO}`,
+		`%{WORD:a:bool}`,
+		`(a`,
+		`a)`,
+		`%{WORD`,
+		`a\`,
+	}
+	for _, grok := range tests {
+		pattern, err := FromGrok(grok, nil)
+		if err == nil {
+			t.Errorf("%s: got pattern %s, want error", grok, pattern)
+			continue
+		}
+		if !errors.Is(err, ErrSyntax) {
+			t.Errorf("%s: got %v, want a syntax error", grok, err)
+		}
+	}
+	defs := map[string]string{"A": "%{B}", "B": "%{A}"}
+	if _, err := FromGrok(`%{A}`, defs); err == nil {
+		t.Errorf("recursive definitions accepted")
+	}
+}
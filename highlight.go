@@ -0,0 +1,75 @@
+package log
+
+import (
+	"sort"
+	"strings"
+)
+
+// Highlighter marks in the printed form of an entry the values that satisfied
+// the like and match functions and the ~= operator of a filter, like grep
+// does with its --color option. Terms under a negation are ignored.
+type Highlighter struct {
+	terms []term
+}
+
+func NewHighlighter(expr string) (*Highlighter, error) {
+	f := filter{input: expr}
+	if f.skip(); f.pos < len(f.input) {
+		if _, err := f.parse(); err != nil {
+			return nil, err
+		}
+		if f.skip(); f.pos < len(f.input) {
+			return nil, f.errorf("unexpected %q", f.input[f.pos:])
+		}
+	}
+	return &Highlighter{terms: f.terms}, nil
+}
+
+// Mark wraps between start and end all the occurrences in line of the parts
+// of the fields of e matched by the terms of the filter.
+func (h *Highlighter) Mark(e Entry, line, start, end string) string {
+	type span struct {
+		from, to int
+	}
+	var spans []span
+	for _, t := range h.terms {
+		for _, value := range t.re.FindAllString(fieldString(getField(e, t.field)), -1) {
+			if value == "" {
+				continue
+			}
+			for i := 0; ; {
+				x := strings.Index(line[i:], value)
+				if x < 0 {
+					break
+				}
+				spans = append(spans, span{from: i + x, to: i + x + len(value)})
+				i += x + len(value)
+			}
+		}
+	}
+	if len(spans) == 0 {
+		return line
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].from < spans[j].from
+	})
+	var (
+		str  strings.Builder
+		last int
+	)
+	for i := 0; i < len(spans); i++ {
+		s := spans[i]
+		for i+1 < len(spans) && spans[i+1].from <= s.to {
+			if i++; spans[i].to > s.to {
+				s.to = spans[i].to
+			}
+		}
+		str.WriteString(line[last:s.from])
+		str.WriteString(start)
+		str.WriteString(line[s.from:s.to])
+		str.WriteString(end)
+		last = s.to
+	}
+	str.WriteString(line[last:])
+	return str.String()
+}
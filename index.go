@@ -0,0 +1,429 @@
+package log
+
+import (
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrIndex is the error of an index that does not describe its file anymore,
+// eg, when the file was truncated or rewritten since the index was built.
+var ErrIndex = errors.New("index out of date")
+
+const (
+	// indexBlock is the size of the parts of a file described by an index
+	indexBlock = 1 << 16
+	// indexValues is the maximum number of levels or processes listed for a
+	// part of a file
+	indexValues = 32
+	// indexCheck is the size of the text before the end of the indexed part of
+	// a file used to check that it has not changed
+	indexCheck = 1 << 12
+)
+
+// Index describes where the entries of a file are by blocks of about 64KB,
+// starting at the beginning of an entry. It is saved next to the file, with
+// the .idx extension. Only the part of the file written when the index was
+// built is described: the entries appended after are always read.
+type Index struct {
+	File    string `json:"file"`
+	Pattern string `json:"pattern"`
+	// the options of the Reader that built the index changing the entries
+	Location string   `json:"location,omitempty"`
+	Year     int      `json:"year,omitempty"`
+	Strict   bool     `json:"strict,omitempty"`
+	Records  bool     `json:"records,omitempty"`
+	Starts   []string `json:"starts,omitempty"`
+	// Size is the size of the indexed part of the file and Check the CRC32 of
+	// its last bytes
+	Size   int64        `json:"size"`
+	Check  uint32       `json:"check"`
+	Blocks []IndexBlock `json:"blocks"`
+}
+
+// IndexBlock gives the times, levels and processes of the entries of a block
+// of a file. The entries without a time are not counted in First and Last.
+// Levels and Processes are nil when the block has too many different ones.
+type IndexBlock struct {
+	Offset    int64     `json:"offset"`
+	First     time.Time `json:"first"`
+	Last      time.Time `json:"last"`
+	Levels    []string  `json:"levels"`
+	Processes []string  `json:"processes"`
+}
+
+// IndexQuery selects the blocks of a file that can hold entries at or after
+// Since, before Until, with one of the Levels (ignoring case) and one of the
+// Processes. The zero values select all the blocks. Like in the filters, the
+// times without a year are compared in the year of Since and Until.
+type IndexQuery struct {
+	Since     time.Time
+	Until     time.Time
+	Levels    []string
+	Processes []string
+}
+
+func (q IndexQuery) match(b IndexBlock) bool {
+	if !q.Since.IsZero() && (b.Last.IsZero() || sameYear(b.Last, q.Since).Before(q.Since)) {
+		return false
+	}
+	if !q.Until.IsZero() && (b.First.IsZero() || !sameYear(b.First, q.Until).Before(q.Until)) {
+		return false
+	}
+	return matchIndexValues(b.Levels, q.Levels) && matchIndexValues(b.Processes, q.Processes)
+}
+
+func matchIndexValues(values, query []string) bool {
+	if values == nil || len(query) == 0 {
+		return true
+	}
+	for _, q := range query {
+		for _, v := range values {
+			if strings.EqualFold(v, q) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// BuildIndex reads the entries of file matching pattern and saves its index
+// next to it. The options are the ones given to NewReader to read the file
+// (eg, WithLocation or WithRecords).
+func BuildIndex(file, pattern string, opts ...Option) (*Index, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	rs, err := NewReader(io.LimitReader(f, fi.Size()), pattern, "", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := Index{
+		File:    file,
+		Pattern: pattern,
+	}
+	x.setOptions(rs)
+	var (
+		e         Entry
+		block     *IndexBlock
+		levels    indexSet
+		processes indexSet
+	)
+	flush := func() {
+		if block != nil {
+			block.Levels, block.Processes = levels.list(), processes.list()
+		}
+		levels, processes = indexSet{}, indexSet{}
+	}
+	for {
+		err := rs.ReadInto(&e)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if block == nil || e.Source.Offset-block.Offset >= indexBlock {
+			var offset int64
+			if block != nil {
+				offset = e.Source.Offset
+			}
+			flush()
+			x.Blocks = append(x.Blocks, IndexBlock{Offset: offset})
+			block = &x.Blocks[len(x.Blocks)-1]
+		}
+		if !e.When.IsZero() {
+			seen(&block.First, &block.Last, e.When)
+		}
+		levels.add(e.Level)
+		processes.add(e.Process)
+	}
+	flush()
+	if x.Size = rs.Stats().Bytes; x.Size > fi.Size() {
+		x.Size = fi.Size()
+	}
+	if x.Check, err = indexChecksum(f, x.Size); err != nil {
+		return nil, err
+	}
+	return &x, x.save(indexPath(file))
+}
+
+// Compatible tells whether the index was built for pattern and with the same
+// options as opts, so that it describes the entries given by a Reader created
+// with them.
+func (x *Index) Compatible(pattern string, opts ...Option) bool {
+	r, err := NewReader(strings.NewReader(""), pattern, "", opts...)
+	if err != nil || x.Pattern != pattern {
+		return false
+	}
+	other := Index{Pattern: pattern}
+	other.setOptions(r)
+	return x.Location == other.Location && x.Year == other.Year && x.Strict == other.Strict &&
+		x.Records == other.Records && strings.Join(x.Starts, "\n") == strings.Join(other.Starts, "\n")
+}
+
+func (x *Index) setOptions(r *Reader) {
+	if loc := r.cfg.location; loc != nil {
+		x.Location = loc.String()
+	}
+	x.Year, x.Strict = r.cfg.year, r.cfg.strict
+	if r.records != nil {
+		x.Records, x.Starts = true, r.records.starts
+	}
+}
+
+// indexSet is the set of the different values of a field in a block.
+type indexSet struct {
+	values []string
+	many   bool
+}
+
+func (s *indexSet) add(value string) {
+	if s.many {
+		return
+	}
+	for _, v := range s.values {
+		if v == value {
+			return
+		}
+	}
+	if len(s.values) >= indexValues {
+		s.values, s.many = nil, true
+		return
+	}
+	s.values = append(s.values, value)
+}
+
+func (s *indexSet) list() []string {
+	if s.many {
+		return nil
+	}
+	return s.values
+}
+
+// LoadIndex reads the index saved next to file. The error is ErrIndex when the
+// file has changed since the index was built.
+func LoadIndex(file string) (*Index, error) {
+	buf, err := os.ReadFile(indexPath(file))
+	if err != nil {
+		return nil, err
+	}
+	var x Index
+	if err := json.Unmarshal(buf, &x); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() < x.Size {
+		return nil, ErrIndex
+	}
+	if sum, err := indexChecksum(f, x.Size); err != nil || sum != x.Check {
+		if err == nil {
+			err = ErrIndex
+		}
+		return nil, err
+	}
+	return &x, nil
+}
+
+func (x *Index) save(file string) error {
+	buf, err := json.Marshal(x)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file))
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(buf); err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+func indexPath(file string) string {
+	return file + ".idx"
+}
+
+// indexChecksum gives the CRC32 of the bytes of f before size.
+func indexChecksum(f *os.File, size int64) (uint32, error) {
+	start := size - indexCheck
+	if start < 0 {
+		start = 0
+	}
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, io.NewSectionReader(f, start, size-start)); err != nil {
+		return 0, err
+	}
+	return h.Sum32(), nil
+}
+
+// Indexed is an io.Reader giving only the blocks of a file that can hold the
+// entries selected by a query according to the index of the file, and the
+// part of the file appended after the index was built.
+//
+// Like with a Rotated, a Reader created with an Indexed sets the File and
+// Offset of the Source of its entries to their position in the file. The line
+// numbers are relative to the blocks read.
+type Indexed struct {
+	file    *os.File
+	index   *Index
+	regions []indexRegion
+	curr    int
+	last    byte
+	total   int64
+
+	mu       sync.Mutex
+	segments []watchSegment
+}
+
+// indexRegion is a part of a file made of consecutive blocks. end is -1 for
+// the part appended after the index was built.
+type indexRegion struct {
+	pos   int64
+	end   int64
+	begun bool
+}
+
+// OpenIndexed opens file to read the blocks selected by q with the index saved
+// next to it. The error is ErrIndex when the file has changed since the index
+// was built.
+func OpenIndexed(file string, q IndexQuery) (*Indexed, error) {
+	x, err := LoadIndex(file)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	rd := Indexed{
+		file:  f,
+		index: x,
+	}
+	for i, b := range x.Blocks {
+		if !q.match(b) {
+			continue
+		}
+		end := x.Size
+		if i+1 < len(x.Blocks) {
+			end = x.Blocks[i+1].Offset
+		}
+		if n := len(rd.regions); n > 0 && rd.regions[n-1].end == b.Offset {
+			rd.regions[n-1].end = end
+			continue
+		}
+		rd.regions = append(rd.regions, indexRegion{pos: b.Offset, end: end})
+	}
+	if n := len(rd.regions); n > 0 && rd.regions[n-1].end == x.Size {
+		rd.regions[n-1].end = -1
+	} else {
+		rd.regions = append(rd.regions, indexRegion{pos: x.Size, end: -1})
+	}
+	return &rd, nil
+}
+
+// Index gives the index used to read the file. Its Pattern is the one to give
+// to NewReader.
+func (x *Indexed) Index() *Index {
+	return x.index
+}
+
+func (x *Indexed) Read(b []byte) (int, error) {
+	for x.curr < len(x.regions) {
+		r := &x.regions[x.curr]
+		if r.pos == r.end {
+			x.curr++
+			continue
+		}
+		if len(b) == 0 {
+			return 0, nil
+		}
+		if !r.begun {
+			if x.total > 0 && x.last != '\n' {
+				// the last line of the previous region is not mixed with the
+				// first one of the next region
+				b[0], x.last = '\n', '\n'
+				x.total++
+				return 1, nil
+			}
+			r.begun = true
+			x.mu.Lock()
+			x.segments = append(x.segments, watchSegment{
+				start:  x.total,
+				file:   x.file.Name(),
+				offset: r.pos,
+			})
+			x.mu.Unlock()
+		}
+		buf := b
+		if r.end >= 0 && int64(len(buf)) > r.end-r.pos {
+			buf = buf[:r.end-r.pos]
+		}
+		n, err := x.file.ReadAt(buf, r.pos)
+		if n > 0 {
+			r.pos += int64(n)
+			x.total += int64(n)
+			x.last = buf[n-1]
+			return n, nil
+		}
+		if err == io.EOF {
+			r.end = r.pos
+			continue
+		}
+		return 0, err
+	}
+	return 0, io.EOF
+}
+
+// SourceAt gives the file and the offset in this file of the byte at offset in
+// the stream of the Indexed.
+func (x *Indexed) SourceAt(offset int64) (string, int64) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	i := sort.Search(len(x.segments), func(i int) bool {
+		return x.segments[i].start > offset
+	})
+	if i == 0 {
+		return "", offset
+	}
+	s := x.segments[i-1]
+	if i > 1 {
+		x.segments = x.segments[i-1:]
+	}
+	return s.file, s.offset + offset - s.start
+}
+
+func (x *Indexed) Close() error {
+	x.curr = len(x.regions)
+	return x.file.Close()
+}
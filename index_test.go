@@ -0,0 +1,89 @@
+package log
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIndexYearless(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "syslog")
+	lines := "Mar  1 10:00:00 web01 sshd[12]: accepted\nMar  2 10:00:00 web01 sshd[13]: closed\n"
+	if err := os.WriteFile(file, []byte(lines), 0644); err != nil {
+		t.Fatal(err)
+	}
+	const pattern = "%t(%b %d %H:%M:%S) %h %n[%p]: %m"
+	if _, err := BuildIndex(file, pattern); err != nil {
+		t.Fatal(err)
+	}
+	queries := []struct {
+		query IndexQuery
+		want  int
+	}{
+		{IndexQuery{Since: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)}, 2},
+		{IndexQuery{Until: time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)}, 2},
+		{IndexQuery{Since: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)}, 0},
+		{IndexQuery{Until: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)}, 0},
+	}
+	for _, q := range queries {
+		x, err := OpenIndexed(file, q.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := NewReader(x, pattern, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var count int
+		for {
+			_, err := r.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			count++
+		}
+		x.Close()
+		if count != q.want {
+			t.Errorf("%+v: got %d entries, want %d", q.query, count, q.want)
+		}
+	}
+}
+
+func TestIndexCompatible(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(file, []byte("2024-03-01T10:00:00Z info started\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	const pattern = "%t %l %m"
+	x, err := BuildIndex(file, pattern, WithLocation(time.UTC), WithYear(2023))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		pattern string
+		opts    []Option
+		want    bool
+	}{
+		{pattern, []Option{WithLocation(time.UTC), WithYear(2023)}, true},
+		{pattern, []Option{WithYear(2023), WithLocation(time.UTC)}, true},
+		{"%t %m", []Option{WithLocation(time.UTC), WithYear(2023)}, false},
+		{pattern, []Option{WithYear(2023)}, false},
+		{pattern, []Option{WithLocation(time.UTC), WithYear(YearAuto)}, false},
+		{pattern, []Option{WithLocation(time.UTC), WithYear(2023), WithRecords()}, false},
+		{pattern, []Option{WithLocation(time.UTC), WithYear(2023), WithStrict()}, false},
+	}
+	for i, tt := range tests {
+		if got := x.Compatible(tt.pattern, tt.opts...); got != tt.want {
+			t.Errorf("%d: got %t, want %t", i, got, tt.want)
+		}
+	}
+	if x, err = LoadIndex(file); err != nil || !x.Compatible(pattern, WithLocation(time.UTC), WithYear(2023)) {
+		t.Errorf("saved index not compatible: %v", err)
+	}
+}
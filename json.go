@@ -0,0 +1,238 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"time"
+)
+
+// colors of the keys, the strings and the other values written by a JSON
+// Writer created WithColors.
+const (
+	jsonKeyColor    = "\x1b[34m"
+	jsonStringColor = "\x1b[32m"
+	jsonValueColor  = "\x1b[33m"
+	jsonColorReset  = "\x1b[0m"
+)
+
+type JSONOption func(*jsonWriter)
+
+// WithColors highlights the keys and the values with ANSI colors, for output
+// written to a terminal.
+func WithColors() JSONOption {
+	return func(j *jsonWriter) {
+		j.color = true
+	}
+}
+
+// WithArray writes the entries as the elements of a single JSON array, closed
+// when the Writer is closed, instead of one object per line.
+func WithArray() JSONOption {
+	return func(j *jsonWriter) {
+		j.array = true
+	}
+}
+
+// WithKeys sets the fields written and their order. named writes all the
+// named words in an object and named.<name> a single one. By default, all the
+// fields are written in the order of the field list of the filters, followed
+// by the named words.
+func WithKeys(fields ...string) JSONOption {
+	return func(j *jsonWriter) {
+		if len(fields) > 0 {
+			j.keys = fields
+		}
+	}
+}
+
+// WithoutKeys removes fields from the ones written.
+func WithoutKeys(fields ...string) JSONOption {
+	return func(j *jsonWriter) {
+		for _, f := range fields {
+			j.skip[f] = true
+		}
+	}
+}
+
+type jsonWriter struct {
+	inner  io.Writer
+	buffer bytes.Buffer
+	value  bytes.Buffer
+	enc    *json.Encoder
+
+	keys  []string
+	skip  map[string]bool
+	color bool
+
+	array bool
+	count int
+}
+
+// JSON returns a Writer that writes entries as JSON objects, one per line
+// unless it is created WithArray. Keys always come in the same order and the
+// empty values are left out. The typed values of the named words are written
+// as numbers or booleans, durations in seconds.
+func JSON(w io.Writer, opts ...JSONOption) (Writer, error) {
+	j := jsonWriter{
+		inner: w,
+		keys:  append(append([]string{}, fields...), "named"),
+		skip:  make(map[string]bool),
+	}
+	for _, o := range opts {
+		o(&j)
+	}
+	for _, k := range j.keys {
+		if k != "named" && !isField(k) {
+			return nil, fmt.Errorf("json: %s: unknown field", k)
+		}
+	}
+	for k := range j.skip {
+		if k != "named" && !isField(k) {
+			return nil, fmt.Errorf("json: %s: unknown field", k)
+		}
+	}
+	j.enc = json.NewEncoder(&j.value)
+	j.enc.SetEscapeHTML(false)
+	return &j, nil
+}
+
+func (j *jsonWriter) Write(e Entry) error {
+	if j.array {
+		if j.count == 0 {
+			j.buffer.WriteString("[\n")
+		} else {
+			j.buffer.WriteString(",\n")
+		}
+		j.count++
+	}
+	j.buffer.WriteByte('{')
+	var count int
+	for _, k := range j.keys {
+		if j.skip[k] {
+			continue
+		}
+		if k == "named" {
+			if len(e.Named) == 0 && len(e.Values) == 0 {
+				continue
+			}
+			j.writeKey(k, count)
+			j.writeNamed(e)
+			count++
+			continue
+		}
+		v := getField(e, k)
+		if isEmptyValue(k, v) {
+			continue
+		}
+		j.writeKey(k, count)
+		j.writeValue(v)
+		count++
+	}
+	j.buffer.WriteByte('}')
+	if !j.array {
+		j.buffer.WriteByte('\n')
+	}
+	_, err := io.Copy(j.inner, &j.buffer)
+	return err
+}
+
+// Close ends the array of a Writer created WithArray. The underlying writer is
+// not closed.
+func (j *jsonWriter) Close() error {
+	if !j.array || j.count < 0 {
+		return nil
+	}
+	str := "\n]\n"
+	if j.count == 0 {
+		str = "[]\n"
+	}
+	j.count = -1
+	_, err := io.WriteString(j.inner, str)
+	return err
+}
+
+func (j *jsonWriter) writeNamed(e Entry) {
+	keys := make([]string, 0, len(e.Named)+len(e.Values))
+	for k := range e.Named {
+		keys = append(keys, k)
+	}
+	for k := range e.Values {
+		if _, ok := e.Named[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	j.buffer.WriteByte('{')
+	var count int
+	for _, k := range keys {
+		if j.skip["named."+k] {
+			continue
+		}
+		j.writeKey(k, count)
+		j.writeValue(getField(e, "named."+k))
+		count++
+	}
+	j.buffer.WriteByte('}')
+}
+
+func (j *jsonWriter) writeKey(key string, count int) {
+	if count > 0 {
+		j.buffer.WriteByte(',')
+	}
+	j.writeColor(jsonKeyColor, key)
+	j.buffer.WriteByte(':')
+}
+
+func (j *jsonWriter) writeValue(v interface{}) {
+	color := jsonValueColor
+	switch x := v.(type) {
+	case time.Time:
+		v, color = x.Format(time.RFC3339Nano), jsonStringColor
+	case time.Duration:
+		v = x.Seconds()
+	case net.IP:
+		v, color = x.String(), jsonStringColor
+	case string:
+		color = jsonStringColor
+	}
+	j.writeColor(color, v)
+}
+
+func (j *jsonWriter) writeColor(color string, v interface{}) {
+	j.value.Reset()
+	if err := j.enc.Encode(v); err != nil {
+		j.value.Reset()
+		j.enc.Encode(fmt.Sprint(v))
+	}
+	str := bytes.TrimSuffix(j.value.Bytes(), []byte{'\n'})
+	if !j.color {
+		j.buffer.Write(str)
+		return
+	}
+	j.buffer.WriteString(color)
+	j.buffer.Write(str)
+	j.buffer.WriteString(jsonColorReset)
+}
+
+// isEmptyValue tells whether the value of a field is left out. Offset 0 is the
+// offset of the first line and is kept.
+func isEmptyValue(field string, v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case int:
+		return v == 0 && field != "offset"
+	case time.Time:
+		return v.IsZero()
+	case net.IP:
+		return v == nil
+	default:
+		return false
+	}
+}
@@ -0,0 +1,171 @@
+package log
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// WithFields enables the lazy mode of the Reader: only the given fields and
+// the fields used by its filter are extracted from the lines. The text of the
+// other specifiers is still matched but it is not converted nor stored (eg,
+// the timestamps of %t are not computed when time is not needed and the value
+// of a typed capture is not checked). Fields are given like in the filters
+// (time, host, named.<name>,...), named standing for all the named words.
+//
+// The fields used by the output pattern can be given by PrintFields and the
+// ones used by other filters by FilterFields. Transforms, derived fields,
+// sinks and writers not based on a pattern usually need all the fields: the
+// lazy mode should not be used with them.
+func WithFields(fields ...string) Option {
+	return func(r *Reader) {
+		if r.cfg.fields == nil {
+			r.cfg.fields = make(map[string]bool)
+		}
+		for _, f := range fields {
+			r.cfg.fields[f] = true
+		}
+	}
+}
+
+// useFields adds to the fields to extract the ones used by the filter of the
+// Reader and by its other options.
+func (r *Reader) useFields(filter string) {
+	list, _ := FilterFields(filter)
+	if r.filter != nil {
+		list = append(list, r.filter.fields...)
+	}
+	for _, f := range list {
+		r.cfg.fields[f] = true
+	}
+	if r.embedded {
+		r.cfg.fields["message"] = true
+		r.cfg.fields["named"] = true
+	}
+	if r.schema != nil {
+		for _, f := range r.schema.Required {
+			r.cfg.fields[f] = true
+		}
+		for f := range r.schema.Types {
+			r.cfg.fields[f] = true
+		}
+		if len(r.schema.Levels) > 0 {
+			r.cfg.fields["level"] = true
+		}
+	}
+}
+
+// needs tells whether one of the given fields should be extracted.
+func (c config) needs(fields ...string) bool {
+	if c.fields == nil {
+		return true
+	}
+	for _, f := range fields {
+		if c.fields[f] || (strings.HasPrefix(f, "named.") && c.fields["named"]) {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterFields gives the fields used by a filter.
+func FilterFields(expr string) ([]string, error) {
+	f := filter{input: expr}
+	if f.skip(); f.pos >= len(f.input) {
+		return nil, nil
+	}
+	if _, err := f.parse(); err != nil {
+		return nil, err
+	}
+	return uniqueFields(f.fields), nil
+}
+
+// PrintFields gives the fields used by an output pattern or preset.
+func PrintFields(pattern string) ([]string, error) {
+	pattern = lookupPreset(KindOutput, pattern)
+	if _, err := parsePrint(pattern); err != nil {
+		return nil, err
+	}
+	var (
+		str  = bytes.NewReader([]byte(pattern))
+		list []string
+	)
+	for str.Len() > 0 {
+		if r, _, _ := str.ReadRune(); r != '%' {
+			continue
+		}
+		if peek(str) == '%' {
+			str.ReadRune()
+			continue
+		}
+		offset, _ := str.Seek(0, io.SeekCurrent)
+		parsePrintSpecifier(str)
+		end, _ := str.Seek(0, io.SeekCurrent)
+		spec := strings.TrimLeft(pattern[offset:end], "-.0123456789")
+		if spec == "" || !strings.ContainsRune(printSpecifiers, rune(spec[0])) {
+			continue
+		}
+		if spec[0] == '{' {
+			expr, _ := parseExprArgument(bytes.NewReader([]byte(spec[1:])))
+			_, fields, _ := compileExpr(expr)
+			list = append(list, fields...)
+		} else if f := printField(spec); f != "" {
+			list = append(list, f)
+		}
+	}
+	return uniqueFields(list), nil
+}
+
+var printFields = map[byte]string{
+	't': "time",
+	'n': "process",
+	'p': "pid",
+	'u': "user",
+	'g': "group",
+	'h': "host",
+	'l': "level",
+	'm': "message",
+	'#': "line",
+	'f': "file",
+	'k': "named",
+}
+
+// printField gives the field printed by a specifier (eg, w(user):upper).
+func printField(spec string) string {
+	if spec[0] != 'w' {
+		return printFields[spec[0]]
+	}
+	if !strings.HasPrefix(spec, "w(") {
+		return "named"
+	}
+	name := spec[2:]
+	if x := strings.IndexByte(name, ')'); x >= 0 {
+		name = name[:x]
+	}
+	if name == "" {
+		return "named"
+	}
+	return "named." + name
+}
+
+func uniqueFields(list []string) []string {
+	var (
+		seen = make(map[string]bool)
+		res  []string
+	)
+	for _, f := range list {
+		if !seen[f] {
+			seen[f] = true
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+// parseSkip reads the characters accepted without storing them.
+func parseSkip(accept func(rune) bool) parsefunc {
+	return func(_ *Entry, r *scanner) error {
+		r.scan(0, accept)
+		return nil
+	}
+}
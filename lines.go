@@ -0,0 +1,115 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Overflow tells what a Reader does with the lines longer than the maximum
+// size given to WithMaxLine.
+type Overflow int
+
+const (
+	// OverflowTruncate keeps the start of the line and skips the rest.
+	OverflowTruncate Overflow = iota
+	// OverflowChunk cuts the line in chunks parsed as separate lines having
+	// the same line number.
+	OverflowChunk
+)
+
+// ParseOverflow gives the Overflow mode from its name: truncate or chunk.
+func ParseOverflow(name string) (Overflow, error) {
+	switch name {
+	case "", "truncate":
+		return OverflowTruncate, nil
+	case "chunk":
+		return OverflowChunk, nil
+	default:
+		return OverflowTruncate, fmt.Errorf("%s: unknown overflow mode", name)
+	}
+}
+
+func (o Overflow) String() string {
+	if o == OverflowChunk {
+		return "chunk"
+	}
+	return "truncate"
+}
+
+// lineSplit cuts the input in lines of at most max bytes. Like recordSplit,
+// it keeps the offset and the number of the last line given since they can
+// not be computed from the length of a truncated line.
+type lineSplit struct {
+	max  int
+	mode Overflow
+	// rest of a truncated line to skip or of a chunked line to give
+	skip bool
+	cont bool
+	long int
+
+	pos   int64
+	lines int
+	start int64
+	line  int
+}
+
+func (s *lineSplit) reset(offset int64) {
+	s.pos, s.lines = offset, 0
+	s.skip, s.cont = false, false
+}
+
+func (s *lineSplit) split(data []byte, atEOF bool) (int, []byte, error) {
+	if s.skip {
+		x := bytes.IndexByte(data, '\n')
+		if x < 0 {
+			s.pos += int64(len(data))
+			return len(data), nil, nil
+		}
+		s.skip = false
+		s.pos += int64(x + 1)
+		s.lines++
+		return x + 1, nil, nil
+	}
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	x := bytes.IndexByte(data, '\n')
+	if x >= 0 && x <= s.max {
+		s.cont = false
+		return s.take(data[:x], x+1, true)
+	}
+	if x < 0 && len(data) <= s.max {
+		if atEOF {
+			return s.take(data, len(data), false)
+		}
+		return 0, nil, nil
+	}
+	n := s.max
+	for n > 0 && !utf8.RuneStart(data[n]) {
+		n--
+	}
+	if n == 0 {
+		n = s.max
+	}
+	if !s.cont {
+		s.long++
+	}
+	if s.mode == OverflowChunk {
+		s.cont = true
+	} else {
+		s.skip = true
+	}
+	return s.take(data[:n], n, false)
+}
+
+func (s *lineSplit) take(line []byte, advance int, eol bool) (int, []byte, error) {
+	s.start = s.pos
+	s.line = s.lines + 1
+	s.pos += int64(advance)
+	if eol {
+		s.lines++
+		line = bytes.TrimSuffix(line, []byte{'\r'})
+	}
+	return advance, line, nil
+}
@@ -0,0 +1,158 @@
+package log
+
+import (
+	"strings"
+	"sync"
+)
+
+// month and day names accepted by the %b and %a time specifiers. Names from
+// every registered locale are accepted, both in their full and abbreviated
+// forms.
+
+var names = struct {
+	sync.RWMutex
+	months map[string]int
+	days   map[string]int
+}{
+	months: make(map[string]int),
+	days:   make(map[string]int),
+}
+
+func init() {
+	RegisterLocale("en", enMonths, enDays)
+	RegisterLocale("fr", frMonths, frDays)
+	RegisterLocale("de", deMonths, deDays)
+	RegisterLocale("es", esMonths, esDays)
+}
+
+// RegisterLocale makes the given month names (january first) and day names
+// (sunday first) available to the time parser. Each element lists the
+// accepted spellings of one month or day.
+func RegisterLocale(lang string, months [12][]string, days [7][]string) {
+	names.Lock()
+	defer names.Unlock()
+	for i, ns := range months {
+		for _, n := range ns {
+			names.months[strings.ToLower(n)] = i + 1
+		}
+	}
+	for i, ns := range days {
+		for _, n := range ns {
+			names.days[strings.ToLower(n)] = i
+		}
+	}
+}
+
+func lookupMonth(str string) (int, bool) {
+	names.RLock()
+	defer names.RUnlock()
+	x, ok := names.months[strings.ToLower(str)]
+	return x, ok
+}
+
+func lookupDay(str string) (int, bool) {
+	names.RLock()
+	defer names.RUnlock()
+	x, ok := names.days[strings.ToLower(str)]
+	return x, ok
+}
+
+var enMonths = [12][]string{
+	{"jan", "january"},
+	{"feb", "february"},
+	{"mar", "march"},
+	{"apr", "april"},
+	{"may"},
+	{"jun", "june"},
+	{"jul", "july"},
+	{"aug", "august"},
+	{"sep", "sept", "september"},
+	{"oct", "october"},
+	{"nov", "november"},
+	{"dec", "december"},
+}
+
+var enDays = [7][]string{
+	{"sun", "sunday"},
+	{"mon", "monday"},
+	{"tue", "tuesday"},
+	{"wed", "wednesday"},
+	{"thu", "thursday"},
+	{"fri", "friday"},
+	{"sat", "saturday"},
+}
+
+var frMonths = [12][]string{
+	{"janv", "janv.", "janvier"},
+	{"févr", "févr.", "fevr", "février", "fevrier"},
+	{"mars"},
+	{"avr", "avr.", "avril"},
+	{"mai"},
+	{"juin"},
+	{"juil", "juil.", "juillet"},
+	{"août", "aout"},
+	{"sept", "sept.", "septembre"},
+	{"oct.", "octobre"},
+	{"nov.", "novembre"},
+	{"déc", "déc.", "dec.", "décembre", "decembre"},
+}
+
+var frDays = [7][]string{
+	{"dim", "dim.", "dimanche"},
+	{"lun", "lun.", "lundi"},
+	{"mar.", "mardi"},
+	{"mer", "mer.", "mercredi"},
+	{"jeu", "jeu.", "jeudi"},
+	{"ven", "ven.", "vendredi"},
+	{"sam", "sam.", "samedi"},
+}
+
+var deMonths = [12][]string{
+	{"jän", "januar"},
+	{"februar"},
+	{"mär", "mrz", "märz", "maerz"},
+	{},
+	{"mai"},
+	{"juni"},
+	{"juli"},
+	{},
+	{},
+	{"okt", "oktober"},
+	{},
+	{"dez", "dezember"},
+}
+
+var deDays = [7][]string{
+	{"so", "son", "sonntag"},
+	{"mo", "mon", "montag"},
+	{"di", "die", "dienstag"},
+	{"mi", "mit", "mittwoch"},
+	{"do", "don", "donnerstag"},
+	{"fr", "fre", "freitag"},
+	{"sa", "sam", "samstag"},
+}
+
+var esMonths = [12][]string{
+	{"ene", "enero"},
+	{"febrero"},
+	{"marzo"},
+	{"abr", "abril"},
+	{"mayo"},
+	{"junio"},
+	{"julio"},
+	{"ago", "agosto"},
+	{"septiembre", "setiembre"},
+	{"octubre"},
+	{"noviembre"},
+	{"dic", "diciembre"},
+}
+
+var esDays = [7][]string{
+	{"dom", "domingo"},
+	{"lun", "lunes"},
+	{"mar", "martes"},
+	{"mié", "mie", "miércoles", "miercoles"},
+	{"jue", "jueves"},
+	{"vie", "viernes"},
+	{"sáb", "sab", "sábado", "sabado"},
+}
@@ -3,17 +3,23 @@ package log
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // line specifiers (writing)
-// %t: time
+// %t: time (time format, eg, %y-%m-%d, or time preset, eg, rfc3339), in the
+//     given time zone after a @, eg, %t(%y-%m-%d %H:%M:%S@Europe/Paris)
 // %n: process
 // %p: pid
 // %u: user
@@ -22,12 +28,23 @@ import (
 // %l: level
 // %m: message
 // %#: line
+// %f: file the entry was read from
 // %[digit]: word
+// %w(name): named word
+// %k: all named words as key=value pairs (%k(sep) to change the separator,
+//     a blank by default), also given by %w without name
+// %{expr}: value of an expression (see expr.go), eg, %{named.bytes/1024} or
+//     %{upper(level)}
+// other letters: specifiers added with RegisterSpecifier
 // %%: a percent sign
 // c : any character(s)
+// flags and modifiers
+// %-20m: align on the left, %20m: align on the right, %.20m: truncate
+// %m:upper, %m:lower, %m:trim, %h:short (strip domain), %t:relative (eg, 3m ago)
+// %t:raw (timestamp as read when it has no year, eg, Mar  1 10:00:00)
 
 // line specifiers (read)
-// %t: time (time format, eg, %y-%m-%d)
+// %t: time (time format, eg, %y-%m-%d, or time preset, eg, rfc3339)
 // %n: process
 // %p: pid
 // %u: user
@@ -35,10 +52,31 @@ import (
 // %h: host (host format, eg, ip:port, fqdn)
 // %l: level (list of accepted level)
 // %m: message
-// %w: word
+// %w: word (%w(name) to store it as a named word)
+//     %w(name:type) also stores its typed value (int, float, bool, duration,
+//     time or time:layout, eg, %w(status:int), %w(day:time:yyyy-mm-dd))
+// %k: key=value pairs stored as named words
+// %K: key=value pairs with time, level and msg keys mapped to the entry
+// %J: json object with time, level and msg keys mapped to the entry
+// %R: http request line (optionally quoted) stored as method, path, query
+//     and protocol named words
+// %P: syslog priority (<PRI>) stored as facility and severity named words,
+//     the severity giving the level (eg, <11> is user and err, level ERROR)
+// %q: quoted string, with \" and \\ escapes, stored without its quotes as a
+//     word (%q(name) or %q(name:type) to store it as a named word)
+// %[]: text between brackets (or parentheses, braces, angle brackets) stored
+//     without them as a word (%[name] or %[name:type] for a named word)
 // %b: blank
-// %*: discard one or multiple characters
+// %*: discard characters until the next character of the pattern
+//     %*(n) discards n characters, %*(until=str) discards until str
+// %$: end of line, the line does not match if some text remains
+// other letters: specifiers added with RegisterSpecifier
 // %%: a percent sign
+// @(a|b): alternatives (:name: at the start of a branch to name it)
+// ^ : start of line at the start of the pattern (patterns are always anchored
+//     at the start of the line)
+// $ : end of line at the end of the pattern or of an alternative, like %$ (\$
+//     for a dollar sign)
 // c : any character(s)
 
 // host specifiers
@@ -51,27 +89,35 @@ import (
 // %F: ipv4:port
 // %S: ipv6:port
 // %Q: fqdn:port
+// a specifier followed by >name also stores its value as a named word (eg,
+// %h(%4>client_ip:%p>client_port)), ports and masks with their int value
 
 // time specifiers
 // %y: year (4 digits)
 // %m: month (2 digits)
-// %b: month name (abbr)
-// %a: day name (abbr)
+// %b: month name (full or abbr, en/fr/de/es)
+// %a: day name (full or abbr, en/fr/de/es)
 // %d: day (2 digits)
 // %j: day of year (3 digits)
 // %H: hour of day (2 digits)
 // %M: minute of hour (2 digits)
 // %S: second of minute (2 digits)
-// %f: fraction of second (up to 9 digits)
+// %f: fraction of second (any number of digits, nanosecond precision)
+// %F: optional fraction of second with its leading dot
+// %L: milliseconds (3 digits)
+// %E: microseconds (6 digits)
+// %N: nanoseconds (9 digits)
 // %s: unix timestamp
 // %z: zone
-// %I: %y-%m-%d %H:%M:%S%Z
-// %R: %y-%m-%dT%H:%M:%S%Z
-
-func init() {
-	sort.Strings(days)
-	sort.Strings(months)
-}
+// %G: iso week-based year (4 digits)
+// %V: iso week of year (2 digits)
+// %u: iso day of week (1 digit, monday is 1)
+// %q: quarter of year (1 digit)
+// %h: hour of day on a 12-hour clock (2 digits)
+// %p: AM/PM marker
+// %o: day with its ordinal suffix (1st, 2nd,...)
+// %I: %y-%m-%d %H:%M:%S%F%Z
+// %R: %y-%m-%dT%H:%M:%S%F%Z
 
 var (
 	ErrPattern = errors.New("invalid pattern")
@@ -89,33 +135,325 @@ type Entry struct {
 	Message string    `json:"message"`
 	Words   []string  `json:"words"`
 	Host    string    `json:"host"`
+	Addr    Addr      `json:"addr"`
 	When    time.Time `json:"when"`
+	// Stamp is the text of the timestamp when it has no year (eg, in syslog
+	// lines). It can be printed with %t:raw.
+	Stamp string `json:"-"`
+
+	Named map[string]string `json:"named,omitempty"`
+	// Values holds the typed values of the captures declared with a type in
+	// the pattern (eg, %w(status:int)). Named still has their text.
+	Values map[string]interface{} `json:"-"`
+
+	Source Source `json:"source"`
+
+	Pattern string `json:"pattern,omitempty"`
+	// Seq is the number of the entry in the output of Merge and Concat,
+	// starting at 1.
+	Seq int `json:"seq,omitempty"`
+}
+
+// Source tells where an entry comes from: the file (or name given with
+// WithSource), the offset of its line in it and the number of this line in the
+// input of the Reader, and the remote address for entries received from the
+// network.
+type Source struct {
+	File   string `json:"file,omitempty"`
+	Offset int64  `json:"offset"`
+	Line   int    `json:"line,omitempty"`
+	Origin string `json:"origin,omitempty"`
+}
+
+func (e *Entry) setNamed(name, value string) {
+	if e.Named == nil {
+		e.Named = make(map[string]string)
+	}
+	e.Named[name] = value
+}
+
+func (e *Entry) setValue(name string, value interface{}) {
+	if e.Values == nil {
+		e.Values = make(map[string]interface{})
+	}
+	e.Values[name] = value
+}
+
+// MarshalJSON encodes the typed values of Values instead of their text in the
+// named object. Durations are given in seconds.
+func (e Entry) MarshalJSON() ([]byte, error) {
+	type entry Entry
+	if len(e.Words) == 0 {
+		e.Words = nil
+	}
+	if len(e.Values) == 0 {
+		return json.Marshal(entry(e))
+	}
+	named := make(map[string]interface{}, len(e.Named))
+	for k, v := range e.Named {
+		named[k] = v
+	}
+	for k, v := range e.Values {
+		if d, ok := v.(time.Duration); ok {
+			v = d.Seconds()
+		}
+		named[k] = v
+	}
+	return json.Marshal(struct {
+		entry
+		Named map[string]interface{} `json:"named,omitempty"`
+	}{
+		entry: entry(e),
+		Named: named,
+	})
 }
 
 type Reader struct {
-	inner *bufio.Scanner
-	err   error
+	source io.Reader
+	inner  *bufio.Scanner
+	line   scanner
+	err    error
+	lino   int
 
-	keep  filterfunc
-	parse parsefunc
+	keep    filterfunc
+	parse   parsefunc
+	pattern string
+	next    func(*Entry) error
+	skip    func(int, string, error)
+
+	cfg      config
+	schema   *Schema
+	embedded bool
+	derived  []derived
+
+	stats    Stats
+	progress func(Stats)
+	origin   Source
+	locate   func(int64) (string, int64)
+	records  *recordSplit
+	limit    *lineSplit
+	filter   *Filter
+
+	// the readers given to Merge or Concat, stopped when done is closed
+	inputs []*Reader
+	done   chan struct{}
+}
+
+// Stats reports what a Reader has consumed so far. Filtered counts the
+// entries rejected by the filter or dropped by the schema and Failed the lines
+// not matching the pattern.
+type Stats struct {
+	Lines    int
+	Matched  int
+	Filtered int
+	Failed   int
+	Bytes    int64
+	// lines longer than the maximum given to WithMaxLine
+	Long int
+}
+
+const progressEvery = 1024
+
+type config struct {
+	location *time.Location
+	year     int
+	fields   map[string]bool
+	strict   bool
+	// single is set when the lines are parsed one by one, the year of the
+	// times without one not depending on the previous lines
+	single bool
+}
+
+const YearAuto = -1
+
+type Option func(*Reader)
+
+func WithLocation(loc *time.Location) Option {
+	return func(r *Reader) {
+		r.cfg.location = loc
+	}
 }
 
-func NewReader(rs io.Reader, pattern, filter string) (*Reader, error) {
+func WithSchema(s Schema) Option {
+	return func(r *Reader) {
+		r.schema = &s
+	}
+}
+
+// WithFilter makes the Reader only give the entries matching f, in addition to
+// the filter given to NewReader. f can be shared by several Readers.
+func WithFilter(f *Filter) Option {
+	return func(r *Reader) {
+		r.filter = f
+	}
+}
+
+func WithYear(year int) Option {
+	return func(r *Reader) {
+		r.cfg.year = year
+	}
+}
+
+// WithStrict makes the lines having text left once all the specifiers of the
+// pattern are read not match, as if the pattern ended with %$.
+func WithStrict() Option {
+	return func(r *Reader) {
+		r.cfg.strict = true
+	}
+}
+
+// WithRecords makes the entries span all the lines up to the next blank line
+// instead of a single line, like the entries of the MySQL slow query log. The
+// whole record is given to the pattern where \n matches the end of its lines.
+// Source.Line is the number of its first line.
+func WithRecords() Option {
+	return func(r *Reader) {
+		r.records = new(recordSplit)
+	}
+}
+
+// WithRecordStart makes the entries span several lines like WithRecords but
+// an entry starts at each line beginning with one of the prefixes. A line
+// starting with a prefix does not start a new entry when all the lines of the
+// current one start with a prefix, like the # Time: and # User@Host: headers
+// of the MySQL slow query log.
+func WithRecordStart(prefixes ...string) Option {
+	return func(r *Reader) {
+		r.records = &recordSplit{starts: prefixes}
+	}
+}
+
+// WithMaxLine makes the Reader accept the lines longer than size bytes
+// (64KB by default, the longer lines stop the Reader with an error) by
+// truncating or cutting them in chunks according to mode. It has no effect
+// on the records of WithRecords.
+func WithMaxLine(size int, mode Overflow) Option {
+	return func(r *Reader) {
+		if size > 0 {
+			r.limit = &lineSplit{max: size, mode: mode}
+		}
+	}
+}
+
+// WithEmbeddedJSON makes the Reader look for a JSON object at the end of the
+// message of the entries (eg, payload={"id": 1} or {"id": 1}). Its keys are
+// flattened into Named and the object is removed from the message.
+func WithEmbeddedJSON() Option {
+	return func(r *Reader) {
+		r.embedded = true
+	}
+}
+
+// OnProgress registers a function called with the current stats of the
+// Reader every 1024 lines and once the end of the input is reached.
+func OnProgress(fn func(Stats)) Option {
+	return func(r *Reader) {
+		r.progress = fn
+	}
+}
+
+// WithSource sets the file name and origin reported in the Source of the
+// entries. By default, they are taken from the Name and RemoteAddr methods of
+// the input if it has them.
+func WithSource(file, origin string) Option {
+	return func(r *Reader) {
+		r.origin.File = file
+		r.origin.Origin = origin
+	}
+}
+
+func OnSkip(fn func(lino int, line string)) Option {
+	return OnSkipError(func(lino int, line string, _ error) {
+		fn(lino, line)
+	})
+}
+
+// OnSkipError is like OnSkip but also gives the reason why the line did not
+// match the pattern.
+func OnSkipError(fn func(lino int, line string, err error)) Option {
+	return func(r *Reader) {
+		r.skip = fn
+	}
+}
+
+func NewReader(rs io.Reader, pattern, filter string, opts ...Option) (*Reader, error) {
+	r, err := newReader(rs, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	r.next = r.nextLine
+	if p, ok := findPreset(KindInput, pattern); ok && len(p.Start) > 0 && r.records == nil {
+		r.records = &recordSplit{starts: p.Start}
+	}
+	r.scan(rs, 0)
+	r.pattern = lookupPreset(KindInput, pattern)
+	if r.parse, err = parsePattern(r.pattern, r.cfg); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// scan makes the Reader read its lines or its records from rs, starting at
+// offset.
+func (r *Reader) scan(rs io.Reader, offset int64) {
+	r.inner = bufio.NewScanner(rs)
+	switch {
+	case r.records != nil:
+		r.records.pos, r.records.lines = offset, 0
+		r.inner.Buffer(nil, maxRecord)
+		r.inner.Split(r.records.split)
+	case r.limit != nil:
+		r.limit.reset(offset)
+		r.inner.Buffer(nil, r.limit.max+1)
+		r.inner.Split(r.limit.split)
+	}
+}
+
+// newReader creates a Reader without the way to get its entries from rs.
+func newReader(rs io.Reader, filter string, opts []Option) (*Reader, error) {
 	var (
 		r   Reader
 		err error
 	)
-	r.inner = bufio.NewScanner(rs)
-
-	if r.parse, err = parsePattern(pattern); err != nil {
-		return nil, err
+	r.source = rs
+	if n, ok := rs.(interface{ Name() string }); ok {
+		r.origin.File = n.Name()
+	}
+	if n, ok := rs.(interface{ RemoteAddr() net.Addr }); ok {
+		r.origin.Origin = n.RemoteAddr().String()
+	}
+	if s, ok := rs.(interface{ SourceAt(int64) (string, int64) }); ok {
+		r.locate = s.SourceAt
+	}
+	for _, o := range opts {
+		o(&r)
 	}
 	if r.keep, err = parseFilter(filter); err != nil {
 		return nil, err
 	}
+	if shared := r.filter; shared != nil {
+		keep := r.keep
+		r.keep = func(e Entry) bool {
+			return shared.Match(e) && keep(e)
+		}
+	}
+	if r.schema != nil {
+		if err := r.schema.Check(); err != nil {
+			return nil, err
+		}
+	}
+	if r.cfg.fields != nil {
+		r.useFields(filter)
+	}
 	return &r, nil
 }
 
+func (r *Reader) Stats() Stats {
+	s := r.stats
+	s.Lines = r.lino
+	return s
+}
+
 func (r *Reader) ReadAll() ([]Entry, error) {
 	var (
 		es  []Entry
@@ -133,68 +471,302 @@ func (r *Reader) ReadAll() ([]Entry, error) {
 }
 
 func (r *Reader) Read() (Entry, error) {
-	var e Entry
+	e := Entry{
+		Named:  getNamed(),
+		Values: getValues(),
+		Words:  getWords(),
+	}
+	err := r.ReadInto(&e)
+	return e, err
+}
+
+// Release gives back the Named and Values maps and the Words slice of an entry
+// returned by Read to be reused by the next entries. The entry and its copies
+// should not be used anymore after it is released.
+func (r *Reader) Release(e Entry) {
+	putEntry(e)
+}
+
+// ReadInto reads the next entry into e. The Named map and the Words slice of e
+// are reused: they should be copied if they have to outlive the next call.
+func (r *Reader) ReadInto(e *Entry) error {
 	if r.err != nil {
-		return e, r.err
+		return r.err
 	}
+	for {
+		if err := r.next(e); err != nil {
+			r.err = err
+			if r.progress != nil && errors.Is(err, io.EOF) {
+				r.progress(r.Stats())
+			}
+			return r.err
+		}
+		if r.embedded {
+			parseEmbedded(e)
+		}
+		r.derive(e)
+		if r.schema != nil {
+			if err := r.schema.Validate(*e); err != nil {
+				switch r.schema.Action {
+				case SchemaDrop:
+					r.stats.Filtered++
+					continue
+				case SchemaAnnotate:
+					e.setNamed(SchemaField, err.Error())
+				default:
+					r.err = fmt.Errorf("line %d: %w", r.lino, err)
+					return r.err
+				}
+			}
+		}
+		if r.keep == nil || r.keep(*e) {
+			r.stats.Matched++
+			break
+		}
+		r.stats.Filtered++
+	}
+	return r.err
+}
+
+// nextLine parses the next line matching the pattern into e.
+func (r *Reader) nextLine(e *Entry) error {
 	for {
 		if !r.inner.Scan() {
-			r.err = r.inner.Err()
-			if r.err == nil {
-				r.err = io.EOF
+			if err := r.inner.Err(); err != nil {
+				return err
 			}
-			return e, r.err
+			return io.EOF
 		}
 		line := r.inner.Bytes()
+		offset := r.stats.Bytes
+		if s := r.records; s != nil {
+			offset, r.lino, r.stats.Bytes = s.start, s.line, s.pos
+		} else if s := r.limit; s != nil {
+			offset, r.lino, r.stats.Bytes, r.stats.Long = s.start, s.line, s.pos, s.long
+		} else {
+			r.lino++
+			r.stats.Bytes += int64(len(line)) + 1
+		}
+		if r.progress != nil && r.lino%progressEvery == 0 {
+			r.progress(r.Stats())
+		}
 		if len(line) == 0 {
 			continue
 		}
-		err := r.parse(&e, bytes.NewReader(line))
+		r.reset(e, offset)
+		r.line.Reset(line)
+		err := r.parse(e, &r.line)
 		if err != nil {
 			if errors.Is(err, ErrPattern) {
+				r.stats.Failed++
+				if r.skip != nil {
+					r.skip(r.lino, r.inner.Text(), err)
+				}
 				continue
 			}
-			r.err = err
-			return e, r.err
-		}
-		if r.keep == nil || r.keep(e) {
-			e.Line = r.inner.Text()
-			break
+			return err
 		}
+		e.Line = r.inner.Text()
+		return nil
+	}
+}
+
+// reset clears e, keeping its Named and Values maps and its Words slice, and
+// sets its Source.
+func (r *Reader) reset(e *Entry, offset int64) {
+	named, values, words := e.Named, e.Values, e.Words[:0]
+	for k := range named {
+		delete(named, k)
+	}
+	for k := range values {
+		delete(values, k)
+	}
+	*e = Entry{
+		Source: r.origin,
+		Named:  named,
+		Values: values,
+		Words:  words,
+	}
+	e.Source.Offset = offset
+	e.Source.Line = r.lino
+	if r.locate != nil {
+		e.Source.File, e.Source.Offset = r.locate(offset)
+	}
+}
+
+type Writer interface {
+	Write(Entry) error
+}
+
+// WriteCloser is a Writer that has to be closed once all the entries are
+// written to write what it keeps and release its resources. Close gives the
+// errors that could not be reported by Write.
+type WriteCloser interface {
+	Writer
+	io.Closer
+}
+
+// CloseWriter closes w if it is a WriteCloser or flushes it if it only has a
+// Flush method.
+func CloseWriter(w Writer) error {
+	switch w := w.(type) {
+	case io.Closer:
+		return w.Close()
+	case interface{ Flush() error }:
+		return w.Flush()
+	default:
+		return nil
+	}
+}
+
+type WriterOption func(*textWriter)
+
+// WithEscape sets how the control characters (newlines, tabs,...) and the ANSI
+// escape sequences found in the fields are written. By default, they are
+// written as is.
+func WithEscape(mode Escape) WriterOption {
+	return func(w *textWriter) {
+		w.escape = mode
+	}
+}
+
+// WithBuffer keeps up to size bytes of output before writing them to the
+// underlying writer instead of writing each entry on its own. When every is
+// positive, the kept output is also written at most every after the first
+// entry kept. Flush and Close write what is kept.
+func WithBuffer(size int, every time.Duration) WriterOption {
+	return func(w *textWriter) {
+		w.size = size
+		w.every = every
 	}
-	return e, r.err
 }
 
-type Writer struct {
-	inner  io.Writer
-	buffer bytes.Buffer
-	print  printfunc
+// WithWrap wraps the lines longer than width columns. The continuation lines
+// of the message are indented to the column where the message starts, under
+// the fields written before it, and the lines of a multiline message (eg, a
+// stack trace) are written the same way. It is meant for terminals and is
+// ignored when width is not positive.
+func WithWrap(width int) WriterOption {
+	return func(w *textWriter) {
+		w.width = width
+	}
 }
 
-func NewWriter(ws io.Writer, pattern string) (*Writer, error) {
-	print, err := parsePrint(pattern)
+// WithOutputLocation writes the times in the time zone of loc instead of the
+// one they were read with. The zone given to %t takes precedence.
+func WithOutputLocation(loc *time.Location) WriterOption {
+	return func(w *textWriter) {
+		w.location = loc
+	}
+}
+
+type textWriter struct {
+	inner    io.Writer
+	buffer   bytes.Buffer
+	print    printfunc
+	escape   Escape
+	location *time.Location
+
+	width int
+	line  bytes.Buffer
+
+	size  int
+	every time.Duration
+
+	mu    sync.Mutex
+	out   *bufio.Writer
+	timer *time.Timer
+	err   error
+}
+
+func NewWriter(ws io.Writer, pattern string, opts ...WriterOption) (Writer, error) {
+	print, err := parsePrint(lookupPreset(KindOutput, pattern))
 	if err != nil {
 		return nil, err
 	}
-	w := Writer{
+	w := textWriter{
 		inner: ws,
 		print: print,
 	}
+	for _, o := range opts {
+		o(&w)
+	}
+	if w.size > 0 {
+		w.out = bufio.NewWriterSize(ws, w.size)
+	}
 	return &w, nil
 }
 
-func (w *Writer) Write(e Entry) error {
-	w.print(e, &w.buffer)
+func (w *textWriter) Write(e Entry) error {
+	if w.out != nil {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if w.err != nil {
+			return w.err
+		}
+	}
+	if w.location != nil && !e.When.IsZero() {
+		e.When = e.When.In(w.location)
+	}
+	if w.width > 0 {
+		w.wrap(e)
+	} else {
+		w.printEntry(e, &w.buffer)
+	}
 	w.buffer.WriteRune('\n')
-	_, err := io.Copy(w.inner, &w.buffer)
-	return err
+	if w.out == nil {
+		_, err := io.Copy(w.inner, &w.buffer)
+		return err
+	}
+	if _, w.err = io.Copy(w.out, &w.buffer); w.err == nil && w.every > 0 && w.timer == nil {
+		w.timer = time.AfterFunc(w.every, func() {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			w.timer = nil
+			if w.err == nil {
+				w.err = w.out.Flush()
+			}
+		})
+	}
+	return w.err
+}
+
+// Flush writes the output kept with WithBuffer.
+func (w *textWriter) Flush() error {
+	if w.out == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	if w.err == nil {
+		w.err = w.out.Flush()
+	}
+	return w.err
+}
+
+// Close flushes the Writer. The underlying writer is not closed.
+func (w *textWriter) Close() error {
+	return w.Flush()
+}
+
+func (w *textWriter) printEntry(e Entry, buf *bytes.Buffer) {
+	if w.escape == EscapeNone {
+		w.print(e, buf)
+	} else {
+		w.print(e, escapeWriter{inner: buf, mode: w.escape})
+	}
 }
 
 type (
 	printfunc  func(Entry, io.StringWriter)
-	parsefunc  func(*Entry, *bytes.Reader) error
-	whenfunc   func(*when, *bytes.Reader) error
-	hostfunc   func(*host, *bytes.Reader) error
+	parsefunc  func(*Entry, *scanner) error
+	whenfunc   func(*when, *scanner) error
+	timefunc   func(time.Time, *bytes.Buffer)
+	hostfunc   func(*Addr, *scanner) error
 	filterfunc func(Entry) bool
 )
 
@@ -204,7 +776,7 @@ const (
 
 func parsePrint(pattern string) (printfunc, error) {
 	if pattern == "" {
-		return nil, fmt.Errorf("%w: empty pattern not allowed", ErrSyntax)
+		return nil, syntaxError("", "empty pattern not allowed")
 	}
 	var (
 		str = bytes.NewReader([]byte(pattern))
@@ -223,41 +795,247 @@ func parsePrint(pattern string) (printfunc, error) {
 				pfs = append(pfs, printLiteral(buf.String()))
 				buf.Reset()
 			}
-			switch r {
-			case 't':
-				pfs = append(pfs, printTime)
-			case 'n':
-				pfs = append(pfs, printProcess)
-			case 'p':
-				pfs = append(pfs, printPID)
-			case 'u':
-				pfs = append(pfs, printUser)
-			case 'g':
-				pfs = append(pfs, printGroup)
-			case 'h':
-				pfs = append(pfs, printHost)
-			case 'l':
-				pfs = append(pfs, printLevel)
-			case 'm':
-				pfs = append(pfs, printMessage)
-			case '#':
-				pfs = append(pfs, printLine)
-			default:
-				if !isDigit(r) {
-					return nil, fmt.Errorf("%w(print): unknown specifier %c", ErrPattern, r)
-				}
-				str.UnreadRune()
-				var j int
-				if err := parseInt(&j, 0, str, isDigit); err != nil {
-					return nil, err
-				}
-				pfs = append(pfs, printWord(j))
+			str.UnreadRune()
+			fn, err := parsePrintSpecifier(str)
+			if err != nil {
+				return nil, err
 			}
+			pfs = append(pfs, fn)
 		} else {
 			buf.WriteRune(r)
 		}
 	}
-	return mergePrint(pfs), nil
+	if buf.Len() > 0 {
+		pfs = append(pfs, printLiteral(buf.String()))
+	}
+	return mergePrint(pfs), nil
+}
+
+// parsePrintSpecifier parses a specifier with its optional flags: - to align
+// on the left, a width and a precision (.n) to truncate the value. Digits
+// not followed by a specifier select a word (%[digit]).
+func parsePrintSpecifier(str *bytes.Reader) (printfunc, error) {
+	var (
+		left  bool
+		prec  = -1
+		width int
+	)
+	if peek(str) == '-' {
+		str.ReadRune()
+		left = true
+	}
+	digits, _ := parseString(str, 0, isDigit)
+	if digits != "" {
+		width, _ = strconv.Atoi(digits)
+	}
+	if peek(str) == '.' {
+		str.ReadRune()
+		p, _ := parseString(str, 0, isDigit)
+		if p == "" {
+			return nil, syntaxError("print", "missing precision")
+		}
+		prec, _ = strconv.Atoi(p)
+	}
+	r, _, _ := str.ReadRune()
+	if digits != "" && !left && prec < 0 && !isPrintSpecifier(r) {
+		if r != 0 {
+			str.UnreadRune()
+		}
+		return printWord(width), nil
+	}
+	fn, err := printSpecifier(str, r)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		name := parseModifier(str)
+		if name == "" {
+			break
+		}
+		if name == "relative" || name == "raw" {
+			if r != 't' {
+				return nil, syntaxError("print", "%s can only be used with %%t", name)
+			}
+			if name == "raw" {
+				fn = printStamp(fn)
+			} else {
+				fn = printRelative
+			}
+			continue
+		}
+		fn = printModified(fn, printModifiers[name])
+	}
+	if width == 0 && prec < 0 {
+		return fn, nil
+	}
+	return printAligned(fn, width, prec, left), nil
+}
+
+var printModifiers = map[string]func(string) string{
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"trim":     strings.TrimSpace,
+	"short":    shortHost,
+	"relative": nil,
+	"raw":      nil,
+}
+
+// parseModifier returns the name of the modifier following a specifier. A
+// colon not followed by a known modifier is left in the pattern as a literal.
+func parseModifier(str *bytes.Reader) string {
+	if peek(str) != ':' {
+		return ""
+	}
+	offset, _ := str.Seek(0, io.SeekCurrent)
+	str.ReadRune()
+	name, _ := parseString(str, 0, isLetter)
+	if _, ok := printModifiers[name]; !ok || isLetter(peek(str)) {
+		str.Seek(offset, io.SeekStart)
+		return ""
+	}
+	return name
+}
+
+func printModified(fn printfunc, modify func(string) string) printfunc {
+	return func(e Entry, w io.StringWriter) {
+		var str strings.Builder
+		fn(e, &str)
+		w.WriteString(modify(str.String()))
+	}
+}
+
+// printStamp prints the timestamp of an entry as it was in its line when it had
+// no year.
+func printStamp(fn printfunc) printfunc {
+	return func(e Entry, w io.StringWriter) {
+		if e.Stamp != "" {
+			w.WriteString(e.Stamp)
+			return
+		}
+		fn(e, w)
+	}
+}
+
+func printRelative(e Entry, w io.StringWriter) {
+	if e.When.IsZero() {
+		printString("", w)
+		return
+	}
+	var (
+		diff   = time.Since(e.When)
+		suffix = "ago"
+	)
+	if diff < 0 {
+		diff, suffix = -diff, "from now"
+	}
+	var str string
+	switch {
+	case diff < time.Minute:
+		str = fmt.Sprintf("%ds", int(diff/time.Second))
+	case diff < time.Hour:
+		str = fmt.Sprintf("%dm", int(diff/time.Minute))
+	case diff < 24*time.Hour:
+		str = fmt.Sprintf("%dh", int(diff/time.Hour))
+	default:
+		str = fmt.Sprintf("%dd", int(diff/(24*time.Hour)))
+	}
+	w.WriteString(str + " " + suffix)
+}
+
+// shortHost strips the domain of a host name. Addresses are left untouched.
+func shortHost(str string) string {
+	host, port, err := net.SplitHostPort(str)
+	if err != nil {
+		host, port = str, ""
+	}
+	if net.ParseIP(host) != nil {
+		return str
+	}
+	if i := strings.IndexByte(host, '.'); i > 0 {
+		host = host[:i]
+	}
+	if port != "" {
+		return net.JoinHostPort(host, port)
+	}
+	return host
+}
+
+const printSpecifiers = "tnpughlm#fwk{"
+
+func printSpecifier(str *bytes.Reader, r rune) (printfunc, error) {
+	switch r {
+	case 't':
+		arg, err := parseArgument(str, rfcPattern, "time")
+		if err != nil {
+			return nil, err
+		}
+		return printTime(arg)
+	case 'n':
+		return printProcess, nil
+	case 'p':
+		return printPID, nil
+	case 'u':
+		return printUser, nil
+	case 'g':
+		return printGroup, nil
+	case 'h':
+		return printHost, nil
+	case 'l':
+		return printLevel, nil
+	case 'm':
+		return printMessage, nil
+	case '#':
+		return printLine, nil
+	case 'f':
+		return printFile, nil
+	case 'w':
+		if peek(str) != '(' {
+			return printPairs(" "), nil
+		}
+		arg, err := parseArgument(str, "", "word")
+		if err != nil {
+			return nil, err
+		}
+		if arg == "" {
+			return printPairs(" "), nil
+		}
+		return printNamed(arg), nil
+	case 'k':
+		arg, err := parseArgument(str, " ", "pairs")
+		if err != nil {
+			return nil, err
+		}
+		return printPairs(arg), nil
+	case '{':
+		return printExpr(str)
+	default:
+		if spec := lookupSpecifier(r); spec.print != nil {
+			return printCustom(spec.print), nil
+		}
+		return nil, syntaxError("print", "unknown specifier %c", r)
+	}
+}
+
+func printAligned(fn printfunc, width, prec int, left bool) printfunc {
+	return func(e Entry, w io.StringWriter) {
+		var str strings.Builder
+		fn(e, &str)
+		runes := []rune(str.String())
+		if prec >= 0 && len(runes) > prec {
+			runes = runes[:prec]
+		}
+		var pad string
+		if n := width - len(runes); n > 0 {
+			pad = strings.Repeat(" ", n)
+		}
+		if !left {
+			w.WriteString(pad)
+		}
+		w.WriteString(string(runes))
+		if left {
+			w.WriteString(pad)
+		}
+	}
 }
 
 func mergePrint(pfs []printfunc) printfunc {
@@ -270,6 +1048,9 @@ func mergePrint(pfs []printfunc) printfunc {
 
 func printLiteral(str string) printfunc {
 	return func(_ Entry, w io.StringWriter) {
+		if e, ok := w.(escapeWriter); ok {
+			w = e.inner
+		}
 		printString(str, w)
 	}
 }
@@ -284,12 +1065,73 @@ func printWord(i int) printfunc {
 	}
 }
 
-func printTime(e Entry, w io.StringWriter) {
-	var str string
-	if !e.When.IsZero() {
-		str = e.When.Format(time.RFC3339)
+func printFile(e Entry, w io.StringWriter) {
+	printString(e.Source.File, w)
+}
+
+// printPairs prints all the named words as key=value pairs sorted by key.
+// Values are quoted when needed like in logfmt.
+func printPairs(sep string) printfunc {
+	return func(e Entry, w io.StringWriter) {
+		keys := make([]string, 0, len(e.Named))
+		for k := range e.Named {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var str strings.Builder
+		for i, k := range keys {
+			if i > 0 {
+				str.WriteString(sep)
+			}
+			v := e.Named[k]
+			if v == "" || strings.ContainsAny(v, " \t=\"") {
+				v = strconv.Quote(v)
+			}
+			str.WriteString(k)
+			str.WriteString("=")
+			str.WriteString(v)
+		}
+		printString(str.String(), w)
 	}
-	printString(str, w)
+}
+
+func printNamed(name string) printfunc {
+	return func(e Entry, w io.StringWriter) {
+		printString(e.Named[name], w)
+	}
+}
+
+func printTime(pattern string) (printfunc, error) {
+	var loc *time.Location
+	if x := strings.LastIndexByte(pattern, '@'); x >= 0 {
+		zone := pattern[x+1:]
+		if zone == "" {
+			return nil, syntaxError("time", "time zone expected after @")
+		}
+		z, err := time.LoadLocation(zone)
+		if err != nil {
+			return nil, syntaxError("time", "%s: unknown time zone", zone)
+		}
+		pattern, loc = pattern[:x], z
+	}
+	format, err := formatTimePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	fn := func(e Entry, w io.StringWriter) {
+		var str string
+		if !e.When.IsZero() {
+			when := e.When
+			if loc != nil {
+				when = when.In(loc)
+			}
+			var buf bytes.Buffer
+			format(when, &buf)
+			str = buf.String()
+		}
+		printString(str, w)
+	}
+	return fn, nil
 }
 
 func printProcess(e Entry, w io.StringWriter) {
@@ -335,32 +1177,41 @@ func printString(str string, w io.StringWriter) {
 	w.WriteString(str)
 }
 
-func parseFilter(str string) (filterfunc, error) {
-	if str == "" {
-		return func(_ Entry) bool { return true }, nil
-	}
-	return nil, nil
-}
-
-func parsePattern(pattern string) (parsefunc, error) {
+func parsePattern(pattern string, cfg config) (parsefunc, error) {
 	if pattern == "" {
-		return nil, fmt.Errorf("%w: empty pattern not allowed", ErrSyntax)
+		return nil, syntaxError("", "empty pattern not allowed")
 	}
 	var (
 		until = func(r rune) bool { return r == 0 }
-		str   = bytes.NewReader([]byte(pattern))
+		str   = bytes.NewReader([]byte(strings.TrimPrefix(pattern, "^")))
 	)
-	_, fn, err := parsePatternUntil(str, until)
+	_, fn, err := parsePatternUntil(str, until, cfg)
+	if e, ok := err.(*SyntaxError); ok && e.Pos >= 0 && strings.HasPrefix(pattern, "^") {
+		e.Pos++
+	}
+	if err == nil && cfg.strict {
+		fn = mergeSpecifiers([]parsefunc{fn, parseEnd()}, []string{"", "$"})
+	}
 	return fn, err
 }
 
-func parsePatternUntil(str *bytes.Reader, until func(rune) bool) (rune, parsefunc, error) {
+func parsePatternUntil(str *bytes.Reader, until func(rune) bool, cfg config) (rune, parsefunc, error) {
 	var (
-		pfs  []parsefunc
-		buf  bytes.Buffer
-		last rune
+		pfs   []parsefunc
+		names []string
+		buf   bytes.Buffer
+		last  rune
 	)
+	// literal adds the text read since the last specifier
+	literal := func() {
+		if buf.Len() > 0 {
+			pfs = append(pfs, parseLiteral(buf.String()))
+			names = append(names, strconv.Quote(buf.String()))
+			buf.Reset()
+		}
+	}
 	for {
+		start := int(str.Size()) - str.Len()
 		last, _, _ = str.ReadRune()
 		if until(last) {
 			break
@@ -371,61 +1222,100 @@ func parsePatternUntil(str *bytes.Reader, until func(rune) bool) (rune, parsefun
 				buf.WriteRune(last)
 				continue
 			}
-			if buf.Len() > 0 {
-				pfs = append(pfs, parseLiteral(buf.String()))
-				buf.Reset()
-			}
-			fn, err := parseSpecifier(str, last)
+			literal()
+			fn, err := parseSpecifier(str, last, cfg)
 			if err != nil {
+				if e, ok := err.(*SyntaxError); ok && e.Pos < 0 {
+					e.Pos, e.Got = start, "%"+string(last)
+				}
 				return last, nil, err
 			}
 			pfs = append(pfs, fn)
+			names = append(names, "%"+string(last))
 		} else if last == '@' {
-			fn, err := parseAlternative(str)
+			literal()
+			fn, err := parseAlternative(str, cfg)
 			if err != nil {
 				return last, nil, err
 			}
 			pfs = append(pfs, fn)
+			names = append(names, "@(...)")
+		} else if last == '$' && until(peek(str)) {
+			literal()
+			pfs = append(pfs, parseEnd())
+			names = append(names, "$")
 		} else if last == '\\' {
 			last, _, _ = str.ReadRune()
+			if last == 'n' {
+				// newline inside the records of WithRecords
+				buf.WriteRune('\n')
+				continue
+			}
 			if !isEscape(last) {
-				return last, nil, fmt.Errorf("%w: invalid escaped character %c", last)
+				return last, nil, syntaxErrorAt("", start, "invalid escaped character %c", last)
 			}
 			buf.WriteRune(last)
 		} else {
 			buf.WriteRune(last)
 		}
 	}
-	if buf.Len() > 0 {
-		pfs = append(pfs, parseLiteral(buf.String()))
+	literal()
+	return last, mergeSpecifiers(pfs, names), nil
+}
+
+// mergeSpecifiers is like mergeParse but gives a MatchError with the name of
+// the specifier not matching the line.
+func mergeSpecifiers(pfs []parsefunc, names []string) parsefunc {
+	return func(e *Entry, r *scanner) error {
+		for i, pf := range pfs {
+			offset := r.pos
+			if err := pf(e, r); err != nil {
+				if errors.Is(err, ErrPattern) {
+					err = matchError(names[i], offset, err)
+				}
+				return err
+			}
+		}
+		return nil
 	}
-	return last, mergeParse(pfs), nil
 }
 
-func parseSpecifier(str *bytes.Reader, r rune) (parsefunc, error) {
+func parseSpecifier(str *bytes.Reader, r rune, cfg config) (parsefunc, error) {
 	switch r {
 	case 't':
 		arg, err := parseArgument(str, rfcPattern, "time")
 		if err != nil {
 			return nil, err
 		}
-		return parseTime(arg)
+		return parseTime(arg, cfg)
 	case 'b':
 		return parseBlank(), nil
 	case 'n':
+		if !cfg.needs("process") {
+			return parseSkip(isAlpha), nil
+		}
 		return parseProcess(), nil
 	case 'p':
+		if !cfg.needs("pid") {
+			return parseSkip(isDigit), nil
+		}
 		return parsePID(), nil
 	case 'u':
+		if !cfg.needs("user") {
+			return parseSkip(isAlpha), nil
+		}
 		return parseUser(), nil
 	case 'g':
+		if !cfg.needs("group") {
+			return parseSkip(isAlpha), nil
+		}
 		return parseGroup(), nil
 	case 'h':
 		arg, err := parseArgument(str, "%f", "host")
 		if err != nil {
 			return nil, err
 		}
-		return parseHost(arg)
+		return parseHost(arg, cfg)
 	case 'l':
 		arg, err := parseArgument(str, "-", "level")
 		if err != nil {
@@ -434,242 +1324,894 @@ func parseSpecifier(str *bytes.Reader, r rune) (parsefunc, error) {
 		if arg == "-" {
 			arg = ""
 		}
-		return parseLevel(arg)
-	case 'm':
-		return parseMessage(), nil
-	case 'w':
-		return parseWord(""), nil
-	case '*':
-		return parseDiscard(peek(str)), nil
-	default:
-		return nil, fmt.Errorf("%w: unsupported specifier %%%c", ErrSyntax, r)
+		if arg == "" && !cfg.needs("level") {
+			return parseSkip(isLetter), nil
+		}
+		return parseLevel(arg)
+	case 'm':
+		if !cfg.needs("message") {
+			return parseSkip(func(r rune) bool { return !isEOL(r) }), nil
+		}
+		return parseMessage(), nil
+	case 'w':
+		var (
+			name    string
+			convert convertfunc
+		)
+		if peek(str) == '(' {
+			arg, err := parseArgument(str, "", "word")
+			if err != nil {
+				return nil, err
+			}
+			if name, convert, err = parseCapture(arg, cfg); err != nil {
+				return nil, err
+			}
+			if name != "" && !cfg.needs("named."+name) {
+				return skipWord(peekLiteral(str)), nil
+			}
+		}
+		return parseWord(name, peekLiteral(str), convert), nil
+	case 'q', '[':
+		var (
+			arg string
+			err error
+		)
+		if r == '[' {
+			arg, err = parseBracketArgument(str)
+		} else if peek(str) == '(' {
+			arg, err = parseArgument(str, "", "quoted")
+		}
+		if err != nil {
+			return nil, err
+		}
+		name, convert, err := parseCapture(arg, cfg)
+		if err != nil {
+			return nil, err
+		}
+		scan := scanQuoted
+		if r == '[' {
+			scan = scanBracketed
+		}
+		return parseToken(name, convert, name == "" || cfg.needs("named."+name), scan), nil
+	case 'k':
+		return parsePairs(), nil
+	case 'K':
+		return parseAttrs(cfg)
+	case 'J':
+		return parseJSON(cfg)
+	case 'R':
+		return parseRequest(), nil
+	case 'P':
+		return parsePriority(), nil
+	case '$':
+		return parseEnd(), nil
+	case '*':
+		if peek(str) != '(' {
+			return parseDiscard(peekLiteral(str)), nil
+		}
+		arg, err := parseArgument(str, "", "discard")
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(arg, "until=") {
+			until := arg[len("until="):]
+			if until == "" {
+				return nil, syntaxError("discard", "empty terminator")
+			}
+			return parseDiscardUntil(until), nil
+		}
+		n, err := strconv.Atoi(arg)
+		if err != nil || n <= 0 {
+			return nil, syntaxError("discard", "invalid argument %s", arg)
+		}
+		return parseDiscardN(n), nil
+	default:
+		if spec := lookupSpecifier(r); spec.parse != nil {
+			return parseCustom(spec.parse), nil
+		}
+		return nil, syntaxError("", "unsupported specifier %%%c", r)
+	}
+}
+
+func mergeParse(pfs []parsefunc) parsefunc {
+	return func(e *Entry, r *scanner) error {
+		for _, pf := range pfs {
+			if err := pf(e, r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// parseBracketArgument reads the optional capture of %[name], up to the closing
+// bracket.
+func parseBracketArgument(str *bytes.Reader) (string, error) {
+	var buf strings.Builder
+	for {
+		r, _, err := str.ReadRune()
+		if err != nil {
+			return "", syntaxError("bracketed", "missing closing bracket")
+		}
+		if r == ']' {
+			return buf.String(), nil
+		}
+		buf.WriteRune(r)
+	}
+}
+
+func parseArgument(str *bytes.Reader, option, what string) (string, error) {
+	r, _, err := str.ReadRune()
+	if r != '(' {
+		if option != "" {
+			if err == nil {
+				str.UnreadRune()
+			}
+			return option, nil
+		}
+		return "", syntaxError(what, "missing (")
+	}
+	var buf bytes.Buffer
+	for str.Len() > 0 {
+		r, _, _ := str.ReadRune()
+		if r == ')' {
+			return buf.String(), nil
+		} else if r == '\\' {
+			r, _, _ = str.ReadRune()
+			if !isEscape(r) {
+				return "", syntaxError("", "invalid escaped character %c", r)
+			}
+		}
+		buf.WriteRune(r)
+		if buf.Len() > 64 {
+			return "", syntaxError(what, "argument too long (%s)", buf.String())
+		}
+	}
+	return "", syntaxError(what, "missing )")
+}
+
+func parseAlternative(str *bytes.Reader, cfg config) (parsefunc, error) {
+	r, _, _ := str.ReadRune()
+	if r != '(' {
+		return nil, syntaxError("", "missing (")
+	}
+	var (
+		bs    []branch
+		until = func(r rune) bool { return r == '|' || r == ')' }
+	)
+	for {
+		name := parseBranchName(str)
+		last, fn, err := parsePatternUntil(str, until, cfg)
+		if err != nil {
+			return nil, err
+		}
+		if last != '|' && last != ')' {
+			return nil, syntaxError("", "unexpected character %c", last)
+		}
+		if name == "" {
+			name = fmt.Sprintf("#%d", len(bs)+1)
+		}
+		bs = append(bs, branch{name: name, parse: fn})
+		if last == ')' {
+			break
+		}
+	}
+	return parseAlt(bs)
+}
+
+// branch is one of the alternatives of @(...). A branch can be named by
+// starting it with :name: - the name of the branch that matched is stored in
+// Entry.Pattern. Branches are tried in order.
+type branch struct {
+	name  string
+	parse parsefunc
+}
+
+func parseBranchName(str *bytes.Reader) string {
+	if peek(str) != ':' {
+		return ""
+	}
+	offset, _ := str.Seek(0, io.SeekCurrent)
+	str.ReadRune()
+	name, _ := parseString(str, 0, isAlpha)
+	if c, _, _ := str.ReadRune(); c != ':' || name == "" {
+		str.Seek(offset, io.SeekStart)
+		return ""
+	}
+	return name
+}
+
+func parseAlt(bs []branch) (parsefunc, error) {
+	if len(bs) == 0 {
+		return nil, syntaxError("", "empty alternatives")
+	}
+	fn := func(e *Entry, r *scanner) error {
+		seek, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		saved := *e
+		saved.Words = append([]string(nil), e.Words...)
+		saved.Named = copyNamed(e.Named)
+		saved.Values = copyValues(e.Values)
+		var (
+			furthest int64 = -1
+			failed   string
+		)
+		for _, b := range bs {
+			if err = b.parse(e, r); err == nil {
+				if e.Pattern == saved.Pattern && !strings.HasPrefix(b.name, "#") {
+					e.Pattern = b.name
+				}
+				return nil
+			}
+			if pos, _ := r.Seek(0, io.SeekCurrent); pos > furthest {
+				furthest, failed = pos, fmt.Sprintf("branch %s failed at offset %d", b.name, pos)
+				if err != ErrPattern {
+					failed += " (" + strings.TrimPrefix(err.Error(), ErrPattern.Error()+": ") + ")"
+				}
+			}
+			*e = saved
+			saved.Named = copyNamed(saved.Named)
+			saved.Values = copyValues(saved.Values)
+			if _, err := r.Seek(seek, io.SeekStart); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, ErrPattern) {
+			return fmt.Errorf("%w: %s", ErrPattern, failed)
+		}
+		return err
+	}
+	return fn, nil
+}
+
+func copyNamed(named map[string]string) map[string]string {
+	if named == nil {
+		return nil
+	}
+	other := make(map[string]string, len(named))
+	for k, v := range named {
+		other[k] = v
+	}
+	return other
+}
+
+func copyValues(values map[string]interface{}) map[string]interface{} {
+	if values == nil {
+		return nil
+	}
+	other := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		other[k] = v
+	}
+	return other
+}
+
+func parseLevel(level string) (parsefunc, error) {
+	level = strings.Map(func(r rune) rune {
+		if isBlank(r) {
+			return -1
+		}
+		return r
+	}, level)
+	var levels []string
+	if level != "" {
+		levels = strings.Split(level, ",")
+		sort.Strings(levels)
+
+	}
+	fn := func(e *Entry, r *scanner) error {
+		b := r.scan(0, isLetter)
+		if len(levels) == 0 {
+			e.Level = string(b)
+			return nil
+		}
+		for _, l := range levels {
+			if string(b) == l {
+				e.Level = l
+				return nil
+			}
+		}
+		return ErrPattern
+	}
+	return fn, nil
+}
+
+func parseTime(str string, cfg config) (parsefunc, error) {
+	parse, err := parseTimePattern(str)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		year int
+		last int
+		w    when
+	)
+	skip := !cfg.needs("time")
+	fn := func(e *Entry, r *scanner) error {
+		w = when{}
+		start := r.pos
+		if err := parse(&w, r); err != nil || skip {
+			return err
+		}
+		if w.Year == 0 && w.WeekYear == 0 && w.Unix == 0 {
+			e.Stamp = string(r.buf[start:r.pos])
+		}
+		if w.Year == 0 && w.WeekYear == 0 && w.Unix == 0 && cfg.year != 0 {
+			switch {
+			case year == 0 || cfg.single:
+				year = cfg.guessYear(w)
+			case w.Mon < last:
+				year++
+			}
+			last, w.Year = w.Mon, year
+		}
+		e.When = w.Time(cfg.location)
+		return nil
+	}
+	return fn, nil
+}
+
+func (c config) guessYear(w when) int {
+	if c.year != YearAuto {
+		return c.year
+	}
+	loc := c.location
+	if loc == nil {
+		loc = time.UTC
+	}
+	now := time.Now().In(loc)
+	w.Year = now.Year()
+	if w.Time(loc).After(now.Add(time.Hour * 24)) {
+		w.Year--
+	}
+	return w.Year
+}
+
+func parseHost(str string, cfg config) (parsefunc, error) {
+	parts, err := parseHostParts(str)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		set   = cfg.needs("host", "ip", "port")
+		named bool
+	)
+	for _, p := range parts {
+		named = named || (p.name != "" && cfg.needs("named."+p.name))
+	}
+	if !named {
+		parse := mergeHost(parts)
+		fn := func(e *Entry, r *scanner) error {
+			var a Addr
+			if err := parse(&a, r); err != nil || !set {
+				return err
+			}
+			e.Host, e.Addr = a.String(), a
+			return nil
+		}
+		return fn, nil
 	}
-}
-
-func mergeParse(pfs []parsefunc) parsefunc {
-	return func(e *Entry, r *bytes.Reader) error {
-		for _, pf := range pfs {
-			if err := pf(e, r); err != nil {
+	fn := func(e *Entry, r *scanner) error {
+		var a Addr
+		for _, p := range parts {
+			if err := p.parse(&a, r); err != nil {
 				return err
 			}
+			if p.name != "" {
+				p.store(e, a)
+			}
+		}
+		if set {
+			e.Host, e.Addr = a.String(), a
 		}
 		return nil
 	}
+	return fn, nil
 }
 
-func parseArgument(str *bytes.Reader, option, what string) (string, error) {
-	r, _, _ := str.ReadRune()
-	if r != '(' {
-		if option != "" {
-			return option, str.UnreadRune()
+func parsePID() parsefunc {
+	return func(e *Entry, r *scanner) error {
+		if err := parseInt(&e.Pid, 0, r, isDigit); err != nil {
+			return err
 		}
-		return "", fmt.Errorf("%w(%s): missing (", ErrSyntax, what)
+		return nil
 	}
-	var buf bytes.Buffer
-	for str.Len() > 0 {
-		r, _, _ := str.ReadRune()
-		if r == ')' {
-			return buf.String(), nil
-		} else if r == '\\' {
-			r, _, _ = str.ReadRune()
-			if !isEscape(r) {
-				return "", fmt.Errorf("%w: invalid escaped character %c", r)
-			}
-		}
-		buf.WriteRune(r)
-		if buf.Len() > 64 {
-			return "", fmt.Errorf("%w(%s): argument too long (%s)", ErrSyntax, what, buf.String())
-		}
+}
+
+func parseLiteral(str string) parsefunc {
+	return func(e *Entry, r *scanner) error {
+		return matchLiteral(str, r)
 	}
-	return "", fmt.Errorf("%w(%s): missing )", ErrSyntax, what)
 }
 
-func parseAlternative(str *bytes.Reader) (parsefunc, error) {
-	r, _, _ := str.ReadRune()
-	if r != '(' {
-		return nil, fmt.Errorf("%w: missing (", ErrSyntax)
+func parseMessage() parsefunc {
+	return func(e *Entry, r *scanner) error {
+		e.Message, _ = parseString(r, 0, func(r rune) bool { return !isEOL(r) })
+		return nil
 	}
-	var (
-		pfs   []parsefunc
-		until = func(r rune) bool { return r == '|' || r == ')' }
-	)
-	for {
-		last, fn, err := parsePatternUntil(str, until)
-		if err != nil {
-			return nil, err
+}
+
+// convertfunc gives the typed value of a capture.
+type convertfunc func(string) (interface{}, error)
+
+// parseCapture splits the argument of %w into the name of the capture and its
+// optional type: int, float, bool, duration, string or time with an optional
+// time pattern (eg, status:int or ts:time:%y-%m-%d). A duration can be given
+// as a number of a unit (eg, elapsed:duration:ms).
+func parseCapture(arg string, cfg config) (string, convertfunc, error) {
+	x := strings.IndexByte(arg, ':')
+	if x < 0 {
+		return arg, nil, nil
+	}
+	name, kind, layout := arg[:x], arg[x+1:], ""
+	if x := strings.IndexByte(kind, ':'); x >= 0 {
+		kind, layout = kind[:x], kind[x+1:]
+	}
+	if name == "" {
+		return "", nil, syntaxError("", "missing name in capture %s", arg)
+	}
+	if layout != "" && kind != "time" && kind != "duration" {
+		return "", nil, syntaxError("", "%s: layout only allowed with time and duration", arg)
+	}
+	var convert convertfunc
+	switch kind {
+	case "string":
+	case "int":
+		convert = func(str string) (interface{}, error) {
+			return strconv.Atoi(str)
 		}
-		if last != '|' && last != ')' {
-			return nil, fmt.Errorf("%w: unexpected character %c", ErrSyntax, last)
+	case "float":
+		convert = func(str string) (interface{}, error) {
+			return strconv.ParseFloat(str, 64)
 		}
-		pfs = append(pfs, fn)
-		if last == ')' {
+	case "bool":
+		convert = func(str string) (interface{}, error) {
+			return strconv.ParseBool(str)
+		}
+	case "duration":
+		if layout == "" {
+			convert = func(str string) (interface{}, error) {
+				return ParseDuration(str)
+			}
 			break
 		}
+		unit, err := time.ParseDuration("1" + layout)
+		if err != nil {
+			return "", nil, syntaxError("", "%s: unknown unit %s", arg, layout)
+		}
+		convert = func(str string) (interface{}, error) {
+			n, err := strconv.ParseFloat(str, 64)
+			if err != nil {
+				return nil, err
+			}
+			return time.Duration(n * float64(unit)), nil
+		}
+	case "time":
+		parse, err := parseCaptureTime(layout)
+		if err != nil {
+			return "", nil, err
+		}
+		convert = func(str string) (interface{}, error) {
+			var w when
+			if err := parse(&w, newScanner([]byte(str))); err != nil {
+				return nil, err
+			}
+			return w.Time(cfg.location), nil
+		}
+	default:
+		return "", nil, syntaxError("", "%s: unknown type %s", name, kind)
 	}
-	return parseAlt(pfs)
+	return name, convert, nil
 }
 
-func parseAlt(pfs []parsefunc) (parsefunc, error) {
-	if len(pfs) == 0 {
-		return nil, fmt.Errorf("%w: empty alternatives", ErrSyntax)
+// parseCaptureTime accepts the layout of a time capture as a time pattern or
+// in the syntax of Java's SimpleDateFormat (eg, yyyy-MM-dd). When the layout
+// has no time of day, mm stands for the month (eg, yyyy-mm-dd).
+func parseCaptureTime(layout string) (whenfunc, error) {
+	if layout == "" || strings.IndexByte(layout, '%') >= 0 || lookupPreset(KindTime, layout) != layout {
+		return parseTimePattern(layout)
 	}
-	fn := func(e *Entry, r *bytes.Reader) error {
-		var (
-			err  error
-			seek int64
-		)
-		seek, err = r.Seek(0, io.SeekCurrent)
+	if !strings.ContainsAny(strings.ToLower(layout), "hs") {
+		layout = strings.ReplaceAll(layout, "mm", "MM")
+	}
+	pattern, err := convertJavaDate(layout)
+	if err != nil {
+		return nil, err
+	}
+	return parseTimePattern(pattern)
+}
+
+func parseWord(name string, stop rune, convert convertfunc) parsefunc {
+	accept := acceptWord(stop)
+	return func(e *Entry, r *scanner) error {
+		b, err := scanWord(r, accept)
 		if err != nil {
 			return err
 		}
-		for _, pf := range pfs {
-			if err = pf(e, r); err == nil {
-				break
-			}
-			seek, err = r.Seek(seek, io.SeekStart)
+		return storeWord(e, name, string(b), convert)
+	}
+}
+
+// storeWord keeps str as the named word name, or as a word when name is empty.
+func storeWord(e *Entry, name, str string, convert convertfunc) error {
+	if name != "" {
+		e.setNamed(name, str)
+		if convert != nil && str != "" && str != "-" {
+			v, err := convert(str)
 			if err != nil {
-				return err
+				return &ValueError{Field: name, Value: str, Err: err}
 			}
+			e.setValue(name, v)
 		}
+	} else if str != "" {
+		e.Words = append(e.Words, str)
+	}
+	return nil
+}
+
+// skipWord reads a word like parseWord without keeping it.
+func skipWord(stop rune) parsefunc {
+	accept := acceptWord(stop)
+	return func(_ *Entry, r *scanner) error {
+		_, err := scanWord(r, accept)
 		return err
 	}
-	return fn, nil
 }
 
-func parseLevel(level string) (parsefunc, error) {
-	level = strings.Map(func(r rune) rune {
-		if isBlank(r) {
-			return -1
+func acceptWord(stop rune) func(rune) bool {
+	if isBlank(stop) || stop == '%' {
+		stop = 0
+	}
+	return func(r rune) bool {
+		return !isBlank(r) && !isEOL(r) && r != '\n' && (stop == 0 || r != stop)
+	}
+}
+
+func scanWord(r *scanner, accept func(rune) bool) ([]byte, error) {
+	quote := peek(r)
+	if !isQuote(quote) {
+		return r.scan(0, accept), nil
+	}
+	r.ReadRune()
+	b := r.scan(0, func(r rune) bool { return r != quote })
+	if c, _, _ := r.ReadRune(); c != quote {
+		return nil, ErrPattern
+	}
+	return bytes.TrimSpace(b), nil
+}
+
+// parseToken reads a token with scan and keeps it like %w, unless keep is
+// false.
+func parseToken(name string, convert convertfunc, keep bool, scan func(*scanner) (string, error)) parsefunc {
+	return func(e *Entry, r *scanner) error {
+		str, err := scan(r)
+		if err != nil || !keep {
+			return err
 		}
-		return r
-	}, level)
-	var levels []string
-	if level != "" {
-		levels = strings.Split(level, ",")
-		sort.Strings(levels)
+		return storeWord(e, name, str, convert)
+	}
+}
 
+// scanQuoted reads a string between single or double quotes, in which a
+// backslash escapes the quote, the backslash and gives \n, \r and \t their
+// usual meaning. The other escaped characters are kept with their backslash.
+func scanQuoted(r *scanner) (string, error) {
+	quote, _, _ := r.ReadRune()
+	if !isQuote(quote) {
+		return "", ErrPattern
 	}
-	fn := func(e *Entry, r *bytes.Reader) error {
-		e.Level, _ = parseString(r, 0, isLetter)
-		x := sort.SearchStrings(levels, e.Level)
-		if len(levels) > 0 && (x >= len(levels) || levels[x] != e.Level) {
-			return ErrPattern
+	var buf strings.Builder
+	for {
+		c, _, _ := r.ReadRune()
+		switch c {
+		case 0, '\n':
+			return "", ErrPattern
+		case quote:
+			return buf.String(), nil
+		case '\\':
+			c, _, _ = r.ReadRune()
+			switch c {
+			case 0:
+				return "", ErrPattern
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case quote, '\\':
+			default:
+				buf.WriteByte('\\')
+			}
 		}
-		return nil
+		buf.WriteRune(c)
 	}
-	return fn, nil
 }
 
-func parseTime(str string) (parsefunc, error) {
-	parse, err := parseTimePattern(str)
+// scanBracketed reads the text between brackets, parentheses, braces or angle
+// brackets, nested ones included, without its surrounding blanks.
+func scanBracketed(r *scanner) (string, error) {
+	open, _, _ := r.ReadRune()
+	x := strings.IndexRune("[({<", open)
+	if x < 0 {
+		return "", ErrPattern
+	}
+	var (
+		end   = rune("])}>"[x])
+		depth = 1
+		start = r.pos
+	)
+	for {
+		c, _, _ := r.ReadRune()
+		switch c {
+		case 0, '\n':
+			return "", ErrPattern
+		case open:
+			depth++
+		case end:
+			if depth--; depth == 0 {
+				b := r.buf[start : r.pos-1]
+				return string(bytes.TrimSpace(b)), nil
+			}
+		}
+	}
+}
+
+func parsePairs() parsefunc {
+	return readPairs(func(e *Entry, key, value string) {
+		e.setNamed(key, value)
+	})
+}
+
+func parseAttrs(cfg config) (parsefunc, error) {
+	set, err := setAttr(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return readPairs(set), nil
+}
+
+func parseJSON(cfg config) (parsefunc, error) {
+	set, err := setAttr(cfg)
 	if err != nil {
 		return nil, err
 	}
-	fn := func(e *Entry, r *bytes.Reader) error {
+	fn := func(e *Entry, r *scanner) error {
 		var (
-			w   when
-			err = parse(&w, r)
+			obj map[string]interface{}
+			dec = json.NewDecoder(r)
 		)
-		if err == nil {
-			e.When = w.Time()
+		dec.UseNumber()
+		if err := dec.Decode(&obj); err != nil {
+			return ErrPattern
 		}
-		return err
+		flattenJSON(e, "", obj, set)
+		r.Seek(0, io.SeekEnd)
+		return nil
 	}
 	return fn, nil
 }
 
-func parseHost(str string) (parsefunc, error) {
-	parse, err := parseHostPattern(str)
+// flattenJSON gives to set the values of a JSON object. The keys of nested
+// objects are joined with dots.
+func flattenJSON(e *Entry, key string, value interface{}, set func(*Entry, string, string)) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, vv := range v {
+			if key != "" {
+				k = key + "." + k
+			}
+			flattenJSON(e, k, vv, set)
+		}
+	case string:
+		set(e, key, v)
+	case nil:
+		set(e, key, "")
+	default:
+		b, _ := json.Marshal(v)
+		set(e, key, string(b))
+	}
+}
+
+// parseEmbedded looks for a JSON object at the end of the message of e, given
+// raw or as the value of a key (eg, payload={...}). Its keys are added to
+// Named, prefixed by the key if any, and the object is removed from the
+// message.
+func parseEmbedded(e *Entry) {
+	msg := strings.TrimSpace(e.Message)
+	if !strings.HasSuffix(msg, "}") {
+		return
+	}
+	for i := strings.IndexByte(msg, '{'); i >= 0; {
+		if str := msg[i:]; json.Valid([]byte(str)) {
+			var obj map[string]interface{}
+			dec := json.NewDecoder(strings.NewReader(str))
+			dec.UseNumber()
+			if dec.Decode(&obj) != nil {
+				return
+			}
+			prefix := msg[:i]
+			if strings.HasSuffix(prefix, "=") {
+				prefix = prefix[:len(prefix)-1]
+				j := strings.LastIndexFunc(prefix, func(r rune) bool {
+					return !isAlpha(r) && r != '.'
+				})
+				msg, prefix = prefix[:j+1], prefix[j+1:]
+			} else {
+				msg, prefix = prefix, ""
+			}
+			flattenJSON(e, prefix, obj, func(e *Entry, key, value string) {
+				e.setNamed(key, value)
+			})
+			e.Message = strings.TrimSpace(msg)
+			return
+		}
+		x := strings.IndexByte(msg[i+1:], '{')
+		if x < 0 {
+			break
+		}
+		i += x + 1
+	}
+}
+
+func setAttr(cfg config) (func(*Entry, string, string), error) {
+	when, err := parseTime(rfcPattern, cfg)
 	if err != nil {
 		return nil, err
 	}
-	fn := func(e *Entry, r *bytes.Reader) error {
-		var h host
-		if err := parse(&h, r); err != nil {
-			return err
+	fn := func(e *Entry, key, value string) {
+		switch key {
+		case "time":
+			if err := when(e, newScanner([]byte(value))); err == nil {
+				return
+			}
+		case "level":
+			e.Level = value
+			return
+		case "msg":
+			e.Message = value
+			return
 		}
-		e.Host = h.String()
-		return nil
+		e.setNamed(key, value)
 	}
 	return fn, nil
 }
 
-func parsePID() parsefunc {
-	return func(e *Entry, r *bytes.Reader) error {
-		if err := parseInt(&e.Pid, 0, r, isDigit); err != nil {
-			return err
+func readPairs(set func(*Entry, string, string)) parsefunc {
+	return func(e *Entry, r *scanner) error {
+		for r.Len() > 0 {
+			offset, _ := r.Seek(0, io.SeekCurrent)
+			key, _ := parseString(r, 0, func(r rune) bool { return isAlpha(r) || r == '.' })
+			if key == "" || peek(r) != '=' {
+				r.Seek(offset, io.SeekStart)
+				break
+			}
+			r.ReadRune()
+			var value string
+			if q := peek(r); isQuote(q) {
+				r.ReadRune()
+				value, _ = parseQuoted(r, q)
+			} else {
+				value, _ = parseString(r, 0, func(r rune) bool {
+					return !isBlank(r) && !isEOL(r) && r != ','
+				})
+			}
+			set(e, key, value)
+			if peek(r) == ',' {
+				r.ReadRune()
+			}
+			parseString(r, 0, isBlank)
 		}
 		return nil
 	}
 }
 
-func parseLiteral(str string) parsefunc {
-	return func(e *Entry, r *bytes.Reader) error {
-		pat := strings.NewReader(str)
-		for pat.Len() > 0 {
-			w, _, _ := pat.ReadRune()
-			g, _, _ := r.ReadRune()
-			if w != g {
+func parseRequest() parsefunc {
+	notBlank := func(r rune) bool {
+		return !isBlank(r) && !isEOL(r) && r != '"'
+	}
+	return func(e *Entry, r *scanner) error {
+		quoted := peek(r) == '"'
+		if quoted {
+			r.ReadRune()
+		}
+		method, _ := parseString(r, 0, func(r rune) bool { return r >= 'A' && r <= 'Z' })
+		if method == "" || peek(r) != ' ' {
+			return ErrPattern
+		}
+		r.ReadRune()
+		target, _ := parseString(r, 0, notBlank)
+		if target == "" || peek(r) != ' ' {
+			return ErrPattern
+		}
+		r.ReadRune()
+		proto, _ := parseString(r, 0, notBlank)
+		if !strings.HasPrefix(proto, "HTTP/") {
+			return ErrPattern
+		}
+		if quoted {
+			if c, _, _ := r.ReadRune(); c != '"' {
 				return ErrPattern
 			}
 		}
+		var query string
+		if i := strings.IndexByte(target, '?'); i >= 0 {
+			target, query = target[:i], target[i+1:]
+		}
+		e.setNamed("method", method)
+		e.setNamed("path", target)
+		e.setNamed("query", query)
+		e.setNamed("protocol", proto)
 		return nil
 	}
 }
 
-func parseMessage() parsefunc {
-	return func(e *Entry, r *bytes.Reader) error {
-		e.Message, _ = parseString(r, 0, func(r rune) bool { return !isEOL(r) })
-		return nil
+var (
+	syslogFacilities = []string{
+		"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+		"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+		"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
 	}
-}
+	syslogSeverities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+	syslogLevels     = []string{"EMERGENCY", "ALERT", "CRITICAL", "ERROR", "WARNING", "NOTICE", "INFO", "DEBUG"}
+)
 
-func parseWord(str string) parsefunc {
-	return func(e *Entry, r *bytes.Reader) error {
-		var (
-			buf     bytes.Buffer
-			quote   = peek(r)
-			isDelim = func(r rune) (bool, error) { return isBlank(r) || isEOL(r), nil }
-		)
-		if isQuote(quote) {
-			r.ReadRune()
-			isDelim = func(r rune) (bool, error) {
-				if isEOL(r) {
-					return false, ErrPattern
-				}
-				return r == quote, nil
-			}
+// parsePriority parses the PRI of the syslog messages (RFC 3164 and 5424):
+// facility*8 + severity between angle brackets.
+func parsePriority() parsefunc {
+	return func(e *Entry, r *scanner) error {
+		if c, _, _ := r.ReadRune(); c != '<' {
+			return ErrPattern
 		}
-		for {
-			z, _, _ := r.ReadRune()
-			ok, err := isDelim(z)
-			if err != nil {
-				return err
-			}
-			if ok {
-				break
-			}
-			buf.WriteRune(z)
+		str, _ := parseString(r, 0, isDigit)
+		if str == "" || len(str) > 3 || (len(str) > 1 && str[0] == '0') {
+			return ErrPattern
 		}
-		if !isQuote(quote) {
-			r.UnreadRune()
+		if c, _, _ := r.ReadRune(); c != '>' {
+			return ErrPattern
 		}
-		if str := strings.TrimSpace(buf.String()); str != "" {
-			e.Words = append(e.Words, str)
+		pri, _ := strconv.Atoi(str)
+		if pri >= len(syslogFacilities)*8 {
+			return ErrPattern
 		}
+		e.setNamed("facility", syslogFacilities[pri/8])
+		e.setNamed("severity", syslogSeverities[pri%8])
+		e.Level = syslogLevels[pri%8]
 		return nil
 	}
 }
 
+func parseQuoted(r *scanner, quote rune) (string, error) {
+	var buf bytes.Buffer
+	for {
+		c, _, err := r.ReadRune()
+		if err != nil || isEOL(c) {
+			return buf.String(), ErrPattern
+		}
+		if c == quote {
+			break
+		}
+		if c == '\\' {
+			if n := peek(r); n == quote || n == '\\' {
+				c, _, _ = r.ReadRune()
+			}
+		}
+		buf.WriteRune(c)
+	}
+	return buf.String(), nil
+}
+
 func parseUser() parsefunc {
-	return func(e *Entry, r *bytes.Reader) error {
+	return func(e *Entry, r *scanner) error {
 		e.User, _ = parseString(r, 0, isAlpha)
 		return nil
 	}
 }
 
 func parseGroup() parsefunc {
-	return func(e *Entry, r *bytes.Reader) error {
+	return func(e *Entry, r *scanner) error {
 		e.Group, _ = parseString(r, 0, isAlpha)
 		return nil
 	}
@@ -679,54 +2221,62 @@ func parseDiscard(next rune) parsefunc {
 	accept := func(r rune) bool {
 		return r != next
 	}
-	return func(_ *Entry, r *bytes.Reader) error {
+	return func(_ *Entry, r *scanner) error {
 		parseString(r, 0, accept)
 		return nil
 	}
 }
 
+// parseEnd checks that the end of the line is reached.
+func parseEnd() parsefunc {
+	return func(_ *Entry, r *scanner) error {
+		if r.Len() == 0 {
+			return nil
+		}
+		rest := r.buf[r.pos:]
+		if len(rest) > 32 {
+			rest = rest[:32]
+		}
+		return fmt.Errorf("%w: unexpected %q at end of line", ErrPattern, rest)
+	}
+}
+
+// parseDiscardN discards exactly n characters.
+func parseDiscardN(n int) parsefunc {
+	return func(_ *Entry, r *scanner) error {
+		_, err := parseString(r, n, nil)
+		return err
+	}
+}
+
+// parseDiscardUntil discards the characters before str. The line does not
+// match if str is not found.
+func parseDiscardUntil(str string) parsefunc {
+	return func(_ *Entry, r *scanner) error {
+		if !r.skipUntil(str) {
+			return ErrPattern
+		}
+		return nil
+	}
+}
+
 func parseProcess() parsefunc {
-	return func(e *Entry, r *bytes.Reader) error {
+	return func(e *Entry, r *scanner) error {
 		e.Process, _ = parseString(r, 0, isAlpha)
 		return nil
 	}
 }
 
 func parseBlank() parsefunc {
-	return func(_ *Entry, r *bytes.Reader) error {
+	return func(_ *Entry, r *scanner) error {
 		parseString(r, 0, isBlank)
 		return nil
 	}
 }
 
-var days = []string{
-	"mon",
-	"tue",
-	"wed",
-	"thu",
-	"fri",
-	"sat",
-	"sun",
-}
-
-var months = []string{
-	"jan",
-	"feb",
-	"mar",
-	"apr",
-	"may",
-	"jun",
-	"jul",
-	"aug",
-	"sep",
-	"oct",
-	"nov",
-	"dec",
-}
-
 const (
-	isoPattern = "%y-%m-%d %H:%M:%S%Z"
-	rfcPattern = "%y-%m-%dT%H:%M:%S%Z"
+	isoPattern = "%y-%m-%d %H:%M:%S%F%Z"
+	rfcPattern = "%y-%m-%dT%H:%M:%S%F%Z"
 )
 
 type when struct {
@@ -741,41 +2291,103 @@ type when struct {
 	Zone    int
 	YearDay int
 	Unix    int
+
+	WeekYear int
+	Week     int
+	WeekDay  int
+	Quarter  int
+
+	zoned    bool
+	meridiem bool
+	pm       bool
 }
 
-func (w when) Time() time.Time {
+func (w when) Time(loc *time.Location) time.Time {
 	if w.Unix != 0 {
-		return time.Unix(int64(w.Unix), 0)
+		t := time.Unix(int64(w.Unix), int64(w.Frac))
+		if loc != nil {
+			t = t.In(loc)
+		}
+		return t
+	}
+	if w.Year == 0 {
+		w.Year = w.WeekYear
 	}
 	if w.Year == 0 {
 		w.Year++
 	}
+	if w.Mon == 0 && w.Quarter > 0 {
+		w.Mon = (w.Quarter-1)*3 + 1
+	}
 	if w.Mon == 0 {
 		w.Mon++
 	}
+	if w.meridiem {
+		w.Hour %= 12
+		if w.pm {
+			w.Hour += 12
+		}
+	}
 	if w.Day == 0 {
 		w.Day++
 	}
 	zone := time.UTC
-	if w.Zone != 0 {
+	if w.zoned && w.Zone != 0 {
 		zone = time.FixedZone("", w.Zone)
+	} else if !w.zoned && loc != nil {
+		zone = loc
 	}
 	t := time.Date(w.Year, time.Month(w.Mon), w.Day, w.Hour, w.Min, w.Sec, w.Frac, zone)
 	if w.YearDay > 0 {
 		t = t.AddDate(0, 0, w.YearDay-t.YearDay())
 	}
+	if w.Week > 0 {
+		t = w.weekDate(zone)
+	}
 	return t
 }
 
+func (w when) weekDate(zone *time.Location) time.Time {
+	year := w.WeekYear
+	if year == 0 {
+		year = w.Year
+	}
+	var (
+		jan4 = time.Date(year, time.January, 4, w.Hour, w.Min, w.Sec, w.Frac, zone)
+		wday = int(jan4.Weekday()+6) % 7
+		days = (w.Week-1)*7 - wday
+	)
+	if w.WeekDay > 0 {
+		days += w.WeekDay - 1
+	}
+	return jan4.AddDate(0, 0, days)
+}
+
 func parseTimePattern(pattern string) (whenfunc, error) {
+	wfs, fxs, err := compileTimePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return optimizeWhen(wfs, fxs), nil
+}
+
+// compileTimePattern gives the functions parsing each part of pattern and the
+// fixed field of each of them, if any.
+func compileTimePattern(pattern string) ([]whenfunc, []*fixedField, error) {
 	if pattern == "" {
 		pattern = isoPattern
 	}
+	pattern = lookupPreset(KindTime, pattern)
 	var (
 		str = bytes.NewReader([]byte(pattern))
 		buf bytes.Buffer
 		wfs []whenfunc
+		fxs []*fixedField
 	)
+	add := func(fn whenfunc, fixed *fixedField) {
+		wfs = append(wfs, fn)
+		fxs = append(fxs, fixed)
+	}
 	for str.Len() > 0 {
 		r, _, _ := str.ReadRune()
 		if r == '%' {
@@ -785,61 +2397,229 @@ func parseTimePattern(pattern string) (whenfunc, error) {
 				continue
 			}
 			if buf.Len() > 0 {
-				wfs = append(wfs, parseWhenLiteral(buf.String()))
+				add(parseWhenLiteral(buf.String()), &fixedField{literal: buf.String()})
 				buf.Reset()
 			}
 			switch r {
 			case 'I':
 				fn, err := parseTimePattern(isoPattern)
 				if err != nil {
-					return nil, err
+					return nil, nil, err
 				}
-				wfs = append(wfs, fn)
+				add(fn, nil)
 			case 'R':
-				fn, err := parseTimePattern(isoPattern)
+				fn, err := parseTimePattern(rfcPattern)
 				if err != nil {
-					return nil, err
+					return nil, nil, err
 				}
-				wfs = append(wfs, fn)
+				add(fn, nil)
 			case 'y':
-				wfs = append(wfs, parseYear)
+				add(parseYear, fixedNumber(4, func(w *when, n int) { w.Year = n }))
 			case 'm':
-				wfs = append(wfs, parseMonth)
+				add(parseMonth, fixedNumber(2, func(w *when, n int) { w.Mon = n }))
 			case 'd':
-				wfs = append(wfs, parseDay)
+				add(parseDay, &fixedField{width: 2, blank: true, set: func(w *when, n int) { w.Day = n }})
 			case 'j':
-				wfs = append(wfs, parseDOY)
+				add(parseDOY, fixedNumber(3, func(w *when, n int) { w.YearDay = n }))
 			case 'a':
-				wfs = append(wfs, parseDayStr)
+				add(parseDayStr, nil)
 			case 'b':
-				wfs = append(wfs, parseMonthStr)
+				add(parseMonthStr, nil)
 			case 's':
-				wfs = append(wfs, parseTimestamp)
+				add(parseTimestamp, nil)
 			case 'H':
-				wfs = append(wfs, parseHour)
+				add(parseHour, fixedNumber(2, func(w *when, n int) { w.Hour = n }))
 			case 'M':
-				wfs = append(wfs, parseMinute)
+				add(parseMinute, fixedNumber(2, func(w *when, n int) { w.Min = n }))
 			case 'S':
-				wfs = append(wfs, parseSecond)
+				add(parseSecond, fixedNumber(2, func(w *when, n int) { w.Sec = n }))
 			case 'f':
-				wfs = append(wfs, parseFraction)
+				add(parseFraction, nil)
+			case 'F':
+				add(parseOptionalFraction, nil)
+			case 'L':
+				add(parseFractionN(3), fixedFraction(3))
+			case 'E':
+				add(parseFractionN(6), fixedFraction(6))
+			case 'N':
+				add(parseFractionN(9), fixedFraction(9))
 			case 'Z':
-				wfs = append(wfs, parseZone)
+				add(parseZone, nil)
+			case 'G':
+				add(parseWeekYear, fixedNumber(4, func(w *when, n int) { w.WeekYear = n }))
+			case 'V':
+				add(parseWeek, nil)
+			case 'u':
+				add(parseWeekDay, nil)
+			case 'q':
+				add(parseQuarter, nil)
+			case 'h':
+				add(parseHour12, nil)
+			case 'p':
+				add(parseMeridiem, nil)
+			case 'o':
+				add(parseOrdinalDay, nil)
 			default:
-				return nil, fmt.Errorf("%w(time): unknown specifier %c", ErrSyntax, r)
+				return nil, nil, syntaxError("time", "unknown specifier %c", r)
 			}
 		} else {
 			buf.WriteRune(r)
 		}
 	}
 	if buf.Len() > 0 {
-		wfs = append(wfs, parseWhenLiteral(buf.String()))
+		add(parseWhenLiteral(buf.String()), &fixedField{literal: buf.String()})
+	}
+	return wfs, fxs, nil
+}
+
+func formatTimePattern(pattern string) (timefunc, error) {
+	if pattern == "" {
+		pattern = rfcPattern
+	}
+	pattern = lookupPreset(KindTime, pattern)
+	var (
+		str = bytes.NewReader([]byte(pattern))
+		buf bytes.Buffer
+		tfs []timefunc
+	)
+	for str.Len() > 0 {
+		r, _, _ := str.ReadRune()
+		if r != '%' {
+			buf.WriteRune(r)
+			continue
+		}
+		r, _, _ = str.ReadRune()
+		if r == '%' {
+			buf.WriteRune(r)
+			continue
+		}
+		if buf.Len() > 0 {
+			tfs = append(tfs, formatLiteral(buf.String()))
+			buf.Reset()
+		}
+		var fn timefunc
+		switch r {
+		case 'I', 'R':
+			pattern := isoPattern
+			if r == 'R' {
+				pattern = rfcPattern
+			}
+			fn, _ = formatTimePattern(pattern)
+		case 'y':
+			fn = formatInt(4, func(t time.Time) int { return t.Year() })
+		case 'm':
+			fn = formatInt(2, func(t time.Time) int { return int(t.Month()) })
+		case 'd':
+			fn = formatInt(2, func(t time.Time) int { return t.Day() })
+		case 'j':
+			fn = formatInt(3, func(t time.Time) int { return t.YearDay() })
+		case 'a':
+			fn = formatLayout("Mon")
+		case 'b':
+			fn = formatLayout("Jan")
+		case 's':
+			fn = formatInt(0, func(t time.Time) int { return int(t.Unix()) })
+		case 'H':
+			fn = formatInt(2, func(t time.Time) int { return t.Hour() })
+		case 'M':
+			fn = formatInt(2, func(t time.Time) int { return t.Minute() })
+		case 'S':
+			fn = formatInt(2, func(t time.Time) int { return t.Second() })
+		case 'f':
+			fn = formatFraction(false)
+		case 'F':
+			fn = formatFraction(true)
+		case 'L':
+			fn = formatInt(3, func(t time.Time) int { return t.Nanosecond() / int(time.Millisecond) })
+		case 'E':
+			fn = formatInt(6, func(t time.Time) int { return t.Nanosecond() / int(time.Microsecond) })
+		case 'N':
+			fn = formatInt(9, func(t time.Time) int { return t.Nanosecond() })
+		case 'Z':
+			fn = formatLayout("Z07:00")
+		case 'G':
+			fn = formatInt(4, func(t time.Time) int {
+				y, _ := t.ISOWeek()
+				return y
+			})
+		case 'V':
+			fn = formatInt(2, func(t time.Time) int {
+				_, w := t.ISOWeek()
+				return w
+			})
+		case 'u':
+			fn = formatInt(1, func(t time.Time) int { return int(t.Weekday()+6)%7 + 1 })
+		case 'q':
+			fn = formatInt(1, func(t time.Time) int { return (int(t.Month())-1)/3 + 1 })
+		case 'h':
+			fn = formatLayout("03")
+		case 'p':
+			fn = formatLayout("PM")
+		case 'o':
+			fn = func(t time.Time, buf *bytes.Buffer) {
+				buf.WriteString(strconv.Itoa(t.Day()))
+				buf.WriteString(ordinalSuffix(t.Day()))
+			}
+		default:
+			return nil, syntaxError("time", "unknown specifier %c", r)
+		}
+		tfs = append(tfs, fn)
+	}
+	if buf.Len() > 0 {
+		tfs = append(tfs, formatLiteral(buf.String()))
+	}
+	return mergeFormat(tfs), nil
+}
+
+func mergeFormat(tfs []timefunc) timefunc {
+	return func(t time.Time, buf *bytes.Buffer) {
+		for _, fn := range tfs {
+			fn(t, buf)
+		}
+	}
+}
+
+func formatLiteral(str string) timefunc {
+	return func(_ time.Time, buf *bytes.Buffer) {
+		buf.WriteString(str)
+	}
+}
+
+func formatLayout(layout string) timefunc {
+	return func(t time.Time, buf *bytes.Buffer) {
+		buf.WriteString(t.Format(layout))
+	}
+}
+
+func formatFraction(optional bool) timefunc {
+	return func(t time.Time, buf *bytes.Buffer) {
+		nano := t.Nanosecond()
+		if optional && nano == 0 {
+			return
+		}
+		str := strings.TrimRight(fmt.Sprintf("%09d", nano), "0")
+		if str == "" {
+			str = "0"
+		}
+		if optional {
+			buf.WriteByte('.')
+		}
+		buf.WriteString(str)
+	}
+}
+
+func formatInt(width int, get func(time.Time) int) timefunc {
+	return func(t time.Time, buf *bytes.Buffer) {
+		str := strconv.Itoa(get(t))
+		for i := len(str); i < width; i++ {
+			buf.WriteByte('0')
+		}
+		buf.WriteString(str)
 	}
-	return mergeWhen(wfs), nil
 }
 
 func mergeWhen(wfs []whenfunc) whenfunc {
-	return func(w *when, r *bytes.Reader) error {
+	return func(w *when, r *scanner) error {
 		for _, fn := range wfs {
 			if err := fn(w, r); err != nil {
 				return err
@@ -849,66 +2629,175 @@ func mergeWhen(wfs []whenfunc) whenfunc {
 	}
 }
 
-func parseYear(w *when, r *bytes.Reader) error {
+func parseYear(w *when, r *scanner) error {
 	return parseInt(&w.Year, 4, r, isDigit)
 }
 
-func parseDOY(w *when, r *bytes.Reader) error {
+func parseDOY(w *when, r *scanner) error {
 	return parseInt(&w.YearDay, 3, r, isDigit)
 }
 
-func parseDay(w *when, r *bytes.Reader) error {
+func parseDay(w *when, r *scanner) error {
+	if peek(r) == ' ' {
+		r.ReadRune()
+		return parseInt(&w.Day, 1, r, isDigit)
+	}
 	return parseInt(&w.Day, 2, r, isDigit)
 }
 
-func parseDayStr(w *when, r *bytes.Reader) error {
-	day, err := parseString(r, 3, isLetter)
+func parseDayStr(w *when, r *scanner) error {
+	day, err := parseName(r)
 	if err != nil {
 		return err
 	}
-	day = strings.ToLower(day)
-	x := sort.SearchStrings(days, day)
-	if x >= len(days) || days[x] != day {
+	if _, ok := lookupDay(day); !ok {
 		return ErrPattern
 	}
 	return nil
 }
 
-func parseMonth(w *when, r *bytes.Reader) error {
+func parseMonth(w *when, r *scanner) error {
 	return parseInt(&w.Mon, 2, r, isDigit)
 }
 
-func parseMonthStr(w *when, r *bytes.Reader) error {
-	month, err := parseString(r, 3, isLetter)
+func parseMonthStr(w *when, r *scanner) error {
+	month, err := parseName(r)
 	if err != nil {
 		return err
 	}
-	month = strings.ToLower(month)
-	x := sort.SearchStrings(months, month)
-	if x >= len(months) || months[x] != month {
+	x, ok := lookupMonth(month)
+	if !ok {
 		return ErrPattern
 	}
-	w.Mon = x + 1
+	w.Mon = x
 	return nil
 }
 
-func parseHour(w *when, r *bytes.Reader) error {
+func parseName(r *scanner) (string, error) {
+	str, _ := parseString(r, 0, unicode.IsLetter)
+	if str == "" {
+		return "", ErrPattern
+	}
+	if peek(r) == '.' {
+		r.ReadRune()
+		if _, ok := lookupMonth(str + "."); ok {
+			return str + ".", nil
+		}
+		if _, ok := lookupDay(str + "."); ok {
+			return str + ".", nil
+		}
+		r.UnreadRune()
+	}
+	return str, nil
+}
+
+func parseHour(w *when, r *scanner) error {
 	return parseInt(&w.Hour, 2, r, isDigit)
 }
 
-func parseMinute(w *when, r *bytes.Reader) error {
+func parseHour12(w *when, r *scanner) error {
+	if err := parseInt(&w.Hour, 2, r, isDigit); err != nil {
+		return err
+	}
+	if w.Hour < 1 || w.Hour > 12 {
+		return ErrPattern
+	}
+	return nil
+}
+
+func parseMeridiem(w *when, r *scanner) error {
+	str, err := parseString(r, 2, isLetter)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(str) {
+	case "am":
+	case "pm":
+		w.pm = true
+	default:
+		return ErrPattern
+	}
+	w.meridiem = true
+	return nil
+}
+
+func parseWeekYear(w *when, r *scanner) error {
+	return parseInt(&w.WeekYear, 4, r, isDigit)
+}
+
+func parseWeek(w *when, r *scanner) error {
+	if err := parseInt(&w.Week, 2, r, isDigit); err != nil {
+		return err
+	}
+	if w.Week < 1 || w.Week > 53 {
+		return ErrPattern
+	}
+	return nil
+}
+
+func parseWeekDay(w *when, r *scanner) error {
+	if err := parseInt(&w.WeekDay, 1, r, isDigit); err != nil {
+		return err
+	}
+	if w.WeekDay < 1 || w.WeekDay > 7 {
+		return ErrPattern
+	}
+	return nil
+}
+
+func parseQuarter(w *when, r *scanner) error {
+	if err := parseInt(&w.Quarter, 1, r, isDigit); err != nil {
+		return err
+	}
+	if w.Quarter < 1 || w.Quarter > 4 {
+		return ErrPattern
+	}
+	return nil
+}
+
+func parseOrdinalDay(w *when, r *scanner) error {
+	if err := parseInt(&w.Day, 0, r, isDigit); err != nil {
+		return err
+	}
+	suffix, err := parseString(r, 2, isLetter)
+	if err != nil {
+		return err
+	}
+	if strings.ToLower(suffix) != ordinalSuffix(w.Day) {
+		return ErrPattern
+	}
+	return nil
+}
+
+func ordinalSuffix(day int) string {
+	switch {
+	case day%100 >= 11 && day%100 <= 13:
+		return "th"
+	case day%10 == 1:
+		return "st"
+	case day%10 == 2:
+		return "nd"
+	case day%10 == 3:
+		return "rd"
+	default:
+		return "th"
+	}
+}
+
+func parseMinute(w *when, r *scanner) error {
 	return parseInt(&w.Min, 2, r, isDigit)
 }
 
-func parseSecond(w *when, r *bytes.Reader) error {
+func parseSecond(w *when, r *scanner) error {
 	return parseInt(&w.Sec, 2, r, isDigit)
 }
 
-func parseTimestamp(w *when, r *bytes.Reader) error {
+func parseTimestamp(w *when, r *scanner) error {
 	return parseInt(&w.Unix, 0, r, isDigit)
 }
 
-func parseZone(w *when, r *bytes.Reader) error {
+func parseZone(w *when, r *scanner) error {
+	w.zoned = true
 	switch z, _, _ := r.ReadRune(); z {
 	case 'Z':
 	case '+', '-':
@@ -921,54 +2810,107 @@ func parseZone(w *when, r *bytes.Reader) error {
 			return err
 		}
 		w.Zone *= i * 60 * 60
-		if z := peek(r); z == ':' {
+		if c := peek(r); c == ':' {
 			r.ReadRune()
 		}
-		if z := peek(r); isDigit(z) {
+		if c := peek(r); isDigit(c) {
 			err := parseInt(&i, 2, r, isDigit)
-			if err == nil {
+			if err == nil && z == '-' {
+				w.Zone -= i * 60
+			} else if err == nil {
 				w.Zone += i * 60
 			}
 			return err
 		}
 	default:
-		return ErrPattern
+		if !isLetter(z) {
+			return ErrPattern
+		}
+		r.UnreadRune()
+		name, _ := parseString(r, 0, isLetter)
+		offset, ok := zoneNames[strings.ToUpper(name)]
+		if !ok {
+			// unknown abbreviations are in the location of the Reader
+			w.zoned = false
+		}
+		w.Zone = offset * 60 * 60
 	}
 	return nil
 }
 
-func parseFraction(w *when, r *bytes.Reader) error {
-	if err := parseInt(&w.Frac, 0, r, isDigit); err != nil {
-		return err
+// zoneNames are the offsets in hours of the zone abbreviations accepted by %Z.
+var zoneNames = map[string]int{
+	"UT":   0,
+	"UTC":  0,
+	"GMT":  0,
+	"WET":  0,
+	"CET":  1,
+	"CEST": 2,
+	"EET":  2,
+	"EEST": 3,
+	"EST":  -5,
+	"EDT":  -4,
+	"CST":  -6,
+	"CDT":  -5,
+	"MST":  -7,
+	"MDT":  -6,
+	"PST":  -8,
+	"PDT":  -7,
+}
+
+func parseFraction(w *when, r *scanner) error {
+	str, _ := parseString(r, 0, isDigit)
+	if str == "" {
+		return ErrPattern
 	}
-	switch {
-	case w.Frac < 1000:
-		w.Frac *= 1000 * 1000
-	case w.Frac < 1000*1000:
-		w.Frac *= 1000
-	default:
+	if len(str) > 9 {
+		str = str[:9]
 	}
-	return nil
+	str += strings.Repeat("0", 9-len(str))
+	frac, err := strconv.Atoi(str)
+	if err == nil {
+		w.Frac = frac
+	}
+	return err
 }
 
-func parseWhenLiteral(str string) whenfunc {
-	return func(_ *when, r *bytes.Reader) error {
-		pat := strings.NewReader(str)
-		for pat.Len() > 0 {
-			w, _, _ := pat.ReadRune()
-			g, _, _ := r.ReadRune()
-			if w != g {
-				return ErrPattern
-			}
+func parseOptionalFraction(w *when, r *scanner) error {
+	if c := peek(r); c != '.' && c != ',' {
+		return nil
+	}
+	r.ReadRune()
+	return parseFraction(w, r)
+}
+
+func parseFractionN(n int) whenfunc {
+	return func(w *when, r *scanner) error {
+		str, err := parseString(r, n, isDigit)
+		if err != nil {
+			return err
 		}
+		return parseFraction(w, newScanner([]byte(str)))
+	}
+}
+
+func matchLiteral(str string, r *scanner) error {
+	if r.Len() >= len(str) && string(r.buf[r.pos:r.pos+len(str)]) == str {
+		r.pos, r.prev = r.pos+len(str), -1
 		return nil
 	}
+	// rune by rune to stop where the line differs
+	for _, w := range str {
+		if g, _, _ := r.ReadRune(); w != g {
+			return ErrPattern
+		}
+	}
+	return nil
 }
 
-const (
-	ip4len = 4
-	ip6len = 8
-)
+func parseWhenLiteral(str string) whenfunc {
+	return func(_ *when, r *scanner) error {
+		return matchLiteral(str, r)
+	}
+}
 
 const (
 	ip4long  = "%4:%p"
@@ -976,25 +2918,67 @@ const (
 	fqdnlong = "%f:%p"
 )
 
-type host struct {
-	Name string
-	Addr string
-	Mask int
-	Port int
+// Addr is the structured form of the host parsed by %h.
+type Addr struct {
+	Name string `json:"name,omitempty"`
+	IP   net.IP `json:"ip,omitempty"`
+	Port int    `json:"port,omitempty"`
+	Mask int    `json:"mask,omitempty"`
+}
+
+func (a Addr) String() string {
+	host := a.Name
+	if host == "" && a.IP != nil {
+		host = a.IP.String()
+		if a.Mask > 0 {
+			host = fmt.Sprintf("%s/%d", host, a.Mask)
+		}
+	}
+	if a.Port == 0 {
+		return host
+	}
+	return net.JoinHostPort(host, strconv.Itoa(a.Port))
+}
+
+// hostPart is a specifier of a host pattern, or a literal, with the name given
+// to its value.
+type hostPart struct {
+	parse hostfunc
+	spec  rune
+	name  string
 }
 
-func (h host) String() string {
-	if h.Name != "" {
-		return h.Name
+// store sets the value of the part just parsed into a as a named word of e.
+func (p hostPart) store(e *Entry, a Addr) {
+	switch p.spec {
+	case '4', '6':
+		e.setNamed(p.name, a.IP.String())
+	case 'h', 'f':
+		e.setNamed(p.name, a.Name)
+	case 'p':
+		e.setNamed(p.name, strconv.Itoa(a.Port))
+		e.setValue(p.name, a.Port)
+	case 'm':
+		e.setNamed(p.name, strconv.Itoa(a.Mask))
+		e.setValue(p.name, a.Mask)
+	default:
+		e.setNamed(p.name, a.String())
 	}
-	return fmt.Sprintf("%s:%d", h.Addr, h.Port)
 }
 
 func parseHostPattern(pattern string) (hostfunc, error) {
+	parts, err := parseHostParts(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return mergeHost(parts), nil
+}
+
+func parseHostParts(pattern string) ([]hostPart, error) {
 	var (
 		str = bytes.NewReader([]byte(pattern))
 		buf bytes.Buffer
-		hfs []hostfunc
+		hfs []hostPart
 	)
 	for str.Len() > 0 {
 		r, _, _ := str.ReadRune()
@@ -1005,57 +2989,60 @@ func parseHostPattern(pattern string) (hostfunc, error) {
 				continue
 			}
 			if buf.Len() > 0 {
-				hfs = append(hfs, parseHostLiteral(buf.String()))
+				hfs = append(hfs, hostPart{parse: parseHostLiteral(buf.String())})
 				buf.Reset()
 			}
+			var fn hostfunc
 			switch r {
 			case '4':
-				hfs = append(hfs, parseIPv4)
+				fn = parseIPv4
 			case '6':
-				hfs = append(hfs, parseIPv6)
+				fn = parseIPv6
 			case 'p':
-				hfs = append(hfs, parsePort)
+				fn = parsePort
 			case 'f':
-				hfs = append(hfs, parseFQDN)
+				fn = parseFQDN
 			case 'h':
-				hfs = append(hfs, parseHostname)
+				fn = parseHostname
 			case 'm':
-				hfs = append(hfs, parseMask)
-			case 'F':
-				fn, err := parseHostPattern(ip4long)
-				if err != nil {
-					return nil, err
-				}
-				hfs = append(hfs, fn)
-			case 'S':
-				fn, err := parseHostPattern(ip6long)
-				if err != nil {
-					return nil, err
+				fn = parseMask
+			case 'F', 'S', 'Q':
+				long := fqdnlong
+				if r == 'F' {
+					long = ip4long
+				} else if r == 'S' {
+					long = ip6long
 				}
-				hfs = append(hfs, fn)
-			case 'Q':
-				fn, err := parseHostPattern(fqdnlong)
-				if err != nil {
+				var err error
+				if fn, err = parseHostPattern(long); err != nil {
 					return nil, err
 				}
-				hfs = append(hfs, fn)
 			default:
-				return nil, fmt.Errorf("%w(host): unknown specifier %c", ErrSyntax, r)
+				return nil, syntaxError("host", "unknown specifier %c", r)
+			}
+			part := hostPart{parse: fn, spec: r}
+			if peek(str) == '>' {
+				// > not followed by a name is a literal
+				str.ReadRune()
+				if part.name, _ = parseString(str, 0, isAlpha); part.name == "" {
+					buf.WriteRune('>')
+				}
 			}
+			hfs = append(hfs, part)
 		} else {
 			buf.WriteRune(r)
 		}
 	}
 	if buf.Len() > 0 {
-		hfs = append(hfs, parseHostLiteral(buf.String()))
+		hfs = append(hfs, hostPart{parse: parseHostLiteral(buf.String())})
 	}
-	return mergeHost(hfs), nil
+	return hfs, nil
 }
 
-func mergeHost(hfs []hostfunc) hostfunc {
-	return func(h *host, r *bytes.Reader) error {
-		for _, fn := range hfs {
-			if err := fn(h, r); err != nil {
+func mergeHost(parts []hostPart) hostfunc {
+	return func(h *Addr, r *scanner) error {
+		for _, p := range parts {
+			if err := p.parse(h, r); err != nil {
 				return err
 			}
 		}
@@ -1064,122 +3051,89 @@ func mergeHost(hfs []hostfunc) hostfunc {
 }
 
 func parseHostLiteral(str string) hostfunc {
-	return func(_ *host, r *bytes.Reader) error {
-		pat := strings.NewReader(str)
-		for pat.Len() > 0 {
-			w, _, _ := pat.ReadRune()
-			g, _, _ := r.ReadRune()
-			if w != g {
-				return ErrPattern
-			}
-		}
-		return nil
+	return func(_ *Addr, r *scanner) error {
+		return matchLiteral(str, r)
 	}
 }
 
-func parseIPv4(h *host, r *bytes.Reader) error {
-	var (
-		buf   bytes.Buffer
-		quote = peek(r)
-	)
-	if quote == '[' {
-		r.ReadRune()
-	}
-	for i := 0; i < ip4len; i++ {
-		var j int
-		if err := parseInt(&j, 0, r, isDigit); err != nil {
-			return err
-		}
-		if j < 0 || j > 0xFF {
-			return ErrPattern
-		}
-		buf.WriteString(strconv.Itoa(j))
-		if i < ip4len-1 {
-			if k := peek(r); k != '.' {
-				return ErrPattern
-			}
-			r.ReadRune()
-			buf.WriteRune('.')
-		}
-	}
-	if k := peek(r); quote == '[' {
-		if k != ']' {
-			return ErrPattern
-		}
-		r.ReadRune()
-	}
-	h.Addr = buf.String()
-	return nil
+func parseIPv4(h *Addr, r *scanner) error {
+	return parseIP(h, r, false)
 }
 
-func parseIPv6(h *host, r *bytes.Reader) error {
-	var (
-		buf   bytes.Buffer
-		quote = peek(r)
-	)
-	if quote == '[' {
+func parseIPv6(h *Addr, r *scanner) error {
+	return parseIP(h, r, true)
+}
+
+func parseIP(h *Addr, r *scanner, ip6 bool) error {
+	quoted := peek(r) == '['
+	if quoted {
 		r.ReadRune()
 	}
-	for i := 0; i < ip6len; i++ {
-		var j int
-		if err := parseInt(&j, 0, r, isHexa); err != nil {
-			return err
+	accept := func(c rune) bool { return isDigit(c) || c == '.' }
+	if ip6 {
+		accept = func(c rune) bool { return isHexa(c) || c == ':' || c == '.' }
+	}
+	offset, _ := r.Seek(0, io.SeekCurrent)
+	str, _ := parseString(r, 0, accept)
+	// an unbracketed ipv6 may be followed by :port. Try the longest prefix
+	// that is a valid address.
+	for {
+		ip := net.ParseIP(str)
+		if ip != nil && (ip.To4() == nil) == ip6 {
+			h.IP = ip
+			break
 		}
-		if j < 0 || j > 0xFFFF {
+		i := strings.LastIndexByte(str, ':')
+		if !ip6 || quoted || i <= 0 {
 			return ErrPattern
 		}
-		buf.WriteString(strconv.FormatInt(int64(j), 16))
-		if i < ip6len-1 {
-			if k := peek(r); k != ':' {
-				break
-			}
-			buf.WriteRune(':')
-			r.ReadRune()
-			if k := peek(r); k == ':' {
-				buf.WriteRune(':')
-				r.ReadRune()
-			}
-		}
+		str = str[:i]
 	}
-	if k := peek(r); quote == '[' {
-		if k != ']' {
+	r.Seek(offset+int64(len(str)), io.SeekStart)
+	if quoted {
+		if c, _, _ := r.ReadRune(); c != ']' {
 			return ErrPattern
 		}
-		r.ReadRune()
 	}
-	h.Addr = buf.String()
 	return nil
 }
 
-func parseMask(h *host, r *bytes.Reader) error {
-	if err := parseInt(&h.Mask, 0, r, isDigit); err != nil {
-		return err
-	}
-	if h.Mask < 0 || h.Mask > 32 {
-		return ErrPattern
-	}
-	return nil
+func parseMask(h *Addr, r *scanner) error {
+	return parseNumber(&h.Mask, r, 32)
 }
 
-func parsePort(h *host, r *bytes.Reader) error {
-	if err := parseInt(&h.Port, 0, r, isDigit); err != nil {
-		return err
+func parsePort(h *Addr, r *scanner) error {
+	return parseNumber(&h.Port, r, 0xFFFF)
+}
+
+func parseNumber(i *int, r *scanner, max int) error {
+	str, _ := parseString(r, 0, isDigit)
+	if str == "" {
+		return ErrPattern
 	}
-	if h.Port < 0 || h.Port > 0xFFFF {
+	n, err := strconv.Atoi(str)
+	if err != nil || n > max {
 		return ErrPattern
 	}
+	*i = n
 	return nil
 }
 
-func parseHostname(h *host, r *bytes.Reader) error {
+func parseHostname(h *Addr, r *scanner) error {
 	h.Name, _ = parseString(r, 0, isAlpha)
+	if !isLabel(h.Name) {
+		return ErrPattern
+	}
 	return nil
 }
 
-func parseFQDN(h *host, r *bytes.Reader) error {
+func parseFQDN(h *Addr, r *scanner) error {
 	var buf bytes.Buffer
 	for {
 		part, _ := parseString(r, 0, isAlpha)
+		if !isLabel(part) {
+			return ErrPattern
+		}
 		buf.WriteString(part)
 		if k := peek(r); k != '.' {
 			break
@@ -1191,7 +3145,21 @@ func parseFQDN(h *host, r *bytes.Reader) error {
 	return nil
 }
 
+func isLabel(str string) bool {
+	if str == "" || len(str) > 63 {
+		return false
+	}
+	return str[0] != '-' && str[len(str)-1] != '-'
+}
+
 func parseInt(i *int, n int, str io.RuneScanner, accept func(rune) bool) error {
+	if s, ok := str.(*scanner); ok {
+		b := s.scan(n, accept)
+		if n > 0 && utf8.RuneCount(b) != n {
+			return ErrPattern
+		}
+		return atoi(i, b)
+	}
 	var buf bytes.Buffer
 	for i := 0; n <= 0 || i < n; i++ {
 		r, _, err := str.ReadRune()
@@ -1209,6 +3177,7 @@ func parseInt(i *int, n int, str io.RuneScanner, accept func(rune) bool) error {
 	}
 	part := strings.TrimLeft(buf.String(), "0")
 	if part == "" {
+		*i = 0
 		return nil
 	}
 	x, err := strconv.ParseInt(part, 0, 64)
@@ -1218,20 +3187,47 @@ func parseInt(i *int, n int, str io.RuneScanner, accept func(rune) bool) error {
 	return err
 }
 
+// atoi converts b to an int without allocating if b only contains digits.
+func atoi(i *int, b []byte) error {
+	var x int
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			v, err := strconv.ParseInt(string(b), 0, 64)
+			if err == nil {
+				*i = int(v)
+			}
+			return err
+		}
+		x = x*10 + int(c-'0')
+	}
+	*i = x
+	return nil
+}
+
 func parseString(r io.RuneScanner, length int, accept func(rune) bool) (string, error) {
 	if accept == nil {
 		accept = func(_ rune) bool { return true }
 	}
-	defer r.UnreadRune()
-	var buf bytes.Buffer
-	for i := 0; length <= 0 || i < length; i++ {
+	if s, ok := r.(*scanner); ok {
+		b := s.scan(length, accept)
+		if length > 0 && utf8.RuneCount(b) != length {
+			return "", ErrPattern
+		}
+		return string(b), nil
+	}
+	var (
+		buf bytes.Buffer
+		n   int
+	)
+	for ; length <= 0 || n < length; n++ {
 		c, _, _ := r.ReadRune()
 		if !accept(c) {
+			r.UnreadRune()
 			break
 		}
 		buf.WriteRune(c)
 	}
-	if length > 0 && buf.Len() != length {
+	if length > 0 && n != length {
 		return "", ErrPattern
 	}
 	return buf.String(), nil
@@ -1243,6 +3239,20 @@ func peek(r io.RuneScanner) rune {
 	return c
 }
 
+// peekLiteral gives the next character matched by the pattern, the escaped one
+// if it starts with a backslash.
+func peekLiteral(str *bytes.Reader) rune {
+	pos := str.Size() - int64(str.Len())
+	defer str.Seek(pos, io.SeekStart)
+	c, _, _ := str.ReadRune()
+	if c == '\\' {
+		if c, _, _ = str.ReadRune(); c == 'n' {
+			c = '\n'
+		}
+	}
+	return c
+}
+
 func isDigit(r rune) bool {
 	return r >= '0' && r <= '9'
 }
@@ -1272,5 +3282,5 @@ func isQuote(r rune) bool {
 }
 
 func isEscape(r rune) bool {
-	return r == '\\' || r == '@' || r == '*' || r == '(' || r == ')' || r == '|'
+	return r == '\\' || r == '@' || r == '*' || r == '(' || r == ')' || r == '|' || r == '^' || r == '$'
 }
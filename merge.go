@@ -0,0 +1,191 @@
+package log
+
+import (
+	"io"
+)
+
+// readAhead is the number of entries parsed in advance for each reader given
+// to Merge and Concat.
+const readAhead = 256
+
+type readResult struct {
+	entry Entry
+	err   error
+}
+
+// Merge creates a Reader giving the entries of rs ordered by time. The readers
+// are parsed at the same time, each in its own goroutine, and their entries
+// are expected to be already ordered by time, like the files of a rotation
+// set. Entries without time are given as soon as they are read. Entries with
+// the same time are given in the order of rs, then of their lines, so that the
+// output does not depend on the pace of the readers.
+func Merge(rs ...*Reader) *Reader {
+	var (
+		r     = combined(rs)
+		chans = make([]<-chan readResult, len(rs))
+		heads = make([]*readResult, len(rs))
+	)
+	for i := range rs {
+		chans[i] = readAll(rs[i], nil, r.done)
+	}
+	r.next = func(e *Entry) error {
+		if r.closed() {
+			return io.EOF
+		}
+		pick := -1
+		for i := range chans {
+			if heads[i] == nil && chans[i] != nil {
+				res, ok := <-chans[i]
+				if !ok {
+					chans[i] = nil
+					continue
+				}
+				if res.err != nil {
+					return res.err
+				}
+				heads[i] = &res
+			}
+			if heads[i] == nil {
+				continue
+			}
+			// on ties, the head of the first reader is kept
+			if pick < 0 || before(heads[i].entry, heads[pick].entry) {
+				pick = i
+			}
+		}
+		if pick < 0 {
+			return io.EOF
+		}
+		r.take(e, heads[pick].entry)
+		heads[pick] = nil
+		return nil
+	}
+	return r
+}
+
+// Concat creates a Reader giving the entries of rs one reader after the other.
+// Up to jobs readers are parsed at the same time in their own goroutine while
+// the entries of the first ones are consumed.
+func Concat(jobs int, rs ...*Reader) *Reader {
+	if jobs <= 0 {
+		jobs = 1
+	}
+	var (
+		r     = combined(rs)
+		sem   = make(chan struct{}, jobs)
+		chans = make(chan (<-chan readResult), len(rs))
+		curr  <-chan readResult
+	)
+	go func() {
+		defer close(chans)
+		// readers are started in order so that the one being consumed never
+		// waits after a slot taken by the next ones
+		for i := range rs {
+			select {
+			case sem <- struct{}{}:
+			case <-r.done:
+				return
+			}
+			chans <- readAll(rs[i], sem, r.done)
+		}
+	}()
+	r.next = func(e *Entry) error {
+		for {
+			if r.closed() {
+				return io.EOF
+			}
+			if curr == nil {
+				c, ok := <-chans
+				if !ok {
+					return io.EOF
+				}
+				curr = c
+			}
+			res, ok := <-curr
+			if !ok {
+				curr = nil
+				continue
+			}
+			if res.err != nil {
+				return res.err
+			}
+			r.take(e, res.entry)
+			return nil
+		}
+	}
+	return r
+}
+
+func combined(rs []*Reader) *Reader {
+	r, _ := newReader(nil, "", nil)
+	r.inputs = rs
+	r.done = make(chan struct{})
+	return r
+}
+
+// Close stops the goroutines parsing the readers given to Merge or Concat,
+// that would wait forever when the entries are not all read, and closes these
+// readers. The inputs of the readers are not closed. Close does nothing for
+// the other Readers.
+func (r *Reader) Close() error {
+	if r.done == nil || r.closed() {
+		return nil
+	}
+	close(r.done)
+	for _, x := range r.inputs {
+		x.Close()
+	}
+	return nil
+}
+
+func (r *Reader) closed() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// readAll sends the entries of r to the returned channel and closes it at the
+// end of r or when done is closed. A slot is released from sem when r is
+// exhausted.
+func readAll(r *Reader, sem, done chan struct{}) <-chan readResult {
+	ch := make(chan readResult, readAhead)
+	go func() {
+		defer close(ch)
+		if sem != nil {
+			defer func() { <-sem }()
+		}
+		for {
+			e, err := r.Read()
+			if err == io.EOF {
+				return
+			}
+			select {
+			case ch <- readResult{entry: e, err: err}:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// take replaces e by an entry of one of the combined readers.
+func (r *Reader) take(e *Entry, other Entry) {
+	putEntry(*e)
+	*e = other
+	r.lino++
+	e.Seq = r.lino
+}
+
+func before(e, other Entry) bool {
+	if e.When.IsZero() || other.When.IsZero() {
+		return e.When.IsZero() && !other.When.IsZero()
+	}
+	return e.When.Before(other.When)
+}
@@ -0,0 +1,47 @@
+package log
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCombinedClose(t *testing.T) {
+	var str strings.Builder
+	for i := 0; i < 10*readAhead; i++ {
+		fmt.Fprintf(&str, "2024-01-01T10:00:%02dZ info message %d\n", i%60, i)
+	}
+	combine := map[string]func(...*Reader) *Reader{
+		"merge": Merge,
+		"concat": func(rs ...*Reader) *Reader {
+			return Concat(1, rs...)
+		},
+	}
+	for name, fn := range combine {
+		before := runtime.NumGoroutine()
+		var rs []*Reader
+		for i := 0; i < 4; i++ {
+			r, err := NewReader(strings.NewReader(str.String()), "%t %l %m", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			rs = append(rs, r)
+		}
+		r := fn(rs...)
+		if _, err := r.Read(); err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+		if _, err := r.Read(); err == nil {
+			t.Errorf("%s: entry read after Close", name)
+		}
+		for i := 0; runtime.NumGoroutine() > before; i++ {
+			if i >= 100 {
+				t.Fatalf("%s: %d goroutines left running", name, runtime.NumGoroutine()-before)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
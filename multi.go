@@ -0,0 +1,62 @@
+package log
+
+// Discard is a Writer on which all Write calls succeed without doing anything.
+var Discard Writer = discard{}
+
+type discard struct{}
+
+func (discard) Write(Entry) error {
+	return nil
+}
+
+type multiWriter struct {
+	writers []Writer
+}
+
+// MultiWriter creates a Writer that duplicates its writes to all the provided
+// writers. If one of them returns an error, the write stops and the error is
+// returned. Flush and Close are given to all the writers that support them.
+func MultiWriter(ws ...Writer) Writer {
+	var all []Writer
+	for _, w := range ws {
+		if m, ok := w.(*multiWriter); ok {
+			all = append(all, m.writers...)
+		} else {
+			all = append(all, w)
+		}
+	}
+	return &multiWriter{writers: all}
+}
+
+func (m *multiWriter) Write(e Entry) error {
+	for _, w := range m.writers {
+		if err := w.Write(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *multiWriter) Flush() error {
+	var err error
+	for _, w := range m.writers {
+		f, ok := w.(interface{ Flush() error })
+		if !ok {
+			continue
+		}
+		if e := f.Flush(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (m *multiWriter) Close() error {
+	var err error
+	for _, w := range m.writers {
+		if e := CloseWriter(w); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,88 @@
+package log
+
+import (
+	"strings"
+	"sync"
+)
+
+// Pattern is a compiled input pattern parsing single lines without a Reader.
+type Pattern struct {
+	source string
+	strict bool
+	// the parse functions keep the state of the line being parsed
+	parsers sync.Pool
+}
+
+// CompilePattern compiles an input pattern or the name of an input preset.
+// Only the options changing how the lines are parsed are used (WithLocation,
+// WithYear and WithStrict).
+func CompilePattern(pattern string, opts ...Option) (*Pattern, error) {
+	r, err := newReader(nil, "", opts)
+	if err != nil {
+		return nil, err
+	}
+	r.cfg.single = true
+	source := lookupPreset(KindInput, pattern)
+	parse, err := parsePattern(source, r.cfg)
+	if err != nil {
+		return nil, err
+	}
+	p := Pattern{
+		source: pattern,
+		strict: r.cfg.strict,
+	}
+	p.parsers.New = func() interface{} {
+		parse, _ := parsePattern(source, r.cfg)
+		return parse
+	}
+	p.parsers.Put(parse)
+	return &p, nil
+}
+
+// Parse parses line into an Entry. The error is a MatchError, matched by
+// ErrPattern, if the line does not match the pattern. Parse can be called by
+// several goroutines and the lines are parsed independently: the year of the
+// times without one is guessed for each line.
+func (p *Pattern) Parse(line string) (Entry, error) {
+	parse := p.parsers.Get().(parsefunc)
+	defer p.parsers.Put(parse)
+	e := Entry{Line: line}
+	if err := parse(&e, newScanner([]byte(line))); err != nil {
+		return Entry{}, err
+	}
+	return e, nil
+}
+
+func (p *Pattern) String() string {
+	return p.source
+}
+
+// Output is a compiled output pattern formatting entries without a Writer.
+type Output struct {
+	source string
+	print  printfunc
+}
+
+// CompileOutput compiles an output pattern or the name of an output preset.
+func CompileOutput(pattern string) (*Output, error) {
+	print, err := parsePrint(lookupPreset(KindOutput, pattern))
+	if err != nil {
+		return nil, err
+	}
+	o := Output{
+		source: pattern,
+		print:  print,
+	}
+	return &o, nil
+}
+
+// Format gives the text of e, without a trailing newline.
+func (o *Output) Format(e Entry) string {
+	var str strings.Builder
+	o.print(e, &str)
+	return str.String()
+}
+
+func (o *Output) String() string {
+	return o.source
+}
@@ -0,0 +1,53 @@
+package log
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPatternParseIndependent(t *testing.T) {
+	p, err := CompilePattern("%t(%b %d %H:%M:%S) %m", WithYear(2023), WithLocation(time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		for _, line := range []string{"Dec 31 23:59:59 last", "Jan 01 00:00:00 first"} {
+			e, err := p.Parse(line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if y := e.When.Year(); y != 2023 {
+				t.Errorf("%q: got year %d, want 2023", line, y)
+			}
+		}
+	}
+}
+
+func TestPatternParseConcurrent(t *testing.T) {
+	p, err := CompilePattern("%t %l [%n:%p] %m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			when := time.Date(2024, time.Month(i+1), i+1, i, i, i, 0, time.UTC)
+			line := when.Format(time.RFC3339) + " info [proc:42] message"
+			for j := 0; j < 1000; j++ {
+				e, err := p.Parse(line)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if !e.When.Equal(when) || e.Pid != 42 {
+					t.Errorf("%q: got %s %d", line, e.When, e.Pid)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
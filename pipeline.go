@@ -0,0 +1,261 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+type Stage func(Entry) (Entry, bool)
+
+// ErrorPolicy tells what a Pipeline does when a writer fails. By default, the
+// first error stops the Pipeline.
+type ErrorPolicy struct {
+	// Retries is the number of times a failed write is tried again, waiting
+	// Backoff before the first retry and twice as long before each next one,
+	// up to MaxBackoff when it is set.
+	Retries    int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Skip drops the entry once all its writes failed, or when it can not be
+	// rewritten, and goes on with the next entries instead of stopping the
+	// Pipeline. OnSkip is then called with the entry and the error.
+	Skip   bool
+	OnSkip func(Entry, error)
+}
+
+type Pipeline struct {
+	reader  *Reader
+	stages  []Stage
+	writers []Writer
+	reuse   bool
+	policy  ErrorPolicy
+	err     error
+	// failed is the error of a stage stopping the Pipeline
+	failed error
+}
+
+func NewPipeline(r *Reader) *Pipeline {
+	return &Pipeline{reader: r}
+}
+
+func (p *Pipeline) Stage(s Stage) *Pipeline {
+	p.stages = append(p.stages, s)
+	return p
+}
+
+func (p *Pipeline) Filter(expr string) *Pipeline {
+	keep, err := parseFilter(expr)
+	if err != nil {
+		p.setError(err)
+		return p
+	}
+	return p.Stage(func(e Entry) (Entry, bool) {
+		return e, keep(e)
+	})
+}
+
+func (p *Pipeline) Transform(fn func(Entry) Entry) *Pipeline {
+	return p.Stage(func(e Entry) (Entry, bool) {
+		return fn(e), true
+	})
+}
+
+// Rewrite applies the transform statements of expr to the entries (see
+// CompileTransform). An entry that can not be rewritten stops the Pipeline, or
+// is dropped according to the ErrorPolicy.
+func (p *Pipeline) Rewrite(expr string) *Pipeline {
+	fn, err := CompileTransform(expr)
+	if err != nil {
+		p.setError(err)
+		return p
+	}
+	return p.Stage(func(e Entry) (Entry, bool) {
+		other, err := fn(e)
+		if err == nil {
+			return other, true
+		}
+		if !p.policy.Skip {
+			p.failed = err
+		} else if p.policy.OnSkip != nil {
+			p.policy.OnSkip(e, err)
+		}
+		return e, false
+	})
+}
+
+// Anonymize replaces the values of fields by pseudonyms (see Anonymize).
+func (p *Pipeline) Anonymize(key []byte, fields ...string) *Pipeline {
+	fn, err := Anonymize(key, fields...)
+	if err != nil {
+		p.setError(err)
+		return p
+	}
+	return p.Transform(fn)
+}
+
+func (p *Pipeline) Dedupe(fields ...string) *Pipeline {
+	if len(fields) == 0 {
+		fields = []string{"message"}
+	}
+	for _, f := range fields {
+		if !isField(f) {
+			p.setError(fmt.Errorf("%s: unknown field", f))
+			return p
+		}
+	}
+	var last []string
+	return p.Stage(func(e Entry) (Entry, bool) {
+		var (
+			curr = make([]string, len(fields))
+			same = last != nil
+		)
+		for i, f := range fields {
+			curr[i] = fieldString(getField(e, f))
+			same = same && curr[i] == last[i]
+		}
+		last = curr
+		return e, !same
+	})
+}
+
+func (p *Pipeline) Sample(every int) *Pipeline {
+	if every <= 0 {
+		p.setError(fmt.Errorf("sample: %d: invalid value", every))
+		return p
+	}
+	var count int
+	return p.Stage(func(e Entry) (Entry, bool) {
+		count++
+		return e, (count-1)%every == 0
+	})
+}
+
+func (p *Pipeline) RateLimit(limit int, per time.Duration) *Pipeline {
+	if limit <= 0 || per <= 0 {
+		p.setError(fmt.Errorf("ratelimit: %d/%s: invalid rate", limit, per))
+		return p
+	}
+	var (
+		window time.Time
+		count  int
+	)
+	return p.Stage(func(e Entry) (Entry, bool) {
+		if when := e.When.Truncate(per); !when.Equal(window) {
+			window, count = when, 0
+		}
+		count++
+		return e, count <= limit
+	})
+}
+
+// Reuse makes the Pipeline read all the entries into the same Entry to save
+// allocations. It can only be used when the stages and the writers do not keep
+// the entries (or their Named, Values and Words) once they are processed.
+func (p *Pipeline) Reuse() *Pipeline {
+	p.reuse = true
+	return p
+}
+
+// OnError sets what the Pipeline does when a writer fails. Writes failing with
+// ErrClosed are never tried again.
+func (p *Pipeline) OnError(policy ErrorPolicy) *Pipeline {
+	p.policy = policy
+	return p
+}
+
+func (p *Pipeline) To(ws ...Writer) *Pipeline {
+	p.writers = append(p.writers, ws...)
+	return p
+}
+
+// Close closes the writers of the Pipeline (see CloseWriter) and gives the
+// first error.
+func (p *Pipeline) Close() error {
+	var err error
+	for _, w := range p.writers {
+		if e := CloseWriter(w); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (p *Pipeline) Run() error {
+	if p.err != nil {
+		return p.err
+	}
+	if p.reuse {
+		return p.runInto()
+	}
+	for {
+		e, err := p.reader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if err := p.process(e); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *Pipeline) runInto() error {
+	e := getEntry()
+	defer putEntry(*e)
+	for {
+		if err := p.reader.ReadInto(e); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if err := p.process(*e); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *Pipeline) process(e Entry) error {
+	for _, s := range p.stages {
+		var keep bool
+		if e, keep = s(e); !keep {
+			return p.failed
+		}
+	}
+	for _, w := range p.writers {
+		if err := p.write(w, e); err != nil {
+			if !p.policy.Skip {
+				return err
+			}
+			if p.policy.OnSkip != nil {
+				p.policy.OnSkip(e, err)
+			}
+		}
+	}
+	return nil
+}
+
+// write writes e to w, trying again according to the ErrorPolicy.
+func (p *Pipeline) write(w Writer, e Entry) error {
+	wait := p.policy.Backoff
+	for i := 0; ; i++ {
+		err := w.Write(e)
+		if err == nil || i >= p.policy.Retries || errors.Is(err, ErrClosed) {
+			return err
+		}
+		time.Sleep(wait)
+		if wait *= 2; p.policy.MaxBackoff > 0 && wait > p.policy.MaxBackoff {
+			wait = p.policy.MaxBackoff
+		}
+	}
+}
+
+func (p *Pipeline) setError(err error) {
+	if p.err == nil {
+		p.err = err
+	}
+}
@@ -0,0 +1,60 @@
+package log
+
+import (
+	"sync"
+)
+
+// pools of the maps and slices of the entries. They are filled by the
+// entries released by Reader.Release and by the Pipeline.
+var (
+	namedPool  sync.Pool
+	valuesPool sync.Pool
+	wordsPool  sync.Pool
+)
+
+func getEntry() *Entry {
+	return &Entry{
+		Named:  getNamed(),
+		Values: getValues(),
+		Words:  getWords(),
+	}
+}
+
+func putEntry(e Entry) {
+	if e.Named != nil {
+		for k := range e.Named {
+			delete(e.Named, k)
+		}
+		namedPool.Put(e.Named)
+	}
+	if e.Values != nil {
+		for k := range e.Values {
+			delete(e.Values, k)
+		}
+		valuesPool.Put(e.Values)
+	}
+	if e.Words != nil {
+		wordsPool.Put(e.Words[:0])
+	}
+}
+
+func getNamed() map[string]string {
+	if m, ok := namedPool.Get().(map[string]string); ok {
+		return m
+	}
+	return nil
+}
+
+func getValues() map[string]interface{} {
+	if m, ok := valuesPool.Get().(map[string]interface{}); ok {
+		return m
+	}
+	return nil
+}
+
+func getWords() []string {
+	if ws, ok := wordsPool.Get().([]string); ok {
+		return ws
+	}
+	return nil
+}
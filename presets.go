@@ -0,0 +1,281 @@
+package log
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// presets are named patterns for well known log formats. A preset can be used
+// everywhere a pattern is expected by giving its name instead of the pattern.
+// Time presets are used the same way for the time patterns (eg, %t(rfc3339)).
+
+const (
+	KindInput  = "input"
+	KindOutput = "output"
+	KindTime   = "time"
+)
+
+// PresetInfo describes a preset. Start lists the beginning of the first line
+// of the entries of the input presets whose entries span several lines (see
+// WithRecordStart).
+type PresetInfo struct {
+	Name    string
+	Kind    string
+	Pattern string
+	Example string
+	Start   []string
+}
+
+const syslogPrefix = "%t(%b %d %H:%M:%S) %h(%h) "
+
+var builtinPresets = []PresetInfo{
+	{
+		Name:    "iso8601",
+		Kind:    KindTime,
+		Pattern: rfcPattern,
+	},
+	{
+		Name:    "rfc3339",
+		Kind:    KindTime,
+		Pattern: rfcPattern,
+	},
+	{
+		Name:    "rfc822",
+		Kind:    KindTime,
+		Pattern: "%a, %d %b %y %H:%M:%S %Z",
+	},
+	{
+		Name:    "syslog",
+		Kind:    KindTime,
+		Pattern: "%b %d %H:%M:%S",
+	},
+	{
+		Name:    "apache",
+		Kind:    KindTime,
+		Pattern: "%d/%b/%y:%H:%M:%S %Z",
+	},
+	{
+		Name:    "unix",
+		Kind:    KindTime,
+		Pattern: "%s",
+	},
+	{
+		Name: "haproxy",
+		Kind: KindInput,
+		Pattern: syslogPrefix + "%n[%p]: %w(client) [%t(%d/%b/%y:%H:%M:%S.%f)] %w(frontend) %w(backend)/%w(server) " +
+			"%w(tq)/%w(tw)/%w(tc)/%w(tr)/%w(ta) %w(status) %w(bytes) %w(request_cookie) %w(response_cookie) " +
+			"%w(termination_state) %w(actconn)/%w(feconn)/%w(beconn)/%w(srv_conn)/%w(retries) " +
+			"%w(srv_queue)/%w(backend_queue) @({%w(request_headers)} {%w(response_headers)} |{%w(request_headers)} |)%m",
+		Example: `Feb  6 12:14:14 localhost haproxy[14389]: 10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in static/srv1 10/0/30/69/109 200 2750 - - ---- 1/1/1/1/0 0/0 {1wt.eu} {} "GET /index.html HTTP/1.1"`,
+	},
+	{
+		Name:    "postfix",
+		Kind:    KindInput,
+		Pattern: syslogPrefix + "postfix/%n[%p]: @(%w(queue_id): %k|)%m",
+		Example: "Oct  3 13:20:02 mail postfix/smtp[2346]: 4F9D21C0A2: to=<bob@example.com>, relay=mx.example.com[1.2.3.4]:25, status=sent (250 OK)",
+	},
+	{
+		Name:    "syslog",
+		Kind:    KindInput,
+		Pattern: syslogPrefix + "%n@([%p]|): %m",
+		Example: "Oct  3 13:20:02 web01 sshd[2346]: Accepted publickey for bob from 10.0.0.2 port 51234",
+	},
+	{
+		Name:    "rfc3164",
+		Kind:    KindInput,
+		Pattern: "%P" + syslogPrefix + "%n@([%p]|): %m",
+		Example: "<34>Oct 11 22:14:15 mymachine su[230]: 'su root' failed for lonvick on /dev/pts/8",
+	},
+	{
+		Name:    "clf",
+		Kind:    KindInput,
+		Pattern: `%h %w(ident) %w(user) [%t(%d/%b/%y:%H:%M:%S %Z)] "%R" %w(status) %w(bytes)`,
+		Example: `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`,
+	},
+	{
+		Name:    "combined",
+		Kind:    KindInput,
+		Pattern: `%h %w(ident) %w(user) [%t(%d/%b/%y:%H:%M:%S %Z)] "%R" %w(status) %w(bytes) %w(referer) %w(agent)`,
+		Example: `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08"`,
+	},
+	{
+		Name:    "klog",
+		Kind:    KindInput,
+		Pattern: "%l(I,W,E,F)%t(%m%d %H:%M:%S.%f)%b%p %w(source)] %m",
+		Example: "I0102 15:04:05.123456    1234 server.go:42] listening on :8080",
+	},
+	{
+		Name:    "go",
+		Kind:    KindInput,
+		Pattern: "%t(%y/%m/%d %H:%M:%S%F) %m",
+		Example: "2009/11/10 23:00:00 listening on :8080",
+	},
+	{
+		Name:    "slog",
+		Kind:    KindInput,
+		Pattern: "%K",
+		Example: `time=2023-08-04T16:09:59.595-04:00 level=INFO msg="request done" method=GET status=200`,
+	},
+	{
+		Name:    "slog-json",
+		Kind:    KindInput,
+		Pattern: "%J",
+		Example: `{"time":"2023-08-04T16:09:59.595-04:00","level":"INFO","msg":"request done","method":"GET","status":200}`,
+	},
+	{
+		Name: "mysql-slow",
+		Kind: KindInput,
+		Pattern: `@(# Time: %t\n|)# User\@Host: %u[%*] \@ %*[%w(client)]%*\n` +
+			`# Query_time: %w(query_time:duration:s)%bLock_time: %w(lock_time:duration:s)%b` +
+			`Rows_sent: %w(rows_sent:int)%bRows_examined: %w(rows_examined:int)%*\n%m`,
+		Example: "# Time: 2024-01-01T10:00:00.123456Z\n# User@Host: app[app] @ db1 [10.0.0.5]  Id:     8\n" +
+			"# Query_time: 2.000150  Lock_time: 0.000010 Rows_sent: 1  Rows_examined: 100000\n" +
+			"SET timestamp=1704103200;\nselect count(*) from orders;",
+		Start: []string{"# Time:", "# User@Host:"},
+	},
+	{
+		Name: "postgres",
+		Kind: KindInput,
+		Pattern: "%t(%y-%m-%d %H:%M:%S%F %Z) [%p] @(%u\\@%w(database) |)%l:%b" +
+			"@(duration: %w(duration:duration:ms) ms%b|)%m",
+		Example: "2024-01-01 10:00:00.123 UTC [4242] app@shop LOG:  duration: 1503.221 ms  statement: select * from orders",
+	},
+	{
+		Name: "heroku",
+		Kind: KindInput,
+		Pattern: "@(%w(length:int) <%w(priority:int)>1 |<%w(priority:int)>1 |)%t " +
+			"@(%n[%w(dyno)]: |%h %n[%w(dyno)]: |%h %n %w(dyno) - )%m",
+		Example: "83 <40>1 2012-11-30T06:45:29+00:00 host app web.3 - State changed from starting to up",
+	},
+	{
+		Name:    "cloudwatch",
+		Kind:    KindInput,
+		Pattern: "%t @(%t\t%w(request_id)\t%l\t|)%m",
+		Example: "2021-03-01T10:00:00.123Z 2021-03-01T10:00:00.123Z\t8f5e0c2a-5b1e-4b9e-9d1a-3c2f1e0d4b5a\tINFO\tprocessing order 42",
+	},
+	{
+		Name:    "cloudwatch-tail",
+		Kind:    KindInput,
+		Pattern: "%t %w(stream) @(%t\t%w(request_id)\t%l\t|)%m",
+		Example: "2021-03-01T10:00:00.123000+00:00 2021/03/01/[$LATEST]0f1e2d3c4b5a START RequestId: 8f5e0c2a-5b1e-4b9e-9d1a-3c2f1e0d4b5a Version: $LATEST",
+	},
+	{
+		Name:    "default",
+		Kind:    KindOutput,
+		Pattern: DefaultPattern,
+	},
+	{
+		Name:    "syslog",
+		Kind:    KindOutput,
+		Pattern: "%t(%b %d %H:%M:%S) %h %n[%p]: %m",
+	},
+	{
+		Name:    "short",
+		Kind:    KindOutput,
+		Pattern: "%t(%H:%M:%S) %l %m",
+	},
+}
+
+var presets = struct {
+	sync.RWMutex
+	infos map[string]map[string]PresetInfo
+}{
+	infos: map[string]map[string]PresetInfo{
+		KindInput:  make(map[string]PresetInfo),
+		KindOutput: make(map[string]PresetInfo),
+		KindTime:   make(map[string]PresetInfo),
+	},
+}
+
+func init() {
+	for _, p := range builtinPresets {
+		if err := RegisterPreset(p); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func RegisterPreset(p PresetInfo) error {
+	var err error
+	switch p.Kind {
+	case KindInput:
+		_, err = parsePattern(p.Pattern, config{})
+	case KindOutput:
+		_, err = parsePrint(p.Pattern)
+	case KindTime:
+		if _, err = parseTimePattern(p.Pattern); err == nil {
+			_, err = formatTimePattern(p.Pattern)
+		}
+	default:
+		err = fmt.Errorf("%s: unknown preset kind", p.Kind)
+	}
+	if err != nil {
+		return err
+	}
+	presets.Lock()
+	defer presets.Unlock()
+	presets.infos[p.Kind][p.Name] = p
+	return nil
+}
+
+func Presets() []PresetInfo {
+	presets.RLock()
+	defer presets.RUnlock()
+	var list []PresetInfo
+	for _, ps := range presets.infos {
+		for _, p := range ps {
+			if p.Kind == KindOutput && p.Example == "" {
+				p.Example = exampleOutput(p.Pattern)
+			}
+			if p.Kind == KindTime && p.Example == "" {
+				p.Example = exampleOutput("%t(" + p.Pattern + ")")
+			}
+			list = append(list, p)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Kind == list[j].Kind {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].Kind < list[j].Kind
+	})
+	return list
+}
+
+func lookupPreset(kind, pattern string) string {
+	if p, ok := findPreset(kind, pattern); ok {
+		return p.Pattern
+	}
+	return pattern
+}
+
+func findPreset(kind, name string) (PresetInfo, bool) {
+	presets.RLock()
+	defer presets.RUnlock()
+	p, ok := presets.infos[kind][name]
+	return p, ok
+}
+
+var exampleEntry = Entry{
+	Pid:     4200,
+	Process: "nginx",
+	User:    "www",
+	Group:   "www",
+	Level:   "INFO",
+	Message: "worker process started",
+	Host:    "web01",
+	When:    time.Date(2021, 3, 1, 8, 0, 2, 0, time.UTC),
+}
+
+func exampleOutput(pattern string) string {
+	print, err := parsePrint(pattern)
+	if err != nil {
+		return ""
+	}
+	var str strings.Builder
+	print(exampleEntry, &str)
+	return str.String()
+}
@@ -0,0 +1,116 @@
+package log
+
+import (
+	"math"
+	"sort"
+)
+
+// digest is a merging t-digest: an approximation of the distribution of a
+// stream of values using a bounded number of centroids. Centroids near the
+// extremes hold few values so that the high quantiles (p95, p99) stay
+// accurate.
+type digest struct {
+	compression float64
+	centroids   []centroid
+	buffer      []centroid
+	total       float64
+	min         float64
+	max         float64
+}
+
+type centroid struct {
+	mean  float64
+	count float64
+}
+
+const defaultCompression = 100
+
+func newDigest(compression float64) *digest {
+	return &digest{
+		compression: compression,
+		min:         math.Inf(1),
+		max:         math.Inf(-1),
+	}
+}
+
+func (d *digest) Add(v float64) {
+	if math.IsNaN(v) {
+		return
+	}
+	d.buffer = append(d.buffer, centroid{mean: v, count: 1})
+	d.total++
+	d.min = math.Min(d.min, v)
+	d.max = math.Max(d.max, v)
+	if len(d.buffer) >= int(d.compression)*5 {
+		d.merge()
+	}
+}
+
+func (d *digest) merge() {
+	if len(d.buffer) == 0 {
+		return
+	}
+	all := append(d.centroids, d.buffer...)
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].mean < all[j].mean
+	})
+	var (
+		list  = []centroid{all[0]}
+		below float64
+	)
+	for _, c := range all[1:] {
+		cur := &list[len(list)-1]
+		q := (below + cur.count + c.count) / d.total
+		if d.scale(q)-d.scale(below/d.total) <= 1 {
+			cur.count += c.count
+			cur.mean += (c.mean - cur.mean) * c.count / cur.count
+			continue
+		}
+		below += cur.count
+		list = append(list, c)
+	}
+	d.centroids = list
+	d.buffer = d.buffer[:0]
+}
+
+// scale is the k1 scale function of the t-digest.
+func (d *digest) scale(q float64) float64 {
+	return d.compression / (2 * math.Pi) * math.Asin(2*math.Min(q, 1)-1)
+}
+
+// Quantile gives the approximate value below which q (between 0 and 1) of the
+// values fall.
+func (d *digest) Quantile(q float64) float64 {
+	d.merge()
+	if len(d.centroids) == 0 {
+		return 0
+	}
+	switch {
+	case q <= 0:
+		return d.min
+	case q >= 1:
+		return d.max
+	}
+	var (
+		cs     = d.centroids
+		target = q * d.total
+		first  = cs[0]
+		last   = cs[len(cs)-1]
+	)
+	if target < first.count/2 {
+		return interpolate(d.min, first.mean, target/(first.count/2))
+	}
+	center := first.count / 2
+	for i := 0; i < len(cs)-1; i++ {
+		next := center + (cs[i].count+cs[i+1].count)/2
+		if target <= next {
+			return interpolate(cs[i].mean, cs[i+1].mean, (target-center)/(next-center))
+		}
+		center = next
+	}
+	return interpolate(last.mean, d.max, (target-center)/(d.total-center))
+}
+
+func interpolate(from, to, frac float64) float64 {
+	return from + (to-from)*frac
+}
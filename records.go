@@ -0,0 +1,117 @@
+package log
+
+import (
+	"bytes"
+)
+
+// maxRecord is the maximum size of a record.
+const maxRecord = 1 << 20
+
+// recordSplit cuts the input in records separated by blank lines or starting
+// at the lines beginning with one of starts. It keeps the offset and the
+// number of the first line of the last record given.
+type recordSplit struct {
+	starts []string
+	pos    int64
+	lines  int
+	start  int64
+	line   int
+}
+
+func (s *recordSplit) split(data []byte, atEOF bool) (int, []byte, error) {
+	if len(s.starts) > 0 {
+		return s.splitStart(data, atEOF)
+	}
+	var (
+		start = -1
+		first int
+		lines int
+	)
+	for i := 0; i < len(data); {
+		end := bytes.IndexByte(data[i:], '\n')
+		if end < 0 && !atEOF {
+			break
+		}
+		next := len(data)
+		if end >= 0 {
+			end += i
+			next = end + 1
+		} else {
+			end = len(data)
+		}
+		blank := len(bytes.TrimSpace(data[i:end])) == 0
+		switch {
+		case blank && start < 0:
+		case blank:
+			return s.take(data[start:i], i, start, first, lines)
+		case start < 0:
+			start, first = i, lines
+		}
+		i = next
+		lines++
+	}
+	if start < 0 {
+		// only blank lines so far
+		if n := bytes.LastIndexByte(data, '\n') + 1; n > 0 || (atEOF && len(data) > 0) {
+			if atEOF {
+				n = len(data)
+			}
+			s.pos += int64(n)
+			s.lines += bytes.Count(data[:n], []byte{'\n'})
+			return n, nil, nil
+		}
+		return 0, nil, nil
+	}
+	if atEOF {
+		return s.take(data[start:], len(data), start, first, lines)
+	}
+	return 0, nil, nil
+}
+
+func (s *recordSplit) splitStart(data []byte, atEOF bool) (int, []byte, error) {
+	var (
+		header = true
+		lines  int
+	)
+	for i := 0; i < len(data); {
+		end := bytes.IndexByte(data[i:], '\n')
+		if end < 0 && !atEOF {
+			break
+		}
+		next := len(data)
+		if end >= 0 {
+			end += i
+			next = end + 1
+		} else {
+			end = len(data)
+		}
+		start := s.isStart(data[i:end])
+		if i > 0 && start && !header {
+			return s.take(data[:i], i, 0, 0, lines)
+		}
+		header = header && start
+		i = next
+		lines++
+	}
+	if atEOF && len(data) > 0 {
+		return s.take(data, len(data), 0, 0, lines)
+	}
+	return 0, nil, nil
+}
+
+func (s *recordSplit) isStart(line []byte) bool {
+	for _, p := range s.starts {
+		if bytes.HasPrefix(line, []byte(p)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *recordSplit) take(record []byte, advance, start, first, lines int) (int, []byte, error) {
+	s.start = s.pos + int64(start)
+	s.line = s.lines + first + 1
+	s.pos += int64(advance)
+	s.lines += lines
+	return advance, bytes.TrimRight(record, "\r\n"), nil
+}
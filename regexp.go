@@ -0,0 +1,481 @@
+package log
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Regexp gives a regular expression equivalent to the pattern for the tools
+// not knowing the patterns (eg, Grafana or grok), so that a pattern can be
+// maintained in one place. The fields are captured by named groups: time,
+// process, pid, user, group, host, level, message and the named words, with
+// a suffix (_2, _3,...) when a field is captured more than once (eg, in the
+// branches of @(a|b), or for the quoted and unquoted forms of a %w). The
+// fields of the groups are given in their order, the named words with their
+// named. prefix.
+//
+// The regular expression only checks the shape of the values (eg, two digits
+// for a month, digits for a word typed as int) and can match lines rejected
+// by the pattern. It is nil when the pattern has specifiers added with
+// RegisterSpecifier.
+func (p *Pattern) Regexp() (*regexp.Regexp, []string) {
+	b := regexpBuilder{
+		groups: make(map[string]int),
+	}
+	b.buf.WriteString("^")
+	str := bytes.NewReader([]byte(strings.TrimPrefix(lookupPreset(KindInput, p.source), "^")))
+	if _, err := b.pattern(str, func(r rune) bool { return r == 0 }); err != nil {
+		return nil, nil
+	}
+	if p.strict {
+		b.buf.WriteString("$")
+	}
+	re, err := regexp.Compile(b.buf.String())
+	if err != nil {
+		return nil, nil
+	}
+	return re, b.fields
+}
+
+// regexpBuilder translates the patterns into regular expressions, following
+// parsePatternUntil and parseSpecifier.
+type regexpBuilder struct {
+	buf    strings.Builder
+	fields []string
+	groups map[string]int
+}
+
+const (
+	alphaRegexp = `[0-9A-Za-z_-]`
+	pairsRegexp = `(?:[0-9A-Za-z_.-]+=(?:"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'|[^\s,]*),?[ \t]*)*`
+)
+
+// group captures in a group the expression written by fn for field.
+func (b *regexpBuilder) group(field string, fn func() error) error {
+	name := strings.Map(func(r rune) rune {
+		if isDigit(r) || isLetter(r) || r == '_' {
+			return r
+		}
+		return '_'
+	}, strings.TrimPrefix(field, "named."))
+	if n := b.groups[name]; n > 0 {
+		b.groups[name]++
+		name += "_" + strconv.Itoa(n+1)
+	} else {
+		b.groups[name] = 1
+	}
+	b.fields = append(b.fields, field)
+	b.buf.WriteString("(?P<" + name + ">")
+	if err := fn(); err != nil {
+		return err
+	}
+	b.buf.WriteString(")")
+	return nil
+}
+
+// capture captures expr in a group for field.
+func (b *regexpBuilder) capture(field, expr string) {
+	b.group(field, func() error {
+		b.buf.WriteString(expr)
+		return nil
+	})
+}
+
+func (b *regexpBuilder) pattern(str *bytes.Reader, until func(rune) bool) (rune, error) {
+	var lit strings.Builder
+	literal := func() {
+		b.buf.WriteString(regexp.QuoteMeta(lit.String()))
+		lit.Reset()
+	}
+	for {
+		last, _, _ := str.ReadRune()
+		if until(last) {
+			literal()
+			return last, nil
+		}
+		switch {
+		case last == '%':
+			if last, _, _ = str.ReadRune(); last == '%' {
+				lit.WriteRune(last)
+				continue
+			}
+			literal()
+			if err := b.specifier(str, last); err != nil {
+				return last, err
+			}
+		case last == '@':
+			literal()
+			if err := b.alternative(str); err != nil {
+				return last, err
+			}
+		case last == '$' && until(peek(str)):
+			literal()
+			b.buf.WriteString("$")
+		case last == '\\':
+			if last, _, _ = str.ReadRune(); last == 'n' {
+				last = '\n'
+			}
+			lit.WriteRune(last)
+		default:
+			lit.WriteRune(last)
+		}
+	}
+}
+
+func (b *regexpBuilder) alternative(str *bytes.Reader) error {
+	if r, _, _ := str.ReadRune(); r != '(' {
+		return syntaxError("", "missing (")
+	}
+	until := func(r rune) bool { return r == '|' || r == ')' }
+	b.buf.WriteString("(?:")
+	for {
+		parseBranchName(str)
+		last, err := b.pattern(str, until)
+		if err != nil {
+			return err
+		}
+		switch last {
+		case '|':
+			b.buf.WriteString("|")
+		case ')':
+			b.buf.WriteString(")")
+			return nil
+		default:
+			return syntaxError("", "unexpected character %c", last)
+		}
+	}
+}
+
+func (b *regexpBuilder) specifier(str *bytes.Reader, r rune) error {
+	switch r {
+	case 't':
+		arg, err := parseArgument(str, rfcPattern, "time")
+		if err != nil {
+			return err
+		}
+		return b.group("time", func() error {
+			return b.time(arg)
+		})
+	case 'b':
+		b.buf.WriteString(`[ \t]*`)
+	case 'n':
+		b.capture("process", alphaRegexp+"*")
+	case 'p':
+		b.capture("pid", `\d+`)
+	case 'u':
+		b.capture("user", alphaRegexp+"*")
+	case 'g':
+		b.capture("group", alphaRegexp+"*")
+	case 'h':
+		arg, err := parseArgument(str, "%f", "host")
+		if err != nil {
+			return err
+		}
+		return b.group("host", func() error {
+			return b.host(arg)
+		})
+	case 'l':
+		arg, err := parseArgument(str, "-", "level")
+		if err != nil {
+			return err
+		}
+		expr := `[A-Za-z]*`
+		if arg = strings.Trim(arg, " -"); arg != "" {
+			var list []string
+			for _, l := range strings.Split(arg, ",") {
+				list = append(list, regexp.QuoteMeta(strings.TrimSpace(l)))
+			}
+			expr = "(?:" + strings.Join(list, "|") + ")"
+		}
+		b.capture("level", expr)
+	case 'm':
+		b.capture("message", "(?s:.*)")
+	case 'w':
+		var name, typed string
+		if peek(str) == '(' {
+			arg, err := parseArgument(str, "", "word")
+			if err != nil {
+				return err
+			}
+			if name, _, err = parseCapture(arg, config{}); err != nil {
+				return err
+			}
+			typed = typedRegexp(arg)
+		}
+		stop := peekLiteral(str)
+		if isBlank(stop) || stop == '%' {
+			stop = 0
+		}
+		class := `\s`
+		if stop != 0 && stop != '\n' {
+			class += regexpClass(stop)
+		}
+		// the quotes of the words are not part of their values
+		values := []string{`[^"]*`, `[^']*`, `[^` + class + `]*`}
+		if typed != "" {
+			values = []string{typed, typed, typed}
+		}
+		b.buf.WriteString("(?:")
+		for i, quote := range []string{`"`, `'`, ""} {
+			if i > 0 {
+				b.buf.WriteString("|")
+			}
+			b.buf.WriteString(quote)
+			if name == "" {
+				b.buf.WriteString(values[i])
+			} else {
+				b.capture("named."+name, values[i])
+			}
+			b.buf.WriteString(quote)
+		}
+		b.buf.WriteString(")")
+	case 'q', '[':
+		var (
+			arg string
+			err error
+		)
+		if r == '[' {
+			arg, err = parseBracketArgument(str)
+		} else if peek(str) == '(' {
+			arg, err = parseArgument(str, "", "quoted")
+		}
+		if err != nil {
+			return err
+		}
+		name, _, err := parseCapture(arg, config{})
+		if err != nil {
+			return err
+		}
+		open, expr, end := `["']`, `(?:[^"'\\]|\\.)*`, `["']`
+		if r == '[' {
+			open, expr, end = `[\[({<]\s*`, `[^\])}>]*?`, `\s*[\])}>]`
+		}
+		if typed := typedRegexp(arg); typed != "" {
+			expr = typed
+		}
+		if name == "" {
+			b.buf.WriteString(open + expr + end)
+			break
+		}
+		b.buf.WriteString(open)
+		b.capture("named."+name, expr)
+		b.buf.WriteString(end)
+	case 'k':
+		b.buf.WriteString(pairsRegexp)
+	case 'K':
+		b.buf.WriteString(".*")
+	case 'J':
+		b.buf.WriteString(`\{.*\}`)
+	case 'R':
+		b.buf.WriteString(`"?`)
+		b.capture("named.method", `[A-Z]+`)
+		b.buf.WriteString(" ")
+		b.capture("named.path", `[^\s?"]*`)
+		b.buf.WriteString(`(?:\?`)
+		b.capture("named.query", `[^\s"]*`)
+		b.buf.WriteString(`)? `)
+		b.capture("named.protocol", `HTTP/[^\s"]+`)
+		b.buf.WriteString(`"?`)
+	case 'P':
+		b.buf.WriteString(`<\d{1,3}>`)
+	case '$':
+		b.buf.WriteString("$")
+	case '*':
+		if peek(str) != '(' {
+			if next := peekLiteral(str); next != 0 && next != '%' {
+				b.buf.WriteString(`[^` + regexpClass(next) + `]*`)
+			} else {
+				b.buf.WriteString(".*?")
+			}
+			break
+		}
+		arg, err := parseArgument(str, "", "discard")
+		if err != nil {
+			return err
+		}
+		if n, err := strconv.Atoi(arg); err == nil {
+			b.buf.WriteString(".{" + strconv.Itoa(n) + "}")
+		} else {
+			b.buf.WriteString(".*?")
+		}
+	default:
+		return syntaxError("", "unsupported specifier %%%c", r)
+	}
+	return nil
+}
+
+func (b *regexpBuilder) time(pattern string) error {
+	if pattern == "" {
+		pattern = isoPattern
+	}
+	var (
+		str = bytes.NewReader([]byte(lookupPreset(KindTime, pattern)))
+		lit strings.Builder
+	)
+	for str.Len() > 0 {
+		r, _, _ := str.ReadRune()
+		if r != '%' {
+			lit.WriteRune(r)
+			continue
+		}
+		if r, _, _ = str.ReadRune(); r == '%' {
+			lit.WriteRune(r)
+			continue
+		}
+		b.buf.WriteString(regexp.QuoteMeta(lit.String()))
+		lit.Reset()
+		var expr string
+		switch r {
+		case 'I', 'R':
+			sub := isoPattern
+			if r == 'R' {
+				sub = rfcPattern
+			}
+			if err := b.time(sub); err != nil {
+				return err
+			}
+			continue
+		case 'y', 'G':
+			expr = `\d{4}`
+		case 'm', 'H', 'M', 'S':
+			expr = `\d{2}`
+		case 'd':
+			expr = `[ \d]?\d`
+		case 'j':
+			expr = `\d{3}`
+		case 'a', 'b':
+			expr = `\pL+\.?`
+		case 's', 'f':
+			expr = `\d+`
+		case 'F':
+			expr = `(?:[.,]\d+)?`
+		case 'L':
+			expr = `\d{3}`
+		case 'E':
+			expr = `\d{6}`
+		case 'N':
+			expr = `\d{9}`
+		case 'Z':
+			expr = `(?:Z|[+-]\d{2}(?::?\d{2})?|[A-Za-z]+)`
+		case 'V', 'h':
+			expr = `\d{1,2}`
+		case 'u', 'q':
+			expr = `\d`
+		case 'p':
+			expr = `[AaPp][Mm]`
+		case 'o':
+			expr = `\d{1,2}(?:st|nd|rd|th)`
+		default:
+			return syntaxError("time", "unknown specifier %c", r)
+		}
+		b.buf.WriteString(expr)
+	}
+	b.buf.WriteString(regexp.QuoteMeta(lit.String()))
+	return nil
+}
+
+func (b *regexpBuilder) host(pattern string) error {
+	var (
+		str = bytes.NewReader([]byte(pattern))
+		lit strings.Builder
+	)
+	for str.Len() > 0 {
+		r, _, _ := str.ReadRune()
+		if r != '%' {
+			lit.WriteRune(r)
+			continue
+		}
+		if r, _, _ = str.ReadRune(); r == '%' {
+			lit.WriteRune(r)
+			continue
+		}
+		b.buf.WriteString(regexp.QuoteMeta(lit.String()))
+		lit.Reset()
+		var long string
+		switch r {
+		case 'F':
+			long = ip4long
+		case 'S':
+			long = ip6long
+		case 'Q':
+			long = fqdnlong
+		}
+		expr, ok := hostRegexps[r]
+		if !ok && long == "" {
+			return syntaxError("host", "unknown specifier %c", r)
+		}
+		write := func() error {
+			if long != "" {
+				return b.host(long)
+			}
+			b.buf.WriteString(expr)
+			return nil
+		}
+		var name string
+		if peek(str) == '>' {
+			// > not followed by a name is a literal
+			str.ReadRune()
+			if name, _ = parseString(str, 0, isAlpha); name == "" {
+				lit.WriteRune('>')
+			}
+		}
+		var err error
+		if name == "" {
+			err = write()
+		} else {
+			err = b.group("named."+name, write)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	b.buf.WriteString(regexp.QuoteMeta(lit.String()))
+	return nil
+}
+
+var hostRegexps = map[rune]string{
+	'4': `\d{1,3}(?:\.\d{1,3}){3}`,
+	'6': `\[?[0-9A-Fa-f:.]+\]?`,
+	'p': `\d+`,
+	'm': `\d{1,2}`,
+	'h': alphaRegexp + `+`,
+	'f': alphaRegexp + `+(?:\.` + alphaRegexp + `+)*`,
+}
+
+// typedRegexps gives the values of the captures declared with a type. A
+// value can also be empty or -, kept without conversion.
+var typedRegexps = map[string]string{
+	"int":   `[+-]?\d+`,
+	"float": `[+-]?(?:\d+(?:\.\d*)?|\.\d+)(?:[eE][+-]?\d+)?`,
+	"bool":  `[01tTfF]|[Tt]rue|TRUE|[Ff]alse|FALSE`,
+}
+
+// typedRegexp gives the expression of the values of the capture arg, empty
+// when its type does not restrict them.
+func typedRegexp(arg string) string {
+	x := strings.IndexByte(arg, ':')
+	if x < 0 {
+		return ""
+	}
+	kind := arg[x+1:]
+	if x := strings.IndexByte(kind, ':'); x >= 0 {
+		kind = kind[:x]
+	}
+	expr, ok := typedRegexps[kind]
+	if !ok {
+		return ""
+	}
+	return "(?:" + expr + "|-)?"
+}
+
+// regexpClass escapes r to be used in a character class.
+func regexpClass(r rune) string {
+	switch r {
+	case '\\', ']', '[', '^', '-':
+		return `\` + string(r)
+	default:
+		return string(r)
+	}
+}
@@ -0,0 +1,111 @@
+package log
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRegexpPresets(t *testing.T) {
+	for _, p := range Presets() {
+		if p.Kind != KindInput || p.Example == "" {
+			continue
+		}
+		pat, err := CompilePattern(p.Name)
+		if err != nil {
+			t.Errorf("%s: %s", p.Name, err)
+			continue
+		}
+		re, fields := pat.Regexp()
+		if re == nil {
+			t.Errorf("%s: no regexp", p.Name)
+			continue
+		}
+		if n := re.NumSubexp(); n != len(fields) {
+			t.Errorf("%s: got %d groups for %d fields", p.Name, n, len(fields))
+			continue
+		}
+		for i, name := range re.SubexpNames()[1:] {
+			want := strings.TrimPrefix(fields[i], "named.")
+			if name != want && !strings.HasPrefix(name, want+"_") {
+				t.Errorf("%s: group %d is %s, field is %s", p.Name, i+1, name, fields[i])
+			}
+		}
+		e, err := pat.Parse(p.Example)
+		if err != nil {
+			t.Errorf("%s: %s", p.Name, err)
+			continue
+		}
+		x := re.FindStringSubmatchIndex(p.Example)
+		if x == nil {
+			t.Errorf("%s: regexp %s does not match %q", p.Name, re, p.Example)
+			continue
+		}
+		for i, field := range fields {
+			if x[2*i+2] < 0 {
+				continue
+			}
+			got := p.Example[x[2*i+2]:x[2*i+3]]
+			if want, ok := entryField(e, field); ok && got != want {
+				t.Errorf("%s: %s: got %q, want %q", p.Name, field, got, want)
+			}
+		}
+	}
+}
+
+// entryField gives the text of field in e, as captured by the regexp.
+func entryField(e Entry, field string) (string, bool) {
+	switch field {
+	case "process":
+		return e.Process, true
+	case "pid":
+		return strconv.Itoa(e.Pid), true
+	case "user":
+		return e.User, true
+	case "group":
+		return e.Group, true
+	case "host":
+		return e.Host, true
+	case "level":
+		return e.Level, true
+	case "message":
+		return e.Message, true
+	case "time":
+		return "", false
+	default:
+		v, ok := e.Named[strings.TrimPrefix(field, "named.")]
+		return v, ok
+	}
+}
+
+func TestRegexpTyped(t *testing.T) {
+	pat, err := CompilePattern(`%w(status:int) %w(ratio:float) %w(ok:bool) %q(code:int) %w(path:string)`, WithStrict())
+	if err != nil {
+		t.Fatal(err)
+	}
+	re, _ := pat.Regexp()
+	if re == nil {
+		t.Fatal("no regexp")
+	}
+	tests := []struct {
+		line  string
+		match bool
+	}{
+		{`200 0.5 true "42" /index.html`, true},
+		{`-1 1e-3 F '-7' /`, true},
+		{`- - - "" /`, true},
+		{`200 .5 1 "42" x`, true},
+		{`OK 0.5 true "42" /index.html`, false},
+		{`200 half true "42" /index.html`, false},
+		{`200 0.5 yes "42" /index.html`, false},
+		{`200 0.5 true "x42" /index.html`, false},
+	}
+	for _, tt := range tests {
+		if got := re.MatchString(tt.line); got != tt.match {
+			t.Errorf("%q: got match %t, want %t", tt.line, got, tt.match)
+		}
+		if _, err := pat.Parse(tt.line); (err == nil) != tt.match {
+			t.Errorf("%q: the pattern and its regexp disagree (%v)", tt.line, err)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package log
+
+import (
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Report summarizes the entries of a time window: the number of entries per
+// level, the most frequent messages of the errors and the messages never seen
+// in the previous windows. Messages are compared with their numbers masked so
+// that messages differing only by an id or a duration are counted together;
+// the first message seen is given as sample. The counts give the times of the
+// first and last entries of the window having their level or message.
+type Report struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Total  int       `json:"total"`
+	Levels []Count   `json:"levels"`
+	Errors []Count   `json:"errors"`
+	New    []string  `json:"new"`
+}
+
+type ReportOption func(*Reporter)
+
+// WithReportLimit sets the maximum number of errors and of new messages given
+// in a report (10 by default).
+func WithReportLimit(n int) ReportOption {
+	return func(r *Reporter) {
+		if n > 0 {
+			r.limit = n
+		}
+	}
+}
+
+// Reporter is a Writer cutting the entries in windows of a fixed duration
+// according to their time and giving a Report of each window. A report is
+// emitted when the first entry of the next window is written, when Flush is
+// called and when the Reporter is closed.
+type Reporter struct {
+	every time.Duration
+	emit  func(Report) error
+	limit int
+
+	mu      sync.Mutex
+	seen    map[string]bool
+	current Report
+	levels  map[string]*Count
+	errors  map[string]*Count
+	count   int
+}
+
+func NewReporter(every time.Duration, emit func(Report) error, opts ...ReportOption) *Reporter {
+	r := Reporter{
+		every: every,
+		emit:  emit,
+		limit: 10,
+		seen:  make(map[string]bool),
+	}
+	for _, o := range opts {
+		o(&r)
+	}
+	r.reset(time.Time{})
+	return &r
+}
+
+func (r *Reporter) Write(e Entry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !e.When.IsZero() {
+		start := e.When.Truncate(r.every)
+		if r.count > 0 && !start.Equal(r.current.Start) {
+			if err := r.flush(); err != nil {
+				return err
+			}
+		}
+		if r.count == 0 {
+			r.reset(start)
+		}
+	}
+	r.count++
+	countOf(r.levels, e.Level).add(e.When)
+
+	key := messageKey(e.Message)
+	if !r.seen[key] {
+		r.seen[key] = true
+		if len(r.current.New) < r.limit {
+			r.current.New = append(r.current.New, e.Message)
+		}
+	}
+	if isErrorLevel(e.Level) {
+		c, ok := r.errors[key]
+		if !ok {
+			c = &Count{Value: e.Message}
+			r.errors[key] = c
+		}
+		c.add(e.When)
+	}
+	return nil
+}
+
+// Flush emits the report of the current window if it has entries.
+func (r *Reporter) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.count == 0 {
+		return nil
+	}
+	return r.flush()
+}
+
+func (r *Reporter) Close() error {
+	return r.Flush()
+}
+
+func (r *Reporter) flush() error {
+	rep := r.current
+	rep.Total = r.count
+	if !rep.Start.IsZero() {
+		rep.End = rep.Start.Add(r.every)
+	}
+	rep.Levels = sortCounts(r.levels, r.count, 0)
+
+	var total int
+	for _, c := range r.errors {
+		total += c.Count
+	}
+	rep.Errors = sortCounts(r.errors, total, r.limit)
+	r.reset(time.Time{})
+	return r.emit(rep)
+}
+
+func (r *Reporter) reset(start time.Time) {
+	r.current = Report{Start: start}
+	r.levels = make(map[string]*Count)
+	r.errors = make(map[string]*Count)
+	r.count = 0
+}
+
+// messageKey masks the numbers of a message.
+func messageKey(msg string) string {
+	var (
+		str   strings.Builder
+		digit bool
+	)
+	for _, c := range msg {
+		if unicode.IsDigit(c) {
+			if !digit {
+				str.WriteByte('#')
+			}
+			digit = true
+			continue
+		}
+		digit = false
+		str.WriteRune(c)
+	}
+	return str.String()
+}
+
+func isErrorLevel(level string) bool {
+	level = strings.ToLower(level)
+	for _, p := range []string{"err", "crit", "fatal", "emerg", "alert", "panic", "severe"} {
+		if strings.HasPrefix(level, p) {
+			return true
+		}
+	}
+	return false
+}
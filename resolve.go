@@ -0,0 +1,228 @@
+package log
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultResolveTTL is how long the names and addresses found by Resolve
+	// are kept.
+	DefaultResolveTTL = 5 * time.Minute
+	// DefaultResolveWorkers is the number of lookups done at the same time by
+	// Resolve.
+	DefaultResolveWorkers = 8
+	// DefaultResolveTimeout is how long Resolve waits for a lookup.
+	DefaultResolveTimeout = 2 * time.Second
+)
+
+// maxResolved bounds the number of results kept by Resolve.
+const maxResolved = 4096
+
+type ResolveOption func(*resolver)
+
+// WithTTL sets how long the results of the lookups, failed ones included, are
+// kept.
+func WithTTL(ttl time.Duration) ResolveOption {
+	return func(r *resolver) {
+		r.ttl = ttl
+	}
+}
+
+// WithWorkers sets the number of entries resolved at the same time.
+func WithWorkers(n int) ResolveOption {
+	return func(r *resolver) {
+		if n > 0 {
+			r.workers = n
+		}
+	}
+}
+
+// WithLookupTimeout sets how long a lookup can take. The host of the entry is
+// left as is when it takes longer.
+func WithLookupTimeout(timeout time.Duration) ResolveOption {
+	return func(r *resolver) {
+		r.timeout = timeout
+	}
+}
+
+// WithResolver sets the resolver used for the lookups instead of
+// net.DefaultResolver.
+func WithResolver(res *net.Resolver) ResolveOption {
+	return func(r *resolver) {
+		r.lookup = res
+	}
+}
+
+type resolved struct {
+	value   string
+	expires time.Time
+}
+
+type resolver struct {
+	ttl     time.Duration
+	workers int
+	timeout time.Duration
+	lookup  *net.Resolver
+
+	mu    sync.Mutex
+	cache map[string]resolved
+}
+
+// Resolve creates a Reader giving the entries of r with their host resolved:
+// the address in the host is replaced by its name (the address being kept in
+// ip) and the address of a host name is set in ip. Up to workers entries (see
+// WithWorkers) are resolved at the same time, while keeping the order of r.
+// Results are cached for the TTL given WithTTL.
+func Resolve(r *Reader, opts ...ResolveOption) *Reader {
+	res := resolver{
+		ttl:     DefaultResolveTTL,
+		workers: DefaultResolveWorkers,
+		timeout: DefaultResolveTimeout,
+		lookup:  net.DefaultResolver,
+		cache:   make(map[string]resolved),
+	}
+	for _, o := range opts {
+		o(&res)
+	}
+	var (
+		rs    = combined([]*Reader{r})
+		sem   = make(chan struct{}, res.workers)
+		queue = make(chan chan readResult, res.workers)
+	)
+	go func() {
+		defer close(queue)
+		for {
+			e, err := r.Read()
+			if err == io.EOF {
+				return
+			}
+			done := make(chan readResult, 1)
+			if err != nil {
+				done <- readResult{err: err}
+				select {
+				case queue <- done:
+				case <-rs.done:
+				}
+				return
+			}
+			select {
+			case sem <- struct{}{}:
+			case <-rs.done:
+				return
+			}
+			select {
+			case queue <- done:
+			case <-rs.done:
+				<-sem
+				return
+			}
+			go func() {
+				defer func() { <-sem }()
+				res.resolve(&e)
+				done <- readResult{entry: e}
+			}()
+		}
+	}()
+	rs.next = func(e *Entry) error {
+		if rs.closed() {
+			return io.EOF
+		}
+		done, ok := <-queue
+		if !ok {
+			return io.EOF
+		}
+		res := <-done
+		if res.err != nil {
+			return res.err
+		}
+		putEntry(*e)
+		*e = res.entry
+		rs.lino++
+		return nil
+	}
+	return rs
+}
+
+func (r *resolver) resolve(e *Entry) {
+	ip := e.Addr.IP
+	if ip == nil {
+		if ip = parseHostIP(e.Host); ip != nil {
+			e.Addr.IP = ip
+		}
+	}
+	if ip != nil {
+		name := r.get("addr:"+ip.String(), func(ctx context.Context) (string, error) {
+			names, err := r.lookup.LookupAddr(ctx, ip.String())
+			if err != nil || len(names) == 0 {
+				return "", err
+			}
+			return strings.TrimSuffix(names[0], "."), nil
+		})
+		if name != "" {
+			e.Host = strings.Replace(e.Host, ip.String(), name, 1)
+			e.Addr.Name = name
+		}
+		return
+	}
+	host := e.Addr.Name
+	if host == "" {
+		host = e.Host
+	}
+	if host == "" {
+		return
+	}
+	addr := r.get("host:"+host, func(ctx context.Context) (string, error) {
+		addrs, err := r.lookup.LookupHost(ctx, host)
+		if err != nil || len(addrs) == 0 {
+			return "", err
+		}
+		return addrs[0], nil
+	})
+	if addr != "" {
+		e.Addr.IP = net.ParseIP(addr)
+	}
+}
+
+// get gives the cached value of key or looks it up. Failed lookups are cached
+// as empty values.
+func (r *resolver) get(key string, lookup func(context.Context) (string, error)) string {
+	now := time.Now()
+	r.mu.Lock()
+	if res, ok := r.cache[key]; ok && now.Before(res.expires) {
+		r.mu.Unlock()
+		return res.value
+	}
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	value, _ := lookup(ctx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.cache) >= maxResolved {
+		for k, res := range r.cache {
+			if now.After(res.expires) {
+				delete(r.cache, k)
+			}
+		}
+		if len(r.cache) >= maxResolved {
+			r.cache = make(map[string]resolved)
+		}
+	}
+	r.cache[key] = resolved{value: value, expires: now.Add(r.ttl)}
+	return value
+}
+
+// parseHostIP parses the address of a host with an optional port.
+func parseHostIP(host string) net.IP {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return net.ParseIP(host)
+}
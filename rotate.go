@@ -0,0 +1,268 @@
+package log
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Rotated is an io.Reader giving the lines of all the files of a rotation set,
+// from the oldest to the current one. The files compressed with gzip (.gz) or
+// bzip2 (.bz2) are decompressed.
+//
+// Like with a Watcher, a Reader created with a Rotated sets the File and
+// Offset of the Source of its entries to the file each line comes from, the
+// offsets of the compressed files being the ones of their decompressed lines.
+type Rotated struct {
+	files []string
+	curr  int
+
+	file  *os.File
+	inner io.Reader
+	last  byte
+	total int64
+
+	mu       sync.Mutex
+	segments []watchSegment
+}
+
+// OpenRotated opens the rotation set of base: base itself and its siblings
+// with a numeric suffix (eg, app.log.1, app.log.2.gz or app.1.log) or a dated
+// one (eg, app.log-20240501, app.log.2024-05-01.gz or app-2024-05-01.log). The
+// dated files come first, from the oldest date, then the numbered ones, from
+// the highest number, then base. base does not need to exist when it has
+// siblings.
+func OpenRotated(base string) (*Rotated, error) {
+	files, err := rotationSet(base)
+	if err != nil {
+		return nil, err
+	}
+	return &Rotated{files: files}, nil
+}
+
+// Files returns the paths of the files of the rotation set, in the order they
+// are read.
+func (r *Rotated) Files() []string {
+	return append([]string(nil), r.files...)
+}
+
+func (r *Rotated) Read(b []byte) (int, error) {
+	for {
+		if r.inner == nil {
+			if r.curr >= len(r.files) {
+				return 0, io.EOF
+			}
+			if r.total > 0 && r.last != '\n' && len(b) > 0 {
+				// the last line of the previous file is not mixed with the
+				// first one of the next file
+				b[0], r.last = '\n', '\n'
+				r.total++
+				return 1, nil
+			}
+			if err := r.open(r.files[r.curr]); err != nil {
+				return 0, err
+			}
+			if r.inner == nil {
+				r.curr++
+				continue
+			}
+		}
+		n, err := r.inner.Read(b)
+		if n > 0 {
+			r.last = b[n-1]
+			r.total += int64(n)
+			if err == io.EOF {
+				err = nil
+			}
+			return n, err
+		}
+		if err == io.EOF {
+			r.file.Close()
+			r.file, r.inner = nil, nil
+			r.curr++
+			continue
+		}
+		return 0, err
+	}
+}
+
+// SourceAt gives the file and the offset in this file of the byte at offset in
+// the stream of the Rotated.
+func (r *Rotated) SourceAt(offset int64) (string, int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := sort.Search(len(r.segments), func(i int) bool {
+		return r.segments[i].start > offset
+	})
+	if i == 0 {
+		return "", offset
+	}
+	s := r.segments[i-1]
+	if i > 1 {
+		r.segments = r.segments[i-1:]
+	}
+	return s.file, offset - s.start
+}
+
+func (r *Rotated) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file, r.inner = nil, nil
+	r.curr = len(r.files)
+	return err
+}
+
+// open opens the file at path. inner is left to nil when the file is an empty
+// compressed file.
+func (r *Rotated) open(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	var inner io.Reader = f
+	switch filepath.Ext(path) {
+	case ".gz":
+		z, err := gzip.NewReader(f)
+		if err == io.EOF {
+			f.Close()
+			return nil
+		}
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		inner = z
+	case ".bz2":
+		inner = bzip2.NewReader(f)
+	}
+	r.file, r.inner = f, inner
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.segments = append(r.segments, watchSegment{
+		start: r.total,
+		file:  path,
+	})
+	return nil
+}
+
+type rotation struct {
+	path  string
+	dated bool
+	// stamp is the date of a dated file, padded to be compared with the
+	// others, or the number of a numbered one
+	stamp string
+	num   int
+}
+
+// rotationSet gives the files of the rotation set of base in the order they
+// have to be read.
+func rotationSet(base string) ([]string, error) {
+	var (
+		dir  = filepath.Dir(base)
+		name = filepath.Base(base)
+		ext  = filepath.Ext(name)
+		stem = strings.TrimSuffix(name, ext)
+	)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		list []rotation
+		seen bool
+	)
+	for _, e := range entries {
+		file := e.Name()
+		if file == name {
+			seen = true
+			continue
+		}
+		if !e.Type().IsRegular() {
+			continue
+		}
+		file = strings.TrimSuffix(strings.TrimSuffix(file, ".gz"), ".bz2")
+		var suffix string
+		switch {
+		case strings.HasPrefix(file, name) && len(file) > len(name):
+			suffix = file[len(name):]
+		case ext != "" && strings.HasPrefix(file, stem) && strings.HasSuffix(file, ext) && len(file) > len(stem)+len(ext):
+			suffix = file[len(stem) : len(file)-len(ext)]
+		default:
+			continue
+		}
+		rot, ok := parseRotation(suffix)
+		if !ok {
+			continue
+		}
+		rot.path = filepath.Join(dir, e.Name())
+		list = append(list, rot)
+	}
+	if !seen && len(list) == 0 {
+		return nil, &os.PathError{Op: "open", Path: base, Err: os.ErrNotExist}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].dated != list[j].dated {
+			return list[i].dated
+		}
+		if list[i].dated {
+			return list[i].stamp < list[j].stamp
+		}
+		return list[i].num > list[j].num
+	})
+	files := make([]string, 0, len(list)+1)
+	for _, r := range list {
+		files = append(files, r.path)
+	}
+	if seen {
+		files = append(files, base)
+	}
+	return files, nil
+}
+
+// parseRotation parses the suffix added by the rotation to a file: a
+// separator (., - or _) followed by a number or by a date made of digits and
+// separators (eg, 20240501 or 2024-05-01_1200).
+func parseRotation(suffix string) (rotation, bool) {
+	var rot rotation
+	if suffix == "" || strings.IndexByte(".-_", suffix[0]) < 0 {
+		return rot, false
+	}
+	var digits strings.Builder
+	for _, c := range suffix[1:] {
+		switch {
+		case c >= '0' && c <= '9':
+			digits.WriteRune(c)
+		case c == '-' || c == '_' || c == '.':
+		default:
+			return rot, false
+		}
+	}
+	str := digits.String()
+	switch {
+	case str == "":
+		return rot, false
+	case len(str) >= 8:
+		rot.dated = true
+		rot.stamp = str
+		if n := len(str); n < 14 {
+			rot.stamp += strings.Repeat("0", 14-n)
+		}
+	default:
+		n, err := strconv.Atoi(suffix[1:])
+		if err != nil {
+			return rot, false
+		}
+		rot.num = n
+	}
+	return rot, true
+}
@@ -0,0 +1,104 @@
+package log
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Rule sends the entries matching Filter to To. An empty Filter matches all
+// the entries and can be given last to catch the entries not matched by the
+// other rules.
+type Rule struct {
+	Filter string
+	To     Writer
+	// Continue gives the entry to the next matching rules too instead of
+	// stopping at this one.
+	Continue bool
+}
+
+type route struct {
+	keep *Filter
+	to   Writer
+	next bool
+}
+
+type routeWriter struct {
+	routes  []route
+	writers []Writer
+}
+
+// Route returns a Writer that writes each entry to the Writer of the first
+// rule it matches, and of the next ones while the rules have Continue set, so
+// that the entries are dispatched to several outputs in a single pass. Entries
+// matching no rule are dropped. Flush and Close are given once to each Writer
+// of the rules.
+func Route(rules []Rule) (Writer, error) {
+	var w routeWriter
+	for i, r := range rules {
+		if r.To == nil {
+			return nil, fmt.Errorf("route: rule %d has no writer", i+1)
+		}
+		keep, err := CompileFilter(r.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("route: rule %d: %w", i+1, err)
+		}
+		w.routes = append(w.routes, route{keep: keep, to: r.To, next: r.Continue})
+		if !w.contains(r.To) {
+			w.writers = append(w.writers, r.To)
+		}
+	}
+	return &w, nil
+}
+
+func (w *routeWriter) Write(e Entry) error {
+	for _, r := range w.routes {
+		if !r.keep.Match(e) {
+			continue
+		}
+		if err := r.to.Write(e); err != nil {
+			return err
+		}
+		if !r.next {
+			break
+		}
+	}
+	return nil
+}
+
+func (w *routeWriter) Flush() error {
+	var err error
+	for _, x := range w.writers {
+		f, ok := x.(interface{ Flush() error })
+		if !ok {
+			continue
+		}
+		if e := f.Flush(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (w *routeWriter) Close() error {
+	var err error
+	for _, x := range w.writers {
+		if e := CloseWriter(x); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// contains tells whether x is already used by a rule. Writers whose type can
+// not be compared are never considered the same.
+func (w *routeWriter) contains(x Writer) bool {
+	if !reflect.TypeOf(x).Comparable() {
+		return false
+	}
+	for _, other := range w.writers {
+		if reflect.TypeOf(other) == reflect.TypeOf(x) && other == x {
+			return true
+		}
+	}
+	return false
+}
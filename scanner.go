@@ -0,0 +1,126 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"unicode/utf8"
+)
+
+// scanner reads the runes of a line like a bytes.Reader but gives access to
+// the bytes already read so that tokens can be sub-sliced from the line
+// instead of being copied rune by rune in a buffer.
+type scanner struct {
+	buf  []byte
+	pos  int
+	prev int
+}
+
+func newScanner(b []byte) *scanner {
+	var s scanner
+	s.Reset(b)
+	return &s
+}
+
+func (s *scanner) Reset(b []byte) {
+	s.buf, s.pos, s.prev = b, 0, -1
+}
+
+func (s *scanner) Len() int {
+	return len(s.buf) - s.pos
+}
+
+func (s *scanner) ReadRune() (rune, int, error) {
+	if s.pos >= len(s.buf) {
+		s.prev = -1
+		return 0, 0, io.EOF
+	}
+	s.prev = s.pos
+	if c := s.buf[s.pos]; c < utf8.RuneSelf {
+		s.pos++
+		return rune(c), 1, nil
+	}
+	r, n := utf8.DecodeRune(s.buf[s.pos:])
+	s.pos += n
+	return r, n, nil
+}
+
+func (s *scanner) UnreadRune() error {
+	if s.prev < 0 {
+		return errors.New("scanner: invalid use of UnreadRune")
+	}
+	s.pos, s.prev = s.prev, -1
+	return nil
+}
+
+func (s *scanner) ReadByte() (byte, error) {
+	if s.pos >= len(s.buf) {
+		return 0, io.EOF
+	}
+	s.prev = -1
+	s.pos++
+	return s.buf[s.pos-1], nil
+}
+
+func (s *scanner) Read(b []byte) (int, error) {
+	if s.pos >= len(s.buf) {
+		return 0, io.EOF
+	}
+	s.prev = -1
+	n := copy(b, s.buf[s.pos:])
+	s.pos += n
+	return n, nil
+}
+
+func (s *scanner) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = int64(s.pos) + offset
+	case io.SeekEnd:
+		pos = int64(len(s.buf)) + offset
+	default:
+		return 0, errors.New("scanner: invalid whence")
+	}
+	if pos < 0 {
+		return 0, errors.New("scanner: negative position")
+	}
+	if pos > int64(len(s.buf)) {
+		pos = int64(len(s.buf))
+	}
+	s.pos, s.prev = int(pos), -1
+	return pos, nil
+}
+
+// skipUntil advances until the start of str. It returns false and does not
+// move if str is not found.
+func (s *scanner) skipUntil(str string) bool {
+	x := bytes.Index(s.buf[s.pos:], []byte(str))
+	if x < 0 {
+		return false
+	}
+	s.pos, s.prev = s.pos+x, -1
+	return true
+}
+
+// scan advances while accept returns true and returns the bytes read.
+func (s *scanner) scan(length int, accept func(rune) bool) []byte {
+	start := s.pos
+	for n := 0; length <= 0 || n < length; n++ {
+		if s.pos >= len(s.buf) {
+			break
+		}
+		r, size := rune(s.buf[s.pos]), 1
+		if r >= utf8.RuneSelf {
+			r, size = utf8.DecodeRune(s.buf[s.pos:])
+		}
+		if !accept(r) {
+			break
+		}
+		s.pos += size
+	}
+	s.prev = -1
+	return s.buf[start:s.pos]
+}
@@ -0,0 +1,118 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrSchema = errors.New("schema violation")
+
+type SchemaAction int
+
+const (
+	SchemaDrop SchemaAction = iota
+	SchemaAnnotate
+	SchemaFail
+)
+
+const SchemaField = "schema"
+
+type Schema struct {
+	Required []string
+	Types    map[string]string
+	Levels   []string
+	Action   SchemaAction
+}
+
+func (s Schema) Check() error {
+	for _, f := range s.Required {
+		if !isField(f) {
+			return fmt.Errorf("%s: unknown field", f)
+		}
+	}
+	for f, t := range s.Types {
+		if !isField(f) {
+			return fmt.Errorf("%s: unknown field", f)
+		}
+		if _, ok := schemaTypes[t]; !ok {
+			return fmt.Errorf("%s: unknown type %s", f, t)
+		}
+	}
+	return nil
+}
+
+func (s Schema) Validate(e Entry) error {
+	var errs []string
+	for _, f := range s.Required {
+		if isZero(getField(e, f)) {
+			errs = append(errs, fmt.Sprintf("%s: missing value", f))
+		}
+	}
+	for f, t := range s.Types {
+		str, ok := getField(e, f).(string)
+		if !ok || str == "" {
+			continue
+		}
+		if !schemaTypes[t](str) {
+			errs = append(errs, fmt.Sprintf("%s: %s is not of type %s", f, str, t))
+		}
+	}
+	if len(s.Levels) > 0 && !s.acceptLevel(e.Level) {
+		errs = append(errs, fmt.Sprintf("level: %s not allowed", e.Level))
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrSchema, strings.Join(errs, "; "))
+}
+
+func (s Schema) acceptLevel(level string) bool {
+	for _, v := range s.Levels {
+		if v == level {
+			return true
+		}
+	}
+	return false
+}
+
+var schemaTypes = map[string]func(string) bool{
+	"string": func(_ string) bool { return true },
+	"int": func(str string) bool {
+		_, err := strconv.ParseInt(str, 10, 64)
+		return err == nil
+	},
+	"float": func(str string) bool {
+		_, err := strconv.ParseFloat(str, 64)
+		return err == nil
+	},
+	"bool": func(str string) bool {
+		_, err := strconv.ParseBool(str)
+		return err == nil
+	},
+	"duration": func(str string) bool {
+		_, err := ParseDuration(str)
+		return err == nil
+	},
+	"time": func(str string) bool {
+		return makeLiteral(str).istime
+	},
+}
+
+func isZero(v interface{}) bool {
+	switch v := v.(type) {
+	case string:
+		return v == ""
+	case int:
+		return v == 0
+	case time.Time:
+		return v.IsZero()
+	case net.IP:
+		return v == nil
+	default:
+		return v == nil
+	}
+}
@@ -0,0 +1,114 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"time"
+)
+
+var ErrSeek = errors.New("input is not seekable")
+
+const seekBlock = 1 << 12
+
+// SeekTime moves the Reader to the first entry whose time is not before t.
+// The input should be sorted by time: a binary search is done on the
+// underlying io.ReadSeeker to find a position close to t before scanning lines
+// one by one. Line numbers are relative to the new position.
+//
+// The year of the times without one is guessed from the entries read after
+// the new position: WithYear(YearAuto) gives the right years, a fixed year is
+// given to the first entries read.
+func (r *Reader) SeekTime(t time.Time) error {
+	rs, ok := r.source.(io.ReadSeeker)
+	if !ok || r.parse == nil {
+		return ErrSeek
+	}
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	var lo, hi int64 = 0, size
+	for hi-lo > seekBlock {
+		mid := lo + (hi-lo)/2
+		var before bool
+		err := r.scanFrom(rs, mid, func(_ int64, e Entry) bool {
+			before = e.When.Before(t)
+			return false
+		})
+		if err != nil {
+			return err
+		}
+		if before {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	offset := size
+	err = r.scanFrom(rs, lo, func(pos int64, e Entry) bool {
+		if e.When.Before(t) {
+			return true
+		}
+		offset = pos
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := rs.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	// the year of the times without one is guessed again from the entries
+	// read after offset
+	parse, err := parsePattern(r.pattern, r.cfg)
+	if err != nil {
+		return err
+	}
+	r.parse = parse
+	r.scan(rs, offset)
+	r.err = nil
+	r.lino = 0
+	r.stats.Bytes = offset
+	return nil
+}
+
+// scanFrom calls fn with the offset and the entry of each line that matches
+// the pattern, starting at the first line beginning after offset, until fn
+// returns false or the end of input is reached. The lines are parsed with
+// their own parse function, to not change the year guessed by the one of the
+// Reader for the times without a year.
+func (r *Reader) scanFrom(rs io.ReadSeeker, offset int64, fn func(int64, Entry) bool) error {
+	parse, err := parsePattern(r.pattern, r.cfg)
+	if err != nil {
+		return err
+	}
+	if _, err := rs.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	rd := bufio.NewReader(rs)
+	if offset > 0 {
+		skip, err := rd.ReadBytes('\n')
+		if err != nil {
+			return nil
+		}
+		offset += int64(len(skip))
+	}
+	for {
+		line, err := rd.ReadBytes('\n')
+		if len(line) > 0 {
+			var e Entry
+			if parse(&e, newScanner(bytes.TrimRight(line, "\r\n"))) == nil && !fn(offset, e) {
+				return nil
+			}
+			offset += int64(len(line))
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
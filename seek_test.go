@@ -0,0 +1,39 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSeekTimeGuessedYear(t *testing.T) {
+	var (
+		buf   bytes.Buffer
+		now   = time.Now().UTC().Truncate(time.Hour)
+		start = now.Add(-360 * 24 * time.Hour)
+	)
+	for w := start; w.Before(now); w = w.Add(time.Hour) {
+		fmt.Fprintf(&buf, "%s info entry\n", w.Format("Jan _2 15:04:05"))
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), "%t(%b %d %H:%M:%S) %l %m", "", WithYear(YearAuto), WithLocation(time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, back := range []int{100, 300, 20} {
+		want := now.Add(-time.Duration(back) * 24 * time.Hour)
+		if err := r.SeekTime(want); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 48; i++ {
+			e, err := r.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !e.When.Equal(want) {
+				t.Fatalf("seek %d days back: got %s, want %s", back, e.When, want)
+			}
+			want = want.Add(time.Hour)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+)
+
+// network and database sinks are not part of the core package. They live in
+// their own packages under sink/ and register themselves when imported so that
+// embedders only pay for the integrations they actually use.
+
+var ErrSink = errors.New("unknown sink")
+
+const DefaultPattern = "%t %n[%p]: %m"
+
+type OpenFunc func(*url.URL) (Writer, error)
+
+var sinks = struct {
+	sync.RWMutex
+	openers map[string]OpenFunc
+}{
+	openers: make(map[string]OpenFunc),
+}
+
+func init() {
+	RegisterSink("file", openFile)
+}
+
+func RegisterSink(scheme string, open OpenFunc) {
+	sinks.Lock()
+	defer sinks.Unlock()
+	if open == nil {
+		panic("log: RegisterSink open function is nil")
+	}
+	if _, dup := sinks.openers[scheme]; dup {
+		panic("log: RegisterSink called twice for " + scheme)
+	}
+	sinks.openers[scheme] = open
+}
+
+func Sinks() []string {
+	sinks.RLock()
+	defer sinks.RUnlock()
+	var list []string
+	for s := range sinks.openers {
+		list = append(list, s)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// OpenSink opens the sink of the given URI. Its Writer should be closed with
+// CloseWriter once all the entries are written.
+func OpenSink(uri string) (Writer, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	sinks.RLock()
+	open, ok := sinks.openers[u.Scheme]
+	sinks.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSink, u.Scheme)
+	}
+	return open(u)
+}
+
+func SinkPattern(u *url.URL) string {
+	if p := u.Query().Get("pattern"); p != "" {
+		return p
+	}
+	return DefaultPattern
+}
+
+func openFile(u *url.URL) (Writer, error) {
+	file := u.Path
+	if u.Opaque != "" {
+		file = u.Opaque
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewWriter(f, SinkPattern(u))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &fileWriter{Writer: w, file: f}, nil
+}
+
+type fileWriter struct {
+	Writer
+	file *os.File
+}
+
+func (w *fileWriter) Close() error {
+	err := CloseWriter(w.Writer)
+	if e := w.file.Close(); err == nil {
+		err = e
+	}
+	return err
+}
@@ -0,0 +1,207 @@
+package fluent
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/midbel/log"
+)
+
+// fluent sends entries to fluentd or fluent bit with the forward protocol.
+// Each entry is sent as a record whose keys are the non empty fields of the
+// entry and its named words.
+
+func init() {
+	log.RegisterSink("fluent", open)
+}
+
+const DefaultTimeout = time.Second * 5
+
+type Option func(*writer)
+
+// WithAck asks the server to acknowledge each message. Write fails if the
+// acknowledgement is not received before the timeout.
+func WithAck() Option {
+	return func(w *writer) {
+		w.ack = true
+	}
+}
+
+func WithTimeout(timeout time.Duration) Option {
+	return func(w *writer) {
+		w.timeout = timeout
+	}
+}
+
+type writer struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	tag     string
+	ack     bool
+	timeout time.Duration
+	buf     bytes.Buffer
+}
+
+func Forward(addr, tag string, opts ...Option) (log.Writer, error) {
+	w := writer{
+		tag:     tag,
+		timeout: DefaultTimeout,
+	}
+	for _, o := range opts {
+		o(&w)
+	}
+	conn, err := net.DialTimeout("tcp", addr, w.timeout)
+	if err != nil {
+		return nil, err
+	}
+	w.conn = conn
+	w.reader = bufio.NewReader(conn)
+	return &w, nil
+}
+
+func (w *writer) Write(e log.Entry) error {
+	return w.WriteBatch([]log.Entry{e})
+}
+
+// WriteBatch sends all the entries in a single message in forward mode.
+func (w *writer) WriteBatch(es []log.Entry) error {
+	if len(es) == 0 {
+		return nil
+	}
+	w.buf.Reset()
+	size := 2
+	if w.ack {
+		size++
+	}
+	appendArray(&w.buf, size)
+	appendString(&w.buf, w.tag)
+	appendArray(&w.buf, len(es))
+	for _, e := range es {
+		appendArray(&w.buf, 2)
+		appendTime(&w.buf, eventTime(e.When))
+		appendRecord(&w.buf, e)
+	}
+	var chunk string
+	if w.ack {
+		chunk = chunkID()
+		appendMap(&w.buf, 1)
+		appendString(&w.buf, "chunk")
+		appendString(&w.buf, chunk)
+	}
+	w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+	if _, err := w.conn.Write(w.buf.Bytes()); err != nil {
+		return err
+	}
+	if !w.ack {
+		return nil
+	}
+	w.conn.SetReadDeadline(time.Now().Add(w.timeout))
+	ack, err := readAck(w.reader)
+	if err != nil {
+		return err
+	}
+	if ack != chunk {
+		return fmt.Errorf("fluent: unexpected ack %s (want %s)", ack, chunk)
+	}
+	return nil
+}
+
+func (w *writer) Close() error {
+	return w.conn.Close()
+}
+
+func appendRecord(buf *bytes.Buffer, e log.Entry) {
+	fields := map[string]interface{}{
+		"message": e.Message,
+		"level":   e.Level,
+		"process": e.Process,
+		"user":    e.User,
+		"group":   e.Group,
+		"host":    e.Host,
+	}
+	for k, v := range e.Named {
+		fields[namedKey(k)] = v
+	}
+	for k, v := range e.Values {
+		fields[namedKey(k)] = v
+	}
+	var keys []string
+	for k, v := range fields {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	size := len(keys)
+	if e.Pid > 0 {
+		size++
+	}
+	appendMap(buf, size)
+	for _, k := range keys {
+		appendString(buf, k)
+		appendValue(buf, fields[k])
+	}
+	if e.Pid > 0 {
+		appendString(buf, "pid")
+		appendInt(buf, int64(e.Pid))
+	}
+}
+
+// eventTime gives the time sent for an entry. The EventTime only holds the
+// times after 1970: the zero time and the times without a year (in year 1) are
+// replaced by the time the entry is sent.
+func eventTime(t time.Time) time.Time {
+	if t.Unix() < 0 {
+		return time.Now()
+	}
+	return t
+}
+
+// namedKey gives the key of a named value in a record, prefixed by named. when
+// it is the one of a field of the entries.
+func namedKey(key string) string {
+	switch key {
+	case "message", "level", "process", "pid", "user", "group", "host":
+		return "named." + key
+	default:
+		return key
+	}
+}
+
+func chunkID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	return base64.StdEncoding.EncodeToString(id[:])
+}
+
+// open handles uri like fluent://host:24224/tag?ack=true&timeout=5s
+func open(u *url.URL) (log.Writer, error) {
+	var (
+		opts []Option
+		q    = u.Query()
+	)
+	if ok, _ := strconv.ParseBool(q.Get("ack")); ok {
+		opts = append(opts, WithAck())
+	}
+	if str := q.Get("timeout"); str != "" {
+		timeout, err := time.ParseDuration(str)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithTimeout(timeout))
+	}
+	tag := path.Base(u.Path)
+	if tag == "." || tag == "/" {
+		tag = "log"
+	}
+	return Forward(u.Host, tag, opts...)
+}
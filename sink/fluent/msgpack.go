@@ -0,0 +1,195 @@
+package fluent
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// minimal msgpack encoding of the types needed by the forward protocol.
+
+var errFormat = errors.New("unexpected msgpack format")
+
+func appendNil(buf *bytes.Buffer) {
+	buf.WriteByte(0xc0)
+}
+
+func appendString(buf *bytes.Buffer, str string) {
+	n := len(str)
+	switch {
+	case n < 32:
+		buf.WriteByte(0xa0 | byte(n))
+	case n <= 0xff:
+		buf.WriteByte(0xd9)
+		buf.WriteByte(byte(n))
+	case n <= 0xffff:
+		buf.WriteByte(0xda)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(0xdb)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+	buf.WriteString(str)
+}
+
+func appendInt(buf *bytes.Buffer, v int64) {
+	switch {
+	case v >= 0 && v < 128:
+		buf.WriteByte(byte(v))
+	case v < 0 && v >= -32:
+		buf.WriteByte(byte(v))
+	default:
+		buf.WriteByte(0xd3)
+		binary.Write(buf, binary.BigEndian, v)
+	}
+}
+
+func appendFloat(buf *bytes.Buffer, v float64) {
+	buf.WriteByte(0xcb)
+	binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+}
+
+func appendBool(buf *bytes.Buffer, v bool) {
+	if v {
+		buf.WriteByte(0xc3)
+	} else {
+		buf.WriteByte(0xc2)
+	}
+}
+
+// appendValue encodes the values found in a record: strings and the typed
+// values of the captures. Durations are given in seconds.
+func appendValue(buf *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case string:
+		appendString(buf, v)
+	case int:
+		appendInt(buf, int64(v))
+	case float64:
+		appendFloat(buf, v)
+	case bool:
+		appendBool(buf, v)
+	case time.Duration:
+		appendFloat(buf, v.Seconds())
+	case time.Time:
+		appendString(buf, v.Format(time.RFC3339Nano))
+	case nil:
+		appendNil(buf)
+	default:
+		appendString(buf, fmt.Sprint(v))
+	}
+}
+
+func appendArray(buf *bytes.Buffer, n int) {
+	appendHeader(buf, n, 0x90, 0xdc, 0xdd)
+}
+
+func appendMap(buf *bytes.Buffer, n int) {
+	appendHeader(buf, n, 0x80, 0xde, 0xdf)
+}
+
+func appendHeader(buf *bytes.Buffer, n int, fix, b16, b32 byte) {
+	switch {
+	case n < 16:
+		buf.WriteByte(fix | byte(n))
+	case n <= 0xffff:
+		buf.WriteByte(b16)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(b32)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
+
+// appendTime encodes t as the EventTime extension (type 0) of the forward
+// protocol to keep the nanoseconds.
+func appendTime(buf *bytes.Buffer, t time.Time) {
+	buf.WriteByte(0xd7)
+	buf.WriteByte(0x00)
+	binary.Write(buf, binary.BigEndian, uint32(t.Unix()))
+	binary.Write(buf, binary.BigEndian, uint32(t.Nanosecond()))
+}
+
+// readAck decodes the {"ack": chunk} response sent by the server.
+func readAck(r *bufio.Reader) (string, error) {
+	n, err := readHeader(r, 0x80, 0xde, 0xdf)
+	if err != nil {
+		return "", err
+	}
+	var ack string
+	for i := 0; i < n; i++ {
+		key, err := readString(r)
+		if err != nil {
+			return "", err
+		}
+		val, err := readString(r)
+		if err != nil {
+			return "", err
+		}
+		if key == "ack" {
+			ack = val
+		}
+	}
+	return ack, nil
+}
+
+func readString(r *bufio.Reader) (string, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	var n int
+	switch {
+	case b&0xe0 == 0xa0:
+		n = int(b & 0x1f)
+	case b == 0xd9:
+		c, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		n = int(c)
+	case b == 0xda:
+		var c uint16
+		if err := binary.Read(r, binary.BigEndian, &c); err != nil {
+			return "", err
+		}
+		n = int(c)
+	case b == 0xdb:
+		var c uint32
+		if err := binary.Read(r, binary.BigEndian, &c); err != nil {
+			return "", err
+		}
+		n = int(c)
+	default:
+		return "", errFormat
+	}
+	str := make([]byte, n)
+	_, err = io.ReadFull(r, str)
+	return string(str), err
+}
+
+func readHeader(r *bufio.Reader, fix, b16, b32 byte) (int, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case b&0xf0 == fix:
+		return int(b & 0x0f), nil
+	case b == b16:
+		var n uint16
+		err := binary.Read(r, binary.BigEndian, &n)
+		return int(n), err
+	case b == b32:
+		var n uint32
+		err := binary.Read(r, binary.BigEndian, &n)
+		return int(n), err
+	default:
+		return 0, errFormat
+	}
+}
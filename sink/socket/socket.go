@@ -0,0 +1,52 @@
+package socket
+
+import (
+	"net"
+	"net/url"
+
+	"github.com/midbel/log"
+)
+
+func init() {
+	log.RegisterSink("tcp", open)
+	log.RegisterSink("udp", open)
+	log.RegisterSink("unix", open)
+}
+
+type writer struct {
+	log.Writer
+	conn net.Conn
+}
+
+func Dial(network, addr, pattern string) (log.Writer, error) {
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	ws, err := log.NewWriter(conn, pattern)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	w := writer{
+		Writer: ws,
+		conn:   conn,
+	}
+	return &w, nil
+}
+
+func (w *writer) Close() error {
+	err := log.CloseWriter(w.Writer)
+	if e := w.conn.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+func open(u *url.URL) (log.Writer, error) {
+	addr := u.Host
+	if u.Scheme == "unix" {
+		addr = u.Path
+	}
+	return Dial(u.Scheme, addr, log.SinkPattern(u))
+}
@@ -0,0 +1,292 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/midbel/log"
+)
+
+// webhook posts alerts to an HTTP endpoint (Slack and Teams incoming
+// webhooks or any service accepting JSON) when entries matching a filter are
+// written. The entries matching during a window are sent in a single alert
+// giving their number and the first of them printed with a pattern.
+
+const (
+	DefaultWindow  = time.Second * 10
+	DefaultLines   = 10
+	DefaultTimeout = time.Second * 10
+)
+
+type Format int
+
+const (
+	Generic Format = iota
+	Slack
+	Teams
+)
+
+// ParseFormat gives the format of the payload from its name: generic, slack
+// or teams.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "", "generic", "json":
+		return Generic, nil
+	case "slack":
+		return Slack, nil
+	case "teams":
+		return Teams, nil
+	default:
+		return Generic, fmt.Errorf("%s: unknown webhook format", name)
+	}
+}
+
+type Option func(*Alerter)
+
+// WithFormat sets the format of the payload. The generic payload is an object
+// with the text of the alert, the filter, the number of entries and their
+// lines.
+func WithFormat(f Format) Option {
+	return func(a *Alerter) {
+		a.format = f
+	}
+}
+
+// WithWindow sets how long the entries are aggregated after the first match
+// before the alert is sent. With a window of 0, an alert is sent for each
+// entry.
+func WithWindow(d time.Duration) Option {
+	return func(a *Alerter) {
+		if d >= 0 {
+			a.window = d
+		}
+	}
+}
+
+// WithRateLimit sends at most n alerts per period. The entries matching when
+// the limit is reached are added to the next alert.
+func WithRateLimit(n int, per time.Duration) Option {
+	return func(a *Alerter) {
+		if n > 0 && per > 0 {
+			a.limit, a.per = n, per
+		}
+	}
+}
+
+// WithLines sets the maximum number of lines given in an alert.
+func WithLines(n int) Option {
+	return func(a *Alerter) {
+		if n > 0 {
+			a.lines = n
+		}
+	}
+}
+
+func WithClient(c *http.Client) Option {
+	return func(a *Alerter) {
+		a.client = c
+	}
+}
+
+type Alerter struct {
+	url    string
+	filter string
+	keep   func(log.Entry) bool
+	print  log.Writer
+	buf    bytes.Buffer
+
+	format Format
+	window time.Duration
+	lines  int
+	limit  int
+	per    time.Duration
+	client *http.Client
+
+	mu      sync.Mutex
+	pending []string
+	count   int
+	timer   *time.Timer
+	sent    []time.Time
+	err     error
+}
+
+// Alert creates a Writer posting alerts to url for the entries matching
+// filter. The lines of the entries in the alerts are printed with the output
+// pattern template (log.DefaultPattern if empty).
+func Alert(filter, url, template string, opts ...Option) (*Alerter, error) {
+	keep, err := log.CompileFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	if template == "" {
+		template = log.DefaultPattern
+	}
+	a := Alerter{
+		url:    url,
+		filter: filter,
+		keep:   keep.Match,
+		window: DefaultWindow,
+		lines:  DefaultLines,
+		client: &http.Client{Timeout: DefaultTimeout},
+	}
+	if a.print, err = log.NewWriter(&a.buf, template, log.WithEscape(log.EscapeControl)); err != nil {
+		return nil, err
+	}
+	for _, o := range opts {
+		o(&a)
+	}
+	return &a, nil
+}
+
+// Write adds e to the current alert if it matches the filter. It returns the
+// error of the last alert sent if it failed.
+func (a *Alerter) Write(e log.Entry) error {
+	if !a.keep(e) {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.count++
+	if len(a.pending) < a.lines {
+		a.buf.Reset()
+		if err := a.print.Write(e); err != nil {
+			return err
+		}
+		a.pending = append(a.pending, strings.TrimRight(a.buf.String(), "\n"))
+	}
+	if a.timer == nil {
+		a.timer = time.AfterFunc(a.delay(a.window), a.fire)
+	}
+	err := a.err
+	a.err = nil
+	return err
+}
+
+// Close sends the pending alert without waiting for the end of its window.
+func (a *Alerter) Close() error {
+	a.mu.Lock()
+	if a.timer != nil {
+		a.timer.Stop()
+		a.timer = nil
+	}
+	count, lines, err := a.take()
+	a.mu.Unlock()
+	if count > 0 {
+		if e := a.send(count, lines); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (a *Alerter) fire() {
+	a.mu.Lock()
+	if a.timer == nil {
+		a.mu.Unlock()
+		return
+	}
+	if wait := a.delay(0); wait > 0 {
+		a.timer.Reset(wait)
+		a.mu.Unlock()
+		return
+	}
+	a.timer = nil
+	a.sent = append(a.sent, time.Now())
+	count, lines, _ := a.take()
+	a.mu.Unlock()
+
+	err := a.send(count, lines)
+
+	a.mu.Lock()
+	if err != nil && a.err == nil {
+		a.err = err
+	}
+	a.mu.Unlock()
+}
+
+// delay gives how long to wait before sending an alert given the rate limit.
+func (a *Alerter) delay(wait time.Duration) time.Duration {
+	if a.limit == 0 {
+		return wait
+	}
+	now := time.Now()
+	for len(a.sent) > 0 && now.Sub(a.sent[0]) >= a.per {
+		a.sent = a.sent[1:]
+	}
+	if len(a.sent) < a.limit {
+		return wait
+	}
+	if next := a.sent[0].Add(a.per).Sub(now); next > wait {
+		return next
+	}
+	return wait
+}
+
+func (a *Alerter) take() (int, []string, error) {
+	count, lines, err := a.count, a.pending, a.err
+	a.count, a.pending, a.err = 0, nil, nil
+	return count, lines, err
+}
+
+func (a *Alerter) send(count int, lines []string) error {
+	buf, err := json.Marshal(a.payload(count, lines))
+	if err != nil {
+		return err
+	}
+	res, err := a.client.Post(a.url, "application/json", bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+	if res.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("webhook: %s: %s", a.url, res.Status)
+	}
+	return nil
+}
+
+func (a *Alerter) payload(count int, lines []string) interface{} {
+	title := fmt.Sprintf("%d entries", count)
+	if count == 1 {
+		title = "1 entry"
+	}
+	if a.filter != "" {
+		title += " matching " + a.filter
+	}
+	if more := count - len(lines); more > 0 {
+		lines = append(lines, fmt.Sprintf("... and %d more", more))
+	}
+	switch a.format {
+	case Slack:
+		return map[string]string{
+			"text": title + "\n```\n" + strings.Join(lines, "\n") + "\n```",
+		}
+	case Teams:
+		return map[string]string{
+			"@type":    "MessageCard",
+			"@context": "https://schema.org/extensions",
+			"summary":  title,
+			"title":    title,
+			"text":     "<pre>" + html.EscapeString(strings.Join(lines, "\n")) + "</pre>",
+		}
+	default:
+		return struct {
+			Text   string   `json:"text"`
+			Filter string   `json:"filter"`
+			Count  int      `json:"count"`
+			Lines  []string `json:"lines"`
+		}{
+			Text:   title,
+			Filter: a.filter,
+			Count:  count,
+			Lines:  lines,
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// SpecifierParser parses the value of a custom specifier found at the start of
+// str, the rest of the line, into e. It returns the number of bytes of str
+// used. Errors not wrapping ErrPattern are wrapped so that the line is
+// rejected like the ones not matching the pattern.
+type SpecifierParser func(e *Entry, str string) (int, error)
+
+// SpecifierPrinter gives the text of a custom specifier for e.
+type SpecifierPrinter func(e Entry) string
+
+type specifier struct {
+	parse SpecifierParser
+	print SpecifierPrinter
+}
+
+var specifiers = struct {
+	sync.RWMutex
+	funcs map[rune]specifier
+}{
+	funcs: make(map[rune]specifier),
+}
+
+// builtinSpecifiers are the letters used by the input and output patterns.
+const builtinSpecifiers = "tbnpughlmwqkKJRPf"
+
+// RegisterSpecifier makes the letter spec available as a specifier of the
+// input patterns if parse is not nil and of the output patterns if print is
+// not nil. It panics if spec is not a letter, is a built in specifier or is
+// already registered. The fields used by print are not known to PrintFields.
+func RegisterSpecifier(spec rune, parse SpecifierParser, print SpecifierPrinter) {
+	specifiers.Lock()
+	defer specifiers.Unlock()
+	if parse == nil && print == nil {
+		panic("log: RegisterSpecifier functions are nil")
+	}
+	if !unicode.IsLetter(spec) || strings.ContainsRune(builtinSpecifiers, spec) {
+		panic(fmt.Sprintf("log: RegisterSpecifier called with invalid specifier %c", spec))
+	}
+	if _, dup := specifiers.funcs[spec]; dup {
+		panic(fmt.Sprintf("log: RegisterSpecifier called twice for %c", spec))
+	}
+	specifiers.funcs[spec] = specifier{parse: parse, print: print}
+}
+
+func lookupSpecifier(spec rune) specifier {
+	specifiers.RLock()
+	defer specifiers.RUnlock()
+	return specifiers.funcs[spec]
+}
+
+func isPrintSpecifier(spec rune) bool {
+	return strings.ContainsRune(printSpecifiers, spec) || lookupSpecifier(spec).print != nil
+}
+
+func parseCustom(parse SpecifierParser) parsefunc {
+	return func(e *Entry, r *scanner) error {
+		n, err := parse(e, string(r.buf[r.pos:]))
+		if err != nil {
+			if !errors.Is(err, ErrPattern) {
+				err = fmt.Errorf("%w: %s", ErrPattern, err)
+			}
+			return err
+		}
+		if n < 0 || n > r.Len() {
+			return fmt.Errorf("%w: invalid length %d", ErrPattern, n)
+		}
+		r.Seek(int64(n), io.SeekCurrent)
+		return nil
+	}
+}
+
+func printCustom(print SpecifierPrinter) printfunc {
+	return func(e Entry, w io.StringWriter) {
+		w.WriteString(print(e))
+	}
+}
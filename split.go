@@ -0,0 +1,138 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// splitFiles is the maximum number of files kept open by Split. The least
+// recently written one is closed to open another, and opened again to append
+// to it when needed.
+const splitFiles = 128
+
+type splitWriter struct {
+	dir   string
+	field string
+	inner func(io.Writer) Writer
+	max   int
+
+	files map[string]*splitFile
+	tick  int
+}
+
+type splitFile struct {
+	file   *os.File
+	writer Writer
+	used   int
+}
+
+func Split(dir, field string, inner func(io.Writer) Writer) (Writer, error) {
+	if !isField(field) {
+		return nil, fmt.Errorf("%s: unknown field", field)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := splitWriter{
+		dir:   dir,
+		field: field,
+		inner: inner,
+		max:   splitFiles,
+		files: make(map[string]*splitFile),
+	}
+	return &s, nil
+}
+
+func (s *splitWriter) Write(e Entry) error {
+	key := splitName(fieldString(getField(e, s.field)))
+	f, ok := s.files[key]
+	if !ok {
+		if len(s.files) >= s.max {
+			if err := s.evict(); err != nil {
+				return err
+			}
+		}
+		file, err := os.OpenFile(filepath.Join(s.dir, key+".log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		f = &splitFile{
+			file:   file,
+			writer: s.inner(file),
+		}
+		s.files[key] = f
+	}
+	s.tick++
+	f.used = s.tick
+	return f.writer.Write(e)
+}
+
+// evict closes the least recently written file.
+func (s *splitWriter) evict() error {
+	var (
+		key  string
+		last *splitFile
+	)
+	for k, f := range s.files {
+		if last == nil || f.used < last.used {
+			key, last = k, f
+		}
+	}
+	if last == nil {
+		return nil
+	}
+	delete(s.files, key)
+	return last.close()
+}
+
+func (s *splitWriter) Flush() error {
+	var err error
+	for _, f := range s.files {
+		if e := f.flush(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (s *splitWriter) Close() error {
+	var err error
+	for k, f := range s.files {
+		if e := f.close(); e != nil && err == nil {
+			err = e
+		}
+		delete(s.files, k)
+	}
+	return err
+}
+
+func (f *splitFile) flush() error {
+	if w, ok := f.writer.(interface{ Flush() error }); ok {
+		return w.Flush()
+	}
+	return nil
+}
+
+func (f *splitFile) close() error {
+	err := f.flush()
+	if e := f.file.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+func splitName(str string) string {
+	str = strings.Map(func(r rune) rune {
+		if isAlpha(r) || r == '.' {
+			return r
+		}
+		return '_'
+	}, str)
+	if str == "" || str == "." || str == ".." {
+		str = "_"
+	}
+	return str
+}
@@ -0,0 +1,48 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplitReopen(t *testing.T) {
+	dir := t.TempDir()
+	w, err := Split(dir, "process", func(w io.Writer) Writer {
+		ws, _ := NewWriter(w, "%m", WithBuffer(1<<10, 0))
+		return ws
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.(*splitWriter).max = 2
+	want := make(map[string][]string)
+	for i := 0; i < 50; i++ {
+		e := Entry{
+			Process: fmt.Sprintf("proc%d", i%5),
+			Message: fmt.Sprintf("message %d", i),
+		}
+		if err := w.Write(e); err != nil {
+			t.Fatal(err)
+		}
+		if n := len(w.(*splitWriter).files); n > 2 {
+			t.Fatalf("%d files opened", n)
+		}
+		want[e.Process] = append(want[e.Process], e.Message)
+	}
+	if err := CloseWriter(w); err != nil {
+		t.Fatal(err)
+	}
+	for proc, lines := range want {
+		buf, err := os.ReadFile(filepath.Join(dir, proc+".log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(buf), strings.Join(lines, "\n")+"\n"; got != want {
+			t.Errorf("%s: got %q, want %q", proc, got, want)
+		}
+	}
+}
@@ -0,0 +1,808 @@
+package log
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// sql queries
+// SELECT column, ... FROM log [WHERE condition] [GROUP BY field, ...]
+// [ORDER BY column [ASC|DESC], ...] [LIMIT n]
+// columns: field [AS name], count(*), count(field), sum(field), avg(field),
+// min(field), max(field) or * for time, level, process, pid, host and message
+// conditions: field = value, !=, <>, <, <=, >, >=, field [NOT] LIKE 'pattern'
+// (% and _ wildcards), field [NOT] IN (value, ...), field BETWEEN a AND b,
+// field IS [NOT] NULL, combined with AND, OR, NOT and parentheses
+// values: 'string', number or field to compare two fields of an entry
+// the fields and the values are compared as numbers when both are numbers, in
+// WHERE as in ORDER BY, and as strings otherwise
+// ORDER BY refers to a column by its name, its expression or its position
+
+var starColumns = []string{"time", "level", "process", "pid", "host", "message"}
+
+// Query runs a SQL query over the entries written to it, the stream being the
+// table log. Like the other analyzers, its result is only known once all the
+// entries are written.
+type Query struct {
+	source  string
+	columns []column
+	keep    filterfunc
+	groupBy []string
+	order   []orderKey
+	limit   int
+
+	aggregate bool
+	groups    map[string]*queryGroup
+	keys      []string
+	rows      [][]interface{}
+}
+
+type column struct {
+	name  string
+	field string
+	agg   string
+}
+
+type orderKey struct {
+	index int
+	desc  bool
+}
+
+type queryGroup struct {
+	values []interface{}
+	aggs   []aggregate
+}
+
+type aggregate struct {
+	count int
+	sum   float64
+	min   interface{}
+	max   interface{}
+}
+
+// CompileQuery compiles a SQL query.
+func CompileQuery(query string) (*Query, error) {
+	p := sqlParser{input: query}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+	q := Query{
+		source: query,
+		groups: make(map[string]*queryGroup),
+	}
+	if err := p.parse(&q); err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+func (q *Query) String() string {
+	return q.source
+}
+
+// Fields gives the fields used by the query.
+func (q *Query) Fields() []string {
+	var list []string
+	for _, c := range q.columns {
+		if c.field != "*" {
+			list = append(list, c.field)
+		}
+	}
+	return uniqueFields(append(list, q.groupBy...))
+}
+
+func (q *Query) Write(e Entry) error {
+	if q.keep != nil && !q.keep(e) {
+		return nil
+	}
+	if !q.aggregate {
+		if len(q.order) == 0 && q.limit > 0 && len(q.rows) >= q.limit {
+			// without ORDER BY, the first rows are the result
+			return nil
+		}
+		row := make([]interface{}, len(q.columns))
+		for i, c := range q.columns {
+			row[i] = getField(e, c.field)
+		}
+		q.rows = append(q.rows, row)
+		return nil
+	}
+	var key string
+	if len(q.groupBy) > 0 {
+		key = entryKey(e, q.groupBy)
+	}
+	grp, ok := q.groups[key]
+	if !ok {
+		grp = &queryGroup{
+			values: make([]interface{}, len(q.columns)),
+			aggs:   make([]aggregate, len(q.columns)),
+		}
+		for i, c := range q.columns {
+			if c.agg == "" {
+				grp.values[i] = getField(e, c.field)
+			}
+		}
+		q.groups[key] = grp
+		q.keys = append(q.keys, key)
+	}
+	for i, c := range q.columns {
+		if c.agg != "" {
+			grp.aggs[i].add(c, e)
+		}
+	}
+	return nil
+}
+
+// Columns gives the names of the columns of the result.
+func (q *Query) Columns() []string {
+	list := make([]string, len(q.columns))
+	for i, c := range q.columns {
+		list[i] = c.name
+	}
+	return list
+}
+
+// Rows gives the result of the query.
+func (q *Query) Rows() [][]string {
+	rows := q.rows
+	if q.aggregate {
+		rows = make([][]interface{}, 0, len(q.keys))
+		for _, k := range q.keys {
+			rows = append(rows, q.groups[k].result(q.columns))
+		}
+		if len(q.keys) == 0 && len(q.groupBy) == 0 {
+			var grp queryGroup
+			grp.values = make([]interface{}, len(q.columns))
+			grp.aggs = make([]aggregate, len(q.columns))
+			rows = append(rows, grp.result(q.columns))
+		}
+	}
+	if len(q.order) > 0 {
+		sort.SliceStable(rows, func(i, j int) bool {
+			for _, o := range q.order {
+				c := compareValues(rows[i][o.index], rows[j][o.index])
+				if c == 0 {
+					continue
+				}
+				return (c < 0) != o.desc
+			}
+			return false
+		})
+	}
+	if q.limit > 0 && len(rows) > q.limit {
+		rows = rows[:q.limit]
+	}
+	list := make([][]string, len(rows))
+	for i, row := range rows {
+		list[i] = make([]string, len(row))
+		for j, v := range row {
+			if f, ok := v.(float64); ok {
+				list[i][j] = strconv.FormatFloat(f, 'f', -1, 64)
+				continue
+			}
+			list[i][j] = fieldString(v)
+		}
+	}
+	return list
+}
+
+func (g *queryGroup) result(columns []column) []interface{} {
+	row := make([]interface{}, len(columns))
+	for i, c := range columns {
+		if c.agg == "" {
+			row[i] = g.values[i]
+			continue
+		}
+		a := g.aggs[i]
+		switch c.agg {
+		case "count":
+			row[i] = a.count
+		case "sum":
+			// like in SQL, the sum of no values is NULL
+			if a.count > 0 {
+				row[i] = a.sum
+			}
+		case "avg":
+			if a.count > 0 {
+				row[i] = a.sum / float64(a.count)
+			}
+		case "min":
+			row[i] = a.min
+		case "max":
+			row[i] = a.max
+		}
+	}
+	return row
+}
+
+func (a *aggregate) add(c column, e Entry) {
+	if c.field == "*" {
+		a.count++
+		return
+	}
+	v := getField(e, c.field)
+	if fieldString(v) == "" {
+		return
+	}
+	switch c.agg {
+	case "sum", "avg":
+		n, ok := toFloat(v)
+		if !ok {
+			return
+		}
+		a.sum += n
+	case "min", "max":
+		if d, ok := v.(time.Duration); ok {
+			v = d.Seconds()
+		}
+		if a.count == 0 || compareValues(v, a.min) < 0 {
+			a.min = v
+		}
+		if a.count == 0 || compareValues(v, a.max) > 0 {
+			a.max = v
+		}
+	}
+	a.count++
+}
+
+// compareValues compares two values of fields: as numbers when both are
+// numbers (or times), as text otherwise. Missing values come first.
+func compareValues(a, b interface{}) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		default:
+			return 1
+		}
+	}
+	if x, ok := toFloat(a); ok {
+		if y, ok := toFloat(b); ok {
+			return compareFloat(x, y)
+		}
+	}
+	return strings.Compare(fieldString(a), fieldString(b))
+}
+
+type sqlToken struct {
+	kind  rune
+	value string
+	pos   int
+}
+
+// kinds of the tokens of a query: the other ones are the operators and the
+// punctuation themselves.
+const (
+	sqlIdent  = 'i'
+	sqlString = 's'
+	sqlNumber = 'n'
+	sqlEOF    = 0
+)
+
+type sqlParser struct {
+	input  string
+	tokens []sqlToken
+	curr   int
+}
+
+func (p *sqlParser) tokenize() error {
+	for i := 0; i < len(p.input); {
+		r, n := utf8.DecodeRuneInString(p.input[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += n
+		case r == '\'':
+			var (
+				buf strings.Builder
+				j   = i + 1
+			)
+			for {
+				if j >= len(p.input) {
+					return p.errorAt(i, "unterminated string")
+				}
+				if p.input[j] == '\'' {
+					if j+1 < len(p.input) && p.input[j+1] == '\'' {
+						buf.WriteByte('\'')
+						j += 2
+						continue
+					}
+					break
+				}
+				buf.WriteByte(p.input[j])
+				j++
+			}
+			p.tokens = append(p.tokens, sqlToken{kind: sqlString, value: buf.String(), pos: i})
+			i = j + 1
+		case isDigit(r) || (r == '-' && i+1 < len(p.input) && isDigit(rune(p.input[i+1]))):
+			j := i + 1
+			for j < len(p.input) && (isDigit(rune(p.input[j])) || strings.IndexByte(".smhdwun", p.input[j]) >= 0) {
+				j++
+			}
+			p.tokens = append(p.tokens, sqlToken{kind: sqlNumber, value: p.input[i:j], pos: i})
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(p.input) {
+				r, n := utf8.DecodeRuneInString(p.input[j:])
+				if !isDigit(r) && !unicode.IsLetter(r) && r != '_' && r != '.' {
+					break
+				}
+				j += n
+			}
+			p.tokens = append(p.tokens, sqlToken{kind: sqlIdent, value: p.input[i:j], pos: i})
+			i = j
+		default:
+			op := string(r)
+			for _, o := range []string{"<=", ">=", "<>", "!="} {
+				if strings.HasPrefix(p.input[i:], o) {
+					op = o
+					break
+				}
+			}
+			if !strings.Contains("=<>!(),*;", op[:1]) || op == "!" {
+				return p.errorAt(i, fmt.Sprintf("unexpected %q", op))
+			}
+			p.tokens = append(p.tokens, sqlToken{kind: rune(op[0]), value: op, pos: i})
+			i += len(op)
+		}
+	}
+	p.tokens = append(p.tokens, sqlToken{kind: sqlEOF, pos: len(p.input)})
+	return nil
+}
+
+func (p *sqlParser) parse(q *Query) error {
+	if err := p.expectKeyword("select"); err != nil {
+		return err
+	}
+	if err := p.parseColumns(q); err != nil {
+		return err
+	}
+	if err := p.expectKeyword("from"); err != nil {
+		return err
+	}
+	if t := p.next(); t.kind != sqlIdent || !strings.EqualFold(t.value, "log") {
+		return p.errorAt(t.pos, "only the table log can be queried")
+	}
+	if p.acceptKeyword("where") {
+		keep, err := p.parseOr()
+		if err != nil {
+			return err
+		}
+		q.keep = keep
+	}
+	if p.acceptKeyword("group") {
+		if err := p.expectKeyword("by"); err != nil {
+			return err
+		}
+		for {
+			field, err := p.parseField()
+			if err != nil {
+				return err
+			}
+			q.groupBy = append(q.groupBy, field)
+			if !p.accept(',') {
+				break
+			}
+		}
+		q.aggregate = true
+	}
+	if p.acceptKeyword("order") {
+		if err := p.expectKeyword("by"); err != nil {
+			return err
+		}
+		for {
+			key, err := p.parseOrder(q)
+			if err != nil {
+				return err
+			}
+			q.order = append(q.order, key)
+			if !p.accept(',') {
+				break
+			}
+		}
+	}
+	if p.acceptKeyword("limit") {
+		t := p.next()
+		n, err := strconv.Atoi(t.value)
+		if t.kind != sqlNumber || err != nil || n < 0 {
+			return p.errorAt(t.pos, "invalid limit")
+		}
+		q.limit = n
+	}
+	p.accept(';')
+	if t := p.peek(); t.kind != sqlEOF {
+		return p.errorAt(t.pos, fmt.Sprintf("unexpected %q", t.value))
+	}
+	for _, c := range q.columns {
+		if c.agg == "" && q.aggregate && !containsField(q.groupBy, c.field) {
+			return syntaxError("sql", "%s should be in GROUP BY or in an aggregate", c.field)
+		}
+	}
+	return nil
+}
+
+func (p *sqlParser) parseColumns(q *Query) error {
+	for {
+		if p.accept('*') {
+			for _, f := range starColumns {
+				q.columns = append(q.columns, column{name: f, field: f})
+			}
+		} else {
+			c, err := p.parseColumn()
+			if err != nil {
+				return err
+			}
+			if p.acceptKeyword("as") {
+				t := p.next()
+				if t.kind != sqlIdent && t.kind != sqlString {
+					return p.errorAt(t.pos, "name expected after AS")
+				}
+				c.name = t.value
+			} else if t := p.peek(); t.kind == sqlIdent && !isKeyword(t.value) {
+				c.name = p.next().value
+			}
+			q.aggregate = q.aggregate || c.agg != ""
+			q.columns = append(q.columns, c)
+		}
+		if !p.accept(',') {
+			return nil
+		}
+	}
+}
+
+// parseColumn parses a field or an aggregate.
+func (p *sqlParser) parseColumn() (column, error) {
+	t := p.peek()
+	if t.kind != sqlIdent {
+		return column{}, p.errorAt(t.pos, "column expected")
+	}
+	agg := strings.ToLower(t.value)
+	switch agg {
+	case "count", "sum", "avg", "min", "max":
+		if p.tokens[p.curr+1].kind != '(' {
+			break
+		}
+		p.curr += 2
+		c := column{agg: agg, field: "*"}
+		if agg != "count" || !p.accept('*') {
+			field, err := p.parseField()
+			if err != nil {
+				return c, err
+			}
+			c.field = field
+		}
+		if err := p.expect(')'); err != nil {
+			return c, err
+		}
+		c.name = agg + "(" + c.field + ")"
+		return c, nil
+	}
+	field, err := p.parseField()
+	return column{name: field, field: field}, err
+}
+
+func (p *sqlParser) parseOrder(q *Query) (orderKey, error) {
+	var key orderKey
+	t := p.peek()
+	switch t.kind {
+	case sqlNumber:
+		p.next()
+		n, err := strconv.Atoi(t.value)
+		if err != nil || n < 1 || n > len(q.columns) {
+			return key, p.errorAt(t.pos, "invalid column position")
+		}
+		key.index = n - 1
+	case sqlIdent:
+		key.index = -1
+		for i, c := range q.columns {
+			if c.name == t.value {
+				key.index = i
+				p.next()
+				break
+			}
+		}
+		if key.index >= 0 {
+			break
+		}
+		c, err := p.parseColumn()
+		if err != nil {
+			return key, err
+		}
+		for i, other := range q.columns {
+			if other.field == c.field && other.agg == c.agg {
+				key.index = i
+				break
+			}
+		}
+		if key.index < 0 {
+			return key, p.errorAt(t.pos, fmt.Sprintf("%s is not a column of the result", c.name))
+		}
+	default:
+		return key, p.errorAt(t.pos, "column expected")
+	}
+	if p.acceptKeyword("desc") {
+		key.desc = true
+	} else {
+		p.acceptKeyword("asc")
+	}
+	return key, nil
+}
+
+func (p *sqlParser) parseOr() (filterfunc, error) {
+	var fs []filterfunc
+	for {
+		fn, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, fn)
+		if !p.acceptKeyword("or") {
+			break
+		}
+	}
+	if len(fs) == 1 {
+		return fs[0], nil
+	}
+	return mergeFilter(fs, false), nil
+}
+
+func (p *sqlParser) parseAnd() (filterfunc, error) {
+	var fs []filterfunc
+	for {
+		fn, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, fn)
+		if !p.acceptKeyword("and") {
+			break
+		}
+	}
+	if len(fs) == 1 {
+		return fs[0], nil
+	}
+	return mergeFilter(fs, true), nil
+}
+
+func (p *sqlParser) parseNot() (filterfunc, error) {
+	if p.acceptKeyword("not") {
+		fn, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return negate(fn), nil
+	}
+	if p.accept('(') {
+		fn, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return fn, p.expect(')')
+	}
+	return p.parseCondition()
+}
+
+func (p *sqlParser) parseCondition() (filterfunc, error) {
+	field, err := p.parseField()
+	if err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("is") {
+		not := p.acceptKeyword("not")
+		if err := p.expectKeyword("null"); err != nil {
+			return nil, err
+		}
+		fn := func(e Entry) bool {
+			return fieldString(getField(e, field)) == ""
+		}
+		if not {
+			return negate(fn), nil
+		}
+		return fn, nil
+	}
+	not := p.acceptKeyword("not")
+	var fn filterfunc
+	switch {
+	case p.acceptKeyword("like"):
+		t := p.next()
+		if t.kind != sqlString {
+			return nil, p.errorAt(t.pos, "pattern expected after LIKE")
+		}
+		fn = makeMatch(field, compileLike(t.value))
+	case p.acceptKeyword("in"):
+		if err := p.expect('('); err != nil {
+			return nil, err
+		}
+		var fs []filterfunc
+		for {
+			lit, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			fs = append(fs, makeCompare(field, "eq", lit))
+			if !p.accept(',') {
+				break
+			}
+		}
+		if err := p.expect(')'); err != nil {
+			return nil, err
+		}
+		fn = mergeFilter(fs, false)
+	case p.acceptKeyword("between"):
+		lower, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("and"); err != nil {
+			return nil, err
+		}
+		upper, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		fn = mergeFilter([]filterfunc{
+			makeCompare(field, "ge", lower),
+			makeCompare(field, "le", upper),
+		}, true)
+	case not:
+		t := p.peek()
+		return nil, p.errorAt(t.pos, "LIKE, IN or BETWEEN expected after NOT")
+	default:
+		t := p.next()
+		ops := map[string]string{
+			"=":  "eq",
+			"!=": "ne",
+			"<>": "ne",
+			"<":  "lt",
+			"<=": "le",
+			">":  "gt",
+			">=": "ge",
+		}
+		op, ok := ops[t.value]
+		if !ok || t.kind == sqlString || t.kind == sqlIdent {
+			return nil, p.errorAt(t.pos, "operator expected")
+		}
+		lit, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		return makeCompare(field, op, lit), nil
+	}
+	if not {
+		return negate(fn), nil
+	}
+	return fn, nil
+}
+
+// parseValue parses a string, a number or a field whose value is compared.
+func (p *sqlParser) parseValue() (literal, error) {
+	t := p.next()
+	switch t.kind {
+	case sqlString, sqlNumber:
+		return makeLiteral(t.value), nil
+	case sqlIdent:
+		if !isField(t.value) {
+			return literal{}, p.errorAt(t.pos, fmt.Sprintf("unknown field %s", t.value))
+		}
+		return literal{ref: t.value}, nil
+	default:
+		return literal{}, p.errorAt(t.pos, "value expected")
+	}
+}
+
+func (p *sqlParser) parseField() (string, error) {
+	t := p.next()
+	if t.kind != sqlIdent || isKeyword(t.value) {
+		return "", p.errorAt(t.pos, "field expected")
+	}
+	if !isField(t.value) {
+		return "", p.errorAt(t.pos, fmt.Sprintf("unknown field %s", t.value))
+	}
+	return t.value, nil
+}
+
+func (p *sqlParser) peek() sqlToken {
+	return p.tokens[p.curr]
+}
+
+func (p *sqlParser) next() sqlToken {
+	t := p.tokens[p.curr]
+	if t.kind != sqlEOF {
+		p.curr++
+	}
+	return t
+}
+
+func (p *sqlParser) accept(kind rune) bool {
+	if p.peek().kind != kind {
+		return false
+	}
+	p.next()
+	return true
+}
+
+func (p *sqlParser) expect(kind rune) error {
+	if t := p.peek(); !p.accept(kind) {
+		err := p.errorAt(t.pos, fmt.Sprintf("%c expected", kind))
+		err.Expected, err.Got = string(kind), t.value
+		return err
+	}
+	return nil
+}
+
+func (p *sqlParser) acceptKeyword(kw string) bool {
+	t := p.peek()
+	if t.kind != sqlIdent || !strings.EqualFold(t.value, kw) {
+		return false
+	}
+	p.next()
+	return true
+}
+
+func (p *sqlParser) expectKeyword(kw string) error {
+	if t := p.peek(); !p.acceptKeyword(kw) {
+		err := p.errorAt(t.pos, fmt.Sprintf("%s expected", strings.ToUpper(kw)))
+		err.Expected, err.Got = strings.ToUpper(kw), t.value
+		return err
+	}
+	return nil
+}
+
+func (p *sqlParser) errorAt(pos int, msg string) *SyntaxError {
+	return syntaxErrorAt("sql", pos, "%s", msg)
+}
+
+var sqlKeywords = []string{
+	"select", "from", "where", "group", "order", "by", "limit", "as", "and",
+	"or", "not", "like", "in", "between", "is", "null", "asc", "desc",
+}
+
+func isKeyword(str string) bool {
+	for _, k := range sqlKeywords {
+		if strings.EqualFold(k, str) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsField(list []string, field string) bool {
+	for _, f := range list {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func negate(fn filterfunc) filterfunc {
+	return func(e Entry) bool {
+		return !fn(e)
+	}
+}
+
+// compileLike converts a LIKE pattern into a regexp matching the whole value.
+func compileLike(pattern string) *regexp.Regexp {
+	var buf strings.Builder
+	buf.WriteString("^(?s:")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			buf.WriteString(".*")
+		case '_':
+			buf.WriteString(".")
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	buf.WriteString(")$")
+	return regexp.MustCompile(buf.String())
+}
@@ -0,0 +1,117 @@
+package log
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func queryEntries(t *testing.T, pattern string, lines ...string) []Entry {
+	t.Helper()
+	p, err := CompilePattern(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []Entry
+	for _, line := range lines {
+		e, err := p.Parse(line)
+		if err != nil {
+			t.Fatalf("%s: %s", line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func runQuery(t *testing.T, query string, entries []Entry) ([]string, *Query) {
+	t.Helper()
+	q, err := CompileQuery(query)
+	if err != nil {
+		t.Errorf("%s: %s", query, err)
+		return nil, nil
+	}
+	for _, e := range entries {
+		if err := q.Write(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var rows []string
+	for _, row := range q.Rows() {
+		rows = append(rows, strings.Join(row, ","))
+	}
+	return rows, q
+}
+
+func TestQuery(t *testing.T) {
+	entries := queryEntries(t, "%l %n %k",
+		"error web n=9 ms=1.5",
+		"info web n=10 ms=2",
+		"error db n=200",
+		"warn db n=30 ms=4",
+		"info cache n=5 ms=0.5",
+	)
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"SELECT level, process FROM log WHERE level = 'error'", []string{"error,web", "error,db"}},
+		{"select process from log where level = 'info' and not process = 'web'", []string{"cache"}},
+		{"SELECT process, count(*) FROM log GROUP BY process ORDER BY 2 DESC, process", []string{"db,2", "web,2", "cache,1"}},
+		{"SELECT process, sum(named.ms) AS total FROM log GROUP BY process ORDER BY total DESC", []string{"db,4", "web,3.5", "cache,0.5"}},
+		{"SELECT sum(named.ms), avg(named.ms), min(named.n), max(named.n), count(named.ms) FROM log", []string{"8,2,5,200,4"}},
+		{"SELECT process, sum(named.ms) FROM log WHERE level = 'error' GROUP BY process ORDER BY process", []string{"db,", "web,1.5"}},
+		{"SELECT sum(named.nope), count(*) FROM log WHERE level = 'debug'", []string{",0"}},
+		{"SELECT named.n FROM log WHERE process LIKE 'w%' OR process LIKE '_b'", []string{"9", "10", "200", "30"}},
+		{"SELECT process FROM log WHERE named.ms IS NULL", []string{"db"}},
+		{"SELECT count(*) FROM log WHERE named.ms IS NOT NULL", []string{"4"}},
+		{"SELECT process FROM log WHERE level NOT IN ('error', 'warn')", []string{"web", "cache"}},
+		{"SELECT named.n FROM log LIMIT 2", []string{"9", "10"}},
+		{"SELECT named.n FROM log ORDER BY named.n DESC LIMIT 2", []string{"200", "30"}},
+		{"SELECT named.n FROM log WHERE named.n > 20", []string{"200", "30"}},
+		{"SELECT named.n FROM log WHERE named.n BETWEEN 5 AND 50", []string{"9", "10", "30", "5"}},
+		{"SELECT named.n FROM log WHERE named.n NOT BETWEEN 5 AND 50", []string{"200"}},
+		{"SELECT named.n FROM log WHERE named.n IN (10, 30.0)", []string{"10", "30"}},
+		{"SELECT named.n FROM log WHERE named.n > 20 ORDER BY named.n", []string{"30", "200"}},
+		{"SELECT named.n FROM log WHERE named.n > named.ms ORDER BY 1", []string{"5", "9", "10", "30"}},
+	}
+	for _, tt := range tests {
+		got, _ := runQuery(t, tt.query, entries)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestQueryLimitRows(t *testing.T) {
+	var lines []string
+	for i := 0; i < 100; i++ {
+		lines = append(lines, "info web n=1")
+	}
+	_, q := runQuery(t, "SELECT named.n FROM log LIMIT 3", queryEntries(t, "%l %n %k", lines...))
+	if q != nil && len(q.rows) != 3 {
+		t.Errorf("%d rows kept, want 3", len(q.rows))
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	queries := []string{
+		"",
+		"SELECT FROM log",
+		"SELECT level FROM",
+		"SELECT nope FROM log",
+		"SELECT level, count(*) FROM log",
+		"SELECT level FROM log ORDER BY process",
+		"SELECT level FROM log ORDER BY 2",
+		"SELECT level FROM log LIMIT x",
+		"SELECT level FROM log WHERE level = ",
+		"SELECT level FROM log WHERE level NOT = 'x'",
+		"SELECT level FROM log WHERE level LIKE 3",
+		"SELECT level FROM log WHERE message = 'unterminated",
+		"SELECT level FROM log extra",
+	}
+	for _, query := range queries {
+		if _, err := CompileQuery(query); err == nil {
+			t.Errorf("%q: compiled", query)
+		}
+	}
+}
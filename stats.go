@@ -0,0 +1,224 @@
+package log
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Count is the number of entries having a value. First and Last are the
+// earliest and latest times of these entries, zero when none has a time.
+type Count struct {
+	Value   string
+	Count   int
+	Percent float64
+	First   time.Time
+	Last    time.Time
+}
+
+func (c *Count) add(when time.Time) {
+	c.Count++
+	seen(&c.First, &c.Last, when)
+}
+
+// seen extends the period from first to last to when, unless it is zero.
+func seen(first, last *time.Time, when time.Time) {
+	if when.IsZero() {
+		return
+	}
+	if first.IsZero() || when.Before(*first) {
+		*first = when
+	}
+	if when.After(*last) {
+		*last = when
+	}
+}
+
+type Top struct {
+	field  string
+	limit  int
+	total  int
+	counts map[string]*Count
+}
+
+func TopN(field string, n int) (*Top, error) {
+	if !isField(field) {
+		return nil, fmt.Errorf("%s: unknown field", field)
+	}
+	t := Top{
+		field:  field,
+		limit:  n,
+		counts: make(map[string]*Count),
+	}
+	return &t, nil
+}
+
+func (t *Top) Write(e Entry) error {
+	t.total++
+	countOf(t.counts, fieldString(getField(e, t.field))).add(e.When)
+	return nil
+}
+
+func (t *Top) Total() int {
+	return t.total
+}
+
+func (t *Top) Counts() []Count {
+	return sortCounts(t.counts, t.total, t.limit)
+}
+
+// countOf gives the Count of value in counts, adding it when it is missing.
+func countOf(counts map[string]*Count, value string) *Count {
+	c, ok := counts[value]
+	if !ok {
+		c = &Count{Value: value}
+		counts[value] = c
+	}
+	return c
+}
+
+func sortCounts(counts map[string]*Count, total, limit int) []Count {
+	cs := make([]Count, 0, len(counts))
+	for _, c := range counts {
+		x := *c
+		x.Percent = float64(c.Count) * 100 / float64(total)
+		cs = append(cs, x)
+	}
+	sort.Slice(cs, func(i, j int) bool {
+		if cs[i].Count == cs[j].Count {
+			return cs[i].Value < cs[j].Value
+		}
+		return cs[i].Count > cs[j].Count
+	})
+	if limit > 0 && len(cs) > limit {
+		cs = cs[:limit]
+	}
+	return cs
+}
+
+type Group struct {
+	Value  string
+	Count  int
+	First  time.Time
+	Last   time.Time
+	Sample string
+
+	Entries []Entry
+}
+
+type Groups struct {
+	field  string
+	keep   bool
+	groups map[string]*Group
+}
+
+func GroupBy(field string) (*Groups, error) {
+	if !isField(field) {
+		return nil, fmt.Errorf("%s: unknown field", field)
+	}
+	g := Groups{
+		field:  field,
+		groups: make(map[string]*Group),
+	}
+	return &g, nil
+}
+
+// Keep makes the Groups retain the entries of each group in Group.Entries.
+func (g *Groups) Keep() *Groups {
+	g.keep = true
+	return g
+}
+
+func (g *Groups) Write(e Entry) error {
+	key := fieldString(getField(e, g.field))
+	grp, ok := g.groups[key]
+	if !ok {
+		grp = &Group{
+			Value:  key,
+			Sample: e.Message,
+		}
+		g.groups[key] = grp
+	}
+	grp.Count++
+	seen(&grp.First, &grp.Last, e.When)
+	if g.keep {
+		grp.Entries = append(grp.Entries, e)
+	}
+	return nil
+}
+
+// Groups returns the groups sorted by count, the biggest first.
+func (g *Groups) Groups() []Group {
+	gs := make([]Group, 0, len(g.groups))
+	for _, grp := range g.groups {
+		gs = append(gs, *grp)
+	}
+	sort.Slice(gs, func(i, j int) bool {
+		if gs[i].Count == gs[j].Count {
+			return gs[i].Value < gs[j].Value
+		}
+		return gs[i].Count > gs[j].Count
+	})
+	return gs
+}
+
+// Summary computes the count, the mean, the minimum, the maximum and the
+// quantiles of the numeric values of a field without keeping them in memory.
+// Durations are counted in seconds. Entries where the field is not a number
+// are ignored.
+type Summary struct {
+	field  string
+	sum    float64
+	digest *digest
+}
+
+func Summarize(field string) (*Summary, error) {
+	if !isField(field) {
+		return nil, fmt.Errorf("%s: unknown field", field)
+	}
+	s := Summary{
+		field:  field,
+		digest: newDigest(defaultCompression),
+	}
+	return &s, nil
+}
+
+func (s *Summary) Write(e Entry) error {
+	v, ok := toFloat(getField(e, s.field))
+	if ok {
+		s.sum += v
+		s.digest.Add(v)
+	}
+	return nil
+}
+
+func (s *Summary) Count() int {
+	return int(s.digest.total)
+}
+
+func (s *Summary) Mean() float64 {
+	if s.digest.total == 0 {
+		return 0
+	}
+	return s.sum / s.digest.total
+}
+
+func (s *Summary) Min() float64 {
+	if s.digest.total == 0 {
+		return 0
+	}
+	return s.digest.min
+}
+
+func (s *Summary) Max() float64 {
+	if s.digest.total == 0 {
+		return 0
+	}
+	return s.digest.max
+}
+
+// Quantile gives an approximation of the q-quantile (eg, 0.95 for the 95th
+// percentile) of the values.
+func (s *Summary) Quantile(q float64) float64 {
+	return s.digest.Quantile(q)
+}
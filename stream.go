@@ -0,0 +1,89 @@
+package log
+
+import (
+	"context"
+	"io"
+)
+
+// Stream reads the entries of r in its own goroutine and sends them to the
+// returned channel. The channel holds up to readAhead entries: once it is
+// full, the reading waits for the consumers. It is closed at the end of r,
+// after the first error or when ctx is done, the error (ctx.Err() for the
+// latter) being then sent to the error channel. The error channel is closed
+// with the entries one and gives nothing at the end of r. r should not be used
+// anymore until the entries channel is closed.
+func (r *Reader) Stream(ctx context.Context) (<-chan Entry, <-chan error) {
+	var (
+		ch   = make(chan Entry, readAhead)
+		errs = make(chan error, 1)
+	)
+	go func() {
+		defer close(errs)
+		defer close(ch)
+		for {
+			if err := ctx.Err(); err != nil {
+				errs <- err
+				return
+			}
+			e, err := r.Read()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case ch <- e:
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+		}
+	}()
+	return ch, errs
+}
+
+// Fanout copies the entries received from ch to n channels, for consumers
+// that all need all the entries, like a writer and the computation of
+// statistics. Each channel holds up to readAhead entries and the slowest
+// consumer sets the pace of the others. The channels are closed once ch is
+// closed or ctx is done. The entries are shared by the consumers that should
+// not modify their Named and Values maps nor their Words.
+func Fanout(ctx context.Context, ch <-chan Entry, n int) []<-chan Entry {
+	var (
+		outs = make([]chan Entry, n)
+		list = make([]<-chan Entry, n)
+	)
+	for i := range outs {
+		outs[i] = make(chan Entry, readAhead)
+		list[i] = outs[i]
+	}
+	go func() {
+		defer func() {
+			for _, c := range outs {
+				close(c)
+			}
+		}()
+		for {
+			var e Entry
+			select {
+			case x, ok := <-ch:
+				if !ok {
+					return
+				}
+				e = x
+			case <-ctx.Done():
+				return
+			}
+			for _, c := range outs {
+				select {
+				case c <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return list
+}
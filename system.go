@@ -0,0 +1,125 @@
+package log
+
+import (
+	"os/user"
+	"strconv"
+	"sync"
+)
+
+type SystemOption func(*systemEnricher)
+
+// ResolveAccounts replaces the numeric users and groups by their names and
+// stores their ids in the uid and gid named words.
+func ResolveAccounts() SystemOption {
+	return func(s *systemEnricher) {
+		s.accounts = true
+	}
+}
+
+// CheckProcesses stores in the alive named word whether the process of the
+// pid of each entry is still running. It is only known on linux.
+func CheckProcesses() SystemOption {
+	return func(s *systemEnricher) {
+		s.processes = true
+	}
+}
+
+type systemEnricher struct {
+	accounts  bool
+	processes bool
+
+	mu     sync.Mutex
+	users  map[string]account
+	groups map[string]account
+}
+
+type account struct {
+	name string
+	id   int
+	ok   bool
+}
+
+// EnrichSystem returns a transform completing the entries with the accounts
+// and the processes of the local system, for logs analyzed on the machine
+// that wrote them. Without options, all enrichments are done. Lookups are
+// cached for the life of the transform.
+func EnrichSystem(opts ...SystemOption) func(Entry) Entry {
+	s := systemEnricher{
+		users:  make(map[string]account),
+		groups: make(map[string]account),
+	}
+	for _, o := range opts {
+		o(&s)
+	}
+	if len(opts) == 0 {
+		s.accounts, s.processes = true, true
+	}
+	return func(e Entry) Entry {
+		if s.accounts {
+			if a := s.lookup(s.users, e.User, lookupUser); a.ok {
+				e.User = a.name
+				setDerived(&e, "uid", a.id)
+			}
+			if a := s.lookup(s.groups, e.Group, lookupGroup); a.ok {
+				e.Group = a.name
+				setDerived(&e, "gid", a.id)
+			}
+		}
+		if s.processes && e.Pid > 0 {
+			if alive, ok := processAlive(e.Pid); ok {
+				setDerived(&e, "alive", alive)
+			}
+		}
+		return e
+	}
+}
+
+func (s *systemEnricher) lookup(cache map[string]account, str string, find func(string) account) account {
+	if str == "" {
+		return account{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := cache[str]
+	if !ok {
+		a = find(str)
+		cache[str] = a
+	}
+	return a
+}
+
+// lookupUser finds the user of a name or of a numeric id.
+func lookupUser(str string) account {
+	var (
+		u   *user.User
+		err error
+	)
+	if _, err = strconv.Atoi(str); err == nil {
+		u, err = user.LookupId(str)
+	} else {
+		u, err = user.Lookup(str)
+	}
+	if err != nil {
+		return account{}
+	}
+	id, err := strconv.Atoi(u.Uid)
+	return account{name: u.Username, id: id, ok: err == nil}
+}
+
+// lookupGroup finds the group of a name or of a numeric id.
+func lookupGroup(str string) account {
+	var (
+		g   *user.Group
+		err error
+	)
+	if _, err = strconv.Atoi(str); err == nil {
+		g, err = user.LookupGroupId(str)
+	} else {
+		g, err = user.LookupGroup(str)
+	}
+	if err != nil {
+		return account{}
+	}
+	id, err := strconv.Atoi(g.Gid)
+	return account{name: g.Name, id: id, ok: err == nil}
+}
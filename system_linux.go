@@ -0,0 +1,13 @@
+package log
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processAlive tells whether a process runs with the given pid. Processes of
+// other users are seen as running even if they can not be signaled.
+func processAlive(pid int) (bool, bool) {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM), true
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package log
+
+// processAlive is only known on linux.
+func processAlive(_ int) (bool, bool) {
+	return false, false
+}
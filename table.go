@@ -0,0 +1,183 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	defaultTableRows  = 100
+	defaultTableWidth = 60
+	ellipsis          = "…"
+)
+
+type TableOption func(*tableWriter)
+
+// WithBorder draws a border around the table and between its columns.
+func WithBorder() TableOption {
+	return func(t *tableWriter) {
+		t.border = true
+	}
+}
+
+// WithMaxWidth sets the maximum width of a column. Longer values are
+// truncated and end with an ellipsis.
+func WithMaxWidth(width int) TableOption {
+	return func(t *tableWriter) {
+		if width > 1 {
+			t.max = width
+		}
+	}
+}
+
+// WithSample sets the number of entries buffered to compute the width of the
+// columns before the table is printed.
+func WithSample(rows int) TableOption {
+	return func(t *tableWriter) {
+		if rows > 0 {
+			t.sample = rows
+		}
+	}
+}
+
+type tableWriter struct {
+	inner   io.Writer
+	columns []string
+	widths  []int
+	rows    [][]string
+	buffer  bytes.Buffer
+
+	border bool
+	max    int
+	sample int
+	ready  bool
+}
+
+// Table returns a Writer that prints entries as an aligned table with one
+// column per field. The width of the columns is computed from the first
+// entries (see WithSample): values written after that are truncated to it.
+func Table(w io.Writer, columns []string, opts ...TableOption) (Writer, error) {
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("table: no columns given")
+	}
+	for _, c := range columns {
+		if !isField(c) {
+			return nil, fmt.Errorf("table: %s: unknown field", c)
+		}
+	}
+	t := tableWriter{
+		inner:   w,
+		columns: columns,
+		widths:  make([]int, len(columns)),
+		max:     defaultTableWidth,
+		sample:  defaultTableRows,
+	}
+	for _, o := range opts {
+		o(&t)
+	}
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = strings.ToUpper(c)
+	}
+	t.measure(header)
+	t.rows = append(t.rows, header)
+	return &t, nil
+}
+
+func (t *tableWriter) Write(e Entry) error {
+	row := make([]string, len(t.columns))
+	for i, c := range t.columns {
+		row[i] = strings.ReplaceAll(fieldString(getField(e, c)), "\t", " ")
+	}
+	if t.ready {
+		t.printRow(row)
+		return t.flush()
+	}
+	t.measure(row)
+	t.rows = append(t.rows, row)
+	if len(t.rows) > t.sample {
+		return t.Flush()
+	}
+	return nil
+}
+
+func (t *tableWriter) Flush() error {
+	if !t.ready {
+		t.ready = true
+		t.printLine()
+		for i, row := range t.rows {
+			t.printRow(row)
+			if i == 0 {
+				t.printLine()
+			}
+		}
+		t.rows = nil
+	}
+	return t.flush()
+}
+
+func (t *tableWriter) Close() error {
+	if err := t.Flush(); err != nil {
+		return err
+	}
+	t.printLine()
+	return t.flush()
+}
+
+func (t *tableWriter) measure(row []string) {
+	for i, str := range row {
+		n := utf8.RuneCountInString(str)
+		if n > t.max {
+			n = t.max
+		}
+		if n > t.widths[i] {
+			t.widths[i] = n
+		}
+	}
+}
+
+func (t *tableWriter) printRow(row []string) {
+	if t.border {
+		t.buffer.WriteString("| ")
+	}
+	for i, str := range row {
+		if i > 0 {
+			if t.border {
+				t.buffer.WriteString(" | ")
+			} else {
+				t.buffer.WriteString("  ")
+			}
+		}
+		width := t.widths[i]
+		if n := utf8.RuneCountInString(str); n > width {
+			str = string([]rune(str)[:width-1]) + ellipsis
+		} else if t.border || i < len(row)-1 {
+			str += strings.Repeat(" ", width-n)
+		}
+		t.buffer.WriteString(str)
+	}
+	if t.border {
+		t.buffer.WriteString(" |")
+	}
+	t.buffer.WriteByte('\n')
+}
+
+func (t *tableWriter) printLine() {
+	if !t.border {
+		return
+	}
+	t.buffer.WriteByte('+')
+	for _, w := range t.widths {
+		t.buffer.WriteString(strings.Repeat("-", w+2))
+		t.buffer.WriteByte('+')
+	}
+	t.buffer.WriteByte('\n')
+}
+
+func (t *tableWriter) flush() error {
+	_, err := io.Copy(t.inner, &t.buffer)
+	return err
+}
@@ -0,0 +1,225 @@
+package log
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// placeholders of the variable tokens of the messages.
+const (
+	numToken  = "<num>"
+	hexToken  = "<hex>"
+	uuidToken = "<uuid>"
+	ipToken   = "<ip>"
+	anyToken  = "<*>"
+)
+
+// Templates clusters the messages of the entries into templates, like the Drain
+// algorithm does. The tokens of the messages looking like numbers, durations,
+// hexadecimal values, UUIDs and IP addresses are first replaced by
+// placeholders. Then a message joins the most similar template having the same
+// number of tokens and starting with the same token if the share of their
+// tokens being equal reaches the similarity. The tokens of the template not
+// equal to the ones of the message become <*>.
+type Templates struct {
+	similarity float64
+	total      int
+	clusters   map[string][]*cluster
+}
+
+type cluster struct {
+	tokens []string
+	count  int
+	first  time.Time
+	last   time.Time
+}
+
+// NewTemplates creates a Templates with the given similarity, between 0 and 1.
+// The default similarity (0.5) is used when it is out of this range.
+func NewTemplates(similarity float64) *Templates {
+	if similarity <= 0 || similarity > 1 {
+		similarity = 0.5
+	}
+	return &Templates{
+		similarity: similarity,
+		clusters:   make(map[string][]*cluster),
+	}
+}
+
+func (t *Templates) Write(e Entry) error {
+	tokens := maskTokens(e.Message)
+	t.total++
+
+	key := strconv.Itoa(len(tokens))
+	if len(tokens) > 0 && !isPlaceholder(tokens[0]) {
+		key += " " + tokens[0]
+	}
+	var (
+		best  *cluster
+		score float64
+	)
+	for _, c := range t.clusters[key] {
+		if s := c.similarity(tokens); best == nil || s > score {
+			best, score = c, s
+		}
+	}
+	if best == nil || score < t.similarity {
+		best = &cluster{tokens: tokens}
+		t.clusters[key] = append(t.clusters[key], best)
+	} else {
+		best.merge(tokens)
+	}
+	best.count++
+	seen(&best.first, &best.last, e.When)
+	return nil
+}
+
+func (t *Templates) Total() int {
+	return t.total
+}
+
+// Counts gives the templates (in Value) from the most to the least frequent,
+// with the times of their first and last messages.
+func (t *Templates) Counts() []Count {
+	counts := make(map[string]*Count)
+	for _, cs := range t.clusters {
+		for _, c := range cs {
+			x := countOf(counts, strings.Join(c.tokens, " "))
+			x.Count += c.count
+			seen(&x.First, &x.Last, c.first)
+			seen(&x.First, &x.Last, c.last)
+		}
+	}
+	return sortCounts(counts, t.total, 0)
+}
+
+func (c *cluster) similarity(tokens []string) float64 {
+	if len(tokens) == 0 {
+		return 1
+	}
+	var same int
+	for i := range tokens {
+		if c.tokens[i] == tokens[i] || c.tokens[i] == anyToken {
+			same++
+		}
+	}
+	return float64(same) / float64(len(tokens))
+}
+
+func (c *cluster) merge(tokens []string) {
+	for i := range tokens {
+		if c.tokens[i] != tokens[i] {
+			c.tokens[i] = anyToken
+		}
+	}
+}
+
+func isPlaceholder(token string) bool {
+	switch token {
+	case numToken, hexToken, uuidToken, ipToken, anyToken:
+		return true
+	default:
+		return false
+	}
+}
+
+// maskTokens splits msg on blanks and replaces the variable tokens. The
+// punctuation around a token and the key of a key=value token are kept.
+func maskTokens(msg string) []string {
+	tokens := strings.Fields(msg)
+	for i, tok := range tokens {
+		if ph := maskToken(tok); ph != "" {
+			tokens[i] = ph
+			continue
+		}
+		var prefix string
+		if x := strings.IndexAny(tok, "=:"); x > 0 && x < len(tok)-1 && !strings.HasPrefix(tok[x+1:], "/") {
+			prefix, tok = tok[:x+1], tok[x+1:]
+		}
+		core := strings.TrimFunc(tok, isTrimmed)
+		if core == "" {
+			continue
+		}
+		if ph := maskToken(core); ph != "" {
+			x := strings.Index(tok, core)
+			tokens[i] = prefix + tok[:x] + ph + tok[x+len(core):]
+		}
+	}
+	return tokens
+}
+
+func isTrimmed(r rune) bool {
+	return unicode.IsPunct(r) && r != '/' && r != '-' && r != '_'
+}
+
+func maskToken(tok string) string {
+	switch {
+	case isUUID(tok):
+		return uuidToken
+	case isIP(tok):
+		return ipToken
+	case isNumber(tok):
+		return numToken
+	case isHex(tok):
+		return hexToken
+	default:
+		return ""
+	}
+}
+
+func isNumber(tok string) bool {
+	if _, err := strconv.ParseFloat(tok, 64); err == nil {
+		return true
+	}
+	_, err := time.ParseDuration(tok)
+	return err == nil
+}
+
+func isHex(tok string) bool {
+	var digit bool
+	if strings.HasPrefix(tok, "0x") || strings.HasPrefix(tok, "0X") {
+		tok, digit = tok[2:], true
+	} else if len(tok) < 8 {
+		return false
+	}
+	for _, c := range tok {
+		switch {
+		case c >= '0' && c <= '9':
+			digit = true
+		case (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F'):
+		default:
+			return false
+		}
+	}
+	return tok != "" && digit
+}
+
+func isUUID(tok string) bool {
+	if len(tok) != 36 {
+		return false
+	}
+	for i, c := range tok {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isIP(tok string) bool {
+	if net.ParseIP(tok) != nil {
+		return true
+	}
+	host, _, err := net.SplitHostPort(tok)
+	return err == nil && net.ParseIP(host) != nil
+}
@@ -0,0 +1,88 @@
+package log
+
+import (
+	"fmt"
+	"time"
+)
+
+type throttleWriter struct {
+	inner  Writer
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+
+	suppressed int
+}
+
+// Throttle limits the number of entries written to w to perSecond entries per
+// second with bursts of up to burst entries. Entries over the limit are
+// dropped and a summary entry with their count is written once entries are
+// accepted again.
+func Throttle(w Writer, perSecond, burst int) Writer {
+	if perSecond <= 0 {
+		return w
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &throttleWriter{
+		inner:  w,
+		rate:   float64(perSecond),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		now:    time.Now,
+	}
+}
+
+func (t *throttleWriter) Write(e Entry) error {
+	now := t.now()
+	if !t.last.IsZero() {
+		t.tokens += now.Sub(t.last).Seconds() * t.rate
+		if t.tokens > t.burst {
+			t.tokens = t.burst
+		}
+	}
+	t.last = now
+	if t.tokens < 1 {
+		t.suppressed++
+		return nil
+	}
+	t.tokens--
+	if err := t.summary(now); err != nil {
+		return err
+	}
+	return t.inner.Write(e)
+}
+
+func (t *throttleWriter) Flush() error {
+	if err := t.summary(t.now()); err != nil {
+		return err
+	}
+	if f, ok := t.inner.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func (t *throttleWriter) Close() error {
+	err := t.summary(t.now())
+	if e := CloseWriter(t.inner); err == nil {
+		err = e
+	}
+	return err
+}
+
+func (t *throttleWriter) summary(now time.Time) error {
+	if t.suppressed == 0 {
+		return nil
+	}
+	e := Entry{
+		When:    now,
+		Level:   "WARNING",
+		Message: fmt.Sprintf("%d entries suppressed", t.suppressed),
+	}
+	t.suppressed = 0
+	return t.inner.Write(e)
+}
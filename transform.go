@@ -0,0 +1,346 @@
+package log
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// transform statements (separated by ;)
+// set(field, value): set field to value
+// replace(field, /regexp/, value): replace all matches of regexp in field
+// rename(field, field): move value of first field to second field
+// delete(field): clear field
+// derive(name, value): set named.<name> to a value or a number (see derive.go)
+
+// transform values
+// "literal", field, lower(value), upper(value), trim(value), concat(value...)
+
+type (
+	transformfunc func(*Entry) error
+	valuefunc     func(Entry) string
+)
+
+// CompileTransform compiles the statements of expr into a function rewriting
+// the entries. The statements are applied in order and the first one failing
+// (eg, setting pid to a value that is not a number) stops the function with
+// its error. The Named and Values of the entries given to the function are not
+// changed: they are copied before being rewritten.
+func CompileTransform(expr string) (func(Entry) (Entry, error), error) {
+	fn, err := parseTransform(expr)
+	if err != nil {
+		return nil, err
+	}
+	return func(e Entry) (Entry, error) {
+		e.Named, e.Values = copyNamed(e.Named), copyValues(e.Values)
+		err := fn(&e)
+		return e, err
+	}, nil
+}
+
+func parseTransform(str string) (transformfunc, error) {
+	var (
+		t   = filter{input: str, what: "transform"}
+		tfs []transformfunc
+	)
+	for {
+		if t.accept(';') {
+			continue
+		}
+		if t.skip(); t.pos >= len(t.input) {
+			break
+		}
+		fn, err := t.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+		tfs = append(tfs, fn)
+	}
+	return mergeTransform(tfs), nil
+}
+
+func mergeTransform(tfs []transformfunc) transformfunc {
+	return func(e *Entry) error {
+		for _, fn := range tfs {
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func (f *filter) parseStatement() (transformfunc, error) {
+	name := f.ident()
+	if err := f.expect('('); err != nil {
+		return nil, err
+	}
+	if name == "derive" {
+		return f.parseDeriveStatement()
+	}
+	field, err := f.parseSettable()
+	if err != nil {
+		return nil, err
+	}
+	var fn transformfunc
+	switch name {
+	case "set":
+		if err := f.expect(','); err != nil {
+			return nil, err
+		}
+		value, err := f.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		fn = func(e *Entry) error {
+			return setField(e, field, value(*e))
+		}
+	case "replace":
+		if err := f.expect(','); err != nil {
+			return nil, err
+		}
+		re, err := f.parseRegexp()
+		if err != nil {
+			return nil, err
+		}
+		if err := f.expect(','); err != nil {
+			return nil, err
+		}
+		value, err := f.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		fn = func(e *Entry) error {
+			str := fieldString(getField(*e, field))
+			return setField(e, field, re.ReplaceAllString(str, value(*e)))
+		}
+	case "rename":
+		if err := f.expect(','); err != nil {
+			return nil, err
+		}
+		target, err := f.parseSettable()
+		if err != nil {
+			return nil, err
+		}
+		fn = func(e *Entry) error {
+			str := fieldString(getField(*e, field))
+			if err := setField(e, field, ""); err != nil {
+				return err
+			}
+			return setField(e, target, str)
+		}
+	case "delete":
+		fn = func(e *Entry) error {
+			return setField(e, field, "")
+		}
+	default:
+		return nil, f.errorf("unknown statement %s", name)
+	}
+	return fn, f.expect(')')
+}
+
+// parseSettable parses a field that can be changed by the statements: the
+// fields of the source of the entries (eg, file or lino) can only be read.
+func (f *filter) parseSettable() (string, error) {
+	offset := f.pos
+	field, err := f.parseField()
+	if err != nil {
+		return "", err
+	}
+	if !isSettable(field) {
+		f.pos = offset
+		return "", f.errorf("field %s can not be changed", field)
+	}
+	return field, nil
+}
+
+func isSettable(field string) bool {
+	switch field {
+	case "time", "pid", "process", "user", "group", "host", "level", "message":
+		return true
+	default:
+		return strings.HasPrefix(field, "named.")
+	}
+}
+
+func (f *filter) parseDeriveStatement() (transformfunc, error) {
+	name := strings.TrimPrefix(f.ident(), "named.")
+	if name == "" {
+		return nil, f.errorf("name expected")
+	}
+	if err := f.expect(','); err != nil {
+		return nil, err
+	}
+	value, err := f.parseDerived()
+	if err != nil {
+		return nil, err
+	}
+	fn := func(e *Entry) error {
+		setDerived(e, name, value(*e))
+		return nil
+	}
+	return fn, f.expect(')')
+}
+
+func (f *filter) parseValue() (valuefunc, error) {
+	f.skip()
+	if f.pos < len(f.input) && isQuote(rune(f.input[f.pos])) {
+		lit, err := f.parseLiteral(isArgument)
+		if err != nil {
+			return nil, err
+		}
+		return func(_ Entry) string { return lit.raw }, nil
+	}
+	offset := f.pos
+	name := f.ident()
+	if _, ok := numericFuncs[name]; ok && f.accept('(') {
+		num, err := f.parseNumberCall(name)
+		if err != nil {
+			return nil, err
+		}
+		fn := func(e Entry) string {
+			v, ok := num(e)
+			if !ok {
+				return ""
+			}
+			return fieldString(v)
+		}
+		return fn, nil
+	}
+	if name != "" && f.accept('(') {
+		return f.parseValueCall(name)
+	}
+	if isField(name) {
+		return func(e Entry) string { return fieldString(getField(e, name)) }, nil
+	}
+	f.pos = offset
+	lit, err := f.parseLiteral(isArgument)
+	if err != nil {
+		return nil, err
+	}
+	return func(_ Entry) string { return lit.raw }, nil
+}
+
+func (f *filter) parseValueCall(name string) (valuefunc, error) {
+	var args []valuefunc
+	for !f.accept(')') {
+		if len(args) > 0 {
+			if err := f.expect(','); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := f.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return f.valueCall(name, args)
+}
+
+func (f *filter) valueCall(name string, args []valuefunc) (valuefunc, error) {
+	apply := func(fn func(string) string) (valuefunc, error) {
+		if len(args) != 1 {
+			return nil, f.errorf("%s: expected 1 argument, got %d", name, len(args))
+		}
+		arg := args[0]
+		return func(e Entry) string { return fn(arg(e)) }, nil
+	}
+	switch name {
+	case "lower":
+		return apply(strings.ToLower)
+	case "upper":
+		return apply(strings.ToUpper)
+	case "trim":
+		return apply(strings.TrimSpace)
+	case "concat":
+		fn := func(e Entry) string {
+			var str strings.Builder
+			for _, a := range args {
+				str.WriteString(a(e))
+			}
+			return str.String()
+		}
+		return fn, nil
+	default:
+		return nil, f.errorf("unknown function %s", name)
+	}
+}
+
+func (f *filter) parseRegexp() (*regexp.Regexp, error) {
+	if !f.accept('/') {
+		return nil, f.errorf("regexp expected")
+	}
+	var str strings.Builder
+	for {
+		if f.pos >= len(f.input) {
+			return nil, f.errorf("unterminated regexp")
+		}
+		c := f.input[f.pos]
+		f.pos++
+		if c == '/' {
+			break
+		}
+		if c == '\\' && f.pos < len(f.input) && f.input[f.pos] == '/' {
+			c = '/'
+			f.pos++
+		}
+		str.WriteByte(c)
+	}
+	re, err := regexp.Compile(str.String())
+	if err != nil {
+		return nil, f.errorf("%s", err)
+	}
+	return re, nil
+}
+
+func setField(e *Entry, name, value string) error {
+	switch name {
+	case "time":
+		if value == "" {
+			e.When = time.Time{}
+			break
+		}
+		lit := makeLiteral(value)
+		if !lit.istime {
+			return fmt.Errorf("%s: invalid time", value)
+		}
+		e.When = lit.when
+	case "pid":
+		if value == "" {
+			e.Pid = 0
+			break
+		}
+		pid, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s: invalid pid", value)
+		}
+		e.Pid = pid
+	case "process":
+		e.Process = value
+	case "user":
+		e.User = value
+	case "group":
+		e.Group = value
+	case "host":
+		e.Host = value
+	case "level":
+		e.Level = value
+	case "message":
+		e.Message = value
+	default:
+		if !strings.HasPrefix(name, "named.") {
+			return fmt.Errorf("%s: unknown field", name)
+		}
+		name = name[len("named."):]
+		delete(e.Values, name)
+		if value == "" {
+			delete(e.Named, name)
+			break
+		}
+		e.setNamed(name, value)
+	}
+	return nil
+}
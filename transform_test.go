@@ -0,0 +1,118 @@
+package log
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTransform(t *testing.T) {
+	tests := []struct {
+		expr  string
+		entry Entry
+		want  Entry
+	}{
+		{
+			expr:  `set(level, lower(level)); replace(message, /token=\w+/, "token=***")`,
+			entry: Entry{Level: "INFO", Message: "login token=abc ok"},
+			want:  Entry{Level: "info", Message: "login token=*** ok"},
+		},
+		{
+			expr:  `rename(named.usr, user); set(pid, named.pid)`,
+			entry: Entry{Named: map[string]string{"usr": "bob", "pid": "42"}},
+			want:  Entry{User: "bob", Pid: 42, Named: map[string]string{"pid": "42"}},
+		},
+		{
+			expr:  `delete(message); set(named.src, concat(host, ":", process))`,
+			entry: Entry{Host: "web", Process: "nginx", Message: "text"},
+			want:  Entry{Host: "web", Process: "nginx", Named: map[string]string{"src": "web:nginx"}},
+		},
+	}
+	for _, tt := range tests {
+		fn, err := CompileTransform(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %s", tt.expr, err)
+			continue
+		}
+		got, err := fn(tt.entry)
+		if err != nil {
+			t.Errorf("%s: %s", tt.expr, err)
+			continue
+		}
+		if got.Level != tt.want.Level || got.Message != tt.want.Message || got.User != tt.want.User || got.Pid != tt.want.Pid || got.Host != tt.want.Host {
+			t.Errorf("%s: got %+v, want %+v", tt.expr, got, tt.want)
+		}
+		if len(got.Named) != len(tt.want.Named) {
+			t.Errorf("%s: got named %v, want %v", tt.expr, got.Named, tt.want.Named)
+		}
+		for k, v := range tt.want.Named {
+			if got.Named[k] != v {
+				t.Errorf("%s: got named %v, want %v", tt.expr, got.Named, tt.want.Named)
+			}
+		}
+	}
+}
+
+func TestTransformKeepsInput(t *testing.T) {
+	fn, err := CompileTransform("rename(named.usr, user)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := Entry{Named: map[string]string{"usr": "bob"}}
+	if _, err := fn(e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Named["usr"] != "bob" {
+		t.Errorf("named of the input changed: %v", e.Named)
+	}
+}
+
+func TestTransformErrors(t *testing.T) {
+	fn, err := CompileTransform(`set(pid, named.pid); set(level, "x")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fn(Entry{Named: map[string]string{"pid": "abc"}}); err == nil {
+		t.Errorf("invalid pid accepted")
+	}
+	for _, expr := range []string{`set(lino, "3")`, `rename(message, file)`, `delete(offset)`, `set(nope, "x")`, `unknown(level)`} {
+		if _, err := CompileTransform(expr); err == nil {
+			t.Errorf("%s: compiled", expr)
+		}
+	}
+}
+
+func TestPipelineRewriteError(t *testing.T) {
+	input := "1 info a\nx info b\n3 info c\n"
+	for _, skip := range []bool{false, true} {
+		r, err := NewReader(strings.NewReader(input), "%w(pid) %l %m", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var (
+			skipped int
+			count   int
+		)
+		policy := ErrorPolicy{
+			Skip:   skip,
+			OnSkip: func(Entry, error) { skipped++ },
+		}
+		err = NewPipeline(r).
+			Rewrite("set(pid, named.pid)").
+			OnError(policy).
+			To(writerFunc(func(Entry) error { count++; return nil })).
+			Run()
+		if skip {
+			if err != nil || count != 2 || skipped != 1 {
+				t.Errorf("skip: got %v, %d entries, %d skipped", err, count, skipped)
+			}
+		} else if err == nil || count != 1 {
+			t.Errorf("got %v, %d entries", err, count)
+		}
+	}
+}
+
+type writerFunc func(Entry) error
+
+func (w writerFunc) Write(e Entry) error {
+	return w(e)
+}
@@ -0,0 +1,247 @@
+package log
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const DefaultWatchInterval = time.Second
+
+// Watcher is an io.Reader giving the lines appended to all the files matching
+// a glob pattern. New files are picked up when they appear and rotated or
+// truncated files are reopened. Only complete lines are given, so the
+// lines of different files are never mixed.
+//
+// A Reader created with a Watcher sets the File and Offset of the Source of its
+// entries to the file each line comes from.
+type Watcher struct {
+	pattern  string
+	interval time.Duration
+
+	files []*watched
+	curr  int
+
+	out   bytes.Buffer
+	total int64
+
+	mu       sync.Mutex
+	segments []watchSegment
+	closed   bool
+}
+
+type watched struct {
+	path    string
+	file    *os.File
+	info    os.FileInfo
+	offset  int64
+	partial []byte
+	gone    bool
+	done    bool
+}
+
+type watchSegment struct {
+	start  int64
+	file   string
+	offset int64
+}
+
+func Watch(pattern string, interval time.Duration) (*Watcher, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	w := Watcher{
+		pattern:  pattern,
+		interval: interval,
+	}
+	return &w, w.scan()
+}
+
+func (w *Watcher) Read(b []byte) (int, error) {
+	for w.out.Len() == 0 {
+		if w.isClosed() {
+			return 0, io.EOF
+		}
+		read, err := w.fill()
+		if err != nil {
+			if w.isClosed() {
+				err = io.EOF
+			}
+			return 0, err
+		}
+		if read {
+			continue
+		}
+		time.Sleep(w.interval)
+		if err := w.scan(); err != nil {
+			return 0, err
+		}
+	}
+	return w.out.Read(b)
+}
+
+// SourceAt gives the file and the offset in this file of the byte at offset in
+// the stream of the Watcher.
+func (w *Watcher) SourceAt(offset int64) (string, int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	i := sort.Search(len(w.segments), func(i int) bool {
+		return w.segments[i].start > offset
+	})
+	if i == 0 {
+		return "", offset
+	}
+	s := w.segments[i-1]
+	if i > 1 {
+		w.segments = w.segments[i-1:]
+	}
+	return s.file, s.offset + offset - s.start
+}
+
+// Files returns the paths of the files currently watched.
+func (w *Watcher) Files() []string {
+	var list []string
+	for _, f := range w.files {
+		if !f.gone {
+			list = append(list, f.path)
+		}
+	}
+	return list
+}
+
+func (w *Watcher) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	for _, f := range w.files {
+		f.file.Close()
+	}
+	return nil
+}
+
+func (w *Watcher) isClosed() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.closed
+}
+
+// fill reads the next file having complete lines available and put them in
+// the output buffer.
+func (w *Watcher) fill() (bool, error) {
+	buf := make([]byte, 32<<10)
+	for range w.files {
+		f := w.files[w.curr]
+		w.curr = (w.curr + 1) % len(w.files)
+		n, err := f.file.Read(buf)
+		if err != nil && err != io.EOF {
+			return false, err
+		}
+		if n == 0 {
+			if !f.gone {
+				continue
+			}
+			if len(f.partial) == 0 {
+				f.done = true
+				continue
+			}
+			// the file will not grow anymore: its last line is complete
+			f.partial = append(f.partial, '\n')
+			f.offset++
+		}
+		data := append(f.partial, buf[:n]...)
+		x := bytes.LastIndexByte(data, '\n')
+		if x < 0 {
+			f.partial = data
+			f.offset += int64(n)
+			continue
+		}
+		lines := data[:x+1]
+		start := f.offset - int64(len(f.partial))
+		f.partial = append([]byte(nil), data[x+1:]...)
+		f.offset += int64(n)
+
+		w.mu.Lock()
+		w.segments = append(w.segments, watchSegment{
+			start:  w.total,
+			file:   f.path,
+			offset: start,
+		})
+		w.mu.Unlock()
+		lines = bytes.ReplaceAll(lines, []byte("\r\n"), []byte("\n"))
+		w.total += int64(len(lines))
+		w.out.Write(lines)
+		return true, nil
+	}
+	return false, nil
+}
+
+// scan looks for new files matching the pattern and for files that have been
+// rotated or truncated.
+func (w *Watcher) scan() error {
+	matches, err := filepath.Glob(w.pattern)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for _, path := range matches {
+		seen[path] = true
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		f := w.lookup(path)
+		switch {
+		case f == nil:
+		case !os.SameFile(f.info, info):
+			// rotated: the old file is kept until all its lines are read
+			f.gone = true
+		case info.Size() < f.offset:
+			f.file.Seek(0, io.SeekStart)
+			f.offset, f.partial, f.info = 0, nil, info
+			continue
+		default:
+			continue
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		w.files = append(w.files, &watched{
+			path: path,
+			file: file,
+			info: info,
+		})
+	}
+	files := w.files[:0]
+	for _, f := range w.files {
+		if !seen[f.path] {
+			f.gone = true
+		}
+		if f.done {
+			f.file.Close()
+			continue
+		}
+		files = append(files, f)
+	}
+	w.files = files
+	if w.curr >= len(w.files) {
+		w.curr = 0
+	}
+	return nil
+}
+
+func (w *Watcher) lookup(path string) *watched {
+	for _, f := range w.files {
+		if f.path == path && !f.gone {
+			return f
+		}
+	}
+	return nil
+}
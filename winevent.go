@@ -0,0 +1,209 @@
+package log
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NewEventReader creates a Reader for Windows events exported as XML, like the
+// output of wevtutil qe (binary EVTX files can be exported with wevtutil qe
+// file.evtx /lf:true /f:xml). The events can be wrapped in an Events element
+// or simply follow each others.
+//
+// The provider is set in Process, the computer in Host, the SID of the user in
+// User and the rendered message if any in Message. The event ID, record ID,
+// channel, task, opcode and keywords are set in Named as well as the values of
+// EventData and UserData. Line is the XML of the event.
+func NewEventReader(rs io.Reader, filter string, opts ...Option) (*Reader, error) {
+	r, err := newReader(rs, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	rec := recorder{inner: rs}
+	dec := xml.NewDecoder(&rec)
+	r.next = func(e *Entry) error {
+		for {
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			start, ok := tok.(xml.StartElement)
+			if !ok || start.Name.Local != "Event" {
+				continue
+			}
+			offset := rec.offset(dec.InputOffset())
+			var ev winEvent
+			if err := dec.DecodeElement(&ev, &start); err != nil {
+				return err
+			}
+			end := dec.InputOffset()
+
+			r.lino++
+			r.stats.Bytes = end
+			r.reset(e, offset)
+			ev.fill(e)
+			e.Line = string(rec.take(offset, end))
+			return nil
+		}
+	}
+	return r, nil
+}
+
+// recorder keeps the bytes read by the xml.Decoder to give the text of the
+// events.
+type recorder struct {
+	inner io.Reader
+	buf   []byte
+	base  int64
+}
+
+func (r *recorder) Read(b []byte) (int, error) {
+	n, err := r.inner.Read(b)
+	r.buf = append(r.buf, b[:n]...)
+	return n, err
+}
+
+// offset finds the start of the element whose start tag ends at end.
+func (r *recorder) offset(end int64) int64 {
+	x := bytes.LastIndexByte(r.buf[:end-r.base], '<')
+	if x < 0 {
+		return end
+	}
+	return r.base + int64(x)
+}
+
+func (r *recorder) take(start, end int64) []byte {
+	b := bytes.TrimSpace(r.buf[start-r.base : end-r.base])
+	b = append([]byte(nil), b...)
+	r.buf = append(r.buf[:0], r.buf[end-r.base:]...)
+	r.base = end
+	return b
+}
+
+type winEvent struct {
+	System struct {
+		Provider struct {
+			Name string `xml:"Name,attr"`
+			Guid string `xml:"Guid,attr"`
+		}
+		EventID     string
+		Level       string
+		Task        string
+		Opcode      string
+		Keywords    string
+		TimeCreated struct {
+			SystemTime string `xml:"SystemTime,attr"`
+		}
+		EventRecordID string
+		Execution     struct {
+			ProcessID int    `xml:"ProcessID,attr"`
+			ThreadID  string `xml:"ThreadID,attr"`
+		}
+		Channel  string
+		Computer string
+		Security struct {
+			UserID string `xml:"UserID,attr"`
+		}
+	}
+	EventData struct {
+		Data []struct {
+			Name  string `xml:"Name,attr"`
+			Value string `xml:",chardata"`
+		}
+	}
+	UserData struct {
+		Inner []byte `xml:",innerxml"`
+	}
+	RenderingInfo struct {
+		Message string
+		Level   string
+	}
+}
+
+var winLevels = map[string]string{
+	"0": "Information",
+	"1": "Critical",
+	"2": "Error",
+	"3": "Warning",
+	"4": "Information",
+	"5": "Verbose",
+}
+
+func (ev winEvent) fill(e *Entry) {
+	sys := ev.System
+	e.Process = sys.Provider.Name
+	e.Pid = sys.Execution.ProcessID
+	e.Host = sys.Computer
+	e.Addr = Addr{Name: sys.Computer}
+	e.User = sys.Security.UserID
+	e.Message = strings.TrimSpace(ev.RenderingInfo.Message)
+	if e.Level = ev.RenderingInfo.Level; e.Level == "" {
+		e.Level = winLevels[sys.Level]
+	}
+	if when, err := time.Parse(time.RFC3339Nano, sys.TimeCreated.SystemTime); err == nil {
+		e.When = when
+	}
+	for _, f := range []struct {
+		name  string
+		value string
+	}{
+		{name: "event_id", value: sys.EventID},
+		{name: "record_id", value: sys.EventRecordID},
+		{name: "channel", value: sys.Channel},
+		{name: "task", value: sys.Task},
+		{name: "opcode", value: sys.Opcode},
+		{name: "keywords", value: sys.Keywords},
+		{name: "thread_id", value: sys.Execution.ThreadID},
+		{name: "provider_guid", value: sys.Provider.Guid},
+	} {
+		if f.value != "" {
+			e.setNamed(f.name, f.value)
+		}
+	}
+	for _, name := range []string{"event_id", "record_id"} {
+		if n, err := strconv.Atoi(e.Named[name]); err == nil {
+			e.setValue(name, n)
+		}
+	}
+	for i, d := range ev.EventData.Data {
+		name := d.Name
+		if name == "" {
+			name = "data." + strconv.Itoa(i)
+		}
+		e.setNamed(name, strings.TrimSpace(d.Value))
+	}
+	readUserData(e, ev.UserData.Inner)
+}
+
+// readUserData sets in Named the text of the elements of UserData having no
+// child.
+func readUserData(e *Entry, inner []byte) {
+	var (
+		dec  = xml.NewDecoder(bytes.NewReader(inner))
+		name string
+		text string
+	)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name, text = t.Name.Local, ""
+		case xml.CharData:
+			text += string(t)
+		case xml.EndElement:
+			if name == t.Name.Local {
+				if text = strings.TrimSpace(text); text != "" {
+					e.setNamed(name, text)
+				}
+			}
+			name, text = "", ""
+		}
+	}
+}
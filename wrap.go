@@ -0,0 +1,147 @@
+package log
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+)
+
+// wrapMark replaces the message of an entry to find the column where the
+// message starts in the lines written.
+const wrapMark = "\uE000"
+
+// minWrap is the smallest number of columns left to the message by the
+// hanging indent. The message is written on its own lines, without indent,
+// when the fields before it leave less.
+const minWrap = 20
+
+func (w *textWriter) wrap(e Entry) {
+	msg := e.Message
+	e.Message = wrapMark
+	w.line.Reset()
+	w.printEntry(e, &w.line)
+	prefix := w.line.String()
+	if x := strings.Index(prefix, wrapMark); x >= 0 {
+		prefix = prefix[:x]
+	} else {
+		prefix = ""
+	}
+
+	e.Message = msg
+	w.line.Reset()
+	w.printEntry(e, &w.line)
+	line := w.line.String()
+	if !strings.HasPrefix(line, prefix) {
+		prefix = ""
+	}
+	wrapLine(&w.buffer, prefix, line[len(prefix):], w.width)
+}
+
+// wrapLine writes prefix followed by text cut in lines of at most width
+// columns, the lines following the first one being indented to the end of
+// prefix.
+func wrapLine(buf *bytes.Buffer, prefix, text string, width int) {
+	buf.WriteString(prefix)
+	var (
+		col    = textWidth(prefix[strings.LastIndexByte(prefix, '\n')+1:])
+		indent = col
+	)
+	if !strings.ContainsAny(text, "\t\n") && textWidth(text) <= width-col {
+		buf.WriteString(text)
+		return
+	}
+	if width-col < minWrap {
+		indent = 0
+	}
+	var (
+		pad   = strings.Repeat(" ", indent)
+		lines = strings.Split(strings.ReplaceAll(text, "\t", "    "), "\n")
+	)
+	for i, str := range lines {
+		for j, chunk := range splitWidth(strings.TrimRight(str, "\r"), width-indent) {
+			if i > 0 || j > 0 || indent != col {
+				buf.WriteRune('\n')
+				if chunk != "" {
+					buf.WriteString(pad)
+				}
+			}
+			buf.WriteString(chunk)
+		}
+	}
+}
+
+// splitWidth cuts str in lines of at most width columns, preferably on the
+// spaces between words.
+func splitWidth(str string, width int) []string {
+	var (
+		list []string
+		lead = len(str) - len(strings.TrimLeft(str, " "))
+	)
+	for {
+		var (
+			cols  int
+			cut   = len(str)
+			space = -1
+		)
+		for i := 0; i < len(str); {
+			if n := escapeLen(str[i:]); n > 0 {
+				i += n
+				continue
+			}
+			r, z := utf8.DecodeRuneInString(str[i:])
+			if r == ' ' {
+				space = i
+			}
+			if cols == width {
+				cut = i
+				break
+			}
+			cols++
+			i += z
+		}
+		if cut == len(str) {
+			return append(list, str)
+		}
+		if space > lead {
+			list = append(list, str[:space])
+			str = strings.TrimLeft(str[space:], " ")
+		} else {
+			list = append(list, str[:cut])
+			str = str[cut:]
+		}
+		if str == "" {
+			return list
+		}
+		lead = 0
+	}
+}
+
+// textWidth gives the number of columns taken by str on a terminal, ignoring
+// the ANSI escape sequences.
+func textWidth(str string) int {
+	var cols int
+	for i := 0; i < len(str); {
+		if n := escapeLen(str[i:]); n > 0 {
+			i += n
+			continue
+		}
+		_, z := utf8.DecodeRuneInString(str[i:])
+		cols++
+		i += z
+	}
+	return cols
+}
+
+// escapeLen gives the length of the CSI escape sequence (eg, colors) str
+// starts with or 0.
+func escapeLen(str string) int {
+	if len(str) < 2 || str[0] != '\x1b' || str[1] != '[' {
+		return 0
+	}
+	for i := 2; i < len(str); i++ {
+		if c := str[i]; c >= 0x40 && c <= 0x7e {
+			return i + 1
+		}
+	}
+	return 0
+}
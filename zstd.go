@@ -0,0 +1,390 @@
+package log
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// zstd frames are written without the help of a library: the repeated parts
+// of each block are found with a hash of their first bytes and written as the
+// sequences of the format, coded with the predefined FSE tables. The literals
+// are kept raw. The compression is lower than the one of the zstd tool but the
+// output can be read by any decoder.
+
+const (
+	zstdMagic     = 0xfd2fb528
+	zstdBlockSize = 1 << 17
+	// window descriptor of 128KB: the matches never cross the blocks
+	zstdWindow   = 7 << 3
+	zstdMinMatch = 4
+	zstdHashLog  = 15
+)
+
+const (
+	zstdBlockRaw        = 0
+	zstdBlockCompressed = 2
+)
+
+var errZstdClosed = errors.New("zstd: writer closed")
+
+type zstdWriter struct {
+	w      io.Writer
+	buf    []byte
+	out    []byte
+	hashes []int32
+	header bool
+	err    error
+}
+
+func newZstdWriter(w io.Writer) *zstdWriter {
+	return &zstdWriter{
+		w:      w,
+		buf:    make([]byte, 0, zstdBlockSize),
+		hashes: make([]int32, 1<<zstdHashLog),
+	}
+}
+
+func (z *zstdWriter) Write(b []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	var n int
+	for len(b) > 0 {
+		c := copy(z.buf[len(z.buf):cap(z.buf)], b)
+		z.buf = z.buf[:len(z.buf)+c]
+		b, n = b[c:], n+c
+		// the block is kept until more data come so that the last one is only
+		// known when the writer is closed
+		if len(z.buf) == cap(z.buf) && len(b) > 0 {
+			if z.err = z.writeBlock(false); z.err != nil {
+				return n, z.err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close writes the last block of the frame. It does not close the underlying
+// writer.
+func (z *zstdWriter) Close() error {
+	if z.err != nil {
+		if z.err == errZstdClosed {
+			return nil
+		}
+		return z.err
+	}
+	if z.err = z.writeBlock(true); z.err != nil {
+		return z.err
+	}
+	z.err = errZstdClosed
+	return nil
+}
+
+func (z *zstdWriter) writeBlock(last bool) error {
+	z.out = z.out[:0]
+	if !z.header {
+		z.out = append(z.out, 0, 0, 0, 0, 0, zstdWindow)
+		binary.LittleEndian.PutUint32(z.out, zstdMagic)
+		z.header = true
+	}
+	var (
+		start = len(z.out)
+		kind  = zstdBlockCompressed
+	)
+	z.out = append(z.out, 0, 0, 0)
+	z.out = z.compress(z.out, z.buf)
+	if size := len(z.out) - start - 3; size >= len(z.buf) {
+		z.out = append(z.out[:start+3], z.buf...)
+		kind = zstdBlockRaw
+	}
+	header := uint32(len(z.out)-start-3)<<3 | uint32(kind)<<1
+	if last {
+		header |= 1
+	}
+	z.out[start], z.out[start+1], z.out[start+2] = byte(header), byte(header>>8), byte(header>>16)
+	z.buf = z.buf[:0]
+	_, err := z.w.Write(z.out)
+	return err
+}
+
+type zstdSequence struct {
+	literals uint32
+	offset   uint32
+	match    uint32
+}
+
+// compress appends the literals and sequences sections of a compressed block
+// of data to out.
+func (z *zstdWriter) compress(out, data []byte) []byte {
+	var (
+		seqs     []zstdSequence
+		literals []byte
+		anchor   int
+	)
+	for i := range z.hashes {
+		z.hashes[i] = -1
+	}
+	for i := 0; i+zstdMinMatch <= len(data); {
+		h := zstdHash(data[i:])
+		cand := int(z.hashes[h])
+		z.hashes[h] = int32(i)
+		if cand < 0 || binary.LittleEndian.Uint32(data[cand:]) != binary.LittleEndian.Uint32(data[i:]) {
+			i++
+			continue
+		}
+		n := zstdMinMatch
+		for i+n < len(data) && data[cand+n] == data[i+n] {
+			n++
+		}
+		literals = append(literals, data[anchor:i]...)
+		seqs = append(seqs, zstdSequence{
+			literals: uint32(i - anchor),
+			offset:   uint32(i - cand),
+			match:    uint32(n),
+		})
+		for j := i + 1; j < i+n && j+zstdMinMatch <= len(data); j += 2 {
+			z.hashes[zstdHash(data[j:])] = int32(j)
+		}
+		i += n
+		anchor = i
+	}
+	literals = append(literals, data[anchor:]...)
+
+	// raw literals section
+	switch n := len(literals); {
+	case n < 1<<5:
+		out = append(out, byte(n<<3))
+	case n < 1<<12:
+		out = append(out, byte(1<<2|n<<4), byte(n>>4))
+	default:
+		out = append(out, byte(3<<2|n<<4), byte(n>>4), byte(n>>12))
+	}
+	out = append(out, literals...)
+
+	switch n := len(seqs); {
+	case n < 128:
+		out = append(out, byte(n))
+	case n < 0x7f00:
+		out = append(out, byte(n>>8+128), byte(n))
+	default:
+		n -= 0x7f00
+		out = append(out, 0xff, byte(n), byte(n>>8))
+	}
+	if len(seqs) == 0 {
+		return out
+	}
+	// the predefined tables are used for the three codes
+	out = append(out, 0)
+	return encodeSequences(out, seqs)
+}
+
+func zstdHash(b []byte) uint32 {
+	return (binary.LittleEndian.Uint32(b) * 2654435761) >> (32 - zstdHashLog)
+}
+
+// encodeSequences appends the bitstream of the sequences to out. It is read
+// backward by the decoders: the sequences are written from the last one and
+// the fields of each in the reverse order of their reading.
+func encodeSequences(out []byte, seqs []zstdSequence) []byte {
+	var (
+		bits                      zstdBitWriter
+		llState, mlState, ofState int
+	)
+	bits.out = out
+	for i := len(seqs) - 1; i >= 0; i-- {
+		var (
+			s                  = seqs[i]
+			llCode, llBits, ll = zstdCode(zstdLiteralsCodes, s.literals)
+			mlCode, mlBits, ml = zstdCode(zstdMatchCodes, s.match-3)
+			offset             = s.offset + 3
+			ofCode             = uint32(highBit(offset))
+		)
+		if i == len(seqs)-1 {
+			llState = zstdLiterals.first(llCode)
+			mlState = zstdMatches.first(mlCode)
+			ofState = zstdOffsets.first(ofCode)
+		} else {
+			ofState = zstdOffsets.encode(&bits, ofCode, ofState)
+			mlState = zstdMatches.encode(&bits, mlCode, mlState)
+			llState = zstdLiterals.encode(&bits, llCode, llState)
+		}
+		bits.add(ll, llBits)
+		bits.add(ml, mlBits)
+		bits.add(offset-1<<ofCode, ofCode)
+	}
+	bits.add(uint32(mlState), zstdMatches.log)
+	bits.add(uint32(ofState), zstdOffsets.log)
+	bits.add(uint32(llState), zstdLiterals.log)
+	return bits.close()
+}
+
+func highBit(v uint32) int {
+	var n int
+	for v > 1 {
+		v >>= 1
+		n++
+	}
+	return n
+}
+
+// zstdCodes gives the baseline and the number of extra bits of the codes of
+// the literals and match lengths.
+type zstdCodes []struct {
+	base uint32
+	bits uint32
+}
+
+// zstdCode gives the code of v, the number of its extra bits and their value.
+func zstdCode(codes zstdCodes, v uint32) (uint32, uint32, uint32) {
+	i := len(codes) - 1
+	for codes[i].base > v {
+		i--
+	}
+	return uint32(i), codes[i].bits, v - codes[i].base
+}
+
+var zstdLiteralsCodes = makeZstdCodes(16, []uint32{
+	16, 1, 18, 1, 20, 1, 22, 1, 24, 2, 28, 2, 32, 3, 40, 3,
+	48, 4, 64, 6, 128, 7, 256, 8, 512, 9, 1024, 10, 2048, 11, 4096, 12,
+	8192, 13, 16384, 14, 32768, 15, 65536, 16,
+})
+
+// the match lengths are coded minus the minimum of 3
+var zstdMatchCodes = makeZstdCodes(32, []uint32{
+	32, 1, 34, 1, 36, 1, 38, 1, 40, 2, 44, 2, 48, 3, 56, 3,
+	64, 4, 80, 4, 96, 5, 128, 7, 256, 8, 512, 9, 1024, 10, 2048, 11,
+	4096, 12, 8192, 13, 16384, 14, 32768, 15, 65536, 16,
+})
+
+// makeZstdCodes gives the n codes without extra bits, their value being their
+// baseline, followed by the pairs of baseline and number of bits of the others.
+func makeZstdCodes(n uint32, pairs []uint32) zstdCodes {
+	var codes zstdCodes
+	for i := uint32(0); i < n; i++ {
+		codes = append(codes, struct{ base, bits uint32 }{i, 0})
+	}
+	for i := 0; i < len(pairs); i += 2 {
+		codes = append(codes, struct{ base, bits uint32 }{pairs[i], pairs[i+1]})
+	}
+	return codes
+}
+
+// zstdTable is a FSE table built like the decoders do. A state is coded with
+// a symbol from the next state: the cell of the symbol whose range holds it.
+type zstdTable struct {
+	log   uint32
+	cells [][]zstdCell
+}
+
+type zstdCell struct {
+	state int
+	base  int
+	bits  uint32
+}
+
+var (
+	zstdLiterals = makeZstdTable(6, []int{
+		4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1,
+		2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1,
+		-1, -1, -1, -1,
+	})
+	zstdMatches = makeZstdTable(6, []int{
+		1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1,
+		-1, -1, -1, -1, -1,
+	})
+	zstdOffsets = makeZstdTable(5, []int{
+		1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1,
+	})
+)
+
+func makeZstdTable(log uint32, dist []int) zstdTable {
+	var (
+		size    = 1 << log
+		symbols = make([]int, size)
+		high    = size - 1
+		next    = make([]int, len(dist))
+	)
+	for s, n := range dist {
+		if n == -1 {
+			symbols[high] = s
+			high--
+			n = 1
+		}
+		next[s] = n
+	}
+	var (
+		pos  int
+		step = size>>1 + size>>3 + 3
+	)
+	for s, n := range dist {
+		for i := 0; i < n; i++ {
+			symbols[pos] = s
+			pos = (pos + step) & (size - 1)
+			for pos > high {
+				pos = (pos + step) & (size - 1)
+			}
+		}
+	}
+	t := zstdTable{
+		log:   log,
+		cells: make([][]zstdCell, len(dist)),
+	}
+	for u, s := range symbols {
+		state := next[s]
+		next[s]++
+		bits := log - uint32(highBit(uint32(state)))
+		t.cells[s] = append(t.cells[s], zstdCell{
+			state: u,
+			base:  state<<bits - size,
+			bits:  bits,
+		})
+	}
+	return t
+}
+
+// first gives a state of the symbol, used for the last sequence.
+func (t zstdTable) first(sym uint32) int {
+	return t.cells[sym][0].state
+}
+
+// encode writes the bits leading the decoder from a state of sym to next and
+// gives this state.
+func (t zstdTable) encode(w *zstdBitWriter, sym uint32, next int) int {
+	for _, c := range t.cells[sym] {
+		if next >= c.base && next < c.base+1<<c.bits {
+			w.add(uint32(next-c.base), c.bits)
+			return c.state
+		}
+	}
+	panic("zstd: state out of range")
+}
+
+// zstdBitWriter writes the bits from the lowest ones of each byte.
+type zstdBitWriter struct {
+	out   []byte
+	value uint64
+	count uint32
+}
+
+func (w *zstdBitWriter) add(v, n uint32) {
+	w.value |= uint64(v&(1<<n-1)) << w.count
+	w.count += n
+	for w.count >= 8 {
+		w.out = append(w.out, byte(w.value))
+		w.value >>= 8
+		w.count -= 8
+	}
+}
+
+// close ends the stream with a bit set, marking its end for the decoder.
+func (w *zstdBitWriter) close() []byte {
+	w.add(1, 1)
+	if w.count > 0 {
+		w.out = append(w.out, byte(w.value))
+	}
+	return w.out
+}
@@ -0,0 +1,234 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func zstdInputs() map[string][]byte {
+	r := rand.New(rand.NewSource(1))
+	random := make([]byte, 300000)
+	r.Read(random)
+	var lines strings.Builder
+	for i := 0; lines.Len() < 1<<19; i++ {
+		fmt.Fprintf(&lines, "2024-01-01T10:%02d:%02dZ INFO [app:%d] request %d done in %dms\n", i/60%60, i%60, r.Intn(100), i, r.Intn(5000))
+	}
+	return map[string][]byte{
+		"empty":  nil,
+		"short":  []byte("hello"),
+		"same":   bytes.Repeat([]byte("a"), 1000000),
+		"random": random,
+		"lines":  []byte(lines.String()),
+		"block":  bytes.Repeat([]byte("abcdefgh"), zstdBlockSize/8),
+	}
+}
+
+func zstdCompress(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	z, err := Compress(&buf, "zstd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for len(data) > 0 {
+		n := 7777
+		if n > len(data) {
+			n = len(data)
+		}
+		if _, err := z.Write(data[:n]); err != nil {
+			t.Fatal(err)
+		}
+		data = data[n:]
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestZstd(t *testing.T) {
+	for name, data := range zstdInputs() {
+		buf := zstdCompress(t, data)
+		got, err := zstdDecode(buf)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s: got %d bytes after decompression, want %d", name, len(got), len(data))
+		}
+		if name == "lines" && len(buf) > len(data)/2 {
+			t.Errorf("%s: %d bytes compressed into %d", name, len(data), len(buf))
+		}
+	}
+}
+
+func TestZstdTool(t *testing.T) {
+	if _, err := exec.LookPath("zstd"); err != nil {
+		t.Skip("zstd not found")
+	}
+	for name, data := range zstdInputs() {
+		cmd := exec.Command("zstd", "-d", "-c")
+		cmd.Stdin = bytes.NewReader(zstdCompress(t, data))
+		got, err := cmd.Output()
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s: got %d bytes after decompression, want %d", name, len(got), len(data))
+		}
+	}
+}
+
+// zstdDecode decodes the frames written by zstdWriter: the raw and
+// compressed blocks, with raw literals and the predefined tables.
+func zstdDecode(buf []byte) ([]byte, error) {
+	if len(buf) < 6 || !bytes.Equal(buf[:6], []byte{0x28, 0xb5, 0x2f, 0xfd, 0, zstdWindow}) {
+		return nil, errors.New("bad frame header")
+	}
+	var out []byte
+	for buf = buf[6:]; ; {
+		if len(buf) < 3 {
+			return nil, errors.New("block header expected")
+		}
+		header := int(buf[0]) | int(buf[1])<<8 | int(buf[2])<<16
+		size := header >> 3
+		if len(buf) < 3+size {
+			return nil, errors.New("block truncated")
+		}
+		block := buf[3 : 3+size]
+		switch header >> 1 & 3 {
+		case zstdBlockRaw:
+			out = append(out, block...)
+		case zstdBlockCompressed:
+			var err error
+			if out, err = zstdDecodeBlock(out, block); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, errors.New("unexpected block type")
+		}
+		if buf = buf[3+size:]; header&1 == 1 {
+			break
+		}
+	}
+	if len(buf) > 0 {
+		return nil, errors.New("data after the last block")
+	}
+	return out, nil
+}
+
+func zstdDecodeBlock(out, block []byte) ([]byte, error) {
+	var n, size int
+	switch block[0] >> 2 & 3 {
+	case 0, 2:
+		n, size = int(block[0]>>3), 1
+	case 1:
+		n, size = int(block[0]>>4)|int(block[1])<<4, 2
+	case 3:
+		n, size = int(block[0]>>4)|int(block[1])<<4|int(block[2])<<12, 3
+	}
+	if block[0]&3 != 0 {
+		return nil, errors.New("literals not raw")
+	}
+	literals, block := block[size:size+n], block[size+n:]
+	count := int(block[0])
+	switch {
+	case count == 0xff:
+		count, block = int(block[1])|int(block[2])<<8+0x7f00, block[3:]
+	case count >= 128:
+		count, block = (count-128)<<8|int(block[1]), block[2:]
+	default:
+		block = block[1:]
+	}
+	if count == 0 {
+		return append(out, literals...), nil
+	}
+	if block[0] != 0 {
+		return nil, errors.New("tables not predefined")
+	}
+	bits := zstdBitReader{buf: block[1:]}
+	if err := bits.init(); err != nil {
+		return nil, err
+	}
+	var (
+		tables = []zstdTable{zstdLiterals, zstdOffsets, zstdMatches}
+		cells  = make([][]zstdCell, len(tables))
+		syms   = make([][]uint32, len(tables))
+		states = make([]int, len(tables))
+	)
+	for i, t := range tables {
+		cells[i] = make([]zstdCell, 1<<t.log)
+		syms[i] = make([]uint32, 1<<t.log)
+		for s, list := range t.cells {
+			for _, c := range list {
+				cells[i][c.state], syms[i][c.state] = c, uint32(s)
+			}
+		}
+		states[i] = int(bits.read(t.log))
+	}
+	const ll, of, ml = 0, 1, 2
+	for i := 0; i < count; i++ {
+		var (
+			ofCode = syms[of][states[of]]
+			mlCode = zstdMatchCodes[syms[ml][states[ml]]]
+			llCode = zstdLiteralsCodes[syms[ll][states[ll]]]
+			offset = 1<<ofCode + bits.read(ofCode)
+			match  = mlCode.base + bits.read(mlCode.bits) + 3
+			length = llCode.base + bits.read(llCode.bits)
+		)
+		if i < count-1 {
+			for _, j := range []int{ll, ml, of} {
+				c := cells[j][states[j]]
+				states[j] = c.base + int(bits.read(c.bits))
+			}
+		}
+		if offset <= 3 {
+			return nil, errors.New("repeated offset")
+		}
+		if int(length) > len(literals) {
+			return nil, errors.New("literals overflow")
+		}
+		out, literals = append(out, literals[:length]...), literals[length:]
+		from := len(out) - int(offset-3)
+		if from < 0 {
+			return nil, errors.New("offset out of range")
+		}
+		for j := 0; j < int(match); j++ {
+			out = append(out, out[from+j])
+		}
+	}
+	if bits.pos != 0 {
+		return nil, errors.New("bits left in the sequences")
+	}
+	return append(out, literals...), nil
+}
+
+// zstdBitReader reads the bitstreams backward.
+type zstdBitReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *zstdBitReader) init() error {
+	if len(r.buf) == 0 || r.buf[len(r.buf)-1] == 0 {
+		return errors.New("end of the bitstream not found")
+	}
+	r.pos = 8*len(r.buf) - 8 + highBit(uint32(r.buf[len(r.buf)-1]))
+	return nil
+}
+
+func (r *zstdBitReader) read(n uint32) uint32 {
+	var v uint32
+	for i := 0; i < int(n); i++ {
+		r.pos--
+		v = v<<1 | uint32(r.buf[r.pos/8]>>(r.pos%8)&1)
+	}
+	return v
+}